@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+const browseHelp = `enter/n next page   p previous page   g first page
+/text only logs containing text, / on its own clears it
+l warn lowest level, l on its own shows every level
+k server1,db only these keys, k on its own shows every key
+f follow new logs until enter is pressed   q quit   ? this help`
+
+func runBrowse(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser browse", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	pageSize := fs.Int("n", 0, "number of logs on a page, defaults to the height of the terminal from $LINES or 20")
+	colorMode := fs.String("color", "auto", "color severities: auto, always or never. auto colors only when writing to a terminal")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser browse: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	if sources.stdinKey != "" {
+		return fail(fmt.Errorf("--stdin-key can't be used since stdin is read for commands"))
+	}
+	if *pageSize < 0 {
+		return fail(fmt.Errorf("-n can't be negative"))
+	}
+	if *pageSize == 0 {
+		*pageSize = 20
+		// Leave room for the status and command lines
+		if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 3 {
+			*pageSize = lines - 2
+		}
+	}
+	color, err := useColor(*colorMode, stdout)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "browse", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+
+	b := &browser{
+		query:    logQuery,
+		pageSize: *pageSize,
+		color:    color,
+		clear:    isTerminal(stdout),
+		out:      stdout,
+	}
+	if err := b.run(ctx, stdin); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(stderr, "logparser browse: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// browser pages through the merged logs, reading a command per line. It works on any terminal since it
+// doesn't need raw mode, every command is followed by enter
+type browser struct {
+	query    *logquery.LogQuery
+	pageSize int
+	color    bool
+	// clear clears the screen before every page
+	clear bool
+	out   io.Writer
+
+	keys  []string
+	level logquery.LogLevel
+	text  string
+
+	// cursors are the cursors of the pages before the current one, so p can go back
+	cursors []string
+	current string
+	next    string
+	message string
+}
+
+// run shows pages until q is entered or input ends
+func (b *browser) run(ctx context.Context, in io.Reader) error {
+	commands := make(chan string)
+	go func() {
+		defer close(commands)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case commands <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := b.show(ctx); err != nil {
+		return err
+	}
+	for {
+		var command string
+		var ok bool
+		select {
+		case command, ok = <-commands:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok || strings.TrimSpace(command) == "q" {
+			return nil
+		}
+		if strings.TrimSpace(command) == "f" {
+			if err := b.follow(ctx, commands); err != nil {
+				b.message = err.Error()
+			}
+			// Pick up what was followed so the pages include it
+			if err := b.query.Refresh(ctx); err != nil {
+				b.message = err.Error()
+			}
+		} else {
+			b.handle(command)
+		}
+		if err := b.show(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// handle applies a command other than q and f
+func (b *browser) handle(command string) {
+	command = strings.TrimSpace(command)
+	name, arg := command, ""
+	if strings.HasPrefix(command, "/") {
+		name, arg = "/", command[1:]
+	} else if i := strings.Index(command, " "); i != -1 {
+		name, arg = command[:i], strings.TrimSpace(command[i+1:])
+	}
+
+	switch name {
+	case "", "n":
+		if b.next == "" {
+			b.message = "no more logs"
+			return
+		}
+		b.cursors = append(b.cursors, b.current)
+		b.current = b.next
+	case "p":
+		if len(b.cursors) == 0 {
+			b.message = "already on the first page"
+			return
+		}
+		b.current = b.cursors[len(b.cursors)-1]
+		b.cursors = b.cursors[:len(b.cursors)-1]
+	case "g":
+		b.restart()
+	case "/":
+		b.text = arg
+		b.restart()
+	case "l":
+		level := logquery.Undefined
+		if arg != "" {
+			var err error
+			if level, err = logquery.ParseLevel(arg); err != nil {
+				b.message = err.Error()
+				return
+			}
+		}
+		b.level = level
+		b.restart()
+	case "k":
+		keys, err := splitKeys(arg, "", b.query.Keys())
+		if err != nil {
+			b.message = err.Error()
+			return
+		}
+		b.keys = nil
+		if arg != "" {
+			b.keys = keys
+		}
+		b.restart()
+	case "?":
+		b.message = browseHelp
+	default:
+		b.message = fmt.Sprintf("unknown command %q, ? shows the commands", command)
+	}
+}
+
+// restart goes back to the first page after the filters change
+func (b *browser) restart() {
+	b.cursors, b.current = nil, ""
+}
+
+// filters returns the query options for the current filters
+func (b *browser) filters() []logquery.QueryOption {
+	opts := []logquery.QueryOption{logquery.WithMinSeverity(b.level)}
+	if b.keys != nil {
+		opts = append(opts, logquery.WithKeys(b.keys...))
+	}
+	if b.text != "" {
+		opts = append(opts, logquery.WithSubstring(b.text))
+	}
+	return opts
+}
+
+// show prints the current page and the status line
+func (b *browser) show(ctx context.Context) error {
+	opts := append(b.filters(), logquery.WithLimit(b.pageSize), logquery.WithCursor(b.current))
+	page, err := b.query.QueryPage(ctx, opts...)
+	var loadErr *logquery.LoadError
+	if err != nil && !errors.As(err, &loadErr) {
+		return err
+	}
+	b.next = page.Cursor
+
+	if b.clear {
+		fmt.Fprint(b.out, "\x1b[H\x1b[2J")
+	}
+	for _, log := range page.Logs {
+		fmt.Fprintln(b.out, formatLog(log, b.color))
+	}
+	if len(page.Logs) == 0 {
+		fmt.Fprintln(b.out, "no logs match")
+	}
+	if b.message != "" {
+		fmt.Fprintln(b.out, b.message)
+		b.message = ""
+	}
+	fmt.Fprintf(b.out, "-- %s -- ? for commands > ", b.status())
+	return nil
+}
+
+// status describes the page and filters
+func (b *browser) status() string {
+	parts := []string{fmt.Sprintf("page %d", len(b.cursors)+1)}
+	if b.keys != nil {
+		parts = append(parts, "keys "+strings.Join(b.keys, ","))
+	}
+	if b.level != logquery.Undefined {
+		parts = append(parts, "level >= "+strings.ToLower(b.level.String()))
+	}
+	if b.text != "" {
+		parts = append(parts, fmt.Sprintf("text %q", b.text))
+	}
+	if b.next == "" {
+		parts = append(parts, "end")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// follow prints new logs matching the filters until a line is entered
+func (b *browser) follow(ctx context.Context, commands <-chan string) error {
+	keys := b.keys
+	if keys == nil {
+		keys = b.query.Keys()
+	}
+	followCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tail, err := b.query.Tail(followCtx, keys, b.level)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(b.out, "\nfollowing, press enter to stop")
+	for {
+		select {
+		case log, ok := <-tail:
+			if !ok {
+				return ctx.Err()
+			}
+			if b.text == "" || strings.Contains(log.Log, b.text) {
+				fmt.Fprintln(b.out, formatLog(log, b.color))
+			}
+		case <-commands:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorDim    = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+)
+
+// useColor resolves a --color value of auto, always or never. auto only colors when w is a terminal
+// and NO_COLOR isn't set
+func useColor(mode string, w io.Writer) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		return isTerminal(w), nil
+	}
+	return false, fmt.Errorf("unknown --color %q, expected auto, always or never", mode)
+}
+
+// isTerminal returns true if w is a character device like a terminal rather than a file or pipe
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// formatLog formats log like Log.String. With color the timestamp is dimmed and the severity is red
+// for errors and yellow for warnings, logs added as context of a match are dimmed entirely
+func formatLog(log logquery.Log, color bool) string {
+	if !color {
+		return log.String()
+	}
+	if log.Context {
+		return colorDim + log.String() + colorReset
+	}
+	// The parts are sanitized before coloring so escapes in the log can't mess with the colors
+	severity := logquery.Sanitize(log.SeverityString)
+	switch {
+	case log.Severity >= logquery.Error:
+		severity = colorRed + severity + colorReset
+	case log.Severity == logquery.Warn:
+		severity = colorYellow + severity + colorReset
+	}
+	return colorDim + logquery.Sanitize(log.TimeString) + colorReset + severity + logquery.Sanitize("["+log.Key+"] "+log.Log) + log.RepeatedString()
+}
+
+// textStyle is how logs are printed as text
+type textStyle struct {
+	color bool
+	// path puts the file and line every log was read from in front of it
+	path bool
+}
+
+// format formats log like formatLog, with path the location comes first like grep -n prints it, so
+// editors and terminals can jump to the line
+func (s textStyle) format(log logquery.Log) string {
+	line := formatLog(log, s.color)
+	location := logquery.Sanitize(log.Location())
+	if !s.path || location == "" {
+		return line
+	}
+	if s.color {
+		location = colorDim + location + colorReset
+	}
+	return location + ": " + line
+}
+
+// textEncoder writes logs as text in a style, see textStyle
+type textEncoder struct {
+	w     io.Writer
+	style textStyle
+}
+
+func (e *textEncoder) Encode(log logquery.Log) error {
+	_, err := fmt.Fprintln(e.w, e.style.format(log))
+	return err
+}
+
+func (e *textEncoder) Close() error {
+	return nil
+}
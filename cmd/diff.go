@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/analyze"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	keys := fs.String("keys", "", "comma separated keys to compare, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	windowA := fs.String("window-a", "", "first period as start/end RFC3339 times or start/duration, e.g. 2020-02-28T05:00:00Z/1h")
+	windowB := fs.String("window-b", "", "second period compared to the first, in the same form as --window-a")
+	minLevel := fs.String("min-level", "", "lowest level to compare: debug, info, warn, error or fatal. Defaults to every log")
+	maxLevel := fs.String("max-level", "", "highest level to compare. Defaults to every level")
+	factor := fs.Float64("factor", 3, "how many times its rate in --window-a a pattern needs in --window-b to be a spike")
+	minCount := fs.Int("min-count", 5, "fewest logs a pattern needs in a window to be reported")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser diff: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	a, err := parseWindow("--window-a", *windowA)
+	if err != nil {
+		return fail(err)
+	}
+	b, err := parseWindow("--window-b", *windowB)
+	if err != nil {
+		return fail(err)
+	}
+	if *factor <= 0 {
+		return fail(fmt.Errorf("--factor must be positive"))
+	}
+	if *minCount <= 0 {
+		return fail(fmt.Errorf("--min-count must be positive"))
+	}
+	level, ceiling, err := levelRange(*minLevel, *maxLevel)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "diff", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	diffKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	differ := analyze.Differ{Factor: *factor, MinCount: *minCount}
+	diffs, err := differ.Run(ctx, logQuery, a, b,
+		logquery.WithKeys(diffKeys...), logquery.WithMinSeverity(level), logquery.WithMaxSeverity(ceiling))
+	// Keys that failed are reported but don't hide the changes of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser diff: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintln(stderr, "logparser diff: no pattern appeared, disappeared or spiked")
+		return 0
+	}
+	rows := [][]string{{"change", "a", "b", "ratio", "keys", "pattern"}}
+	for _, d := range diffs {
+		ratio := ""
+		if d.Change == analyze.Spiked {
+			ratio = strconv.FormatFloat(d.Ratio, 'f', 1, 64) + "x"
+		}
+		rows = append(rows, []string{string(d.Change), strconv.Itoa(d.CountA), strconv.Itoa(d.CountB), ratio, strings.Join(d.Keys, ","), d.Template})
+	}
+	fmt.Fprint(stdout, formatTable(rows[0], rows[1:]))
+	return 0
+}
+
+// parseWindow parses a start/end or start/duration window of the flag name
+func parseWindow(name string, value string) (analyze.Window, error) {
+	window := analyze.Window{}
+	if value == "" {
+		return window, fmt.Errorf("%s is required", name)
+	}
+	slash := strings.Index(value, "/")
+	if slash == -1 {
+		return window, fmt.Errorf("%s must be start/end or start/duration, got %q", name, value)
+	}
+	var err error
+	if window.Start, err = time.Parse(time.RFC3339, value[:slash]); err != nil {
+		return window, fmt.Errorf("%s must start with an RFC3339 time, %s", name, err)
+	}
+	if d, err := time.ParseDuration(value[slash+1:]); err == nil {
+		window.End = window.Start.Add(d)
+	} else if window.End, err = time.Parse(time.RFC3339, value[slash+1:]); err != nil {
+		return window, fmt.Errorf("%s must end with an RFC3339 time or a duration, %s", name, err)
+	}
+	if !window.Start.Before(window.End) {
+		return window, fmt.Errorf("%s must start before it ends", name)
+	}
+	return window, nil
+}
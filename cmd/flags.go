@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// fileFlag collects repeated --file key=path flags
+type fileFlag map[string]string
+
+func (f fileFlag) String() string {
+	pairs := []string{}
+	for key, path := range f {
+		pairs = append(pairs, key+"="+path)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f fileFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("expected key=path, got %q", value)
+	}
+	key, path := value[:i], value[i+1:]
+	if _, ok := f[key]; ok {
+		return fmt.Errorf("key %q is used more than once", key)
+	}
+	f[key] = path
+	return nil
+}
+
+// listFlag collects the values of a flag that can be repeated, in order
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// timeRange is the shared --since/--start/--end flags
+type timeRange struct {
+	since time.Duration
+	start string
+	end   string
+}
+
+// resolve turns the flags into start and end times, zero times mean unbounded
+func (r timeRange) resolve(now time.Time) (time.Time, time.Time, error) {
+	var start, end time.Time
+	if r.since < 0 {
+		return start, end, fmt.Errorf("--since can't be negative")
+	}
+	if r.since > 0 && r.start != "" {
+		return start, end, fmt.Errorf("--since and --start can't be used together")
+	}
+	if r.since > 0 {
+		start = now.Add(-r.since)
+	}
+
+	var err error
+	if r.start != "" {
+		if start, err = time.Parse(time.RFC3339, r.start); err != nil {
+			return start, end, fmt.Errorf("--start must be an RFC3339 time, %s", err)
+		}
+	}
+	if r.end != "" {
+		if end, err = time.Parse(time.RFC3339, r.end); err != nil {
+			return start, end, fmt.Errorf("--end must be an RFC3339 time, %s", err)
+		}
+		if !start.IsZero() && !start.Before(end) {
+			return start, end, fmt.Errorf("the start time must be before --end")
+		}
+	}
+	return start, end, nil
+}
+
+// splitKeys parses comma separated --keys and --exclude values and checks every key is known. Keys can
+// be patterns like `*` or `web-*` which have to match a known key. An empty value means every known key
+func splitKeys(value string, exclude string, known []string) ([]string, error) {
+	include, err := checkKeys(value, known)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := checkKeys(exclude, known)
+	if err != nil {
+		return nil, err
+	}
+	return logquery.SelectKeys(known, include, excluded), nil
+}
+
+// checkKeys splits a comma separated list of keys and patterns, nil if value is empty
+func checkKeys(value string, known []string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	keys := []string{}
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		found := false
+		for _, k := range known {
+			found = found || logquery.MatchKey(key, k)
+		}
+		if !found && logquery.IsKeyPattern(key) {
+			return nil, fmt.Errorf("key pattern %q matches no --file", key)
+		}
+		if !found {
+			return nil, fmt.Errorf("key %q has no --file", key)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// levelRange parses --min-level and --max-level, either can be empty to leave that end open
+func levelRange(minLevel string, maxLevel string) (logquery.LogLevel, logquery.LogLevel, error) {
+	min, max := logquery.Undefined, logquery.Undefined
+	var err error
+	if minLevel != "" {
+		if min, err = logquery.ParseLevel(minLevel); err != nil {
+			return min, max, err
+		}
+	}
+	if maxLevel != "" {
+		if max, err = logquery.ParseLevel(maxLevel); err != nil {
+			return min, max, err
+		}
+		if max < min {
+			return min, max, fmt.Errorf("--max-level %s is below --min-level %s", maxLevel, minLevel)
+		}
+	}
+	return min, max, nil
+}
+
+// capLevel drops the logs above max from a Tail channel, Undefined keeps every log
+func capLevel(logs <-chan logquery.Log, max logquery.LogLevel) <-chan logquery.Log {
+	if max == logquery.Undefined {
+		return logs
+	}
+	rv := make(chan logquery.Log)
+	go func() {
+		defer close(rv)
+		for log := range logs {
+			if log.Severity <= max {
+				rv <- log
+			}
+		}
+	}()
+	return rv
+}
+
+// parseLevels parses a comma separated list of level names
+func parseLevels(value string) ([]logquery.LogLevel, error) {
+	levels := []logquery.LogLevel{}
+	for _, name := range strings.Split(value, ",") {
+		level, err := logquery.ParseLevel(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// flagSet returns true if the flag called name was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+func runHistogram(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser histogram", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	timeRange := timeRange{}
+	keys := fs.String("keys", "", "comma separated keys to chart, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	fs.DurationVar(&timeRange.since, "since", 0, "only chart logs from this long ago, e.g. 24h")
+	fs.StringVar(&timeRange.start, "start", "", "only chart logs after this RFC3339 time")
+	fs.StringVar(&timeRange.end, "end", "", "only chart logs before this RFC3339 time")
+	bucket := fs.Duration("bucket", time.Minute, "size of the buckets logs are counted in, one bar each")
+	minLevel := fs.String("min-level", "", "lowest level to count: debug, info, warn, error or fatal. Defaults to every log")
+	maxLevel := fs.String("max-level", "", "highest level to count. Defaults to every level")
+	width := fs.Int("width", 50, "width of the longest bar in characters")
+	sparkline := fs.Bool("sparkline", false, "draw each key as one line of block characters, a character per bucket, instead of a bar per bucket")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser histogram: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	if *bucket <= 0 || *width <= 0 {
+		return fail(fmt.Errorf("--bucket and --width must be positive"))
+	}
+	level, ceiling, err := levelRange(*minLevel, *maxLevel)
+	if err != nil {
+		return fail(err)
+	}
+	start, end, err := timeRange.resolve(time.Now())
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "histogram", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	chartKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	aggregation, err := logQuery.Aggregate(ctx, start, end, chartKeys, *bucket)
+	// Keys that failed are reported but don't hide the charts of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser histogram: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+	counts := levelCounts(aggregation, level, ceiling)
+	if *sparkline {
+		fmt.Fprint(stdout, sparklines(aggregation, counts, *bucket))
+	} else {
+		fmt.Fprint(stdout, histogram(aggregation, counts, *bucket, *width))
+	}
+	return 0
+}
+
+// levelCounts counts the logs between level and ceiling in every bucket of the aggregation
+func levelCounts(aggregation logquery.Aggregation, level logquery.LogLevel, ceiling logquery.LogLevel) map[string][]int {
+	rv := map[string][]int{}
+	for key, buckets := range aggregation {
+		counts := make([]int, len(buckets))
+		for i, b := range buckets {
+			for severity, count := range b.Counts {
+				if severity >= level && (ceiling == logquery.Undefined || severity <= ceiling) {
+					counts[i] += count
+				}
+			}
+		}
+		rv[key] = counts
+	}
+	return rv
+}
+
+// highestCount is the most logs in any bucket of any key, so every chart has the same scale and the keys
+// can be compared
+func highestCount(counts map[string][]int) int {
+	rv := 0
+	for _, keyCounts := range counts {
+		for _, count := range keyCounts {
+			if count > rv {
+				rv = count
+			}
+		}
+	}
+	return rv
+}
+
+// sortedKeys returns the keys of counts in order
+func sortedKeys(counts map[string][]int) []string {
+	rv := make([]string, 0, len(counts))
+	for key := range counts {
+		rv = append(rv, key)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// matchingRange returns the first and last buckets with logs, leaving out the quiet buckets before the
+// first match and after the last one. first is past last when there are no logs
+func matchingRange(counts []int) (first int, last int) {
+	first, last = 0, len(counts)-1
+	for first <= last && counts[first] == 0 {
+		first++
+	}
+	for last >= first && counts[last] == 0 {
+		last--
+	}
+	return first, last
+}
+
+// bucketLayout is the time layout of the starts of buckets, precise enough to tell them apart
+func bucketLayout(bucket time.Duration) string {
+	if bucket%time.Second != 0 {
+		return "2006-01-02 15:04:05.000"
+	}
+	if bucket%time.Minute != 0 {
+		return "2006-01-02 15:04:05"
+	}
+	return "2006-01-02 15:04"
+}
+
+// histogram charts the counts of every key as a bar per bucket
+func histogram(aggregation logquery.Aggregation, counts map[string][]int, bucket time.Duration, width int) string {
+	highest := highestCount(counts)
+	layout := bucketLayout(bucket)
+	b := &strings.Builder{}
+	for i, key := range sortedKeys(counts) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(key + "\n")
+		first, last := matchingRange(counts[key])
+		if first > last {
+			b.WriteString("  no matching logs\n")
+			continue
+		}
+		for j := first; j <= last; j++ {
+			count := counts[key][j]
+			bar := strings.Repeat("#", (count*width+highest-1)/highest)
+			fmt.Fprintf(b, "  %s  %-*s %d\n", aggregation[key][j].Start.Format(layout), width, bar, count)
+		}
+	}
+	return b.String()
+}
+
+// sparkBlocks are the characters of a sparkline from the fewest logs to the most
+var sparkBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// sparklines draws the counts of every key as one line with a character per bucket, from the first
+// bucket with logs to the last
+func sparklines(aggregation logquery.Aggregation, counts map[string][]int, bucket time.Duration) string {
+	highest := highestCount(counts)
+	layout := bucketLayout(bucket)
+	keys := sortedKeys(counts)
+	keyWidth := 0
+	for _, key := range keys {
+		if len(key) > keyWidth {
+			keyWidth = len(key)
+		}
+	}
+	b := &strings.Builder{}
+	for _, key := range keys {
+		first, last := matchingRange(counts[key])
+		if first > last {
+			fmt.Fprintf(b, "%-*s  no matching logs\n", keyWidth, key)
+			continue
+		}
+		line := make([]rune, 0, last-first+1)
+		total := 0
+		for _, count := range counts[key][first : last+1] {
+			// Any logs at all get at least the lowest block so they don't look like a quiet bucket
+			level := (count*(len(sparkBlocks)-1) + highest - 1) / highest
+			line = append(line, sparkBlocks[level])
+			total += count
+		}
+		fmt.Fprintf(b, "%-*s  %s %s %s  %d logs\n", keyWidth, key, aggregation[key][first].Start.Format(layout),
+			string(line), aggregation[key][last].Start.Format(layout), total)
+	}
+	return b.String()
+}
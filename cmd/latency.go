@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/analyze"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+func runLatency(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser latency", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	timeRange := timeRange{}
+	keys := fs.String("keys", "", "comma separated keys to summarize, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	fs.DurationVar(&timeRange.since, "since", 0, "only summarize logs from this long ago, e.g. 24h")
+	fs.StringVar(&timeRange.start, "start", "", "only summarize logs after this RFC3339 time")
+	fs.StringVar(&timeRange.end, "end", "", "only summarize logs before this RFC3339 time")
+	field := fs.String("field", "", "structured field holding the latency, e.g. duration_ms. Durations like 120ms are read as milliseconds")
+	bucket := fs.Duration("bucket", time.Minute, "size of the buckets the percentiles are taken over")
+	grep := fs.String("grep", "", "only summarize logs whose message contains this text, e.g. a path")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser latency: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if *field == "" {
+		return fail(fmt.Errorf("--field is required"))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	if *bucket <= 0 {
+		return fail(fmt.Errorf("--bucket must be positive"))
+	}
+	start, end, err := timeRange.resolve(time.Now())
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "latency", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	latencyKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	queryOpts := []logquery.QueryOption{logquery.WithKeys(latencyKeys...), logquery.WithStart(start), logquery.WithEnd(end)}
+	if *grep != "" {
+		queryOpts = append(queryOpts, logquery.WithSubstring(*grep))
+	}
+	buckets, skipped, err := analyze.LatencyPercentiles(ctx, logQuery, *field, *bucket, queryOpts...)
+	// Keys that failed are reported but don't hide the latencies of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser latency: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+	if len(buckets) == 0 {
+		fmt.Fprintf(stderr, "logparser latency: no logs had a numeric %s field\n", *field)
+		return 0
+	}
+	rows := [][]string{{"bucket", "count", "p50", "p95", "p99", "max"}}
+	for _, b := range buckets {
+		rows = append(rows, []string{b.Start.Format(statsTime), strconv.Itoa(b.Count),
+			formatLatency(b.P50), formatLatency(b.P95), formatLatency(b.P99), formatLatency(b.Max)})
+	}
+	fmt.Fprint(stdout, formatTable(rows[0], rows[1:]))
+	if skipped > 0 {
+		fmt.Fprintf(stderr, "skipped %d logs without a numeric %s field\n", skipped, *field)
+	}
+	return 0
+}
+
+// formatLatency shows a latency with at most 3 decimals
+func formatLatency(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
@@ -2,24 +2,77 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"time"
-
-	"github.com/screenshotjy/logquery/pkg/logquery"
 )
 
+const usage = `usage: logparser <command> [flags]
+
+commands:
+  query      print logs from one or more files merged in time order
+  serve      serve queries over HTTP as JSON
+  tail       print the latest logs and follow new ones with -f
+  browse     page through logs interactively, filtering and following them with typed commands
+  spikes     find times a key logged many more errors than usual
+  patterns   show the most common messages with their numbers and ids masked
+  push       send logs to Grafana Loki, an OpenTelemetry collector or a Kafka topic, following new ones with -f
+  saved      list, add and delete the saved queries of query --saved
+  histogram  chart the number of logs over time per key
+  stats      summarize each key: lines, parse failures, time span, levels and busiest minute
+  sql        run a SQL SELECT over the logs, like counting errors per key
+  latency    show the p50, p95 and p99 of a latency field per time bucket
+  sessions   group logs sharing an identifier like a user or IP into sessions split by idle time
+  diff       compare the message patterns of two time windows, like before and after a deploy
+
+Run "logparser <command> -h" to see the flags for a command.
+`
+
 func main() {
-	logQuery, err := logquery.NewLogQuery(map[string]string{
-		"server1":   "./logs/server1.log",
-		"db_server": "./logs/db_server.log",
-	})
-
-	if err != nil {
-		fmt.Printf("Error in creating LogQuery, %s", err)
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run dispatches to a sub command and returns the exit code. Bad flags or config exit with 2 and
+// failures while running exit with 1
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
 	}
 
-	s := logQuery.Query(time.Time{}, 100, []string{"server1", "db_server"}, logquery.Info)
-	fmt.Print(s)
+	switch args[0] {
+	case "query":
+		return runQuery(args[1:], stdout, stderr)
+	case "serve":
+		return runServe(args[1:], stdout, stderr)
+	case "tail":
+		return runTail(args[1:], stdout, stderr)
+	case "browse":
+		return runBrowse(args[1:], os.Stdin, stdout, stderr)
+	case "spikes":
+		return runSpikes(args[1:], stdout, stderr)
+	case "patterns":
+		return runPatterns(args[1:], stdout, stderr)
+	case "push":
+		return runPush(args[1:], stdout, stderr)
+	case "histogram":
+		return runHistogram(args[1:], stdout, stderr)
+	case "stats":
+		return runStats(args[1:], stdout, stderr)
+	case "saved":
+		return runSaved(args[1:], stdout, stderr)
+	case "sql":
+		return runSQL(args[1:], stdout, stderr)
+	case "latency":
+		return runLatency(args[1:], stdout, stderr)
+	case "sessions":
+		return runSessions(args[1:], stdout, stderr)
+	case "diff":
+		return runDiff(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
 
+	fmt.Fprintf(stderr, "logparser: unknown command %q\n\n%s", args[0], usage)
+	return 2
 }
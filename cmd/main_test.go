@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageAligned(t *testing.T) {
+	assert := assert.New(t)
+	table := usage[strings.Index(usage, "commands:\n")+len("commands:\n"):]
+	commands := strings.Split(table[:strings.Index(table, "\n\n")], "\n")
+	assert.NotEmpty(commands)
+	column := len("  histogram  ")
+	for _, line := range commands {
+		assert.Equal(" ", line[column-1:column], line)
+		assert.NotEqual(" ", line[column:column+1], line)
+	}
+}
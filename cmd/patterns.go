@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/analyze"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+func runPatterns(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser patterns", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	timeRange := timeRange{}
+	keys := fs.String("keys", "", "comma separated keys to group, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	fs.DurationVar(&timeRange.since, "since", 0, "only group logs from this long ago, e.g. 24h")
+	fs.StringVar(&timeRange.start, "start", "", "only group logs after this RFC3339 time")
+	fs.StringVar(&timeRange.end, "end", "", "only group logs before this RFC3339 time")
+	minLevel := fs.String("min-level", "", "lowest level to group: debug, info, warn, error or fatal. Defaults to every log")
+	maxLevel := fs.String("max-level", "", "highest level to group, e.g. debug to find the noisiest debug logs. Defaults to every level")
+	top := fs.Int("n", 10, "number of patterns to show, 0 shows every pattern")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser patterns: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	if *top < 0 {
+		return fail(fmt.Errorf("-n can't be negative"))
+	}
+	start, end, err := timeRange.resolve(time.Now())
+	if err != nil {
+		return fail(err)
+	}
+	level, ceiling, err := levelRange(*minLevel, *maxLevel)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "patterns", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	patternKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	patterns, err := analyze.TopPatterns(ctx, logQuery, *top,
+		logquery.WithKeys(patternKeys...), logquery.WithStart(start), logquery.WithEnd(end), logquery.WithMinSeverity(level), logquery.WithMaxSeverity(ceiling))
+	// Keys that failed are reported but don't hide the patterns of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser patterns: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+	for _, pattern := range patterns {
+		fmt.Fprintf(stdout, "%7d  %s  [%s]\n", pattern.Count, pattern.Template, strings.Join(pattern.Keys, ","))
+	}
+	return 0
+}
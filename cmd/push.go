@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/kafka"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/loki"
+	"github.com/screenshotjy/logquery/pkg/otlp"
+)
+
+func runPush(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser push", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	lokiURL := fs.String("loki-url", "", "base url of Loki to push to, e.g. http://loki:3100")
+	otlpURL := fs.String("otlp-url", "", "base url of an OpenTelemetry collector's OTLP/HTTP receiver to export to, e.g. http://collector:4318")
+	kafkaBrokers := fs.String("kafka-brokers", "", "comma separated Kafka brokers to publish to as host:port, e.g. kafka-1:9092,kafka-2:9092")
+	kafkaTopic := fs.String("kafka-topic", "", "Kafka topic to publish to with --kafka-brokers")
+	labels := fileFlag{}
+	fs.Var(labels, "label", "name=value label added to every Loki stream or OTLP resource attribute, can be repeated")
+	tenant := fs.String("tenant", "", "tenant sent as X-Scope-OrgID")
+	keys := fs.String("keys", "", "comma separated keys to push, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	minLevel := fs.String("min-level", "", "lowest level to push: debug, info, warn, error or fatal. Defaults to every log")
+	maxLevel := fs.String("max-level", "", "highest level to push. Defaults to every level")
+	follow := fs.Bool("f", false, "keep pushing logs as they are appended until interrupted")
+	batchSize := fs.Int("batch-size", 1000, "max number of logs in one push")
+	interval := fs.Duration("flush-interval", time.Second, "how long new logs wait for a batch to fill with -f")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser push: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	sinks := 0
+	for _, sink := range []string{*lokiURL, *otlpURL, *kafkaBrokers} {
+		if sink != "" {
+			sinks++
+		}
+	}
+	if sinks != 1 {
+		return fail(fmt.Errorf("one of --loki-url, --otlp-url or --kafka-brokers is required"))
+	}
+	if (*kafkaBrokers == "") != (*kafkaTopic == "") {
+		return fail(fmt.Errorf("--kafka-brokers and --kafka-topic have to be used together"))
+	}
+	if *batchSize <= 0 || *interval <= 0 {
+		return fail(fmt.Errorf("--batch-size and --flush-interval must be positive"))
+	}
+	level, ceiling, err := levelRange(*minLevel, *maxLevel)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "push", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	pushKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+	push := (&loki.Client{URL: *lokiURL, Labels: labels, TenantID: *tenant}).Push
+	if *otlpURL != "" {
+		push = (&otlp.Exporter{Endpoint: *otlpURL, Resource: labels}).Export
+	}
+	if *kafkaBrokers != "" {
+		push = (&kafka.Producer{Brokers: strings.Split(*kafkaBrokers, ","), Topic: *kafkaTopic}).Push
+	}
+
+	// Start following before pushing what is already there so nothing appended in between is missed
+	var tail <-chan logquery.Log
+	if *follow {
+		if tail, err = logQuery.Tail(ctx, pushKeys, level); err != nil {
+			fmt.Fprintf(stderr, "logparser push: %s\n", err)
+			return 1
+		}
+		tail = capLevel(tail, ceiling)
+	}
+	logs, err := logQuery.QueryLogs(ctx, logquery.WithKeys(pushKeys...), logquery.WithMinSeverity(level), logquery.WithMaxSeverity(ceiling))
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser push: %s\n", err)
+		return 1
+	}
+	for i := 0; i < len(logs); i += *batchSize {
+		end := i + *batchSize
+		if end > len(logs) {
+			end = len(logs)
+		}
+		if err := push(ctx, logs[i:end]); err != nil {
+			fmt.Fprintf(stderr, "logparser push: %s\n", err)
+			return 1
+		}
+	}
+	fmt.Fprintf(stdout, "pushed %d logs\n", len(logs))
+	if tail == nil {
+		return 0
+	}
+
+	for batch := range logquery.Batches(ctx, tail, *batchSize, *interval) {
+		if err := push(ctx, batch); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(stderr, "logparser push: %s\n", err)
+			return 1
+		}
+	}
+	return 0
+}
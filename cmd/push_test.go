@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushFlags(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{}, "one of --loki-url, --otlp-url or --kafka-brokers is required"},
+		{[]string{"--loki-url", "http://loki:3100", "--kafka-brokers", "kafka:9092"}, "one of --loki-url, --otlp-url or --kafka-brokers is required"},
+		{[]string{"--kafka-brokers", "kafka:9092"}, "--kafka-brokers and --kafka-topic have to be used together"},
+		{[]string{"--loki-url", "http://loki:3100", "--label", "job=legacy", "--batch-size", "0"}, "--batch-size and --flush-interval must be positive"},
+	} {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		args := append([]string{"--file", "app=./app.log", "--key-label", "app=env=prod"}, test.args...)
+		assert.Equal(2, runPush(args, stdout, stderr), test.args)
+		assert.Equal("logparser push: "+test.err+"\n", stderr.String(), test.args)
+		assert.Empty(stdout.String(), test.args)
+	}
+}
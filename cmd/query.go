@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/aggregator"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/querylang"
+	"github.com/screenshotjy/logquery/pkg/saved"
+)
+
+func runQuery(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	agents := fileFlag{}
+	fs.Var(agents, "agent", "name=url of a logparser serve agent to query instead of local files, can be repeated. Its keys are queried as name/key")
+	timeRange := timeRange{}
+	outputZone := fs.String("tz", "", "time zone to display every log in, e.g. UTC or Local")
+	keys := fs.String("keys", "", "comma separated keys to query, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	selector := fs.String("selector", "", "only query sources whose --key-label or config labels match, e.g. env=prod,region!=eu")
+	fs.DurationVar(&timeRange.since, "since", 0, "only show logs from this long ago, e.g. 24h")
+	fs.StringVar(&timeRange.start, "start", "", "only show logs after this RFC3339 time")
+	fs.StringVar(&timeRange.end, "end", "", "only show logs before this RFC3339 time")
+	limit := fs.Int("limit", 100, "max number of logs to show")
+	perKeyLimit := fs.Int("per-key-limit", 0, "max number of logs to show from each key, 0 means only --limit applies")
+	minLevel := fs.String("min-level", "", "lowest level to show: debug, info, warn, error or fatal. Defaults to every log")
+	maxLevel := fs.String("max-level", "", "highest level to show, e.g. warn to leave out errors. Defaults to every level")
+	grep := fs.String("grep", "", "only show logs whose message contains this text")
+	pattern := fs.String("regex", "", "only show logs whose message matches this regular expression")
+	correlate := fileFlag{}
+	fs.Var(correlate, "correlate", "only show logs whose structured field has a value as name=value, e.g. request_id=abc to follow one request across every key. Can be repeated")
+	queryString := fs.String("query", "", `filters as one query like 'level>=warn AND key IN (server1,db) AND msg~"timeout" SINCE 2h'`)
+	savedName := fs.String("saved", "", "run the query saved with this name by logparser saved add instead of --query")
+	savedFile := fs.String("saved-file", saved.DefaultPath(), "file of the saved queries")
+	collapse := fs.Bool("collapse", false, "show a run of the same log of a key once with how many times it repeated")
+	sampleRate := fs.Int("sample", 0, "only show 1 in this many matching logs, the same ones every time")
+	sampleLevels := fs.String("sample-levels", "", "comma separated levels --sample applies to, e.g. debug,info. Defaults to every level")
+	before := fs.Int("B", 0, "also show this many logs of the same key before every match")
+	after := fs.Int("A", 0, "also show this many logs of the same key after every match")
+	around := fs.Int("C", 0, "also show this many logs of the same key before and after every match, -A and -B override it")
+	descending := fs.Bool("desc", false, "show the most recent logs first")
+	output := fs.String("output", "text", "output format: text, ndjson, json, csv or parquet. With --out it defaults to the format of the file's extension")
+	out := fs.String("out", "", "write the logs to this file instead of stdout, e.g. results.json, results.ndjson, results.csv, results.parquet or results.txt")
+	colorMode := fs.String("color", "auto", "color severities in text output: auto, always or never. auto colors only when writing to a terminal")
+	formatTemplate := fs.String("format", "", `Go template every log is printed with instead of --output, e.g. '{{.Time.Format "15:04:05"}} {{.Key}} {{.SeverityString}} {{.Log}}'`)
+	showPath := fs.Bool("show-path", false, "put the file and line every log was read from in front of it in text output, like ./logs/app.log:12:")
+	stats := fs.Bool("stats", false, "print how many logs matched before --limit, per key, and how long the query took to stderr")
+	groupBy := fs.String("group-by", "", "comma separated columns to group every match by, each of key, severity or field.<name>. The groups with their counts and most common messages are printed to stderr")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	// Validate the config before touching any files
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser query: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	var opts []logquery.Option
+	var agg *aggregator.Aggregator
+	var err error
+	if len(agents) > 0 {
+		if len(sources.files) > 0 || len(sources.keyFiles) > 0 || sources.stdinKey != "" || sources.config != "" {
+			return fail(fmt.Errorf("--agent can't be used with --file, --files, --stdin-key or --config"))
+		}
+		if *stats || *groupBy != "" || *selector != "" {
+			return fail(fmt.Errorf("--stats, --group-by and --selector can't be used with --agent"))
+		}
+		if agg, err = aggregator.New(agents, nil); err != nil {
+			return fail(err)
+		}
+	} else if opts, err = sources.options(); err != nil {
+		return fail(err)
+	}
+	queryFlag := "--query"
+	if *savedName != "" {
+		if *queryString != "" {
+			return fail(fmt.Errorf("--saved can't be used with --query"))
+		}
+		q, err := saved.Open(*savedFile).Get(*savedName)
+		if err != nil {
+			return fail(err)
+		}
+		queryFlag, *queryString = "--saved", q.Query
+	}
+	var compiled *logquery.QueryOptions
+	if *queryString != "" {
+		// The query replaces the filter flags instead of guessing how to combine them
+		conflicts := []string{}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "keys", "exclude", "since", "start", "end", "min-level", "max-level", "grep", "regex", "correlate":
+				conflicts = append(conflicts, "--"+f.Name)
+			}
+		})
+		if len(conflicts) > 0 {
+			return fail(fmt.Errorf("%s can't be used with %s", queryFlag, strings.Join(conflicts, ", ")))
+		}
+		if compiled, err = querylang.Compile(*queryString, time.Now()); err != nil {
+			return fail(fmt.Errorf("bad %s, %s", queryFlag, err))
+		}
+	}
+	format := *output
+	if *formatTemplate != "" && flagSet(fs, "output") {
+		return fail(fmt.Errorf("--format can't be used with --output"))
+	}
+	if *out != "" && !flagSet(fs, "output") && *formatTemplate == "" {
+		if format = logquery.FormatForPath(*out); format == "" {
+			return fail(fmt.Errorf("can't tell the format of --out %s from its extension, set --output", *out))
+		}
+	}
+	if _, err := logquery.NewEncoder(format, ioutil.Discard); err != nil {
+		return fail(fmt.Errorf("bad --output, %s", err))
+	}
+	if *formatTemplate != "" {
+		if _, err := logquery.NewTemplateEncoder(*formatTemplate, ioutil.Discard); err != nil {
+			return fail(fmt.Errorf("bad --format, %s", err))
+		}
+	}
+	color, err := useColor(*colorMode, stdout)
+	if err != nil {
+		return fail(err)
+	}
+	// Files are never colored
+	color = color && *out == ""
+	if *limit <= 0 {
+		return fail(fmt.Errorf("--limit must be positive"))
+	}
+	if *perKeyLimit < 0 {
+		return fail(fmt.Errorf("--per-key-limit can't be negative"))
+	}
+	start, end, err := timeRange.resolve(time.Now())
+	if err != nil {
+		return fail(err)
+	}
+	level, ceiling, err := levelRange(*minLevel, *maxLevel)
+	if err != nil {
+		return fail(err)
+	}
+	queryOpts := []logquery.QueryOption{
+		logquery.WithStart(start),
+		logquery.WithEnd(end),
+		logquery.WithTotalLimit(*limit),
+		logquery.WithPerKeyLimit(*perKeyLimit),
+		logquery.WithMinSeverity(level),
+		logquery.WithMaxSeverity(ceiling),
+	}
+	if *grep != "" {
+		queryOpts = append(queryOpts, logquery.WithSubstring(*grep))
+	}
+	if *pattern != "" {
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			return fail(fmt.Errorf("bad --regex, %s", err))
+		}
+		queryOpts = append(queryOpts, logquery.WithPattern(re))
+	}
+	if *descending {
+		queryOpts = append(queryOpts, logquery.WithDescending())
+	}
+	if *sampleRate < 0 {
+		return fail(fmt.Errorf("--sample can't be negative"))
+	}
+	if *sampleRate > 0 {
+		levels := []logquery.LogLevel{}
+		if *sampleLevels != "" {
+			if levels, err = parseLevels(*sampleLevels); err != nil {
+				return fail(fmt.Errorf("bad --sample-levels, %s", err))
+			}
+		}
+		queryOpts = append(queryOpts, logquery.WithSampleRate(*sampleRate, levels...))
+	}
+	if *collapse {
+		queryOpts = append(queryOpts, logquery.WithCollapsedRepeats())
+	}
+	if *before < 0 || *after < 0 || *around < 0 {
+		return fail(fmt.Errorf("-A, -B and -C can't be negative"))
+	}
+	if !flagSet(fs, "B") {
+		*before = *around
+	}
+	if !flagSet(fs, "A") {
+		*after = *around
+	}
+	if *before > 0 || *after > 0 {
+		queryOpts = append(queryOpts, logquery.WithContext(*before, *after))
+	}
+	for name, value := range correlate {
+		queryOpts = append(queryOpts, logquery.FieldEquals(name, value))
+	}
+	if *groupBy != "" {
+		queryOpts = append(queryOpts, logquery.WithGroupBy(strings.Split(*groupBy, ",")...))
+	}
+	if *selector != "" {
+		labels, err := logquery.ParseLabelSelector(*selector)
+		if err != nil {
+			return fail(fmt.Errorf("bad --selector, %s", err))
+		}
+		queryOpts = append(queryOpts, logquery.WithLabelSelector(labels))
+	}
+
+	var outputLoc *time.Location
+	if *outputZone != "" {
+		if outputLoc, err = time.LoadLocation(*outputZone); err != nil {
+			return fail(fmt.Errorf("bad --tz, %s", err))
+		}
+	}
+	ctx := context.Background()
+	var logQuery *logquery.LogQuery
+	var known []string
+	if agg != nil {
+		// Agents that are down are reported and the others are still queried
+		if known, err = agg.Keys(ctx); err != nil {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+		}
+	} else {
+		if logQuery = sources.load(ctx, "query", opts, stderr); logQuery == nil {
+			return 1
+		}
+		known = logQuery.Keys()
+	}
+	queryKeys, err := splitKeys(*keys, *exclude, known)
+	if err != nil {
+		return fail(err)
+	}
+
+	queryOpts = append(queryOpts, logquery.WithKeys(queryKeys...))
+	if compiled != nil {
+		if compiled.Keys != nil {
+			if _, err := splitKeys(strings.Join(compiled.Keys, ","), "", known); err != nil {
+				return fail(err)
+			}
+		}
+		// The query only has filters, everything else still comes from the flags
+		flags := logquery.QueryOptions{}
+		for _, opt := range queryOpts {
+			opt(&flags)
+		}
+		compiled.TotalLimit, compiled.PerKeyLimit, compiled.Descending = flags.TotalLimit, flags.PerKeyLimit, flags.Descending
+		compiled.CollapseRepeats, compiled.SampleRates = flags.CollapseRepeats, flags.SampleRates
+		compiled.Before, compiled.After = flags.Before, flags.After
+		compiled.GroupBy, compiled.Labels = flags.GroupBy, flags.Labels
+		queryOpts = append(queryOpts, logquery.WithOptions(*compiled))
+	}
+	w := stdout
+	var file *os.File
+	var buffered *bufio.Writer
+	if *out != "" {
+		if file, err = os.Create(*out); err != nil {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+			return 1
+		}
+		defer file.Close()
+		buffered = bufio.NewWriter(file)
+		w = buffered
+	}
+	var encoder logquery.Encoder = &textEncoder{w: w, style: textStyle{color: color, path: *showPath}}
+	if !(color || *showPath) || format != "text" {
+		encoder, _ = logquery.NewEncoder(format, w)
+	}
+	if *formatTemplate != "" {
+		encoder, _ = logquery.NewTemplateEncoder(*formatTemplate, w)
+	}
+	encode := func(log logquery.Log) error {
+		if outputLoc != nil {
+			log = logquery.Logs{log}.In(outputLoc)[0]
+		}
+		return encoder.Encode(log)
+	}
+
+	// Local logs are streamed to the output as they are merged, agents are merged up front
+	if agg != nil {
+		var logs logquery.Logs
+		logs, err = agg.QueryLogs(ctx, queryOpts...)
+		var loadErr *logquery.LoadError
+		if err != nil && !errors.As(err, &loadErr) {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+			err = nil
+		}
+		for _, log := range logs {
+			if err = encode(log); err != nil {
+				break
+			}
+		}
+	} else if *stats || *groupBy != "" {
+		// Every match has to be counted before anything is shown
+		var result *logquery.QueryResult
+		result, err = logQuery.QueryResult(ctx, queryOpts...)
+		if errors.Is(err, logquery.ErrInvalidGroupBy) {
+			return fail(fmt.Errorf("bad --group-by, %s", err))
+		}
+		var loadErr *logquery.LoadError
+		if err != nil && !errors.As(err, &loadErr) {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+			err = nil
+		}
+		for _, log := range result.Logs {
+			if err = encode(log); err != nil {
+				break
+			}
+		}
+		if *stats {
+			fmt.Fprintln(stderr, formatStats(result))
+		}
+		if *groupBy != "" {
+			fmt.Fprint(stderr, formatGroups(result.Groups))
+		}
+	} else if *before > 0 || *after > 0 {
+		// Iter can't look back for context so the logs are merged up front
+		var logs logquery.Logs
+		logs, err = logQuery.QueryLogs(ctx, queryOpts...)
+		var loadErr *logquery.LoadError
+		if err != nil && !errors.As(err, &loadErr) {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "logparser query: %s\n", err)
+			err = nil
+		}
+		for _, log := range logs {
+			if err = encode(log); err != nil {
+				break
+			}
+		}
+	} else {
+		it := logQuery.Iter(ctx, queryOpts...)
+		for it.Next() {
+			if err = encode(it.Log()); err != nil {
+				break
+			}
+		}
+		it.Close()
+		if err == nil {
+			err = it.Err()
+		}
+	}
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err == nil && buffered != nil {
+		if err = buffered.Flush(); err == nil {
+			err = file.Close()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser query: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// formatGroups describes the groups of --group-by, a line per group with its most common messages under it
+func formatGroups(groups []logquery.Group) string {
+	b := &strings.Builder{}
+	for _, group := range groups {
+		for i, value := range group.Values {
+			if value == "" {
+				group.Values[i] = "-"
+			}
+		}
+		fmt.Fprintf(b, "%7d  %s\n", group.Count, strings.Join(group.Values, " "))
+		for _, message := range group.Messages {
+			fmt.Fprintf(b, "%7s  %5d  %s\n", "", message.Count, message.Message)
+		}
+	}
+	return b.String()
+}
+
+// formatStats describes how many logs matched a query for --stats
+func formatStats(result *logquery.QueryResult) string {
+	keys := []string{}
+	for key := range result.KeyCounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	counts := make([]string, len(keys))
+	for i, key := range keys {
+		counts[i] = fmt.Sprintf("%s %d", key, result.KeyCounts[key])
+	}
+	shown := "every one shown"
+	if result.Truncated {
+		shown = fmt.Sprintf("%d shown", len(result.Logs))
+	}
+	return fmt.Sprintf("%d logs matched (%s), %s, read %d bytes in %s",
+		result.Matched, strings.Join(counts, ", "), shown, result.BytesRead, result.Duration.Round(time.Microsecond))
+}
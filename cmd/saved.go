@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/screenshotjy/logquery/pkg/saved"
+)
+
+const savedUsage = `usage: logparser saved <list|add|delete> [flags] [args]
+
+  list                       print the saved queries
+  add [-d text] NAME QUERY   save QUERY as NAME, replacing any query with that name
+  delete NAME                delete the query saved as NAME
+
+Run a saved query with logparser query --saved NAME.
+`
+
+func runSaved(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, savedUsage)
+		return 2
+	}
+	action := args[0]
+	switch action {
+	case "list", "add", "delete":
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, savedUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "logparser saved: unknown action %q\n\n%s", action, savedUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("logparser saved "+action, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("saved-file", saved.DefaultPath(), "file of the saved queries")
+	description := fs.String("d", "", "what the query is for, shown by list")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser saved: %s\n", err)
+		return 2
+	}
+	wantArgs := map[string]int{"list": 0, "add": 2, "delete": 1}[action]
+	if fs.NArg() != wantArgs {
+		return fail(fmt.Errorf("%s takes %d arguments, got %d", action, wantArgs, fs.NArg()))
+	}
+	if *description != "" && action != "add" {
+		return fail(fmt.Errorf("-d can only be used with add"))
+	}
+	store := saved.Open(*file)
+
+	var err error
+	switch action {
+	case "list":
+		err = listSaved(store, stdout)
+	case "add":
+		if err = store.Save(fs.Arg(0), saved.Query{Query: fs.Arg(1), Description: *description}); err == nil {
+			fmt.Fprintf(stdout, "saved %s to %s\n", fs.Arg(0), store.Path())
+		}
+	case "delete":
+		err = store.Delete(fs.Arg(0))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+// listSaved prints the saved queries sorted by name
+func listSaved(store *saved.Store, stdout io.Writer) error {
+	queries, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(queries) == 0 {
+		fmt.Fprintf(stdout, "no saved queries in %s\n", store.Path())
+		return nil
+	}
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "%s: %s\n", name, queries[name].Query)
+		if queries[name].Description != "" {
+			fmt.Fprintf(stdout, "  %s\n", queries[name].Description)
+		}
+	}
+	return nil
+}
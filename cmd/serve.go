@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/saved"
+	"github.com/screenshotjy/logquery/pkg/server"
+)
+
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	refresh := fs.Duration("refresh", 0, "read lines appended to the files this often, reloading files that were truncated or replaced by rotation. 0 only reads them on start")
+	retainEntries := fs.Int("retain-entries", 0, "keep at most this many of the newest logs of every key in memory, 0 keeps every log")
+	retainAge := fs.Duration("retain-age", 0, "drop the logs of a key this much older than its newest log, e.g. 24h. 0 keeps every log")
+	queryTimeout := fs.Duration("query-timeout", 0, "stop a query after this long and return the logs it found so far flagged as limited, 0 means no limit")
+	maxScanBytes := fs.Int64("max-scan-bytes", 0, "stop a query after it looked at this many bytes of logs, 0 means no limit")
+	maxMatches := fs.Int("max-matches", 0, "stop a query after it found this many matching logs, counting past the page for stats and group_by. 0 means no limit")
+	savedFile := fs.String("saved-file", "", "file of saved queries to serve under /saved and run with saved=<name>, e.g. the one of logparser saved")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "logparser serve: unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+	opts, err := sources.options()
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser serve: %s\n", err)
+		return 2
+	}
+	if *refresh < 0 || *retainEntries < 0 || *retainAge < 0 {
+		fmt.Fprintf(stderr, "logparser serve: --refresh, --retain-entries and --retain-age can't be negative\n")
+		return 2
+	}
+	if *queryTimeout < 0 || *maxScanBytes < 0 || *maxMatches < 0 {
+		fmt.Fprintf(stderr, "logparser serve: --query-timeout, --max-scan-bytes and --max-matches can't be negative\n")
+		return 2
+	}
+	if *retainEntries > 0 || *retainAge > 0 {
+		opts = append(opts, logquery.WithRetention(logquery.Retention{MaxEntries: *retainEntries, MaxAge: *retainAge}))
+	}
+
+	logQuery := sources.load(context.Background(), "serve", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+
+	if *refresh > 0 {
+		// Keys that fail keep serving their old logs until a later refresh works
+		go func() {
+			ticker := time.NewTicker(*refresh)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := logQuery.Refresh(context.Background()); err != nil {
+					fmt.Fprintf(stderr, "logparser serve: %s\n", err)
+				}
+			}
+		}()
+	}
+
+	s := server.New(logQuery)
+	s.SetQueryLimits(logquery.QueryLimits{MaxScanBytes: *maxScanBytes, MaxMatches: *maxMatches, Timeout: *queryTimeout})
+	if *savedFile != "" {
+		s.UseSavedQueries(saved.Open(*savedFile))
+	}
+	fmt.Fprintf(stdout, "listening on %s\n", *addr)
+	if err := http.ListenAndServe(*addr, s); err != nil {
+		fmt.Fprintf(stderr, "logparser serve: %s\n", err)
+		return 1
+	}
+	return 0
+}
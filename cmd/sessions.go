@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/analyze"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+func runSessions(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser sessions", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	timeRange := timeRange{}
+	keys := fs.String("keys", "", "comma separated keys to read, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	fs.DurationVar(&timeRange.since, "since", 0, "only read logs from this long ago, e.g. 24h")
+	fs.StringVar(&timeRange.start, "start", "", "only read logs after this RFC3339 time")
+	fs.StringVar(&timeRange.end, "end", "", "only read logs before this RFC3339 time")
+	field := fs.String("field", "", "structured field identifying a session, e.g. user or ip")
+	gap := fs.Duration("gap", 30*time.Minute, "idle time after which the next log of an identifier starts a new session")
+	id := fs.String("id", "", "only show the sessions of this identifier")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser sessions: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if *field == "" {
+		return fail(fmt.Errorf("--field is required"))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	if *gap <= 0 {
+		return fail(fmt.Errorf("--gap must be positive"))
+	}
+	start, end, err := timeRange.resolve(time.Now())
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "sessions", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	sessionKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	queryOpts := []logquery.QueryOption{logquery.WithKeys(sessionKeys...), logquery.WithStart(start), logquery.WithEnd(end)}
+	if *id != "" {
+		queryOpts = append(queryOpts, logquery.FieldEquals(*field, *id))
+	}
+	sessions, skipped, err := analyze.Sessions(ctx, logQuery, *field, *gap, queryOpts...)
+	// Keys that failed are reported but don't hide the sessions of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser sessions: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+	if len(sessions) == 0 {
+		fmt.Fprintf(stderr, "logparser sessions: no logs had a %s field\n", *field)
+		return 0
+	}
+	rows := [][]string{{*field, "start", "end", "duration", "events", "errors", "keys"}}
+	for _, s := range sessions {
+		rows = append(rows, []string{s.ID, s.Start.Format(statsTime), s.End.Format(statsTime), s.Duration().String(),
+			strconv.Itoa(s.Events), strconv.Itoa(s.Counts[logquery.Error] + s.Counts[logquery.Fatal]), strings.Join(s.Keys, ",")})
+	}
+	fmt.Fprint(stdout, formatTable(rows[0], rows[1:]))
+	if skipped > 0 {
+		fmt.Fprintf(stderr, "skipped %d logs without a %s field\n", skipped, *field)
+	}
+	return 0
+}
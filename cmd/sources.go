@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/config"
+	"github.com/screenshotjy/logquery/pkg/kafka"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// kafkaSource reads kafka:// paths, it is shared so refreshes and tails only fetch new messages
+var kafkaSource = &kafka.Source{}
+
+// sourceFlags are the flags shared by every command that loads log files
+type sourceFlags struct {
+	files      fileFlag
+	keyFiles   fileFlag
+	fileZones  fileFlag
+	clocks     fileFlag
+	labels     fileFlag
+	extract    fileFlag
+	extractKV  string
+	skewField  string
+	skewRef    string
+	levels     fileFlag
+	redactPats fileFlag
+	redact     string
+	relevel    listFlag
+	stdinKey   string
+	config     string
+	duplicates string
+	mergeGlobs bool
+	rotated    bool
+	cacheDir   string
+	strict     bool
+	lenient    bool
+	stripANSI  bool
+	chunkSize  int
+	workers    int
+	largeFile  int64
+	parallel   int
+	maxLine    int
+}
+
+func (s *sourceFlags) register(fs *flag.FlagSet) {
+	s.files = fileFlag{}
+	s.keyFiles = fileFlag{}
+	s.fileZones = fileFlag{}
+	s.clocks = fileFlag{}
+	s.labels = fileFlag{}
+	s.extract = fileFlag{}
+	s.levels = fileFlag{}
+	s.redactPats = fileFlag{}
+	fs.Var(s.files, "file", "log file to read as key=path, can be repeated. The path can be a directory or glob")
+	fs.Var(s.keyFiles, "files", "comma separated files read under one key and merged in time order as key=path,path, e.g. api=api-1.log,api-2.log. Can be repeated")
+	fs.StringVar(&s.config, "config", "", "YAML file declaring the sources to read and their formats, used along with any --file")
+	fs.StringVar(&s.stdinKey, "stdin-key", "", "read logs piped to stdin under this key, the same as --file key=-")
+	fs.StringVar(&s.duplicates, "duplicates", "error", "what to do when globs put files under a key twice or a file is under two keys: error, merge them under the key or override with the last one")
+	fs.BoolVar(&s.mergeGlobs, "merge-globs", false, "keep every file of a directory or glob under its --file key")
+	fs.BoolVar(&s.strict, "strict", false, "exit as soon as any file fails to load instead of skipping it")
+	fs.BoolVar(&s.rotated, "rotated", false, "also read rotated copies like app.log.1 and app.log.2.gz under the key of their file")
+	fs.StringVar(&s.cacheDir, "cache-dir", "", "keep parsed files in this directory so the next run only parses files that changed")
+	fs.BoolVar(&s.lenient, "lenient", false, "keep lines that can't be parsed, like stack traces, at the time of the log before them")
+	fs.BoolVar(&s.stripANSI, "strip-ansi", false, "remove ANSI escape sequences like colors from every line before it is parsed")
+	fs.Var(s.levels, "level-alias", "extra level name for the default format as name=level, e.g. WARNING=warn or TRACE=debug. Can be repeated")
+	fs.StringVar(&s.redact, "redact", "", "comma separated data to scrub from every log before it is shown, exported or served: email, ip and credit-card")
+	fs.Var(s.redactPats, "redact-pattern", "name=regex of extra data to scrub, replaced with [name]. Can be repeated")
+	fs.Var(&s.relevel, "relevel", "change the level of logs whose message matches as from:to=regex, e.g. error:warn=deprecated, or to=regex for logs at any level. Can be repeated, the first matching rule wins")
+	fs.Var(s.fileZones, "file-tz", "time zone of a file's timestamps as key=zone, e.g. db=America/New_York. Can be repeated")
+	fs.Var(s.clocks, "clock-offset", "duration added to a file's timestamps when its host's clock runs behind as key=offset, e.g. db=2s or db=-500ms. Can be repeated")
+	fs.Var(s.labels, "key-label", "comma separated labels of a key as key=name=value, e.g. api=env=prod,region=eu, picked by query --selector. Can be repeated for other keys")
+	fs.Var(s.extract, "extract", "key=regex whose named groups become fields of the key's logs, e.g. 'api=took (?P<duration_ms>\\d+)ms'. Can be repeated")
+	fs.StringVar(&s.extractKV, "extract-kv", "", "comma separated keys whose messages have every key=value pair in them turned into fields")
+	fs.StringVar(&s.skewField, "skew-field", "", "estimate clock offsets from logs sharing a value of this field, like request_id, against --skew-reference")
+	fs.StringVar(&s.skewRef, "skew-reference", "", "key whose clock the others are corrected to with --skew-field")
+	fs.IntVar(&s.chunkSize, "chunk-size", 0, "read files in chunks of this many bytes parsed in parallel, 0 reads line by line")
+	fs.IntVar(&s.workers, "parse-workers", runtime.NumCPU(), "number of chunks parsed in parallel with --chunk-size")
+	fs.Int64Var(&s.largeFile, "large-file", 64<<20, "files with at least this many bytes to read are parsed in chunks on every CPU without --chunk-size, 0 reads them line by line")
+	fs.IntVar(&s.maxLine, "max-line-length", 1<<20, "lines longer than this many bytes are cut and end with [truncated]")
+	fs.IntVar(&s.parallel, "parallel-files", 32, "max number of files read at once, 0 reads every key at once")
+}
+
+// options validates the flags and turns them into options for NewLogQuery
+func (s *sourceFlags) options() ([]logquery.Option, error) {
+	opts := []logquery.Option{}
+	// listed are the keys registered with WithKeyPaths instead of files
+	listed := map[string]bool{}
+	if s.config != "" {
+		c, err := config.Load(s.config)
+		if err != nil {
+			return nil, err
+		}
+		if opts, err = c.Options(); err != nil {
+			return nil, fmt.Errorf("bad config %s, %s", s.config, err)
+		}
+		mapping := c.Mapping()
+		for key := range c.Sources {
+			if _, ok := s.files[key]; ok {
+				return nil, fmt.Errorf("key %q is used more than once", key)
+			}
+			if path, ok := mapping[key]; ok {
+				s.files[key] = path
+			} else {
+				listed[key] = true
+			}
+		}
+	}
+	if s.stdinKey != "" {
+		if _, ok := s.files[s.stdinKey]; ok || listed[s.stdinKey] {
+			return nil, fmt.Errorf("key %q is used more than once", s.stdinKey)
+		}
+		s.files[s.stdinKey] = "-"
+	}
+	for key, paths := range s.keyFiles {
+		if _, ok := s.files[key]; ok || listed[key] {
+			return nil, fmt.Errorf("key %q is used more than once", key)
+		}
+		opts = append(opts, logquery.WithKeyPaths(key, strings.Split(paths, ",")...))
+		listed[key] = true
+	}
+	if len(s.files)+len(listed) == 0 {
+		return nil, fmt.Errorf("at least one --file, --files, --stdin-key or --config source is required")
+	}
+
+	if s.mergeGlobs {
+		opts = append(opts, logquery.WithMergedGlobs())
+	}
+	duplicates, err := logquery.ParseDuplicatePolicy(s.duplicates)
+	if err != nil {
+		return nil, fmt.Errorf("bad --duplicates, %s", err)
+	}
+	opts = append(opts, logquery.WithDuplicatePolicy(duplicates))
+	if s.strict {
+		opts = append(opts, logquery.WithFailFast())
+	}
+	if s.rotated {
+		opts = append(opts, logquery.WithRotatedFiles())
+	}
+	if s.cacheDir != "" {
+		opts = append(opts, logquery.WithCache(s.cacheDir))
+	}
+	if s.lenient {
+		opts = append(opts, logquery.WithLenientParsing())
+	}
+	if s.stripANSI {
+		opts = append(opts, logquery.WithStripANSI())
+	}
+	if s.chunkSize < 0 || s.workers < 1 {
+		return nil, fmt.Errorf("--chunk-size can't be negative and --parse-workers must be positive")
+	}
+	if s.chunkSize > 0 {
+		opts = append(opts, logquery.WithChunkedParsing(s.chunkSize, s.workers))
+	}
+	if s.largeFile < 0 {
+		return nil, fmt.Errorf("--large-file can't be negative")
+	}
+	opts = append(opts, logquery.WithLargeFileParsing(s.largeFile))
+	if s.maxLine <= 0 {
+		return nil, fmt.Errorf("--max-line-length must be positive")
+	}
+	opts = append(opts, logquery.WithMaxLineLength(s.maxLine))
+	if s.parallel < 0 {
+		return nil, fmt.Errorf("--parallel-files can't be negative")
+	}
+	if s.parallel > 0 {
+		opts = append(opts, logquery.WithParallelism(s.parallel))
+	}
+	if len(s.levels) > 0 {
+		names := map[string]logquery.LogLevel{}
+		for name, level := range s.levels {
+			severity, err := logquery.ParseLevel(level)
+			if err != nil {
+				return nil, fmt.Errorf("bad --level-alias for %s, %s", name, err)
+			}
+			names[name] = severity
+		}
+		aliases, err := logquery.NewSeverityMap(names)
+		if err != nil {
+			return nil, fmt.Errorf("bad --level-alias, %s", err)
+		}
+		opts = append(opts, logquery.WithSeverityAliases(aliases))
+	}
+	redactors := []logquery.Redactor{}
+	if s.redact != "" {
+		for _, name := range strings.Split(s.redact, ",") {
+			redactor, ok := logquery.BuiltinRedactors[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown --redact %q, expected email, ip or credit-card", name)
+			}
+			redactors = append(redactors, redactor)
+		}
+	}
+	// Sorted so the cache sees the same redactors every run
+	names := []string{}
+	for name := range s.redactPats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pattern, err := regexp.Compile(s.redactPats[name])
+		if err != nil {
+			return nil, fmt.Errorf("bad --redact-pattern for %s, %s", name, err)
+		}
+		redactors = append(redactors, logquery.Redactor{Name: name + "=" + pattern.String(), Pattern: pattern, Replacement: "[" + name + "]"})
+	}
+	if len(redactors) > 0 {
+		opts = append(opts, logquery.WithRedactors(redactors...))
+	}
+	if len(s.relevel) > 0 {
+		rules := []logquery.LevelRule{}
+		for _, value := range s.relevel {
+			rule, err := logquery.ParseLevelRule(value)
+			if err != nil {
+				return nil, fmt.Errorf("bad --relevel, %s", err)
+			}
+			rules = append(rules, rule)
+		}
+		opts = append(opts, logquery.WithLevelRules(rules...))
+	}
+	for key, zone := range s.fileZones {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("bad --file-tz for %s, %s", key, err)
+		}
+		opts = append(opts, logquery.WithLocation(key, loc))
+	}
+	for key, value := range s.clocks {
+		offset, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("bad --clock-offset for %s, %s", key, err)
+		}
+		opts = append(opts, logquery.WithClockOffset(key, offset))
+	}
+	for key, value := range s.labels {
+		labels, err := parseLabels(value)
+		if err != nil {
+			return nil, fmt.Errorf("bad --key-label for %s, %s", key, err)
+		}
+		opts = append(opts, logquery.WithLabels(key, labels))
+	}
+	for key, pattern := range s.extract {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad --extract for %s, %s", key, err)
+		}
+		opts = append(opts, logquery.WithFieldExtraction(key, logquery.RegexFields{Pattern: re}))
+	}
+	if s.extractKV != "" {
+		for _, key := range strings.Split(s.extractKV, ",") {
+			opts = append(opts, logquery.WithFieldExtraction(strings.TrimSpace(key), logquery.KeyValueFields{}))
+		}
+	}
+	if (s.skewField == "") != (s.skewRef == "") {
+		return nil, fmt.Errorf("--skew-field and --skew-reference have to be used together")
+	}
+	if s.skewField != "" {
+		opts = append(opts, logquery.WithEstimatedClockOffsets(s.skewField, s.skewRef))
+	}
+	opts = append(opts, logquery.WithSource(kafka.Scheme, kafkaSource))
+	return opts, nil
+}
+
+// parseLabels parses comma separated name=value labels
+func parseLabels(value string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("expected name=value, got %q", pair)
+		}
+		labels[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return labels, nil
+}
+
+// load loads the files. Files that fail are reported on stderr and skipped unless --strict is set, in
+// which case nil is returned
+func (s *sourceFlags) load(ctx context.Context, command string, opts []logquery.Option, stderr io.Writer) *logquery.LogQuery {
+	logQuery, err := logquery.NewLogQuery(ctx, s.files, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser %s: %s\n", command, err)
+	}
+	return logQuery
+}
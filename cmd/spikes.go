@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/analyze"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+func runSpikes(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser spikes", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	timeRange := timeRange{}
+	keys := fs.String("keys", "", "comma separated keys to check, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	fs.DurationVar(&timeRange.since, "since", 0, "only check logs from this long ago, e.g. 24h")
+	fs.StringVar(&timeRange.start, "start", "", "only check logs after this RFC3339 time")
+	fs.StringVar(&timeRange.end, "end", "", "only check logs before this RFC3339 time")
+	bucket := fs.Duration("bucket", time.Minute, "size of the buckets errors are counted in")
+	baseline := fs.Int("baseline", 30, "number of buckets before a bucket its usual error rate is averaged over")
+	factor := fs.Float64("factor", 3, "how many times its usual errors a bucket needs to be a spike")
+	minErrors := fs.Int("min-errors", 5, "fewest errors a bucket needs to be a spike")
+	minLevel := fs.String("min-level", "error", "lowest level counted as an error")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser spikes: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	if *bucket <= 0 || *baseline <= 0 || *factor <= 0 || *minErrors <= 0 {
+		return fail(fmt.Errorf("--bucket, --baseline, --factor and --min-errors must be positive"))
+	}
+	level, err := logquery.ParseLevel(*minLevel)
+	if err != nil {
+		return fail(err)
+	}
+	start, end, err := timeRange.resolve(time.Now())
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "spikes", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	spikeKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	detector := analyze.Detector{Bucket: *bucket, Baseline: *baseline, Factor: *factor, MinErrors: *minErrors, Level: level}
+	spikes, err := detector.Run(ctx, logQuery, start, end, spikeKeys)
+	// Keys that failed are reported but don't hide the spikes of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser spikes: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+	for _, spike := range spikes {
+		fmt.Fprintf(stdout, "%s (%d errors, usually %.1f per %s)\n", spike, spike.Errors, spike.Baseline, *bucket)
+	}
+	return 0
+}
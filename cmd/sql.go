@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/logsql"
+)
+
+func runSQL(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser sql", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: logparser sql [flags] STATEMENT\n\nSTATEMENT is a SELECT over the logs table, e.g.\n\n"+
+			"  SELECT key, count(*) FROM logs WHERE level >= 'error' GROUP BY key\n\n")
+		fs.PrintDefaults()
+	}
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	output := fs.String("output", "table", "output format: table or csv")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser sql: %s\n", err)
+		return 2
+	}
+	if fs.NArg() != 1 {
+		return fail(fmt.Errorf("expected a single quoted statement, got %d arguments", fs.NArg()))
+	}
+	if *output != "table" && *output != "csv" {
+		return fail(fmt.Errorf("bad --output %q, expected table or csv", *output))
+	}
+	stmt, err := logsql.Parse(fs.Arg(0))
+	if err != nil {
+		return fail(fmt.Errorf("bad statement, %s", err))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "sql", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	result, err := stmt.Run(ctx, logQuery)
+	// Keys that failed are reported but don't hide the rows of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser sql: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+
+	rows := make([][]string, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = make([]string, len(row))
+		for j, v := range row {
+			rows[i][j] = logsql.Format(v)
+		}
+	}
+	if *output == "csv" {
+		w := csv.NewWriter(stdout)
+		w.Write(result.Columns)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			fmt.Fprintf(stderr, "logparser sql: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprint(stdout, formatTable(result.Columns, rows))
+	return 0
+}
+
+// formatTable lines up the columns of rows under a header, the last column isn't padded so long
+// messages don't leave trailing spaces
+func formatTable(header []string, rows [][]string) string {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	b := &strings.Builder{}
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if i == len(row)-1 {
+				b.WriteString(cell)
+				break
+			}
+			b.WriteString(cell + strings.Repeat(" ", widths[i]-len([]rune(cell))+2))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// statsTime is how times are shown by stats
+const statsTime = "2006-01-02 15:04:05"
+
+func runStats(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser stats", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	keys := fs.String("keys", "", "comma separated keys to summarize, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser stats: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "stats", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	statsKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	stats, err := logQuery.Stats(ctx, statsKeys)
+	// Keys that failed are reported but don't hide the stats of the others
+	var loadErr *logquery.LoadError
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser stats: %s\n", err)
+		if !errors.As(err, &loadErr) {
+			return 1
+		}
+	}
+	sort.Strings(statsKeys)
+	separator := ""
+	for _, key := range statsKeys {
+		if keyStats, ok := stats[key]; ok {
+			fmt.Fprint(stdout, separator+formatKeyStats(key, keyStats))
+			separator = "\n"
+		}
+	}
+	return 0
+}
+
+// formatKeyStats describes the stats of a key on a line per stat
+func formatKeyStats(key string, stats logquery.KeyStats) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s\n", key)
+	fmt.Fprintf(b, "  lines    %d, %d failed to parse\n", stats.Lines(), stats.Failed)
+	if stats.Logs == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(b, "  span     %s to %s (%s)\n", stats.First.Format(statsTime), stats.Last.Format(statsTime), stats.Span())
+	levels := []logquery.LogLevel{}
+	for level := range stats.Counts {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+	counts := make([]string, len(levels))
+	for i, level := range levels {
+		counts[i] = fmt.Sprintf("%s %d", strings.ToLower(level.String()), stats.Counts[level])
+	}
+	fmt.Fprintf(b, "  levels   %s\n", strings.Join(counts, ", "))
+	fmt.Fprintf(b, "  busiest  %s with %d logs\n", stats.BusiestMinute.Format("2006-01-02 15:04"), stats.BusiestCount)
+	fmt.Fprintf(b, "  length   %.1f bytes per message on average\n", stats.AverageLength())
+	return b.String()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/alert"
+	"github.com/screenshotjy/logquery/pkg/analyze"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+func runTail(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("logparser tail", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	sources := sourceFlags{}
+	sources.register(fs)
+	keys := fs.String("keys", "", "comma separated keys to follow, defaults to every --file. Patterns like * or web-* match several keys")
+	exclude := fs.String("exclude", "", "comma separated keys or patterns to leave out")
+	lines := fs.Int("n", 10, "number of existing logs to show first")
+	follow := fs.Bool("f", false, "keep printing logs as they are appended until interrupted")
+	minLevel := fs.String("min-level", "", "lowest level to show: debug, info, warn, error or fatal. Defaults to every log")
+	maxLevel := fs.String("max-level", "", "highest level to show. Defaults to every level")
+	colorMode := fs.String("color", "auto", "color severities: auto, always or never. auto colors only when writing to a terminal")
+	formatTemplate := fs.String("format", "", `Go template every log is printed with, e.g. '{{.Time.Format "15:04:05"}} {{.Key}} {{.SeverityString}} {{.Log}}'`)
+	showPath := fs.Bool("show-path", false, "put the file every log was read from in front of it, with the line for the last -n logs")
+	alerts := fs.String("alerts", "", "YAML file of alert rules to check the followed logs against, running their webhook, slack, pagerduty or exec actions when one fires. Needs -f")
+	notifyOn := fs.String("notify-on", "", "level of new logs to send a notification for, e.g. fatal. Needs -f and a --notify-* destination")
+	notifyWebhook := fs.String("notify-webhook", "", "url --notify-on logs are POSTed to as JSON")
+	notifySlack := fs.String("notify-slack", "", "url of a Slack incoming webhook --notify-on logs are posted to")
+	notifyPagerDuty := fs.String("notify-pagerduty", "", "routing key of a PagerDuty service --notify-on logs trigger an incident for")
+	notifyCooldown := fs.Duration("notify-cooldown", time.Minute, "how long to wait after a --notify-on notification before sending another")
+	maxPerPattern := fs.Int("max-per-pattern", 0, "show at most this many followed logs of the same key and pattern per --pattern-window, with a line counting the rest. Needs -f, 0 shows every log")
+	patternWindow := fs.Duration("pattern-window", time.Minute, "window --max-per-pattern counts logs in")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "logparser tail: %s\n", err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	opts, err := sources.options()
+	if err != nil {
+		return fail(err)
+	}
+	opts = append(opts, logquery.WithTailErrors(func(path string, err error) {
+		fmt.Fprintf(stderr, "logparser tail: reading %s failed, %s\n", path, err)
+	}))
+	if *lines < 0 {
+		return fail(fmt.Errorf("-n can't be negative"))
+	}
+	level, ceiling, err := levelRange(*minLevel, *maxLevel)
+	if err != nil {
+		return fail(err)
+	}
+	color, err := useColor(*colorMode, stdout)
+	if err != nil {
+		return fail(err)
+	}
+	var encoder logquery.Encoder = &textEncoder{w: stdout, style: textStyle{color: color, path: *showPath}}
+	if *formatTemplate != "" {
+		if encoder, err = logquery.NewTemplateEncoder(*formatTemplate, stdout); err != nil {
+			return fail(fmt.Errorf("bad --format, %s", err))
+		}
+	}
+	rules := []alert.Rule{}
+	if *alerts != "" {
+		if rules, err = alert.Load(*alerts); err != nil {
+			return fail(err)
+		}
+	}
+	notifiers := []alert.Notifier{}
+	if *notifyWebhook != "" {
+		notifiers = append(notifiers, &alert.Webhook{URL: *notifyWebhook})
+	}
+	if *notifySlack != "" {
+		notifiers = append(notifiers, &alert.Slack{URL: *notifySlack})
+	}
+	if *notifyPagerDuty != "" {
+		notifiers = append(notifiers, &alert.PagerDuty{RoutingKey: *notifyPagerDuty})
+	}
+	if *notifyOn != "" && len(notifiers) == 0 {
+		return fail(fmt.Errorf("--notify-on needs --notify-webhook, --notify-slack or --notify-pagerduty"))
+	}
+	if *notifyOn == "" && len(notifiers) > 0 {
+		return fail(fmt.Errorf("--notify-webhook, --notify-slack and --notify-pagerduty need --notify-on"))
+	}
+	if *notifyOn != "" {
+		notifyLevel, err := logquery.ParseLevel(*notifyOn)
+		if err != nil {
+			return fail(fmt.Errorf("bad --notify-on, %s", err))
+		}
+		if *notifyCooldown < 0 {
+			return fail(fmt.Errorf("--notify-cooldown can't be negative"))
+		}
+		level := strings.ToLower(notifyLevel.String())
+		rules = append(rules, alert.Rule{Name: level, Query: "level>=" + level, Cooldown: *notifyCooldown, Notifiers: notifiers})
+	}
+	if *maxPerPattern < 0 {
+		return fail(fmt.Errorf("--max-per-pattern can't be negative"))
+	}
+	if *maxPerPattern > 0 && !*follow {
+		return fail(fmt.Errorf("--max-per-pattern needs -f"))
+	}
+	if *patternWindow <= 0 {
+		return fail(fmt.Errorf("--pattern-window must be positive"))
+	}
+	var engine *alert.Engine
+	if len(rules) > 0 {
+		if !*follow {
+			return fail(fmt.Errorf("--alerts and --notify-on need -f"))
+		}
+		if engine, err = alert.New(rules); err != nil {
+			return fail(err)
+		}
+		engine.OnError = func(a alert.Alert, err error) {
+			fmt.Fprintf(stderr, "logparser tail: notifying alert %s failed, %s\n", a.Rule.Name, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logQuery := sources.load(ctx, "tail", opts, stderr)
+	if logQuery == nil {
+		return 1
+	}
+	tailKeys, err := splitKeys(*keys, *exclude, logQuery.Keys())
+	if err != nil {
+		return fail(err)
+	}
+
+	if *lines > 0 {
+		logs, err := logQuery.QueryLogs(ctx, logquery.WithKeys(tailKeys...), logquery.WithMinSeverity(level), logquery.WithMaxSeverity(ceiling), logquery.WithLimit(*lines), logquery.WithDescending())
+		if err != nil {
+			fmt.Fprintf(stderr, "logparser tail: %s\n", err)
+			return 1
+		}
+		for i := len(logs) - 1; i >= 0; i-- {
+			if err := encoder.Encode(logs[i]); err != nil {
+				fmt.Fprintf(stderr, "logparser tail: %s\n", err)
+				return 1
+			}
+		}
+	}
+	if !*follow {
+		return 0
+	}
+	show := func(log logquery.Log) {
+		if err := encoder.Encode(log); err != nil {
+			fmt.Fprintf(stderr, "logparser tail: %s\n", err)
+		}
+	}
+	if *maxPerPattern > 0 {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		var done func()
+		show, done = throttled(analyze.NewThrottle(*maxPerPattern, *patternWindow), show, stdout, time.Now, ticker.C)
+		defer done()
+	}
+
+	if engine != nil {
+		// The rules see every log, the levels only pick the ones shown
+		logs, err := logQuery.Tail(ctx, tailKeys, logquery.Undefined)
+		if err != nil {
+			fmt.Fprintf(stderr, "logparser tail: %s\n", err)
+			return 1
+		}
+		for log := range logs {
+			for _, a := range engine.Observe(ctx, log) {
+				fmt.Fprintln(stderr, a)
+			}
+			if log.Severity >= level && (ceiling == logquery.Undefined || log.Severity <= ceiling) {
+				show(log)
+			}
+		}
+		engine.Wait()
+		return 0
+	}
+
+	logs, err := logQuery.Tail(ctx, tailKeys, level)
+	if err != nil {
+		fmt.Fprintf(stderr, "logparser tail: %s\n", err)
+		return 1
+	}
+	for log := range capLevel(logs, ceiling) {
+		show(log)
+	}
+	return 0
+}
+
+// throttled wraps show to hold back logs over the throttle's limit. A line counting the logs of a pattern
+// that were held back is printed to out once its window ends, checked on every tick, and for every
+// pattern when done is called. now is the clock logs are counted with
+func throttled(throttle *analyze.Throttle, show func(logquery.Log), out io.Writer, now func() time.Time, ticks <-chan time.Time) (func(logquery.Log), func()) {
+	mutex := sync.Mutex{}
+	printSuppressed := func(suppressed []analyze.Suppressed) {
+		for _, s := range suppressed {
+			fmt.Fprintln(out, logquery.Sanitize(s.String()))
+		}
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticks:
+				mutex.Lock()
+				printSuppressed(throttle.Flush(now()))
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	throttledShow := func(log logquery.Log) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		at := now()
+		// Windows that ended are summed up before a log of a new window is shown
+		printSuppressed(throttle.Flush(at))
+		if throttle.Allow(log, at) {
+			show(log)
+		}
+	}
+	done := func() {
+		close(stop)
+		<-stopped
+		printSuppressed(throttle.FlushAll(now()))
+	}
+	return throttledShow, done
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/analyze"
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailThrottleFlags(t *testing.T) {
+	assert := assert.New(t)
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-f", "--max-per-pattern", "-1"}, "--max-per-pattern can't be negative"},
+		{[]string{"--max-per-pattern", "2"}, "--max-per-pattern needs -f"},
+		{[]string{"-f", "--max-per-pattern", "2", "--pattern-window", "0s"}, "--pattern-window must be positive"},
+	} {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		args := append([]string{"--file", "app=./app.log"}, test.args...)
+		assert.Equal(2, runTail(args, stdout, stderr), test.args)
+		assert.Equal("logparser tail: "+test.err+"\n", stderr.String(), test.args)
+		assert.Empty(stdout.String(), test.args)
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2020, 2, 28, 5, 20, 0, 0, time.UTC)
+	clock := start
+	ticks := make(chan time.Time)
+	out := &bytes.Buffer{}
+	show, done := throttled(analyze.NewThrottle(1, time.Minute), func(log logquery.Log) {
+		fmt.Fprintln(out, log.Log)
+	}, out, func() time.Time { return clock }, ticks)
+
+	for i := 0; i < 3; i++ {
+		show(logquery.Log{Key: "app", Log: "connection refused"})
+	}
+	assert.Equal("connection refused\n", out.String())
+
+	// A tick after the window ended prints what it held back
+	clock = start.Add(2 * time.Minute)
+	ticks <- clock
+	show(logquery.Log{Key: "app", Log: "disk full"})
+	show(logquery.Log{Key: "app", Log: "disk full"})
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(3, len(lines))
+	assert.Equal(`[suppressed] 2 more logs of app like "connection refused" in 1m0s`, lines[1])
+	assert.Equal("disk full", lines[2])
+
+	// Windows that haven't ended are flushed on exit
+	clock = clock.Add(10 * time.Second)
+	done()
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(4, len(lines))
+	assert.Equal(`[suppressed] 1 more logs of app like "disk full" in 10s`, lines[3])
+}
@@ -0,0 +1,396 @@
+// Package aggregator fans queries out to agents, logparser serve processes running next to the log
+// files, and merges their logs in time order so many hosts can be searched as one
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/server"
+)
+
+// maxPageSize is the largest limit an agent accepts in one request, bigger queries are paged
+const maxPageSize = 10000
+
+// Aggregator queries agents by name. Their keys are prefixed with the agent name, so key server1 on agent
+// web1 is queried as web1/server1
+type Aggregator struct {
+	agents map[string]*url.URL
+	client *http.Client
+
+	// pageSize is swapped out in tests
+	pageSize int
+}
+
+// New returns an Aggregator for agents, a map of agent name to the base url it serves on. A nil client
+// uses http.DefaultClient
+func New(agents map[string]string, client *http.Client) (*Aggregator, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	a := &Aggregator{agents: map[string]*url.URL{}, client: client, pageSize: maxPageSize}
+	for name, base := range agents {
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("agent name %q can't be empty or contain /", name)
+		}
+		u, err := url.Parse(base)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("agent %s needs an http url, got %q", name, base)
+		}
+		a.agents[name] = u
+	}
+	return a, nil
+}
+
+// names returns the agent names in order
+func (a *Aggregator) names() []string {
+	names := []string{}
+	for name := range a.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Keys returns the keys of every agent as agent/key. Agents that can't be reached are reported in a
+// *logquery.LoadError along with the keys of the others
+func (a *Aggregator) Keys(ctx context.Context) ([]string, error) {
+	keys := []string{}
+	errs := a.each(ctx, func(name string, agent *url.URL) (func(), error) {
+		rv := map[string][]string{}
+		if err := a.get(ctx, agent, "/keys", nil, &rv); err != nil {
+			return nil, err
+		}
+		return func() {
+			for _, key := range rv["keys"] {
+				keys = append(keys, name+"/"+key)
+			}
+		}, nil
+	})
+	sort.Strings(keys)
+	return keys, errs
+}
+
+// splitKeys groups agent/key keys by agent, the key part can be a pattern like agent/*
+func (a *Aggregator) splitKeys(keys []string) (map[string][]string, error) {
+	rv := map[string][]string{}
+	for _, key := range keys {
+		i := strings.Index(key, "/")
+		if i == -1 || a.agents[key[:i]] == nil {
+			return nil, fmt.Errorf("unknown key %q, keys are agent/key", key)
+		}
+		rv[key[:i]] = append(rv[key[:i]], key[i+1:])
+	}
+	return rv, nil
+}
+
+// QueryLogs sends the query to every agent with one of its keys and merges the results. Cursors and
+// field filters with patterns aren't supported. Agents that fail are reported in a *logquery.LoadError
+// along with the logs of the others
+func (a *Aggregator) QueryLogs(ctx context.Context, opts ...logquery.QueryOption) (logquery.Logs, error) {
+	o := logquery.QueryOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Cursor != "" {
+		return nil, fmt.Errorf("cursors can't be used across agents")
+	}
+	for _, field := range o.Fields {
+		if field.Pattern != nil {
+			return nil, fmt.Errorf("field %s can only be filtered on a value across agents", field.Name)
+		}
+	}
+
+	// Every agent is asked for the whole limit since any of them could have the first logs
+	agentKeys, err := a.splitKeys(o.Keys)
+	if err != nil {
+		return nil, err
+	}
+	agentExclude, err := a.splitKeys(o.ExcludeKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	results := map[string]logquery.Logs{}
+	errs := a.each(ctx, func(name string, agent *url.URL) (func(), error) {
+		keys, ok := agentKeys[name]
+		if o.Keys != nil && !ok {
+			return func() {}, nil
+		}
+		logs, err := a.query(ctx, name, agent, o, keys, agentExclude[name])
+		return func() {
+			results[name] = logs
+		}, err
+	})
+
+	rv := logquery.Logs{}
+	for _, name := range a.names() {
+		rv = append(rv, results[name]...)
+	}
+	// Agents are appended in name order so logs at the same time stay in agent order
+	sort.SliceStable(rv, func(i, j int) bool {
+		if o.Descending {
+			return rv[i].Time.After(rv[j].Time)
+		}
+		return rv[i].Time.Before(rv[j].Time)
+	})
+	if o.TotalLimit > 0 {
+		rv = limitMatches(rv, o.TotalLimit, o.Before, o.After, o.Descending)
+	}
+	return rv, errs
+}
+
+// limitMatches keeps the first limit matches of logs and picks their context again like a local query
+// would, since the agents added context around matches that aren't kept too. Context logs don't count
+// towards the limit, and a match that isn't kept but is next to one that is becomes its context
+func limitMatches(logs logquery.Logs, limit int, before int, after int, descending bool) logquery.Logs {
+	kept := make([]bool, len(logs))
+	matches := 0
+	keys := map[string][]int{}
+	for i, log := range logs {
+		if !log.Context && matches < limit {
+			kept[i] = true
+			matches++
+		}
+		keys[log.Key] = append(keys[log.Key], i)
+	}
+	surrounding := make([]bool, len(logs))
+	for _, indexes := range keys {
+		// Walk every key in file order, an agent sends all the logs that can be context of its matches
+		if descending {
+			for i, j := 0, len(indexes)-1; i < j; i, j = i+1, j-1 {
+				indexes[i], indexes[j] = indexes[j], indexes[i]
+			}
+		}
+		recent := []int{}
+		trailing := 0
+		for _, i := range indexes {
+			switch {
+			case kept[i]:
+				for _, j := range recent {
+					surrounding[j] = true
+				}
+				recent, trailing = recent[:0], after
+			case trailing > 0:
+				surrounding[i] = true
+				trailing--
+			case before > 0:
+				if len(recent) == before {
+					recent = append(recent[:0], recent[1:]...)
+				}
+				recent = append(recent, i)
+			}
+		}
+	}
+
+	rv := logquery.Logs{}
+	for i, log := range logs {
+		if surrounding[i] {
+			log.Context = true
+		}
+		if kept[i] || surrounding[i] {
+			rv = append(rv, log)
+		}
+	}
+	return rv
+}
+
+// each calls fn for every agent concurrently. The func fn returns is called while holding a lock so it
+// can collect results, it is called for agents that partly failed too
+func (a *Aggregator) each(ctx context.Context, fn func(name string, agent *url.URL) (func(), error)) error {
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	errs := map[string]error{}
+	for name, agent := range a.agents {
+		wg.Add(1)
+		go func(name string, agent *url.URL) {
+			defer wg.Done()
+			collect, err := fn(name, agent)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if collect != nil {
+				collect()
+			}
+			if err != nil {
+				errs[name] = err
+			}
+		}(name, agent)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &logquery.LoadError{Errors: errs}
+	}
+	return nil
+}
+
+// query gets up to the limit of logs from one agent, following its cursors when the limit is bigger
+// than an agent returns at once. An agent that failed to load some files still returns the others
+// along with the error. An agent that stopped on its query limits isn't asked for more pages, they
+// would only run into the limits again
+func (a *Aggregator) query(ctx context.Context, name string, agent *url.URL, o logquery.QueryOptions, keys []string, exclude []string) (logquery.Logs, error) {
+	params := queryParams(o, keys, exclude)
+	limit := o.TotalLimit
+	if limit <= 0 {
+		limit = int(^uint(0) >> 1)
+	}
+
+	rv := logquery.Logs{}
+	var loadErr error
+	// Context logs don't count towards the limit, only the matches they were added around
+	matched := 0
+	// lastContext holds the context logs of the last page, the logs between two matches split over pages
+	// are sent with both
+	lastContext := map[string]bool{}
+	for matched < limit {
+		pageSize := limit - matched
+		if pageSize > a.pageSize {
+			pageSize = a.pageSize
+		}
+		params.Set("limit", strconv.Itoa(pageSize))
+
+		page := server.QueryResponse{}
+		if err := a.get(ctx, agent, "/query", params, &page); err != nil {
+			return rv, err
+		}
+		if page.Error != "" {
+			loadErr = errors.New(page.Error)
+		}
+		pageContext := map[string]bool{}
+		for _, record := range page.Logs {
+			if !record.Context {
+				matched++
+			} else {
+				id := fmt.Sprintf("%s\x00%s\x00%d\x00%d", record.Key, record.Path, record.Line, record.Time.UnixNano())
+				pageContext[id] = true
+				if lastContext[id] {
+					continue
+				}
+			}
+			rv = append(rv, fromRecord(name, record))
+		}
+		lastContext = pageContext
+		if page.NextCursor == "" || page.Limited {
+			break
+		}
+		params.Set("cursor", page.NextCursor)
+	}
+	return rv, loadErr
+}
+
+// queryParams turns the options into /query url parameters
+func queryParams(o logquery.QueryOptions, keys []string, exclude []string) url.Values {
+	params := url.Values{}
+	if len(keys) > 0 {
+		params.Set("keys", strings.Join(keys, ","))
+	}
+	if len(exclude) > 0 {
+		params.Set("exclude", strings.Join(exclude, ","))
+	}
+	if !o.Start.IsZero() {
+		params.Set("start", o.Start.Format(time.RFC3339Nano))
+	}
+	if !o.End.IsZero() {
+		params.Set("end", o.End.Format(time.RFC3339Nano))
+	}
+	if o.PerKeyLimit > 0 {
+		params.Set("per_key_limit", strconv.Itoa(o.PerKeyLimit))
+	}
+	if o.MinSeverity != logquery.Undefined {
+		params.Set("min_level", strings.ToLower(o.MinSeverity.String()))
+	}
+	if o.MaxSeverity != logquery.Undefined {
+		params.Set("max_level", strings.ToLower(o.MaxSeverity.String()))
+	}
+	if o.Message != nil {
+		if o.Message.Substring != "" {
+			params.Set("grep", o.Message.Substring)
+		}
+		if o.Message.Pattern != nil {
+			params.Set("regex", o.Message.Pattern.String())
+		}
+	}
+	for _, field := range o.Fields {
+		params.Add("field", field.Name+"="+field.Value)
+	}
+	if o.Descending {
+		params.Set("desc", "true")
+	}
+	if o.CollapseRepeats {
+		params.Set("collapse", "true")
+	}
+	if o.Before > 0 {
+		params.Set("before", strconv.Itoa(o.Before))
+	}
+	if o.After > 0 {
+		params.Set("after", strconv.Itoa(o.After))
+	}
+	// Agents take one rate, the biggest one is sent for the levels sampled at any rate
+	rate, levels := 0, []string{}
+	for level, levelRate := range o.SampleRates {
+		if levelRate > 1 {
+			levels = append(levels, strings.ToLower(level.String()))
+			if levelRate > rate {
+				rate = levelRate
+			}
+		}
+	}
+	if rate > 1 {
+		sort.Strings(levels)
+		params.Set("sample", strconv.Itoa(rate))
+		params.Set("sample_levels", strings.Join(levels, ","))
+	}
+	return params
+}
+
+// get decodes the JSON response of a GET request to an agent into rv
+func (a *Aggregator) get(ctx context.Context, agent *url.URL, path string, params url.Values, rv interface{}) error {
+	u := *agent
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body := struct {
+			Error string `json:"error"`
+		}{}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+			return fmt.Errorf("%s: %s", resp.Status, body.Error)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(rv)
+}
+
+// fromRecord turns a log from an agent back into a Log with its key prefixed by the agent name
+func fromRecord(name string, record logquery.Record) logquery.Log {
+	log := record.Log()
+	log.Key = name + "/" + log.Key
+	// Levels an agent doesn't know stay Undefined but are still shown as the agent sent them
+	if record.Severity != "" {
+		log.SeverityString = "[" + record.Severity + "]"
+	}
+	return log
+}
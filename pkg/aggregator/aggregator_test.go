@@ -0,0 +1,155 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAgent(t *testing.T, key string, path string) *httptest.Server {
+	logQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{key: path})
+	assert.NoError(t, err)
+	agent := httptest.NewServer(server.New(logQuery))
+	t.Cleanup(agent.Close)
+	return agent
+}
+
+func TestAggregator(t *testing.T) {
+	assert := assert.New(t)
+	web := newTestAgent(t, "server1", "../../logs/server1.log")
+	db := newTestAgent(t, "db", "../../logs/db_server.log")
+	a, err := New(map[string]string{"web": web.URL, "db": db.URL + "/"}, nil)
+	assert.NoError(err)
+	a.pageSize = 3
+
+	keys, err := a.Keys(context.Background())
+	assert.NoError(err)
+	assert.Equal([]string{"db/db", "web/server1"}, keys)
+
+	// The logs of both agents are merged in time order like a local query of both files
+	logs, err := a.QueryLogs(context.Background())
+	assert.NoError(err)
+	local, err := logquery.NewLogQuery(context.Background(), map[string]string{
+		"web/server1": "../../logs/server1.log",
+		"db/db":       "../../logs/db_server.log",
+	})
+	assert.NoError(err)
+	want, err := local.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Equal(len(want), len(logs))
+	for i := range logs {
+		assert.True(want[i].Time.Equal(logs[i].Time))
+		assert.Equal(want[i].Key, logs[i].Key)
+		assert.Equal(want[i].Severity, logs[i].Severity)
+		assert.Equal(want[i].Log, logs[i].Log)
+	}
+
+	logs, err = a.QueryLogs(context.Background(), logquery.WithKeys("db/db"), logquery.WithMinSeverity(logquery.Warn),
+		logquery.WithDescending(), logquery.WithLimit(2))
+	assert.NoError(err)
+	assert.Equal(2, len(logs))
+	assert.Equal("Rejecting request: User does not have sufficient quota to create database. ", logs[0].Log)
+	assert.Equal("[warn]", logs[0].SeverityString)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 57, 250000000, time.UTC), logs[0].Time.UTC())
+
+	// Exclusions are sent to the agent the key belongs to
+	logs, err = a.QueryLogs(context.Background(), logquery.WithoutKeys("db/*"))
+	assert.NoError(err)
+	assert.NotEmpty(logs)
+	for _, log := range logs {
+		assert.Equal("web/server1", log.Key)
+	}
+
+	_, err = a.QueryLogs(context.Background(), logquery.WithKeys("db"))
+	assert.Error(err)
+	_, err = a.QueryLogs(context.Background(), logquery.WithoutKeys("db"))
+	assert.Error(err)
+	_, err = New(map[string]string{"a/b": web.URL}, nil)
+	assert.Error(err)
+	_, err = New(map[string]string{"a": "web:8080"}, nil)
+	assert.Error(err)
+}
+
+func TestAggregatorAgentDown(t *testing.T) {
+	assert := assert.New(t)
+	web := newTestAgent(t, "server1", "../../logs/server1.log")
+	down := httptest.NewServer(nil)
+	down.Close()
+	a, err := New(map[string]string{"web": web.URL, "down": down.URL}, nil)
+	assert.NoError(err)
+
+	// The agents that answer still return their logs
+	logs, err := a.QueryLogs(context.Background())
+	var loadErr *logquery.LoadError
+	assert.True(errors.As(err, &loadErr))
+	assert.Contains(loadErr.Errors, "down")
+	assert.Equal(4, len(logs))
+}
+
+func TestFromRecord(t *testing.T) {
+	assert := assert.New(t)
+	at := time.Date(2020, 2, 28, 5, 20, 55, 0, time.UTC)
+	log := fromRecord("web", logquery.Record{Time: at, Key: "server1", Severity: "warn", Message: "slow"})
+	assert.Equal("web/server1", log.Key)
+	assert.Equal(logquery.Warn, log.Severity)
+	assert.Equal("[warn]", log.SeverityString)
+
+	// Levels only the agent knows keep their name
+	log = fromRecord("web", logquery.Record{Time: at, Key: "server1", Severity: "trace", Message: "entering"})
+	assert.Equal(logquery.Undefined, log.Severity)
+	assert.Equal("[trace]", log.SeverityString)
+}
+
+func TestAggregatorContext(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	appPath, workerPath := filepath.Join(dir, "app.log"), filepath.Join(dir, "worker.log")
+	assert.NoError(os.WriteFile(appPath, []byte("[02/28/2020 5:20:50.00][info] a\n"+
+		"[02/28/2020 5:20:51.00][error] boom1\n"+
+		"[02/28/2020 5:20:52.00][info] b\n"+
+		"[02/28/2020 5:20:53.00][info] c\n"+
+		"[02/28/2020 5:20:54.00][error] boom2\n"+
+		"[02/28/2020 5:20:55.00][info] d\n"+
+		"[02/28/2020 5:20:58.00][error] boom4\n"), 0644))
+	assert.NoError(os.WriteFile(workerPath, []byte("[02/28/2020 5:20:51.50][info] x\n"+
+		"[02/28/2020 5:20:56.00][error] boom3\n"+
+		"[02/28/2020 5:20:57.00][info] y\n"), 0644))
+	web := newTestAgent(t, "app", appPath)
+	worker := newTestAgent(t, "worker", workerPath)
+	a, err := New(map[string]string{"web": web.URL, "worker": worker.URL}, nil)
+	assert.NoError(err)
+	a.pageSize = 1
+	local, err := logquery.NewLogQuery(context.Background(), map[string]string{"web/app": appPath, "worker/worker": workerPath})
+	assert.NoError(err)
+
+	// Context logs don't count towards the limit and the last match keeps its context, like a local query
+	for _, limit := range []int{1, 2, 3, 4} {
+		for _, descending := range []bool{false, true} {
+			opts := []logquery.QueryOption{logquery.WithMinSeverity(logquery.Error), logquery.WithContext(1, 1), logquery.WithLimit(limit)}
+			if descending {
+				opts = append(opts, logquery.WithDescending())
+			}
+			logs, err := a.QueryLogs(context.Background(), opts...)
+			assert.NoError(err)
+			want, err := local.QueryLogs(context.Background(), opts...)
+			assert.NoError(err)
+			got, wanted := []string{}, []string{}
+			for _, log := range logs {
+				got = append(got, fmt.Sprintf("%s %s %v", log.Key, log.Log, log.Context))
+			}
+			for _, log := range want {
+				wanted = append(wanted, fmt.Sprintf("%s %s %v", log.Key, log.Log, log.Context))
+			}
+			assert.Equal(wanted, got, "limit %d descending %v", limit, descending)
+		}
+	}
+}
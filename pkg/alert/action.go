@@ -0,0 +1,39 @@
+package alert
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Action is a notifier in a rules file, exactly one of its fields is set
+type Action struct {
+	// Webhook is a url the alert is POSTed to as JSON, see Webhook
+	Webhook string `yaml:"webhook"`
+	// Slack is the url of a Slack incoming webhook the alert is posted to as a message
+	Slack string `yaml:"slack"`
+	// PagerDuty is the routing key of a PagerDuty service an incident is triggered for
+	PagerDuty string `yaml:"pagerduty"`
+	// Exec is a command and its arguments, see Command
+	Exec []string `yaml:"exec"`
+}
+
+// Notifier returns the notifier of the action, sending requests with client
+func (a Action) Notifier(client *http.Client) (Notifier, error) {
+	notifiers := []Notifier{}
+	if a.Webhook != "" {
+		notifiers = append(notifiers, &Webhook{URL: a.Webhook, Client: client})
+	}
+	if a.Slack != "" {
+		notifiers = append(notifiers, &Slack{URL: a.Slack, Client: client})
+	}
+	if a.PagerDuty != "" {
+		notifiers = append(notifiers, &PagerDuty{RoutingKey: a.PagerDuty, Client: client})
+	}
+	if len(a.Exec) > 0 {
+		notifiers = append(notifiers, &Command{Args: a.Exec})
+	}
+	if len(notifiers) != 1 {
+		return nil, fmt.Errorf("an action is one of webhook, slack, pagerduty or exec")
+	}
+	return notifiers[0], nil
+}
@@ -0,0 +1,233 @@
+// Package alert evaluates rules against logs as they are followed and runs actions when one fires, like
+// more than 50 errors from db in 5 minutes or any fatal log
+//
+//	rules:
+//	  db-errors:
+//	    query: level>=error AND key=db
+//	    threshold: 50
+//	    window: 5m
+//	    actions:
+//	      - slack: https://hooks.slack.com/services/...
+//	  fatal:
+//	    query: level=fatal
+//	    cooldown: 1m
+//	    actions:
+//	      - pagerduty: <integration key>
+//	      - exec: [notify-send, logparser]
+//
+// Queries are written in the query language of pkg/querylang without SINCE or time conditions
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/querylang"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxAlertLogs is how many of the latest matching logs an alert carries
+	maxAlertLogs = 10
+	// notifyTimeout is how long a notifier can take before it is cancelled
+	notifyTimeout = 30 * time.Second
+)
+
+// Rule fires when more than Threshold logs match Query within Window
+type Rule struct {
+	// Name is the key of the rule in the rules file
+	Name        string `yaml:"-"`
+	Description string `yaml:"description"`
+	// Query filters the logs counted by the rule, empty counts every log
+	Query string `yaml:"query"`
+	// Threshold is how many matches within Window are allowed, 0 fires on any match
+	Threshold int `yaml:"threshold"`
+	// Window is how far back matches are counted from the latest one, 0 counts only the latest one
+	Window time.Duration `yaml:"window"`
+	// Cooldown is how long after firing the rule stays quiet, defaults to Window
+	Cooldown time.Duration `yaml:"cooldown"`
+	Actions  []Action      `yaml:"actions"`
+	// Notifiers are notified along with Actions, for programs with notifiers of their own
+	Notifiers []Notifier `yaml:"-"`
+}
+
+// file is the contents of a rules file
+type file struct {
+	Rules map[string]Rule `yaml:"rules"`
+}
+
+// Load reads the rules of the file at path sorted by name. Unknown fields are an error so typos don't
+// go unnoticed
+func Load(path string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	f := file{}
+	if err := decoder.Decode(&f); err != nil {
+		return nil, fmt.Errorf("bad rules %s, %s", path, err)
+	}
+	if len(f.Rules) == 0 {
+		return nil, fmt.Errorf("no rules in %s", path)
+	}
+	rv := make([]Rule, 0, len(f.Rules))
+	for name, rule := range f.Rules {
+		rule.Name = name
+		rv = append(rv, rule)
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Name < rv[j].Name })
+	return rv, nil
+}
+
+// Alert is a rule firing
+type Alert struct {
+	Rule Rule
+	// Time is the time of the log that fired the rule
+	Time time.Time
+	// Count is how many logs matched within the window
+	Count int
+	// Logs are the latest of the matching logs, up to 10
+	Logs logquery.Logs
+}
+
+func (a Alert) String() string {
+	if a.Rule.Window == 0 {
+		return fmt.Sprintf("alert %s: %s", a.Rule.Name, a.Logs[len(a.Logs)-1])
+	}
+	return fmt.Sprintf("alert %s: %d logs matched within %s, more than %d", a.Rule.Name, a.Count, a.Rule.Window, a.Rule.Threshold)
+}
+
+// Engine counts the logs it is shown against its rules and notifies the ones that fire. Time is taken
+// from the logs so old logs can be replayed through it too
+type Engine struct {
+	// HTTPClient sends the requests of actions, nil means http.DefaultClient
+	HTTPClient *http.Client
+	// OnError is called when notifying an alert fails, nil drops the failure
+	OnError func(Alert, error)
+
+	mutex   sync.Mutex
+	rules   []*ruleState
+	running sync.WaitGroup
+}
+
+// ruleState is a rule with the matches inside its window
+type ruleState struct {
+	rule   Rule
+	filter *logquery.QueryOptions
+	// times are the times of the matches inside the window, logs the latest of them
+	times      []time.Time
+	logs       logquery.Logs
+	quietUntil time.Time
+}
+
+// New returns an engine for rules, checking that their queries compile
+func New(rules []Rule) (*Engine, error) {
+	e := &Engine{}
+	for _, rule := range rules {
+		filter, err := querylang.Compile(rule.Query, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("bad query of rule %s, %s", rule.Name, err)
+		}
+		if !filter.Start.IsZero() || !filter.End.IsZero() {
+			return nil, fmt.Errorf("rule %s can't have SINCE or time conditions, use window", rule.Name)
+		}
+		if rule.Threshold < 0 || rule.Window < 0 || rule.Cooldown < 0 {
+			return nil, fmt.Errorf("rule %s can't have a negative threshold, window or cooldown", rule.Name)
+		}
+		if rule.Threshold > 0 && rule.Window == 0 {
+			return nil, fmt.Errorf("rule %s needs a window to count its threshold in", rule.Name)
+		}
+		if rule.Cooldown == 0 {
+			rule.Cooldown = rule.Window
+		}
+		for i, action := range rule.Actions {
+			if _, err := action.Notifier(nil); err != nil {
+				return nil, fmt.Errorf("bad action %d of rule %s, %s", i+1, rule.Name, err)
+			}
+		}
+		e.rules = append(e.rules, &ruleState{rule: rule, filter: filter})
+	}
+	return e, nil
+}
+
+// Observe counts log against every rule and returns the alerts it fired. Their notifiers are started in
+// the background with ctx, Wait waits for them
+func (e *Engine) Observe(ctx context.Context, log logquery.Log) []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	rv := []Alert{}
+	for _, state := range e.rules {
+		alert, ok := state.observe(log)
+		if !ok {
+			continue
+		}
+		rv = append(rv, alert)
+		notifiers := append([]Notifier{}, alert.Rule.Notifiers...)
+		for _, action := range alert.Rule.Actions {
+			notifier, _ := action.Notifier(e.HTTPClient)
+			notifiers = append(notifiers, notifier)
+		}
+		for _, notifier := range notifiers {
+			e.running.Add(1)
+			go func(notifier Notifier) {
+				defer e.running.Done()
+				ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+				defer cancel()
+				if err := notifier.Notify(ctx, alert); err != nil && e.OnError != nil {
+					e.OnError(alert, err)
+				}
+			}(notifier)
+		}
+	}
+	return rv
+}
+
+// Wait waits for the notifiers started by Observe to finish
+func (e *Engine) Wait() {
+	e.running.Wait()
+}
+
+// observe counts log if it matches and returns an alert if that takes the rule over its threshold
+func (s *ruleState) observe(log logquery.Log) (Alert, bool) {
+	if !s.filter.Match(log) || log.Time.Before(s.quietUntil) {
+		return Alert{}, false
+	}
+	// Logs of different keys can arrive slightly out of order so every match is checked
+	cutoff := log.Time.Add(-s.rule.Window)
+	s.times = append(s.times, log.Time)
+	times := s.times[:0]
+	for _, t := range s.times {
+		if !t.Before(cutoff) {
+			times = append(times, t)
+		}
+	}
+	s.times = times
+	logs := logquery.Logs{}
+	for _, l := range append(s.logs, log) {
+		if !l.Time.Before(cutoff) {
+			logs = append(logs, l)
+		}
+	}
+	if len(logs) > maxAlertLogs {
+		logs = logs[len(logs)-maxAlertLogs:]
+	}
+	s.logs = logs
+	if len(s.times) <= s.rule.Threshold {
+		return Alert{}, false
+	}
+
+	alert := Alert{Rule: s.rule, Time: log.Time, Count: len(s.times), Logs: s.logs}
+	// The next alert needs matches of its own
+	s.times, s.logs = nil, nil
+	s.quietUntil = log.Time.Add(s.rule.Cooldown)
+	return alert, true
+}
@@ -0,0 +1,169 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2020, 2, 28, 5, 20, 0, 0, time.UTC)
+
+func testLog(key string, severity logquery.LogLevel, after time.Duration) logquery.Log {
+	t := start.Add(after)
+	return logquery.Log{Time: t, Severity: severity, Key: key, Log: "query failed",
+		TimeString: "[" + t.Format("01/02/2006 15:04:05.00") + "]", SeverityString: "[" + severity.String() + "]"}
+}
+
+// ruleNames returns the names of the rules that fired
+func ruleNames(alerts []Alert) []string {
+	rv := []string{}
+	for _, alert := range alerts {
+		rv = append(rv, alert.Rule.Name)
+	}
+	return rv
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(os.WriteFile(path, []byte(`rules:
+  fatal:
+    query: level=fatal
+    actions:
+      - exec: [notify-send, logparser]
+  db-errors:
+    query: level>=error AND key=db
+    threshold: 50
+    window: 5m
+    actions:
+      - slack: https://hooks.slack.com/services/x
+`), 0644))
+
+	rules, err := Load(path)
+	assert.NoError(err)
+	assert.Equal(2, len(rules))
+	assert.Equal("db-errors", rules[0].Name)
+	assert.Equal(5*time.Minute, rules[0].Window)
+	assert.Equal(50, rules[0].Threshold)
+	assert.Equal([]Action{{Slack: "https://hooks.slack.com/services/x"}}, rules[0].Actions)
+	assert.Equal("fatal", rules[1].Name)
+	_, err = New(rules)
+	assert.NoError(err)
+
+	assert.NoError(os.WriteFile(path, []byte("rules:\n  a:\n    qeury: level=fatal\n"), 0644))
+	_, err = Load(path)
+	assert.Error(err)
+	assert.NoError(os.WriteFile(path, []byte("rules: {}\n"), 0644))
+	_, err = Load(path)
+	assert.Error(err)
+}
+
+func TestNewBadRules(t *testing.T) {
+	assert := assert.New(t)
+	for _, rule := range []Rule{
+		{Name: "query", Query: "level>=loud"},
+		{Name: "since", Query: "level=fatal SINCE 1h"},
+		{Name: "threshold", Threshold: -1},
+		{Name: "window", Threshold: 5},
+		{Name: "action", Actions: []Action{{}}},
+		{Name: "actions", Actions: []Action{{Webhook: "http://a", Slack: "http://b"}}},
+	} {
+		_, err := New([]Rule{rule})
+		assert.Error(err, rule.Name)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	assert := assert.New(t)
+	engine, err := New([]Rule{
+		{Name: "db-errors", Query: "level>=error AND key=db", Threshold: 2, Window: time.Minute},
+		{Name: "fatal", Query: "level=fatal", Cooldown: 10 * time.Second},
+	})
+	assert.NoError(err)
+	ctx := context.Background()
+
+	assert.Empty(engine.Observe(ctx, testLog("db", logquery.Error, 0)))
+	assert.Empty(engine.Observe(ctx, testLog("api", logquery.Error, time.Second)))
+	assert.Empty(engine.Observe(ctx, testLog("db", logquery.Warn, 2*time.Second)))
+	assert.Empty(engine.Observe(ctx, testLog("db", logquery.Error, 30*time.Second)))
+	// The first error has left the window
+	assert.Empty(engine.Observe(ctx, testLog("db", logquery.Error, 61*time.Second)))
+	alerts := engine.Observe(ctx, testLog("db", logquery.Fatal, 62*time.Second))
+	assert.Equal([]string{"db-errors", "fatal"}, ruleNames(alerts))
+	assert.Equal(3, alerts[0].Count)
+	assert.Equal(3, len(alerts[0].Logs))
+	assert.Equal("alert db-errors: 3 logs matched within 1m0s, more than 2", alerts[0].String())
+	assert.Equal(1, alerts[1].Count)
+
+	// Both rules are cooling down, db-errors for its window and fatal for its cooldown
+	assert.Empty(engine.Observe(ctx, testLog("db", logquery.Fatal, 70*time.Second)))
+	assert.Equal([]string{"fatal"}, ruleNames(engine.Observe(ctx, testLog("db", logquery.Fatal, 72*time.Second))))
+	for _, after := range []time.Duration{122, 123} {
+		assert.Empty(engine.Observe(ctx, testLog("db", logquery.Error, after*time.Second)))
+	}
+	assert.Equal([]string{"db-errors"}, ruleNames(engine.Observe(ctx, testLog("db", logquery.Error, 124*time.Second))))
+}
+
+func TestActions(t *testing.T) {
+	assert := assert.New(t)
+	mutex := sync.Mutex{}
+	bodies := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.URL.Path == "/fail" {
+			http.Error(w, "no", http.StatusInternalServerError)
+			return
+		}
+		body := map[string]interface{}{}
+		assert.NoError(json.NewDecoder(r.Body).Decode(&body))
+		bodies[r.URL.Path], _ = json.Marshal(body)
+	}))
+	defer server.Close()
+
+	actions := []Action{{Webhook: server.URL + "/hook"}, {Slack: server.URL + "/slack"}, {Webhook: server.URL + "/fail"}}
+	output := filepath.Join(t.TempDir(), "alert.json")
+	if runtime.GOOS != "windows" {
+		actions = append(actions, Action{Exec: []string{"sh", "-c", `cat > "$0"; echo "$LOGPARSER_ALERT_RULE $LOGPARSER_ALERT_COUNT" >> "$0"`, output}})
+	}
+	engine, err := New([]Rule{{Name: "fatal", Description: "something died", Query: "level=fatal", Actions: actions}})
+	assert.NoError(err)
+	failed := []error{}
+	engine.OnError = func(alert Alert, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failed = append(failed, err)
+	}
+
+	assert.Equal(1, len(engine.Observe(context.Background(), testLog("db", logquery.Fatal, 0))))
+	engine.Wait()
+
+	assert.JSONEq(`{"rule": "fatal", "description": "something died", "query": "level=fatal", "time": "2020-02-28T05:20:00Z",
+		"count": 1, "threshold": 0, "window": "0s", "logs": [{"time": "2020-02-28T05:20:00Z", "severity": "fatal", "key": "db", "message": "query failed"}]}`, string(bodies["/hook"]))
+	assert.JSONEq(`{"text": "*alert fatal: [02/28/2020 05:20:00.00][FATAL][db] query failed*\nsomething died"}`, string(bodies["/slack"]))
+	assert.Equal(1, len(failed))
+	if runtime.GOOS != "windows" {
+		written, err := os.ReadFile(output)
+		assert.NoError(err)
+		assert.Contains(string(written), `"rule":"fatal"`)
+		assert.Contains(string(written), "fatal 1\n")
+	}
+
+	engine, err = New([]Rule{{Name: "fatal", Actions: []Action{{Exec: []string{"false"}}}}})
+	assert.NoError(err)
+	var failure error
+	engine.OnError = func(alert Alert, err error) { failure = err }
+	engine.Observe(context.Background(), testLog("db", logquery.Info, 0))
+	engine.Wait()
+	assert.Error(failure)
+}
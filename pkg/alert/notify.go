@@ -0,0 +1,197 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// pagerDutyURL is the PagerDuty Events API v2 endpoint
+const pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Notifier sends an alert somewhere, like a chat channel or a pager
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// payload is the JSON form of an alert sent to webhooks and commands
+type payload struct {
+	Rule        string            `json:"rule"`
+	Description string            `json:"description,omitempty"`
+	Query       string            `json:"query"`
+	Time        time.Time         `json:"time"`
+	Count       int               `json:"count"`
+	Threshold   int               `json:"threshold"`
+	Window      string            `json:"window"`
+	Logs        []logquery.Record `json:"logs"`
+}
+
+func newPayload(alert Alert) payload {
+	rv := payload{
+		Rule:        alert.Rule.Name,
+		Description: alert.Rule.Description,
+		Query:       alert.Rule.Query,
+		Time:        alert.Time,
+		Count:       alert.Count,
+		Threshold:   alert.Rule.Threshold,
+		Window:      alert.Rule.Window.String(),
+		Logs:        make([]logquery.Record, len(alert.Logs)),
+	}
+	for i, log := range alert.Logs {
+		rv.Logs[i] = log.Record()
+	}
+	return rv
+}
+
+// Webhook POSTs alerts as JSON with the rule, count and the latest matching logs
+type Webhook struct {
+	URL string
+	// Client sends the requests, nil means http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts the alert to the webhook
+func (w *Webhook) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, w.Client, w.URL, newPayload(alert))
+}
+
+// Slack posts alerts to a Slack incoming webhook as a message
+type Slack struct {
+	// URL is the url of the incoming webhook, like https://hooks.slack.com/services/...
+	URL string
+	// Client sends the requests, nil means http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts the alert and its latest log to the channel of the webhook
+func (s *Slack) Notify(ctx context.Context, alert Alert) error {
+	text := "*" + alert.String() + "*"
+	if alert.Rule.Description != "" {
+		text += "\n" + alert.Rule.Description
+	}
+	if alert.Rule.Window != 0 {
+		text += "\n```" + alert.Logs[len(alert.Logs)-1].String() + "```"
+	}
+	return postJSON(ctx, s.Client, s.URL, map[string]string{"text": text})
+}
+
+// PagerDuty triggers incidents through the PagerDuty Events API v2. Alerts of the same rule are grouped
+// into one incident until it is resolved
+type PagerDuty struct {
+	// RoutingKey is the integration key of the service
+	RoutingKey string
+	// URL defaults to the Events API
+	URL string
+	// Client sends the requests, nil means http.DefaultClient
+	Client *http.Client
+}
+
+// pagerDutyEvent is the body of a trigger event
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string    `json:"summary"`
+	Source        string    `json:"source"`
+	Severity      string    `json:"severity"`
+	Timestamp     time.Time `json:"timestamp"`
+	CustomDetails payload   `json:"custom_details"`
+}
+
+// Notify triggers an incident for the alert, its severity is the highest level of the alert's logs
+func (p *PagerDuty) Notify(ctx context.Context, alert Alert) error {
+	latest := alert.Logs[len(alert.Logs)-1]
+	highest := logquery.Undefined
+	for _, log := range alert.Logs {
+		if log.Severity > highest {
+			highest = log.Severity
+		}
+	}
+	severity := "info"
+	switch {
+	case highest >= logquery.Fatal:
+		severity = "critical"
+	case highest >= logquery.Error:
+		severity = "error"
+	case highest >= logquery.Warn:
+		severity = "warning"
+	}
+	url := p.URL
+	if url == "" {
+		url = pagerDutyURL
+	}
+	return postJSON(ctx, p.Client, url, pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    "logparser/" + alert.Rule.Name,
+		Payload: pagerDutyPayload{
+			Summary:       alert.String(),
+			Source:        latest.Key,
+			Severity:      severity,
+			Timestamp:     alert.Time,
+			CustomDetails: newPayload(alert),
+		},
+	})
+}
+
+// Command runs a command for every alert with the alert as JSON on stdin, like a webhook's body, and the
+// rule name and count in LOGPARSER_ALERT_RULE and LOGPARSER_ALERT_COUNT
+type Command struct {
+	// Args are the command and its arguments
+	Args []string
+}
+
+// Notify runs the command and returns its output if it fails
+func (c *Command) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(newPayload(alert))
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "LOGPARSER_ALERT_RULE="+alert.Rule.Name, "LOGPARSER_ALERT_COUNT="+strconv.Itoa(alert.Count))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed with %s: %s", c.Args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("post to %s failed with %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
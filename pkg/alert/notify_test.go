@@ -0,0 +1,69 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// notifications records the alerts it is sent
+type notifications struct {
+	alerts chan Alert
+}
+
+func (n *notifications) Notify(ctx context.Context, alert Alert) error {
+	n.alerts <- alert
+	return nil
+}
+
+func TestPagerDuty(t *testing.T) {
+	assert := assert.New(t)
+	events := make(chan pagerDutyEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := pagerDutyEvent{}
+		assert.NoError(json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	rule := Rule{Name: "db-errors", Query: "key=db", Threshold: 1, Window: time.Minute}
+	alert := Alert{Rule: rule, Time: start, Count: 2, Logs: logquery.Logs{testLog("db", logquery.Warn, 0), testLog("db", logquery.Error, time.Second)}}
+	assert.NoError((&PagerDuty{RoutingKey: "key", URL: server.URL}).Notify(context.Background(), alert))
+	event := <-events
+	assert.Equal("key", event.RoutingKey)
+	assert.Equal("trigger", event.EventAction)
+	assert.Equal("logparser/db-errors", event.DedupKey)
+	assert.Equal("alert db-errors: 2 logs matched within 1m0s, more than 1", event.Payload.Summary)
+	assert.Equal("db", event.Payload.Source)
+	assert.Equal("error", event.Payload.Severity)
+	assert.Equal(2, event.Payload.CustomDetails.Count)
+	assert.Equal(2, len(event.Payload.CustomDetails.Logs))
+
+	assert.Error((&PagerDuty{RoutingKey: "key", URL: server.URL + "/\x00"}).Notify(context.Background(), alert))
+}
+
+func TestRuleNotifiers(t *testing.T) {
+	assert := assert.New(t)
+	notified := &notifications{alerts: make(chan Alert, 1)}
+	engine, err := New([]Rule{{Name: "fatal", Query: "level=fatal", Notifiers: []Notifier{notified}}})
+	assert.NoError(err)
+
+	engine.Observe(context.Background(), testLog("db", logquery.Fatal, 0))
+	engine.Wait()
+	assert.Equal("fatal", (<-notified.alerts).Rule.Name)
+
+	for _, action := range []Action{{}, {Slack: "http://a", PagerDuty: "key"}} {
+		_, err := action.Notifier(nil)
+		assert.Error(err)
+	}
+	notifier, err := Action{PagerDuty: "key"}.Notifier(nil)
+	assert.NoError(err)
+	assert.Equal(&PagerDuty{RoutingKey: "key"}, notifier)
+}
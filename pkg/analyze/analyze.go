@@ -0,0 +1,148 @@
+// Package analyze looks for unusual patterns in logs, like a key suddenly logging far more errors than
+// it usually does
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Detector finds error spikes, buckets of a key with many more errors than the buckets before them. The
+// zero value uses the defaults of each field
+type Detector struct {
+	// Bucket is the size of the buckets error rates are counted in, defaults to a minute
+	Bucket time.Duration
+	// Baseline is how many buckets before a bucket its usual error rate is averaged over, defaults to 30
+	Baseline int
+	// Factor is how many times the baseline a bucket needs to be a spike, defaults to 3
+	Factor float64
+	// MinErrors is the fewest errors a bucket needs to be a spike, so a key going from 0 to 1 errors
+	// isn't one. Defaults to 5
+	MinErrors int
+	// Level is the lowest level counted as an error, defaults to logquery.Error
+	Level logquery.LogLevel
+}
+
+// Spike is a run of consecutive buckets of a key that all had more errors than their baseline
+type Spike struct {
+	Key string
+	// Start is the start of the first bucket and End the end of the last one
+	Start time.Time
+	End   time.Time
+	// Errors is the number of errors across the spike
+	Errors int
+	// Baseline is the usual number of errors in a bucket before the spike started
+	Baseline float64
+}
+
+func (s Spike) String() string {
+	return fmt.Sprintf("error spike on %s %s–%s", s.Key, s.Start.Format("15:04"), s.End.Format("15:04"))
+}
+
+// withDefaults fills in the fields left at their zero value
+func (d Detector) withDefaults() Detector {
+	if d.Bucket <= 0 {
+		d.Bucket = time.Minute
+	}
+	if d.Baseline <= 0 {
+		d.Baseline = 30
+	}
+	if d.Factor <= 0 {
+		d.Factor = 3
+	}
+	if d.MinErrors <= 0 {
+		d.MinErrors = 5
+	}
+	if d.Level == logquery.Undefined {
+		d.Level = logquery.Error
+	}
+	return d
+}
+
+// Run counts the errors of the keys between start and end and returns their spikes. Keys that failed to
+// load are reported in a *logquery.LoadError along with the spikes of the others
+func (d Detector) Run(ctx context.Context, l *logquery.LogQuery, start time.Time, end time.Time, keys []string) ([]Spike, error) {
+	d = d.withDefaults()
+	aggregation, err := l.Aggregate(ctx, start, end, keys, d.Bucket)
+	if aggregation == nil {
+		return nil, err
+	}
+	return d.Detect(aggregation), err
+}
+
+// Detect returns the spikes of every key in the aggregation, which has to be in buckets of d.Bucket.
+// Spikes are sorted by start time and then key
+func (d Detector) Detect(aggregation logquery.Aggregation) []Spike {
+	d = d.withDefaults()
+	rv := []Spike{}
+	for key, buckets := range aggregation {
+		rv = append(rv, d.detectKey(key, buckets)...)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if !rv[i].Start.Equal(rv[j].Start) {
+			return rv[i].Start.Before(rv[j].Start)
+		}
+		return rv[i].Key < rv[j].Key
+	})
+	return rv
+}
+
+// detectKey finds the spikes in the buckets of one key
+func (d Detector) detectKey(key string, buckets []logquery.Bucket) []Spike {
+	rv := []Spike{}
+	// history holds the error counts of the last buckets that weren't spikes, so a long spike doesn't
+	// become its own baseline
+	history := []int{}
+	var current *Spike
+	for _, bucket := range buckets {
+		errors := d.errors(bucket)
+		baseline := mean(history)
+		// The first bucket of a key has nothing to compare against
+		if len(history) > 0 && errors >= d.MinErrors && float64(errors) > d.Factor*baseline {
+			if current == nil {
+				current = &Spike{Key: key, Start: bucket.Start, Baseline: baseline}
+			}
+			current.End = bucket.Start.Add(d.Bucket)
+			current.Errors += errors
+			continue
+		}
+		if current != nil {
+			rv = append(rv, *current)
+			current = nil
+		}
+		history = append(history, errors)
+		if len(history) > d.Baseline {
+			history = history[1:]
+		}
+	}
+	if current != nil {
+		rv = append(rv, *current)
+	}
+	return rv
+}
+
+// errors counts the logs in the bucket at or above the error level
+func (d Detector) errors(bucket logquery.Bucket) int {
+	rv := 0
+	for level, count := range bucket.Counts {
+		if level >= d.Level {
+			rv += count
+		}
+	}
+	return rv
+}
+
+func mean(values []int) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, value := range values {
+		sum += value
+	}
+	return float64(sum) / float64(len(values))
+}
@@ -0,0 +1,79 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// buckets makes minute buckets starting at 14:00 with the given error counts and one info log each
+func buckets(errors ...int) []logquery.Bucket {
+	start := time.Date(2020, 2, 28, 14, 0, 0, 0, time.UTC)
+	rv := []logquery.Bucket{}
+	for i, count := range errors {
+		rv = append(rv, logquery.Bucket{
+			Start:  start.Add(time.Duration(i) * time.Minute),
+			Counts: map[logquery.LogLevel]int{logquery.Info: 1, logquery.Error: count},
+		})
+	}
+	return rv
+}
+
+func TestDetect(t *testing.T) {
+	assert := assert.New(t)
+	detector := Detector{Baseline: 5}
+
+	spikes := detector.Detect(logquery.Aggregation{
+		"db_server": buckets(1, 2, 1, 0, 2, 9, 12, 8, 10, 11, 1, 1),
+		"server1":   buckets(1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1),
+		// Always failing a lot isn't a spike
+		"batch": buckets(20, 22, 19, 21, 20, 20),
+	})
+	assert.Equal(1, len(spikes))
+	assert.Equal("db_server", spikes[0].Key)
+	assert.Equal(50, spikes[0].Errors)
+	assert.Equal(1.2, spikes[0].Baseline)
+	assert.Equal("error spike on db_server 14:05–14:10", spikes[0].String())
+
+	// Fewer errors than MinErrors are never a spike
+	spikes = detector.Detect(logquery.Aggregation{"db_server": buckets(0, 0, 0, 4, 0)})
+	assert.Equal(0, len(spikes))
+
+	// Warnings count once the level is lowered
+	warnings := buckets(0, 0, 0, 0)
+	warnings[3].Counts[logquery.Warn] = 6
+	assert.Equal(0, len(detector.Detect(logquery.Aggregation{"db_server": warnings})))
+	detector.Level = logquery.Warn
+	assert.Equal(1, len(detector.Detect(logquery.Aggregation{"db_server": warnings})))
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	lines := []string{}
+	start := time.Date(2020, 2, 28, 5, 0, 0, 0, time.UTC)
+	for minute := 0; minute < 10; minute++ {
+		errors := 1
+		if minute == 6 {
+			errors = 8
+		}
+		for i := 0; i < errors; i++ {
+			at := start.Add(time.Duration(minute)*time.Minute + time.Duration(i)*time.Second)
+			lines = append(lines, fmt.Sprintf("[%s][error] Connection refused", at.Format("01/02/2006 3:04:05.00")))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "db.log")
+	assert.NoError(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	testQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{"db": path})
+	assert.NoError(err)
+
+	spikes, err := Detector{}.Run(context.Background(), testQuery, time.Time{}, time.Time{}, []string{"db"})
+	assert.NoError(err)
+	assert.Equal([]Spike{{Key: "db", Start: start.Add(6 * time.Minute), End: start.Add(7 * time.Minute), Errors: 8, Baseline: 1}}, spikes)
+}
@@ -0,0 +1,155 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Change is how a pattern changed between two windows
+type Change string
+
+const (
+	// Appeared patterns weren't logged in the first window
+	Appeared Change = "new"
+	// Disappeared patterns weren't logged in the second window
+	Disappeared Change = "gone"
+	// Spiked patterns were logged much more often in the second window
+	Spiked Change = "spike"
+)
+
+// Window is a time range of a Differ, logs at exactly Start or End are left out like with
+// logquery.WithStart and WithEnd
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration is the length of the window
+func (w Window) Duration() time.Duration {
+	return w.End.Sub(w.Start)
+}
+
+// Differ compares the patterns of two windows, like before and after a deploy. The zero value uses the
+// defaults of each field
+type Differ struct {
+	// Factor is how many times its rate in the first window a pattern needs in the second to be a
+	// spike, defaults to 3
+	Factor float64
+	// MinCount is the fewest logs a pattern needs in the window it appears in to be reported, so one
+	// stray log isn't a new pattern. Defaults to 5
+	MinCount int
+}
+
+// PatternDiff is a pattern that appeared, disappeared or spiked between two windows
+type PatternDiff struct {
+	Change   Change
+	Template string
+	// Example is the first message of the pattern
+	Example string
+	// CountA and CountB are the logs of the pattern in each window
+	CountA int
+	CountB int
+	// Ratio is the rate of the pattern in the second window over its rate in the first, rates are per
+	// second so windows of different lengths compare. It is 0 for new and gone patterns
+	Ratio float64
+	// Keys are the keys the pattern was seen in during either window, sorted
+	Keys []string
+}
+
+// withDefaults fills in the fields left at their zero value
+func (d Differ) withDefaults() Differ {
+	if d.Factor <= 0 {
+		d.Factor = 3
+	}
+	if d.MinCount <= 0 {
+		d.MinCount = 5
+	}
+	return d
+}
+
+// Run groups the logs matching opts in each window into patterns and compares them. The time range of
+// opts is replaced by the windows. Keys that failed to load are reported in a *logquery.LoadError along
+// with the changes of the others
+func (d Differ) Run(ctx context.Context, l *logquery.LogQuery, a, b Window, opts ...logquery.QueryOption) ([]PatternDiff, error) {
+	for _, w := range []Window{a, b} {
+		if w.Start.IsZero() || w.End.IsZero() || !w.Start.Before(w.End) {
+			return nil, fmt.Errorf("a window needs a start before its end")
+		}
+	}
+	opts = opts[:len(opts):len(opts)]
+	patternsA, err := TopPatterns(ctx, l, 0, append(opts, logquery.WithStart(a.Start), logquery.WithEnd(a.End))...)
+	patternsB, errB := TopPatterns(ctx, l, 0, append(opts, logquery.WithStart(b.Start), logquery.WithEnd(b.End))...)
+	if err == nil {
+		err = errB
+	}
+	return d.Compare(patternsA, patternsB, a.Duration(), b.Duration()), err
+}
+
+// Compare returns the patterns of b that are new or spiked compared to a and the patterns of a that
+// are gone from b. durationA and durationB are the lengths of the windows the patterns were grouped
+// over. Changes are sorted new first, then spikes and then gone patterns, each by count
+func (d Differ) Compare(a, b []Pattern, durationA, durationB time.Duration) []PatternDiff {
+	d = d.withDefaults()
+	before := map[string]Pattern{}
+	for _, pattern := range a {
+		before[pattern.Template] = pattern
+	}
+	after := map[string]Pattern{}
+	for _, pattern := range b {
+		after[pattern.Template] = pattern
+	}
+
+	rv := []PatternDiff{}
+	for _, pattern := range b {
+		old, ok := before[pattern.Template]
+		diff := PatternDiff{Template: pattern.Template, Example: pattern.Example, CountA: old.Count, CountB: pattern.Count, Keys: mergeKeys(old.Keys, pattern.Keys)}
+		if pattern.Count < d.MinCount {
+			continue
+		}
+		if !ok {
+			diff.Change = Appeared
+			rv = append(rv, diff)
+			continue
+		}
+		diff.Ratio = (float64(pattern.Count) / durationB.Seconds()) / (float64(old.Count) / durationA.Seconds())
+		if diff.Ratio >= d.Factor {
+			diff.Change = Spiked
+			rv = append(rv, diff)
+		}
+	}
+	for _, pattern := range a {
+		if _, ok := after[pattern.Template]; !ok && pattern.Count >= d.MinCount {
+			rv = append(rv, PatternDiff{Change: Disappeared, Template: pattern.Template, Example: pattern.Example, CountA: pattern.Count, Keys: pattern.Keys})
+		}
+	}
+
+	order := map[Change]int{Appeared: 0, Spiked: 1, Disappeared: 2}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Change != rv[j].Change {
+			return order[rv[i].Change] < order[rv[j].Change]
+		}
+		if ci, cj := rv[i].CountA+rv[i].CountB, rv[j].CountA+rv[j].CountB; ci != cj {
+			return ci > cj
+		}
+		return rv[i].Template < rv[j].Template
+	})
+	return rv
+}
+
+// mergeKeys returns the sorted keys in either a or b
+func mergeKeys(a, b []string) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, key := range append(append([]string{}, a...), b...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,71 @@
+package analyze
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDifferCompare(t *testing.T) {
+	assert := assert.New(t)
+	a := []Pattern{
+		{Template: "request served in <*>", Count: 100, Keys: []string{"web"}},
+		{Template: "cache miss <*>", Count: 10, Keys: []string{"web"}},
+		{Template: "using legacy config", Count: 6, Keys: []string{"api"}},
+		{Template: "rare", Count: 1, Keys: []string{"api"}},
+	}
+	b := []Pattern{
+		{Template: "request served in <*>", Count: 110, Keys: []string{"web"}},
+		{Template: "cache miss <*>", Count: 40, Keys: []string{"api", "web"}},
+		{Template: "connection refused", Count: 7, Example: "connection refused", Keys: []string{"db"}},
+		{Template: "new but rare", Count: 2, Keys: []string{"db"}},
+	}
+
+	diffs := Differ{}.Compare(a, b, time.Hour, time.Hour)
+	assert.Equal([]PatternDiff{
+		{Change: Appeared, Template: "connection refused", Example: "connection refused", CountB: 7, Keys: []string{"db"}},
+		{Change: Spiked, Template: "cache miss <*>", CountA: 10, CountB: 40, Ratio: 4, Keys: []string{"api", "web"}},
+		{Change: Disappeared, Template: "using legacy config", CountA: 6, Keys: []string{"api"}},
+	}, diffs)
+
+	// Rates are per second so a window twice as long needs twice the logs
+	diffs = Differ{}.Compare(a, b, time.Hour, 2*time.Hour)
+	assert.Equal(2, len(diffs))
+	assert.Equal(Appeared, diffs[0].Change)
+	assert.Equal(Disappeared, diffs[1].Change)
+
+	diffs = Differ{Factor: 1.05, MinCount: 1}.Compare(a, b, time.Hour, time.Hour)
+	assert.Equal(6, len(diffs))
+}
+
+func TestDifferRun(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte(`ts=2020-02-28T05:00:30Z level=info msg="job 1 done"
+ts=2020-02-28T05:01:00Z level=info msg="old path used"
+ts=2020-02-28T05:02:00Z level=info msg="job 2 done"
+ts=2020-02-28T06:00:30Z level=info msg="job 3 done"
+ts=2020-02-28T06:01:00Z level=error msg="timeout after 30s"
+ts=2020-02-28T06:02:00Z level=error msg="timeout after 31s"
+`), 0644))
+	testQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{"app": path}, logquery.WithParser("app", &logquery.LogfmtParser{}))
+	assert.NoError(err)
+	at := func(hour int) time.Time {
+		return time.Date(2020, 2, 28, hour, 0, 0, 0, time.UTC)
+	}
+
+	diffs, err := Differ{MinCount: 1}.Run(context.Background(), testQuery, Window{at(5), at(6)}, Window{at(6), at(7)})
+	assert.NoError(err)
+	assert.Equal([]PatternDiff{
+		{Change: Appeared, Template: "timeout after <*>", Example: "timeout after 30s", CountB: 2, Keys: []string{"app"}},
+		{Change: Disappeared, Template: "old path used", Example: "old path used", CountA: 1, Keys: []string{"app"}},
+	}, diffs)
+
+	_, err = Differ{}.Run(context.Background(), testQuery, Window{at(6), at(5)}, Window{at(6), at(7)})
+	assert.Error(err)
+}
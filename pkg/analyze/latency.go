@@ -0,0 +1,100 @@
+package analyze
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// LatencyBucket summarizes the latencies of the logs in the bucket starting at Start
+type LatencyBucket struct {
+	Start time.Time
+	Count int
+	P50   float64
+	P95   float64
+	P99   float64
+	Max   float64
+}
+
+// Latencies collects a numeric field of logs into time buckets, like the request time a parser pulls out
+// of access logs
+type Latencies struct {
+	field  string
+	bucket time.Duration
+	values map[time.Time][]float64
+	// Skipped counts the logs without the field or with a value that isn't a number
+	Skipped int
+}
+
+// NewLatencies returns Latencies collecting field in buckets of the given size. Buckets are aligned to
+// multiples of bucket since the zero time like logquery.Aggregate's
+func NewLatencies(field string, bucket time.Duration) *Latencies {
+	return &Latencies{field: field, bucket: bucket, values: map[time.Time][]float64{}}
+}
+
+// ParseLatency reads a latency field. Numbers are used as they are and durations like 120ms or 1.5s are
+// converted to milliseconds
+func ParseLatency(value string) (float64, bool) {
+	if n, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+		return n, true
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return float64(d) / float64(time.Millisecond), true
+	}
+	return 0, false
+}
+
+// Add adds the latency of log to its bucket
+func (l *Latencies) Add(log logquery.Log) {
+	value, ok := ParseLatency(log.Fields[l.field])
+	if !ok {
+		l.Skipped++
+		return
+	}
+	start := log.Time.Truncate(l.bucket)
+	l.values[start] = append(l.values[start], value)
+}
+
+// Buckets returns the buckets that had a latency in time order
+func (l *Latencies) Buckets() []LatencyBucket {
+	rv := make([]LatencyBucket, 0, len(l.values))
+	for start, values := range l.values {
+		sort.Float64s(values)
+		rv = append(rv, LatencyBucket{
+			Start: start,
+			Count: len(values),
+			P50:   percentile(values, 50),
+			P95:   percentile(values, 95),
+			P99:   percentile(values, 99),
+			Max:   values[len(values)-1],
+		})
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Start.Before(rv[j].Start) })
+	return rv
+}
+
+// percentile returns the nearest rank percentile p of sorted values, always one of the values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// LatencyPercentiles returns the p50, p95 and p99 of field for the logs matching opts in buckets of the
+// given size, along with how many matching logs had no usable value. Keys that failed to load are
+// reported in a *logquery.LoadError along with the buckets of the others
+func LatencyPercentiles(ctx context.Context, l *logquery.LogQuery, field string, bucket time.Duration, opts ...logquery.QueryOption) ([]LatencyBucket, int, error) {
+	latencies := NewLatencies(field, bucket)
+	it := l.Iter(ctx, opts...)
+	defer it.Close()
+	for it.Next() {
+		latencies.Add(it.Log())
+	}
+	return latencies.Buckets(), latencies.Skipped, it.Err()
+}
@@ -0,0 +1,51 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+	assert := assert.New(t)
+	lines := []string{}
+	// 100 requests taking 1 to 100ms in the first minute, 2 in the next
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf(`{"ts":"2020-02-28T05:20:%02d.%03dZ","level":"info","msg":"GET /","duration":"%d"}`, i/2, i%2*500, i))
+	}
+	lines = append(lines,
+		`{"ts":"2020-02-28T05:21:10Z","level":"info","msg":"GET /","duration":"1.5s"}`,
+		`{"ts":"2020-02-28T05:21:20Z","level":"info","msg":"GET /","duration":"250ms"}`,
+		`{"ts":"2020-02-28T05:21:30Z","level":"info","msg":"GET /","duration":"slow"}`,
+		`{"ts":"2020-02-28T05:21:40Z","level":"info","msg":"healthy"}`,
+	)
+	path := filepath.Join(t.TempDir(), "access.json")
+	assert.NoError(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	testQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{"web": path}, logquery.WithParser("web", &logquery.JSONParser{}))
+	assert.NoError(err)
+
+	buckets, skipped, err := LatencyPercentiles(context.Background(), testQuery, "duration", time.Minute)
+	assert.NoError(err)
+	assert.Equal(2, skipped)
+	assert.Equal([]LatencyBucket{
+		{Start: time.Date(2020, 2, 28, 5, 20, 0, 0, time.UTC), Count: 100, P50: 50, P95: 95, P99: 99, Max: 100},
+		{Start: time.Date(2020, 2, 28, 5, 21, 0, 0, time.UTC), Count: 2, P50: 250, P95: 1500, P99: 1500, Max: 1500},
+	}, buckets)
+
+	buckets, _, err = LatencyPercentiles(context.Background(), testQuery, "duration", time.Minute, logquery.WithStart(time.Date(2020, 2, 28, 5, 21, 0, 0, time.UTC)))
+	assert.NoError(err)
+	assert.Equal(1, len(buckets))
+
+	value, ok := ParseLatency("12.5")
+	assert.True(ok)
+	assert.Equal(12.5, value)
+	_, ok = ParseLatency("NaN")
+	assert.False(ok)
+}
@@ -0,0 +1,127 @@
+package analyze
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Wildcard replaces the parts of a message that change between logs of the same pattern
+const Wildcard = "<*>"
+
+// hexID matches tokens that are probably ids even without digits in them, like deadbeef or uuids
+var hexID = regexp.MustCompile(`^(?i)(0x)?[0-9a-f]{8,}$|^(?i)[0-9a-f]{8}(-[0-9a-f]{4}){3}-[0-9a-f]{12}$`)
+
+// Pattern is a group of messages that only differ in their numbers and ids
+type Pattern struct {
+	// Template is the message with the parts that vary replaced by Wildcard
+	Template string
+	Count    int
+	// Example is the first message of the pattern
+	Example string
+	// Keys are the keys the pattern was seen in, sorted
+	Keys []string
+	// First and Last are the times of the first and last log of the pattern
+	First time.Time
+	Last  time.Time
+}
+
+// Template masks the numbers and ids in a message so similar messages end up with the same template.
+// Messages are split on whitespace and each word with a digit in it, or that looks like a hex id, is
+// replaced by Wildcard. Only the value of name=value words is masked so the name stays in the template
+func Template(message string) string {
+	words := strings.Fields(message)
+	for i, word := range words {
+		if eq := strings.Index(word, "="); eq > 0 && eq < len(word)-1 {
+			if variable(word[eq+1:]) {
+				words[i] = word[:eq+1] + Wildcard
+			}
+			continue
+		}
+		if variable(word) {
+			words[i] = Wildcard
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// variable returns true if the word is likely to change between logs of the same pattern
+func variable(word string) bool {
+	trimmed := strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.IndexFunc(trimmed, unicode.IsDigit) != -1 || hexID.MatchString(trimmed)
+}
+
+// Patterns groups logs by the template of their message
+type Patterns struct {
+	patterns map[string]*Pattern
+	keys     map[string]map[string]bool
+}
+
+// NewPatterns returns an empty Patterns
+func NewPatterns() *Patterns {
+	return &Patterns{patterns: map[string]*Pattern{}, keys: map[string]map[string]bool{}}
+}
+
+// Add counts a log under the template of its message
+func (p *Patterns) Add(log logquery.Log) {
+	template := Template(log.Log)
+	pattern, ok := p.patterns[template]
+	if !ok {
+		pattern = &Pattern{Template: template, Example: log.Log, First: log.Time, Last: log.Time}
+		p.patterns[template] = pattern
+		p.keys[template] = map[string]bool{}
+	}
+	pattern.Count++
+	if log.Time.Before(pattern.First) {
+		pattern.First = log.Time
+	}
+	if log.Time.After(pattern.Last) {
+		pattern.Last = log.Time
+	}
+	p.keys[template][log.Key] = true
+}
+
+// Top returns the n patterns with the most logs, most first. Patterns with the same count are sorted by
+// template. n <= 0 returns every pattern
+func (p *Patterns) Top(n int) []Pattern {
+	rv := []Pattern{}
+	for template, pattern := range p.patterns {
+		top := *pattern
+		top.Keys = []string{}
+		for key := range p.keys[template] {
+			top.Keys = append(top.Keys, key)
+		}
+		sort.Strings(top.Keys)
+		rv = append(rv, top)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Count != rv[j].Count {
+			return rv[i].Count > rv[j].Count
+		}
+		return rv[i].Template < rv[j].Template
+	})
+	if n > 0 && len(rv) > n {
+		rv = rv[:n]
+	}
+	return rv
+}
+
+// TopPatterns groups the logs matching opts and returns the n most common patterns. Limits in opts
+// limit how many logs are grouped. Keys that failed to load are reported in a *logquery.LoadError along
+// with the patterns of the others
+func TopPatterns(ctx context.Context, l *logquery.LogQuery, n int, opts ...logquery.QueryOption) ([]Pattern, error) {
+	patterns := NewPatterns()
+	it := l.Iter(ctx, opts...)
+	defer it.Close()
+	for it.Next() {
+		patterns.Add(it.Log())
+	}
+	return patterns.Top(n), it.Err()
+}
@@ -0,0 +1,63 @@
+package analyze
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("Opening database <*> for write.", Template("Opening database “my_db7” for write. "))
+	assert.Equal("took <*> for request <*> user=alice id=<*>", Template("took 35ms for request 3f2a9c1e-0b5d-4e8a-9c1f-2b3d4e5f6a7b user=alice id=42"))
+	assert.Equal("session <*> expired", Template("session deadbeefcafe expired"))
+	assert.Equal("Rejecting request: No such database.", Template("Rejecting request: No such database."))
+}
+
+func TestTopPatterns(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "api.log")
+	assert.NoError(os.WriteFile(path, []byte(`[02/28/2020 5:20:55.00][error] Connection to 10.0.0.1 timed out after 30s
+[02/28/2020 5:20:56.00][info] user 42 logged in
+[02/28/2020 5:20:57.00][error] Connection to 10.0.0.7 timed out after 31s
+[02/28/2020 5:20:58.00][info] Cache warmed
+[02/28/2020 5:20:59.00][error] Connection to 10.0.0.1 timed out after 30s
+[02/28/2020 5:21:00.00][info] user 7 logged in
+`), 0644))
+	testQuery, _ := logquery.NewLogQuery(context.Background(), map[string]string{
+		"api":     path,
+		"server1": "../../logs/server1.log",
+	})
+
+	patterns, err := TopPatterns(context.Background(), testQuery, 2)
+	assert.NoError(err)
+	assert.Equal(2, len(patterns))
+	assert.Equal("Connection to <*> timed out after <*>", patterns[0].Template)
+	assert.Equal(3, patterns[0].Count)
+	assert.Equal([]string{"api"}, patterns[0].Keys)
+	assert.Equal("Connection to 10.0.0.1 timed out after 30s", patterns[0].Example)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 55, 0, time.UTC), patterns[0].First)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 59, 0, time.UTC), patterns[0].Last)
+	assert.Equal("user <*> logged in", patterns[1].Template)
+	assert.Equal(2, patterns[1].Count)
+
+	// Filters pick the logs that are grouped
+	patterns, err = TopPatterns(context.Background(), testQuery, 0, logquery.WithMinSeverity(logquery.Error))
+	assert.NoError(err)
+	assert.Equal(3, len(patterns))
+	assert.Equal(3, patterns[0].Count)
+	assert.Equal([]string{"server1"}, patterns[1].Keys)
+
+	p := NewPatterns()
+	p.Add(logquery.Log{Key: "a", Log: "retry 1", Time: time.Unix(20, 0)})
+	p.Add(logquery.Log{Key: "b", Log: "retry 2", Time: time.Unix(10, 0)})
+	top := p.Top(0)
+	assert.Equal([]string{"a", "b"}, top[0].Keys)
+	assert.Equal(time.Unix(10, 0), top[0].First)
+	assert.Equal(time.Unix(20, 0), top[0].Last)
+}
@@ -0,0 +1,99 @@
+package analyze
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Session is a run of logs sharing an identifier with no idle gap longer than the sessionizer's
+type Session struct {
+	// ID is the value of the identifier field, like a user id or an IP
+	ID    string
+	Start time.Time
+	End   time.Time
+	// Events is the number of logs in the session
+	Events int
+	// Counts are the logs of the session per level
+	Counts map[logquery.LogLevel]int
+	// Keys are the keys the session was seen in, sorted
+	Keys []string
+}
+
+// Duration is the time from the first to the last log of the session
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Sessionizer groups logs into sessions by the value of a field, a session ends once its identifier
+// hasn't been seen for longer than the gap. Logs have to be added in time order
+type Sessionizer struct {
+	field  string
+	gap    time.Duration
+	open   map[string]*Session
+	closed []Session
+	// Skipped counts the logs without the field
+	Skipped int
+}
+
+// NewSessionizer returns a Sessionizer splitting the sessions of field on idle gaps longer than gap
+func NewSessionizer(field string, gap time.Duration) *Sessionizer {
+	return &Sessionizer{field: field, gap: gap, open: map[string]*Session{}}
+}
+
+// Add adds log to the session of its identifier, starting a new one after an idle gap
+func (s *Sessionizer) Add(log logquery.Log) {
+	id, ok := log.Fields[s.field]
+	if !ok || id == "" {
+		s.Skipped++
+		return
+	}
+	session, ok := s.open[id]
+	if ok && log.Time.Sub(session.End) > s.gap {
+		s.closed = append(s.closed, *session)
+		ok = false
+	}
+	if !ok {
+		session = &Session{ID: id, Start: log.Time, Counts: map[logquery.LogLevel]int{}}
+		s.open[id] = session
+	}
+	session.End = log.Time
+	session.Events++
+	session.Counts[log.Severity]++
+	i := sort.SearchStrings(session.Keys, log.Key)
+	if i == len(session.Keys) || session.Keys[i] != log.Key {
+		session.Keys = append(session.Keys, "")
+		copy(session.Keys[i+1:], session.Keys[i:])
+		session.Keys[i] = log.Key
+	}
+}
+
+// Sessions returns every session so far, the ones still open included, by start time
+func (s *Sessionizer) Sessions() []Session {
+	rv := append([]Session{}, s.closed...)
+	for _, session := range s.open {
+		rv = append(rv, *session)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if !rv[i].Start.Equal(rv[j].Start) {
+			return rv[i].Start.Before(rv[j].Start)
+		}
+		return rv[i].ID < rv[j].ID
+	})
+	return rv
+}
+
+// Sessions groups the logs matching opts into sessions of field split by idle gaps longer than gap,
+// and returns them with how many matching logs didn't have the field. Keys that failed to load are
+// reported in a *logquery.LoadError along with the sessions of the others
+func Sessions(ctx context.Context, l *logquery.LogQuery, field string, gap time.Duration, opts ...logquery.QueryOption) ([]Session, int, error) {
+	sessionizer := NewSessionizer(field, gap)
+	it := l.Iter(ctx, opts...)
+	defer it.Close()
+	for it.Next() {
+		sessionizer.Add(it.Log())
+	}
+	return sessionizer.Sessions(), sessionizer.Skipped, it.Err()
+}
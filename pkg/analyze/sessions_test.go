@@ -0,0 +1,50 @@
+package analyze
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	web := filepath.Join(dir, "web.log")
+	api := filepath.Join(dir, "api.log")
+	assert.NoError(os.WriteFile(web, []byte(`ts=2020-02-28T05:00:00Z level=info msg=login user=alice
+ts=2020-02-28T05:01:00Z level=info msg=login user=bob
+ts=2020-02-28T05:10:00Z level=info msg=view user=alice
+ts=2020-02-28T05:50:00Z level=info msg=login user=alice
+ts=2020-02-28T05:51:00Z level=info msg=healthcheck
+`), 0644))
+	assert.NoError(os.WriteFile(api, []byte(`ts=2020-02-28T05:05:00Z level=error msg="save failed" user=alice
+ts=2020-02-28T05:55:00Z level=info msg=save user=alice
+`), 0644))
+	testQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{"web": web, "api": api},
+		logquery.WithParser("web", &logquery.LogfmtParser{}), logquery.WithParser("api", &logquery.LogfmtParser{}))
+	assert.NoError(err)
+	at := func(min int) time.Time {
+		return time.Date(2020, 2, 28, 5, min, 0, 0, time.UTC)
+	}
+
+	sessions, skipped, err := Sessions(context.Background(), testQuery, "user", 30*time.Minute)
+	assert.NoError(err)
+	assert.Equal(1, skipped)
+	assert.Equal([]Session{
+		{ID: "alice", Start: at(0), End: at(10), Events: 3, Counts: map[logquery.LogLevel]int{logquery.Info: 2, logquery.Error: 1}, Keys: []string{"api", "web"}},
+		{ID: "bob", Start: at(1), End: at(1), Events: 1, Counts: map[logquery.LogLevel]int{logquery.Info: 1}, Keys: []string{"web"}},
+		{ID: "alice", Start: at(50), End: at(55), Events: 2, Counts: map[logquery.LogLevel]int{logquery.Info: 2}, Keys: []string{"api", "web"}},
+	}, sessions)
+	assert.Equal(10*time.Minute, sessions[0].Duration())
+
+	// A longer gap keeps alice in one session
+	sessions, _, err = Sessions(context.Background(), testQuery, "user", time.Hour, logquery.FieldEquals("user", "alice"))
+	assert.NoError(err)
+	assert.Equal(1, len(sessions))
+	assert.Equal(5, sessions[0].Events)
+}
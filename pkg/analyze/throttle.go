@@ -0,0 +1,105 @@
+package analyze
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Suppressed counts the logs of a pattern a Throttle held back during one window
+type Suppressed struct {
+	Key      string
+	Template string
+	Count    int
+	// Start and End are when the window began and ended
+	Start time.Time
+	End   time.Time
+}
+
+// String is the summary line shown in place of the suppressed logs
+func (s Suppressed) String() string {
+	return fmt.Sprintf("[suppressed] %d more logs of %s like %q in %s", s.Count, s.Key, s.Template, s.End.Sub(s.Start))
+}
+
+// Throttle caps how many logs of the same key and pattern are shown per window, so a crash loop
+// repeating one message doesn't drown out everything else in a tail. A pattern's window starts at the
+// first log of it that is shown. Throttle isn't safe to use from several goroutines
+type Throttle struct {
+	limit   int
+	window  time.Duration
+	windows map[string]*throttleWindow
+	// ended are the windows with suppressed logs that ended but weren't flushed yet
+	ended []Suppressed
+}
+
+// throttleWindow is the current window of a pattern
+type throttleWindow struct {
+	suppressed Suppressed
+	shown      int
+}
+
+// NewThrottle returns a Throttle letting through limit logs of every pattern per window
+func NewThrottle(limit int, window time.Duration) *Throttle {
+	return &Throttle{limit: limit, window: window, windows: map[string]*throttleWindow{}}
+}
+
+// Allow returns true if log should be shown at now, false if its pattern is over the limit in the
+// current window
+func (t *Throttle) Allow(log logquery.Log, now time.Time) bool {
+	template := Template(log.Log)
+	id := log.Key + "\x00" + template
+	w, ok := t.windows[id]
+	if ok && !now.Before(w.suppressed.End) {
+		t.end(id, w)
+		ok = false
+	}
+	if !ok {
+		w = &throttleWindow{suppressed: Suppressed{Key: log.Key, Template: template, Start: now, End: now.Add(t.window)}}
+		t.windows[id] = w
+	}
+	if w.shown < t.limit {
+		w.shown++
+		return true
+	}
+	w.suppressed.Count++
+	return false
+}
+
+// Flush returns the windows that ended by now with logs suppressed in them, oldest first
+func (t *Throttle) Flush(now time.Time) []Suppressed {
+	for id, w := range t.windows {
+		if !now.Before(w.suppressed.End) {
+			t.end(id, w)
+		}
+	}
+	rv := t.ended
+	t.ended = nil
+	sort.SliceStable(rv, func(i, j int) bool {
+		if !rv[i].Start.Equal(rv[j].Start) {
+			return rv[i].Start.Before(rv[j].Start)
+		}
+		return rv[i].Key+rv[i].Template < rv[j].Key+rv[j].Template
+	})
+	return rv
+}
+
+// FlushAll ends every window at now, like when the tail stops, and returns the ones with logs
+// suppressed in them
+func (t *Throttle) FlushAll(now time.Time) []Suppressed {
+	for _, w := range t.windows {
+		if w.suppressed.End.After(now) {
+			w.suppressed.End = now
+		}
+	}
+	return t.Flush(now)
+}
+
+// end forgets the window of a pattern, keeping its summary if it suppressed anything
+func (t *Throttle) end(id string, w *throttleWindow) {
+	delete(t.windows, id)
+	if w.suppressed.Count > 0 {
+		t.ended = append(t.ended, w.suppressed)
+	}
+}
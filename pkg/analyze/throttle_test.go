@@ -0,0 +1,42 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2020, 2, 28, 5, 20, 0, 0, time.UTC)
+	throttle := NewThrottle(2, time.Minute)
+	crash := func(n int) logquery.Log {
+		return logquery.Log{Key: "api", Log: "worker 7 crashed, restart " + string(rune('0'+n))}
+	}
+
+	shown := 0
+	for i := 0; i < 6; i++ {
+		if throttle.Allow(crash(i), start.Add(time.Duration(i)*time.Second)) {
+			shown++
+		}
+	}
+	assert.Equal(2, shown)
+	// Other patterns and keys have their own limit
+	assert.True(throttle.Allow(logquery.Log{Key: "api", Log: "request served"}, start.Add(7*time.Second)))
+	assert.True(throttle.Allow(logquery.Log{Key: "db", Log: "worker 7 crashed, restart 9"}, start.Add(8*time.Second)))
+
+	assert.Empty(throttle.Flush(start.Add(30 * time.Second)))
+	suppressed := throttle.Flush(start.Add(time.Minute))
+	assert.Equal([]Suppressed{{Key: "api", Template: "worker <*> crashed, restart <*>", Count: 4, Start: start, End: start.Add(time.Minute)}}, suppressed)
+	assert.Equal(`[suppressed] 4 more logs of api like "worker <*> crashed, restart <*>" in 1m0s`, suppressed[0].String())
+
+	// A new window starts with the next log
+	assert.True(throttle.Allow(crash(1), start.Add(2*time.Minute)))
+	assert.True(throttle.Allow(crash(2), start.Add(2*time.Minute)))
+	assert.False(throttle.Allow(crash(3), start.Add(2*time.Minute)))
+	stop := start.Add(2*time.Minute + 10*time.Second)
+	assert.Equal([]Suppressed{{Key: "api", Template: "worker <*> crashed, restart <*>", Count: 1, Start: start.Add(2 * time.Minute), End: stop}}, throttle.FlushAll(stop))
+	assert.Empty(throttle.FlushAll(stop))
+}
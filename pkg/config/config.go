@@ -0,0 +1,330 @@
+// Package config reads the sources to load and how to parse them from a YAML file, so setups with many
+// files and formats don't need long command lines
+//
+//	levels:
+//	  WARNING: warn
+//	relevel:
+//	  - match: deprecated
+//	    from: error
+//	    to: warn
+//	sources:
+//	  server1:
+//	    path: ./logs/server1.log
+//	  api:
+//	    path: /var/log/api/*.log
+//	    format: json
+//	    time_field: time
+//	    timezone: America/New_York
+//	    labels:
+//	      env: prod
+//	      region: eu
+//	  checkout:
+//	    paths: [./checkout-1.log, ./checkout-2.log]
+//	  worker:
+//	    path: ./worker.log
+//	    extract:
+//	      regex: ['took (?P<duration_ms>\d+)ms']
+//	      key_values: true
+//	  nginx:
+//	    path: journald://nginx.service
+//	  legacy:
+//	    path: ./legacy.log
+//	    format: regex
+//	    regex: '^(?P<time>\S+ \S+) (?P<level>\w+) (?P<msg>.*)$'
+//	    time_layout: 2006-01-02 15:04:05
+//	    levels:
+//	      CRIT: fatal
+//
+// JSON files work too since YAML reads JSON
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the contents of a config file
+type Config struct {
+	// Levels are extra level names for every source, like WARNING: warn. Names are case insensitive and
+	// can only alias debug, info, warn, error or fatal, so TRACE: debug reads trace logs as debug
+	Levels map[string]string `yaml:"levels"`
+	// Relevel are level rules for every source, after the ones of each source
+	Relevel []LevelRule `yaml:"relevel"`
+	// Sources by key
+	Sources map[string]Source `yaml:"sources"`
+}
+
+// Source is a file, directory or glob read under a key and the format of its lines
+type Source struct {
+	Path string `yaml:"path"`
+	// Paths are read under the key along with Path and merged in time order, like the files of every
+	// instance of a service
+	Paths []string `yaml:"paths"`
+	// Format is bracket, the default `[time][level] message` format, regex, json, logfmt, syslog, gelf,
+	// journald or winevent. journald:// and winevent:// paths default to their own format
+	Format string `yaml:"format"`
+	// Regex has the named groups time, level and msg for the regex format
+	Regex string `yaml:"regex"`
+	// TimeLayout is the Go time layout of timestamps in the regex, json and logfmt formats
+	TimeLayout string `yaml:"time_layout"`
+	// TimeField, LevelField and MessageField name the fields of the json and logfmt formats
+	TimeField    string `yaml:"time_field"`
+	LevelField   string `yaml:"level_field"`
+	MessageField string `yaml:"message_field"`
+	// DefaultLevel is the level of lines without one in the regex, json, logfmt, syslog and gelf formats
+	DefaultLevel string `yaml:"default_level"`
+	// Levels are extra level names for this source on top of the top level ones
+	Levels map[string]string `yaml:"levels"`
+	// Timezone is the zone of timestamps without one, like America/New_York
+	Timezone string `yaml:"timezone"`
+	// ClockOffset is added to every timestamp for a host whose clock runs behind, like 2s or -500ms
+	ClockOffset string `yaml:"clock_offset"`
+	// Extract pulls fields out of the messages so they can be queried
+	Extract Extract `yaml:"extract"`
+	// Labels like env: prod pick sources with a label selector, see logquery.WithLabels
+	Labels map[string]string `yaml:"labels"`
+	// Relevel changes the level of this source's logs, the first matching rule wins
+	Relevel []LevelRule `yaml:"relevel"`
+}
+
+// LevelRule changes the level of the logs it matches, see logquery.WithLevelRules
+type LevelRule struct {
+	// Match is a regular expression matched against the message, empty matches every message
+	Match string `yaml:"match"`
+	// From limits the rule to logs at this level, empty matches every level
+	From string `yaml:"from"`
+	// To is the level matched logs get
+	To string `yaml:"to"`
+}
+
+// Extract is how fields are pulled out of messages, see logquery.WithFieldExtraction
+type Extract struct {
+	// Regex are regular expressions whose named groups become fields, like 'took (?P<duration_ms>\d+)ms'
+	Regex []string `yaml:"regex"`
+	// KeyValues extracts every key=value pair in a message
+	KeyValues bool `yaml:"key_values"`
+}
+
+// Load reads the config file at path. Unknown fields are an error so typos don't go unnoticed
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	c := &Config{}
+	if err := decoder.Decode(c); err != nil {
+		return nil, fmt.Errorf("bad config %s, %s", path, err)
+	}
+	return c, nil
+}
+
+// Mapping returns the path of every source by key, as NewLogQuery takes it. Sources with only Paths
+// aren't in it, Options registers them
+func (c *Config) Mapping() map[string]string {
+	rv := map[string]string{}
+	for key, source := range c.Sources {
+		if source.Path != "" {
+			rv[key] = source.Path
+		}
+	}
+	return rv
+}
+
+// Options returns the parser, time zone, label and level rule options of every source for NewLogQuery
+func (c *Config) Options() ([]logquery.Option, error) {
+	globalLevels, err := severities(c.Levels, nil)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for key := range c.Sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rv := []logquery.Option{}
+	rules := []logquery.LevelRule{}
+	for _, key := range keys {
+		source := c.Sources[key]
+		if source.Path == "" && len(source.Paths) == 0 {
+			return nil, fmt.Errorf("source %s has no path", key)
+		}
+		if len(source.Paths) > 0 {
+			rv = append(rv, logquery.WithKeyPaths(key, source.Paths...))
+		}
+		parser, err := source.parser(globalLevels)
+		if err != nil {
+			return nil, fmt.Errorf("source %s, %s", key, err)
+		}
+		rv = append(rv, logquery.WithParser(key, parser))
+		if source.Timezone != "" {
+			loc, err := time.LoadLocation(source.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("source %s, %s", key, err)
+			}
+			rv = append(rv, logquery.WithLocation(key, loc))
+		}
+		if source.ClockOffset != "" {
+			offset, err := time.ParseDuration(source.ClockOffset)
+			if err != nil {
+				return nil, fmt.Errorf("source %s, bad clock_offset, %s", key, err)
+			}
+			rv = append(rv, logquery.WithClockOffset(key, offset))
+		}
+		extractors := []logquery.FieldExtractor{}
+		for _, pattern := range source.Extract.Regex {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("source %s, bad extract regex, %s", key, err)
+			}
+			extractors = append(extractors, logquery.RegexFields{Pattern: re})
+		}
+		if source.Extract.KeyValues {
+			extractors = append(extractors, logquery.KeyValueFields{})
+		}
+		if len(extractors) > 0 {
+			rv = append(rv, logquery.WithFieldExtraction(key, extractors...))
+		}
+		if len(source.Labels) > 0 {
+			rv = append(rv, logquery.WithLabels(key, source.Labels))
+		}
+		for _, rule := range source.Relevel {
+			levelRule, err := rule.levelRule(key)
+			if err != nil {
+				return nil, fmt.Errorf("source %s, %s", key, err)
+			}
+			rules = append(rules, levelRule)
+		}
+	}
+	for _, rule := range c.Relevel {
+		levelRule, err := rule.levelRule("")
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, levelRule)
+	}
+	if len(rules) > 0 {
+		rv = append(rv, logquery.WithLevelRules(rules...))
+	}
+	return rv, nil
+}
+
+// levelRule builds the rule for the logs of key, or every key if it is empty
+func (r LevelRule) levelRule(key string) (logquery.LevelRule, error) {
+	rv := logquery.LevelRule{Key: key}
+	var err error
+	if r.To == "" {
+		return rv, fmt.Errorf("relevel rules need a to level")
+	}
+	if rv.To, err = logquery.ParseLevel(r.To); err != nil {
+		return rv, fmt.Errorf("bad relevel to, %s", err)
+	}
+	if r.From != "" {
+		if rv.From, err = logquery.ParseLevel(r.From); err != nil {
+			return rv, fmt.Errorf("bad relevel from, %s", err)
+		}
+	}
+	if r.Match != "" {
+		if rv.Pattern, err = regexp.Compile(r.Match); err != nil {
+			return rv, fmt.Errorf("bad relevel match, %s", err)
+		}
+	}
+	return rv, nil
+}
+
+// parser builds the parser for the format of the source
+func (s Source) parser(globalLevels logquery.SeverityMap) (logquery.LineParser, error) {
+	levels, err := severities(s.Levels, globalLevels)
+	if err != nil {
+		return nil, err
+	}
+	defaultLevel := logquery.Undefined
+	if s.DefaultLevel != "" {
+		if defaultLevel, err = logquery.ParseLevel(s.DefaultLevel); err != nil {
+			return nil, fmt.Errorf("bad default_level, %s", err)
+		}
+	}
+
+	format, path := s.Format, s.Path
+	if path == "" && len(s.Paths) > 0 {
+		path = s.Paths[0]
+	}
+	for _, scheme := range []string{"journald", "winevent"} {
+		if format == "" && strings.HasPrefix(path, scheme+"://") {
+			format = scheme
+		}
+	}
+	switch format {
+	case "", "bracket":
+		return &logquery.BracketParser{Severities: levels}, nil
+	case "regex":
+		if s.Regex == "" {
+			return nil, fmt.Errorf("the regex format needs a regex")
+		}
+		re, err := regexp.Compile(s.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("bad regex, %s", err)
+		}
+		if s.TimeLayout == "" {
+			return nil, fmt.Errorf("the regex format needs a time_layout")
+		}
+		return &logquery.RegexParser{Regex: re, TimeLayout: s.TimeLayout, DefaultSeverity: defaultLevel, Severities: levels}, nil
+	case "json":
+		return &logquery.JSONParser{
+			TimeField: s.TimeField, LevelField: s.LevelField, MessageField: s.MessageField,
+			TimeLayout: s.TimeLayout, DefaultSeverity: defaultLevel, Severities: levels,
+		}, nil
+	case "logfmt":
+		return &logquery.LogfmtParser{
+			TimeField: s.TimeField, LevelField: s.LevelField, MessageField: s.MessageField,
+			TimeLayout: s.TimeLayout, DefaultSeverity: defaultLevel, Severities: levels,
+		}, nil
+	case "syslog":
+		return &logquery.SyslogParser{DefaultSeverity: defaultLevel}, nil
+	case "gelf":
+		return &logquery.GELFParser{DefaultSeverity: defaultLevel, Severities: levels}, nil
+	case "journald":
+		return &logquery.JournaldParser{}, nil
+	case "winevent":
+		return &logquery.WinEventParser{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected bracket, regex, json, logfmt, syslog, gelf, journald or winevent", s.Format)
+}
+
+// severities parses level names on top of base, nil if there are none. Names differing only in case from
+// one in base replace it
+func severities(names map[string]string, base logquery.SeverityMap) (logquery.SeverityMap, error) {
+	if len(names) == 0 {
+		return base, nil
+	}
+	levels := map[string]logquery.LogLevel{}
+	for name, value := range names {
+		level, err := logquery.ParseLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("bad level for %s, %s", name, err)
+		}
+		levels[name] = level
+	}
+	added, err := logquery.NewSeverityMap(levels)
+	if err != nil {
+		return nil, err
+	}
+	rv := logquery.SeverityMap{}
+	for name, level := range base {
+		rv[name] = level
+	}
+	for name, level := range added {
+		rv[name] = level
+	}
+	return rv, nil
+}
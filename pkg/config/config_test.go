@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "legacy.log")
+	assert.NoError(os.WriteFile(legacy, []byte("2020-02-28 05:20:55 CRIT disk full\n2020-02-28 05:20:56 WARNING disk nearly full\n"), 0644))
+	api := filepath.Join(dir, "api.log")
+	assert.NoError(os.WriteFile(api, []byte(`{"time":"2020-02-28T05:20:57Z","msg":"started in 12ms user=alice"}`+"\n"), 0644))
+	db2 := filepath.Join(dir, "db-2.log")
+	assert.NoError(os.WriteFile(db2, []byte("[02/28/2020 5:20:56.00][info] replica up\n"), 0644))
+	path := filepath.Join(dir, "logparser.yaml")
+	assert.NoError(os.WriteFile(path, []byte(`
+levels:
+  WARNING: warn
+relevel:
+  - match: did not exist
+    to: error
+  - match: rejected
+    from: error
+    to: warn
+sources:
+  server1:
+    path: ../../logs/server1.log
+    labels:
+      env: prod
+    relevel:
+      - match: did not exist
+        to: info
+  db:
+    paths: [../../logs/db_server.log, `+db2+`]
+  api:
+    path: `+api+`
+    format: json
+    time_field: time
+    default_level: info
+    clock_offset: 2s
+    extract:
+      regex: ['in (?P<startup_ms>\d+)ms']
+      key_values: true
+  legacy:
+    path: `+legacy+`
+    format: regex
+    regex: '^(?P<time>\S+ \S+) (?P<level>\w+) (?P<msg>.*)$'
+    time_layout: 2006-01-02 15:04:05
+    timezone: America/New_York
+    levels:
+      CRIT: fatal
+`), 0644))
+
+	c, err := Load(path)
+	assert.NoError(err)
+	assert.Equal("../../logs/server1.log", c.Mapping()["server1"])
+	opts, err := c.Options()
+	assert.NoError(err)
+	testQuery, err := logquery.NewLogQuery(context.Background(), c.Mapping(), opts...)
+	assert.NoError(err)
+	assert.Equal([]string{"api", "db", "legacy", "server1"}, testQuery.Keys())
+
+	logs, _ := testQuery.QueryLogs(context.Background(), logquery.WithKeys("legacy"))
+	assert.Equal(2, len(logs))
+	assert.Equal(logquery.Fatal, logs[0].Severity)
+	// Top level level names apply to every source
+	assert.Equal(logquery.Warn, logs[1].Severity)
+	assert.Equal("America/New_York", logs[0].Time.Location().String())
+	logs, _ = testQuery.QueryLogs(context.Background(), logquery.WithKeys("api"))
+	assert.Equal(logquery.Info, logs[0].Severity)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 59, 0, time.UTC), logs[0].Time)
+	assert.Equal(map[string]string{"startup_ms": "12", "user": "alice"}, logs[0].Fields)
+	assert.Equal(map[string]string{"env": "prod"}, testQuery.Labels("server1"))
+	// The rules of a source come before the top level ones
+	logs, _ = testQuery.QueryLogs(context.Background(), logquery.WithKeys("server1"))
+	assert.Equal([]logquery.LogLevel{logquery.Info, logquery.Info, logquery.Warn, logquery.Fatal}, []logquery.LogLevel{logs[0].Severity, logs[1].Severity, logs[2].Severity, logs[3].Severity})
+	// Both files are merged under db
+	logs, _ = testQuery.QueryLogs(context.Background(), logquery.WithKeys("db"))
+	assert.Equal(5, len(logs))
+	assert.Equal("replica up", logs[1].Log)
+}
+
+func TestLoadErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	for _, bad := range []string{
+		"sources:\n  a:\n    pth: x.log\n",
+		"sources:\n  a:\n    path: x.log\n    format: csv\n",
+		"sources:\n  a:\n    path: x.log\n    format: regex\n",
+		"sources:\n  a:\n    path: x.log\n    levels:\n      CRIT: critical\n",
+		"sources:\n  a:\n    path: x.log\n    levels:\n      Crit: fatal\n      CRIT: error\n",
+		"sources:\n  a:\n    format: json\n",
+		"sources:\n  a:\n    path: x.log\n    timezone: Mars/Base\n",
+		"sources:\n  a:\n    path: x.log\n    clock_offset: 2 seconds\n",
+		"sources:\n  a:\n    path: x.log\n    extract:\n      regex: ['(']\n",
+		"sources:\n  a:\n    path: x.log\n    relevel:\n      - match: x\n",
+		"relevel:\n  - match: '('\n    to: warn\nsources:\n  a:\n    path: x.log\n",
+		"relevel:\n  - from: severe\n    to: warn\nsources:\n  a:\n    path: x.log\n",
+	} {
+		path := filepath.Join(dir, "bad.yaml")
+		assert.NoError(os.WriteFile(path, []byte(bad), 0644))
+		c, err := Load(path)
+		if err == nil {
+			_, err = c.Options()
+		}
+		assert.Error(err, bad)
+	}
+	_, err := Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(err)
+}
+
+func TestSourceFormats(t *testing.T) {
+	assert := assert.New(t)
+	parser, err := Source{Path: "journald://nginx.service"}.parser(nil)
+	assert.NoError(err)
+	assert.IsType(&logquery.JournaldParser{}, parser)
+	parser, err = Source{Path: "./app.log", Format: "journald"}.parser(nil)
+	assert.NoError(err)
+	assert.IsType(&logquery.JournaldParser{}, parser)
+	parser, err = Source{Path: "./graylog.json", Format: "gelf", DefaultLevel: "warn"}.parser(nil)
+	assert.NoError(err)
+	assert.Equal(&logquery.GELFParser{DefaultSeverity: logquery.Warn}, parser)
+	parser, err = Source{Path: "winevent://System"}.parser(nil)
+	assert.NoError(err)
+	assert.IsType(&logquery.WinEventParser{}, parser)
+}
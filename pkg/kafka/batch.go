@@ -0,0 +1,191 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"time"
+)
+
+// castagnoli is the CRC-32C table record batches are checked with
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// batchHeaderSize is the size of a record batch up to its records, after the base offset and length
+const batchHeaderSize = 49
+
+// Attributes of a record batch
+const (
+	compressionMask = 0x07
+	compressionGzip = 1
+	controlBatch    = 0x20
+)
+
+// record is a message of a topic
+type record struct {
+	offset int64
+	time   time.Time
+	key    []byte
+	value  []byte
+}
+
+// decodeBatches reads the records of the v2 record batches in data, the records of a fetch. A fetch can
+// end with part of a batch, it is left for the next one. next is the offset after the last complete
+// batch, so batches holding only transaction markers still move the fetch along
+func decodeBatches(data []byte) (records []record, next int64, err error) {
+	next = -1
+	for len(data) >= 12 {
+		base := int64(binary.BigEndian.Uint64(data))
+		length := int(int32(binary.BigEndian.Uint32(data[8:])))
+		if length < batchHeaderSize {
+			return nil, 0, fmt.Errorf("bad record batch length %d", length)
+		}
+		if len(data)-12 < length {
+			break
+		}
+		batch := data[12 : 12+length]
+		data = data[12+length:]
+
+		if magic := batch[4]; magic != 2 {
+			return nil, 0, fmt.Errorf("message format v%d isn't supported, only v2 record batches are", magic)
+		}
+		if crc := binary.BigEndian.Uint32(batch[5:]); crc32.Checksum(batch[9:], castagnoli) != crc {
+			return nil, 0, fmt.Errorf("record batch at offset %d is corrupt", base)
+		}
+		attributes := binary.BigEndian.Uint16(batch[9:])
+		next = base + int64(int32(binary.BigEndian.Uint32(batch[11:]))) + 1
+		if attributes&controlBatch != 0 {
+			continue
+		}
+		baseTime := int64(binary.BigEndian.Uint64(batch[15:]))
+		count := int(int32(binary.BigEndian.Uint32(batch[45:])))
+		raw := batch[batchHeaderSize:]
+		switch attributes & compressionMask {
+		case 0:
+		case compressionGzip:
+			reader, err := gzip.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, 0, fmt.Errorf("record batch at offset %d, %s", base, err)
+			}
+			if raw, err = ioutil.ReadAll(reader); err != nil {
+				return nil, 0, fmt.Errorf("record batch at offset %d, %s", base, err)
+			}
+		default:
+			return nil, 0, fmt.Errorf("record batch at offset %d is compressed with codec %d, only gzip is supported", base, attributes&compressionMask)
+		}
+
+		d := &decoder{buf: raw}
+		for i := 0; i < count && d.err == nil; i++ {
+			length := d.varint()
+			if d.err == nil && (length < 0 || length > int64(len(d.buf))) {
+				d.err = errTruncated
+			}
+			fields := &decoder{buf: d.take(int(length))}
+			fields.int8()
+			timeDelta := fields.varint()
+			offsetDelta := fields.varint()
+			r := record{offset: base + offsetDelta, key: fields.varBytes(), value: fields.varBytes()}
+			r.time = time.Unix(0, (baseTime+timeDelta)*int64(time.Millisecond))
+			// Headers follow and aren't needed
+			if fields.err != nil {
+				d.err = fields.err
+				break
+			}
+			records = append(records, r)
+		}
+		if d.err != nil {
+			return nil, 0, fmt.Errorf("record batch at offset %d, %s", base, d.err)
+		}
+	}
+	return records, next, nil
+}
+
+// encodeBatch writes records as one uncompressed v2 record batch, their offsets are set by the broker
+func encodeBatch(records []record) []byte {
+	baseTime, maxTime := millis(records[0].time), millis(records[0].time)
+	body := []byte{}
+	for i, r := range records {
+		t := millis(r.time)
+		if t > maxTime {
+			maxTime = t
+		}
+		fields := []byte{0}
+		fields = appendVarint(fields, t-baseTime)
+		fields = appendVarint(fields, int64(i))
+		fields = appendVarBytes(fields, r.key)
+		fields = appendVarBytes(fields, r.value)
+		// No headers
+		fields = appendVarint(fields, 0)
+		body = append(appendVarint(body, int64(len(fields))), fields...)
+	}
+
+	checked := &encoder{}
+	checked.int16(0)
+	checked.int32(int32(len(records) - 1))
+	checked.int64(baseTime)
+	checked.int64(maxTime)
+	// No producer id, epoch or sequence since the producer isn't idempotent
+	checked.int64(-1)
+	checked.int16(-1)
+	checked.int32(-1)
+	checked.int32(int32(len(records)))
+	checked.buf = append(checked.buf, body...)
+
+	batch := &encoder{}
+	batch.int64(0)
+	batch.int32(int32(4 + 1 + 4 + len(checked.buf)))
+	// The partition leader epoch is set by the broker
+	batch.int32(-1)
+	batch.int8(2)
+	batch.int32(int32(crc32.Checksum(checked.buf, castagnoli)))
+	batch.buf = append(batch.buf, checked.buf...)
+	return batch.buf
+}
+
+// millis is t in unix milliseconds, like record timestamps
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// partitionFor picks the partition of a key like the Java client's default partitioner, so logquery and
+// other producers send a key to the same partition
+func partitionFor(key []byte, partitions int) int {
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
+
+// murmur2 is the hash the Java client partitions keys with
+func murmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	length := len(data)
+	h := uint32(seed) ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
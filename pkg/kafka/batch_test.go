@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatches(t *testing.T) {
+	assert := assert.New(t)
+	at := time.Date(2020, 2, 28, 5, 20, 55, 170000000, time.UTC)
+	records := []record{
+		{time: at, key: []byte("api"), value: []byte("first")},
+		{time: at.Add(-time.Second), value: []byte("second")},
+		{time: at.Add(time.Minute), key: []byte("api")},
+	}
+	batch := encodeBatch(records)
+	// The broker sets the base offset of the batch
+	binary.BigEndian.PutUint64(batch, 40)
+
+	// A fetch can end with part of the next batch
+	decoded, next, err := decodeBatches(append(batch, batch[:30]...))
+	assert.NoError(err)
+	assert.Equal(int64(43), next)
+	assert.Equal(3, len(decoded))
+	for i, r := range decoded {
+		assert.Equal(int64(40+i), r.offset)
+		assert.True(records[i].time.Equal(r.time))
+		assert.Equal(records[i].key, r.key)
+		assert.Equal(records[i].value, r.value)
+	}
+
+	// Gzip batches are read too, their crc covers the compressed records
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	_, err = writer.Write(batch[12+batchHeaderSize:])
+	assert.NoError(err)
+	assert.NoError(writer.Close())
+	gzipped := append(append([]byte{}, batch[:12+batchHeaderSize]...), compressed.Bytes()...)
+	binary.BigEndian.PutUint32(gzipped[8:], uint32(len(gzipped)-12))
+	binary.BigEndian.PutUint16(gzipped[21:], compressionGzip)
+	binary.BigEndian.PutUint32(gzipped[17:], crc32.Checksum(gzipped[21:], castagnoli))
+	decoded, _, err = decodeBatches(gzipped)
+	assert.NoError(err)
+	assert.Equal(3, len(decoded))
+	assert.Equal("second", string(decoded[1].value))
+
+	corrupt := append([]byte{}, batch...)
+	corrupt[len(corrupt)-3] ^= 1
+	_, _, err = decodeBatches(corrupt)
+	assert.Error(err)
+	old := append([]byte{}, batch...)
+	old[16] = 1
+	_, _, err = decodeBatches(old)
+	assert.Error(err)
+}
+
+func TestCRC32C(t *testing.T) {
+	assert.Equal(t, uint32(0xe3069283), crc32.Checksum([]byte("123456789"), castagnoli))
+}
+
+func TestMurmur2(t *testing.T) {
+	assert := assert.New(t)
+	// The values the Java client's tests expect
+	for key, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		assert.Equal(want, murmur2([]byte(key)), key)
+	}
+	assert.Equal(partitionFor([]byte("api"), 6), partitionFor([]byte("api"), 6))
+}
@@ -0,0 +1,424 @@
+// Package kafka reads log lines from Kafka topics as a logquery Source and publishes logs to a topic, so
+// logquery can run in a pipeline between topics. It speaks the Kafka protocol itself instead of
+// depending on a client library, using request versions every broker from 1.0 to 4.x accepts. Record
+// batches can be uncompressed or gzip, there is no SASL or TLS
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API keys of the requests that are sent
+const (
+	apiProduce     = 0
+	apiFetch       = 1
+	apiListOffsets = 2
+	apiMetadata    = 3
+)
+
+// Versions of the requests, the oldest ones Kafka 4 still accepts
+const (
+	produceVersion     = 3
+	fetchVersion       = 4
+	listOffsetsVersion = 1
+	metadataVersion    = 4
+)
+
+// Special offsets of a ListOffsets request
+const (
+	earliestOffset int64 = -2
+	latestOffset   int64 = -1
+)
+
+// defaultTimeout bounds a request to a broker when no timeout is set
+const defaultTimeout = 10 * time.Second
+
+// maxResponseSize keeps a broken or hostile broker from making a reader allocate without bound
+const maxResponseSize = 64 << 20
+
+// clientID is how logquery names itself to brokers
+const clientID = "logquery"
+
+// Error is an error code a broker returned
+type Error int16
+
+// errorNames are the codes a reader or producer is likely to see
+var errorNames = map[Error]string{
+	1:  "offset out of range",
+	2:  "corrupt message",
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	7:  "request timed out",
+	10: "message too large",
+	19: "not enough replicas",
+	29: "topic authorization failed",
+}
+
+func (e Error) Error() string {
+	if name, ok := errorNames[e]; ok {
+		return fmt.Sprintf("kafka error %d, %s", int16(e), name)
+	}
+	return fmt.Sprintf("kafka error %d", int16(e))
+}
+
+// cluster sends requests to the brokers of a cluster, one connection per request since logs are read
+// and pushed in batches far apart
+type cluster struct {
+	brokers []string
+	timeout time.Duration
+}
+
+// partition is a partition of a topic and the address of the broker leading it
+type partition struct {
+	id     int32
+	leader string
+}
+
+// request sends a request to the broker at addr and returns a decoder of the response body
+func (c *cluster) request(ctx context.Context, addr string, api int16, version int16, body []byte) (*decoder, error) {
+	timeout := c.timeoutOrDefault()
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// Closing the connection stops the request when ctx is done before the deadline
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	const correlationID = 1
+	header := &encoder{}
+	header.int32(0)
+	header.int16(api)
+	header.int16(version)
+	header.int32(correlationID)
+	header.string(clientID)
+	msg := append(header.buf, body...)
+	binary.BigEndian.PutUint32(msg, uint32(len(msg)-4))
+	if _, err := conn.Write(msg); err != nil {
+		return nil, c.failed(ctx, addr, err)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, c.failed(ctx, addr, err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxResponseSize {
+		return nil, fmt.Errorf("broker %s sent a response of %d bytes", addr, n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, c.failed(ctx, addr, err)
+	}
+	d := &decoder{buf: resp}
+	if id := d.int32(); id != correlationID {
+		return nil, fmt.Errorf("broker %s answered request %d instead of %d", addr, id, correlationID)
+	}
+	return d, nil
+}
+
+// failed returns the error of ctx if it stopped a request instead of the error of the closed connection
+func (c *cluster) failed(ctx context.Context, addr string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("broker %s, %w", addr, err)
+}
+
+// partitions returns the partitions of topic in order, asking each bootstrap broker until one answers
+func (c *cluster) partitions(ctx context.Context, topic string) ([]partition, error) {
+	body := &encoder{}
+	body.array(1)
+	body.string(topic)
+	// allow_auto_topic_creation
+	body.int8(0)
+
+	var lastErr error
+	for _, addr := range c.brokers {
+		d, err := c.request(ctx, addr, apiMetadata, metadataVersion, body.buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		return readMetadata(d, topic)
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("no brokers to ask for topic %s", topic)
+	}
+	return nil, lastErr
+}
+
+// readMetadata reads a v4 metadata response for topic
+func readMetadata(d *decoder, topic string) ([]partition, error) {
+	d.int32() // throttle_time_ms
+	brokers := map[int32]string{}
+	for n := d.array(); n > 0; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+
+	var rv []partition
+	var topicErr error
+	for n := d.array(); n > 0; n-- {
+		code := Error(d.int16())
+		name := d.string()
+		d.int8() // is_internal
+		for p := d.array(); p > 0; p-- {
+			partitionCode := Error(d.int16())
+			id := d.int32()
+			leader := d.int32()
+			d.int32s() // replica_nodes
+			d.int32s() // isr_nodes
+			d.int32s() // offline_replicas
+			if name != topic {
+				continue
+			}
+			addr, ok := brokers[leader]
+			if partitionCode != 0 || !ok {
+				if partitionCode == 0 {
+					partitionCode = 5
+				}
+				topicErr = fmt.Errorf("topic %s partition %d, %w", topic, id, partitionCode)
+			}
+			rv = append(rv, partition{id: id, leader: addr})
+		}
+		if name == topic && code != 0 {
+			topicErr = fmt.Errorf("topic %s, %w", topic, code)
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("metadata for topic %s, %w", topic, d.err)
+	}
+	if topicErr != nil {
+		return nil, topicErr
+	}
+	if len(rv) == 0 {
+		return nil, fmt.Errorf("topic %s, %w", topic, Error(3))
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].id < rv[j].id
+	})
+	return rv, nil
+}
+
+// byLeader groups partitions by the broker leading them so each broker gets one request
+func byLeader(partitions []partition) map[string][]partition {
+	rv := map[string][]partition{}
+	for _, p := range partitions {
+		rv[p.leader] = append(rv[p.leader], p)
+	}
+	return rv
+}
+
+// offsets returns the earliest or latest offset of every partition, the latest is the offset the next
+// message will get
+func (c *cluster) offsets(ctx context.Context, topic string, partitions []partition, which int64) (map[int32]int64, error) {
+	rv := map[int32]int64{}
+	for addr, led := range byLeader(partitions) {
+		body := &encoder{}
+		body.int32(-1) // replica_id
+		body.array(1)
+		body.string(topic)
+		body.array(len(led))
+		for _, p := range led {
+			body.int32(p.id)
+			body.int64(which)
+		}
+		d, err := c.request(ctx, addr, apiListOffsets, listOffsetsVersion, body.buf)
+		if err != nil {
+			return nil, err
+		}
+		for n := d.array(); n > 0; n-- {
+			d.string()
+			for p := d.array(); p > 0; p-- {
+				id := d.int32()
+				code := Error(d.int16())
+				d.int64() // timestamp
+				offset := d.int64()
+				if code != 0 {
+					return nil, fmt.Errorf("offsets of topic %s partition %d, %w", topic, id, code)
+				}
+				rv[id] = offset
+			}
+		}
+		if d.err != nil {
+			return nil, fmt.Errorf("offsets of topic %s, %w", topic, d.err)
+		}
+	}
+	for _, p := range partitions {
+		if _, ok := rv[p.id]; !ok {
+			return nil, fmt.Errorf("offsets of topic %s, partition %d is missing", topic, p.id)
+		}
+	}
+	return rv, nil
+}
+
+// fetch returns the records of a partition from offset on, as many as the broker sends at once. next is
+// where the following fetch starts
+func (c *cluster) fetch(ctx context.Context, topic string, p partition, offset int64) (records []record, next int64, err error) {
+	body := &encoder{}
+	body.int32(-1)      // replica_id
+	body.int32(500)     // max_wait_ms
+	body.int32(1)       // min_bytes
+	body.int32(4 << 20) // max_bytes
+	body.int8(0)        // isolation_level, read uncommitted
+	body.array(1)
+	body.string(topic)
+	body.array(1)
+	body.int32(p.id)
+	body.int64(offset)
+	body.int32(1 << 20) // partition_max_bytes
+	d, err := c.request(ctx, p.leader, apiFetch, fetchVersion, body.buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	d.int32() // throttle_time_ms
+	var data []byte
+	var code Error
+	for n := d.array(); n > 0; n-- {
+		d.string()
+		for n := d.array(); n > 0; n-- {
+			id := d.int32()
+			partitionCode := Error(d.int16())
+			d.int64() // high_watermark
+			d.int64() // last_stable_offset
+			for n := d.array(); n > 0; n-- {
+				d.int64() // producer_id
+				d.int64() // first_offset
+			}
+			records := d.bytes()
+			if id == p.id {
+				data, code = records, partitionCode
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, 0, fmt.Errorf("fetching topic %s partition %d, %w", topic, p.id, d.err)
+	}
+	if code != 0 {
+		return nil, 0, fmt.Errorf("fetching topic %s partition %d, %w", topic, p.id, code)
+	}
+	all, next, err := decodeBatches(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching topic %s partition %d, %w", topic, p.id, err)
+	}
+	// A batch is sent whole even when offset is in the middle of it
+	for _, r := range all {
+		if r.offset >= offset {
+			records = append(records, r)
+		}
+	}
+	if next < offset {
+		next = offset
+	}
+	return records, next, nil
+}
+
+// produce appends the records to their partitions, waiting for every in-sync replica to have them
+func (c *cluster) produce(ctx context.Context, topic string, partitions []partition, records map[int32][]record) error {
+	for addr, led := range byLeader(partitions) {
+		body := &encoder{}
+		body.nullString() // transactional_id
+		body.int16(-1)    // acks from every in-sync replica
+		body.int32(int32(c.timeoutOrDefault() / time.Millisecond))
+		body.array(1)
+		body.string(topic)
+		sent := []partition{}
+		for _, p := range led {
+			if len(records[p.id]) > 0 {
+				sent = append(sent, p)
+			}
+		}
+		if len(sent) == 0 {
+			continue
+		}
+		body.array(len(sent))
+		for _, p := range sent {
+			body.int32(p.id)
+			body.bytes(encodeBatch(records[p.id]))
+		}
+		answered := 0
+		d, err := c.request(ctx, addr, apiProduce, produceVersion, body.buf)
+		if err != nil {
+			return err
+		}
+		for n := d.array(); n > 0; n-- {
+			d.string()
+			for p := d.array(); p > 0; p-- {
+				id := d.int32()
+				code := Error(d.int16())
+				d.int64() // base_offset
+				d.int64() // log_append_time_ms
+				if code != 0 {
+					return fmt.Errorf("producing to topic %s partition %d, %w", topic, id, code)
+				}
+				answered++
+			}
+		}
+		if d.err != nil {
+			return fmt.Errorf("producing to topic %s, %w", topic, d.err)
+		}
+		if answered != len(sent) {
+			return fmt.Errorf("producing to topic %s, broker %s didn't answer for every partition", topic, addr)
+		}
+	}
+	return nil
+}
+
+// timeoutOrDefault is how long a request may take
+func (c *cluster) timeoutOrDefault() time.Duration {
+	if c.timeout <= 0 {
+		return defaultTimeout
+	}
+	return c.timeout
+}
+
+// parseURI splits a kafka://broker:9092,broker2:9092/topic path into its brokers and topic
+func parseURI(uri string) (brokers []string, topic string, err error) {
+	rest := strings.TrimPrefix(uri, Scheme+"://")
+	i := strings.Index(rest, "/")
+	if rest == uri || i <= 0 || i == len(rest)-1 {
+		return nil, "", fmt.Errorf("bad kafka path %s, expected kafka://broker:9092/topic", uri)
+	}
+	for _, broker := range strings.Split(rest[:i], ",") {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			return nil, "", fmt.Errorf("bad broker %q in %s, expected host:port", broker, uri)
+		}
+		brokers = append(brokers, broker)
+	}
+	return brokers, rest[i+1:], nil
+}
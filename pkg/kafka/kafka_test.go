@@ -0,0 +1,320 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBroker is a single broker leading every partition of one topic, it keeps the batches produced to
+// each partition and answers the requests the source and producer send
+type fakeBroker struct {
+	listener net.Listener
+	topic    string
+
+	mutex sync.Mutex
+	// batches are the batches of every partition with their base offsets set
+	batches [][][]byte
+	next    []int64
+}
+
+func newFakeBroker(t *testing.T, topic string, partitions int) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	b := &fakeBroker{listener: listener, topic: topic, batches: make([][][]byte, partitions), next: make([]int64, partitions)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return b
+}
+
+func (b *fakeBroker) uri() string {
+	return Scheme + "://" + b.listener.Addr().String() + "/" + b.topic
+}
+
+// append adds records to a partition as one batch, like a producer other than logquery
+func (b *fakeBroker) append(partition int, records ...record) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	batch := encodeBatch(records)
+	binary.BigEndian.PutUint64(batch, uint64(b.next[partition]))
+	b.batches[partition] = append(b.batches[partition], batch)
+	b.next[partition] += int64(len(records))
+}
+
+// records returns the records of a partition
+func (b *fakeBroker) records(partition int) []record {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	rv := []record{}
+	for _, batch := range b.batches[partition] {
+		records, _, _ := decodeBatches(batch)
+		rv = append(rv, records...)
+	}
+	return rv
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		api := d.int16()
+		d.int16() // version
+		correlationID := d.int32()
+		d.string() // client_id
+		resp := &encoder{}
+		resp.int32(0)
+		resp.int32(correlationID)
+		b.mutex.Lock()
+		switch api {
+		case apiMetadata:
+			b.metadata(resp)
+		case apiListOffsets:
+			b.listOffsets(d, resp)
+		case apiFetch:
+			b.fetch(d, resp)
+		case apiProduce:
+			b.produce(d, resp)
+		}
+		b.mutex.Unlock()
+		binary.BigEndian.PutUint32(resp.buf, uint32(len(resp.buf)-4))
+		if _, err := conn.Write(resp.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) metadata(resp *encoder) {
+	host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	resp.int32(0) // throttle_time_ms
+	resp.array(1)
+	resp.int32(0)
+	resp.string(host)
+	resp.int32(int32(portNumber))
+	resp.nullString()
+	resp.nullString()
+	resp.int32(0)
+	resp.array(1)
+	resp.int16(0)
+	resp.string(b.topic)
+	resp.int8(0)
+	resp.array(len(b.batches))
+	for id := range b.batches {
+		resp.int16(0)
+		resp.int32(int32(id))
+		resp.int32(0)
+		for i := 0; i < 3; i++ {
+			resp.array(1)
+			resp.int32(0)
+		}
+	}
+}
+
+func (b *fakeBroker) listOffsets(d *decoder, resp *encoder) {
+	d.int32() // replica_id
+	resp.array(d.array())
+	resp.string(d.string())
+	n := d.array()
+	resp.array(n)
+	for ; n > 0; n-- {
+		id := d.int32()
+		offset := int64(0)
+		if d.int64() == latestOffset {
+			offset = b.next[id]
+		}
+		resp.int32(id)
+		resp.int16(0)
+		resp.int64(-1)
+		resp.int64(offset)
+	}
+}
+
+func (b *fakeBroker) fetch(d *decoder, resp *encoder) {
+	d.take(17) // replica_id, max_wait_ms, min_bytes, max_bytes, isolation_level
+	resp.int32(0)
+	resp.array(d.array())
+	resp.string(d.string())
+	n := d.array()
+	resp.array(n)
+	for ; n > 0; n-- {
+		id := d.int32()
+		offset := d.int64()
+		d.int32() // partition_max_bytes
+		resp.int32(id)
+		resp.int16(0)
+		resp.int64(b.next[id])
+		resp.int64(b.next[id])
+		resp.array(0)
+		// Like a real broker, every batch holding offset or after it is sent whole
+		data := []byte{}
+		for _, batch := range b.batches[id] {
+			last := int64(binary.BigEndian.Uint64(batch)) + int64(binary.BigEndian.Uint32(batch[23:]))
+			if last >= offset {
+				data = append(data, batch...)
+			}
+		}
+		resp.bytes(data)
+	}
+}
+
+func (b *fakeBroker) produce(d *decoder, resp *encoder) {
+	d.string() // transactional_id
+	d.int16()  // acks
+	d.int32()  // timeout_ms
+	resp.array(d.array())
+	resp.string(d.string())
+	n := d.array()
+	resp.array(n)
+	for ; n > 0; n-- {
+		id := d.int32()
+		batch := append([]byte{}, d.bytes()...)
+		count := int64(binary.BigEndian.Uint32(batch[23:])) + 1
+		binary.BigEndian.PutUint64(batch, uint64(b.next[id]))
+		resp.int32(id)
+		resp.int16(0)
+		resp.int64(b.next[id])
+		resp.int64(-1)
+		b.batches[id] = append(b.batches[id], batch)
+		b.next[id] += count
+	}
+	resp.int32(0) // throttle_time_ms
+}
+
+func line(at time.Time, msg string) record {
+	return record{time: at, value: []byte("[" + at.Format("01/02/2006 3:04:05.00") + "][info] " + msg)}
+}
+
+func TestSource(t *testing.T) {
+	assert := assert.New(t)
+	broker := newFakeBroker(t, "legacy-logs", 2)
+	at := time.Date(2020, 2, 28, 5, 20, 55, 0, time.UTC)
+	broker.append(0, line(at, "first"), line(at.Add(2*time.Second), "third"))
+	broker.append(1, line(at.Add(time.Second), "second"))
+	// Tombstones aren't lines
+	broker.append(1, record{time: at, key: []byte("gone")})
+
+	source := &Source{}
+	logQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{
+		"legacy": broker.uri(),
+	}, logquery.WithSource(Scheme, source))
+	assert.NoError(err)
+	messages := func() []string {
+		logs, err := logQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		rv := []string{}
+		for _, log := range logs {
+			rv = append(rv, log.Log)
+		}
+		return rv
+	}
+	// Partitions are read one after the other and the logs sorted once loaded
+	assert.Equal([]string{"first", "second", "third"}, messages())
+
+	// Refresh only fetches what was produced since, starting in the middle of a batch
+	broker.append(1, line(at.Add(3*time.Second), "fourth"), line(at.Add(4*time.Second), "fifth"))
+	assert.NoError(logQuery.Refresh(context.Background()))
+	assert.Equal([]string{"first", "second", "third", "fourth", "fifth"}, messages())
+	assert.NoError(logQuery.Refresh(context.Background()))
+	assert.Equal(5, len(messages()))
+
+	// Sources that don't remember the last read skip the bytes already read
+	fresh := &Source{}
+	size, err := fresh.Size(context.Background(), broker.uri())
+	assert.NoError(err)
+	r, _, err := fresh.Open(context.Background(), broker.uri(), size-int64(len(line(at, "fifth").value)+1))
+	assert.NoError(err)
+	rest, err := io.ReadAll(r)
+	assert.NoError(err)
+	assert.Equal(string(line(at.Add(4*time.Second), "fifth").value)+"\n", string(rest))
+
+	_, _, err = source.Expand(context.Background(), Scheme+"://localhost:9092/legacy-*")
+	assert.Error(err)
+	for _, uri := range []string{"kafka://localhost:9092", "kafka:///topic", "kafka://localhost/topic", "http://localhost:9092/topic"} {
+		_, _, err = parseURI(uri)
+		assert.Error(err, uri)
+	}
+}
+
+func TestProducer(t *testing.T) {
+	assert := assert.New(t)
+	broker := newFakeBroker(t, "logs", 3)
+	at := time.Date(2020, 2, 28, 5, 20, 55, 0, time.UTC)
+	logs := []logquery.Log{
+		{Time: at, Key: "api", Severity: logquery.Info, Log: "started"},
+		{Time: at.Add(time.Second), Key: "db", Severity: logquery.Error, Log: "disk full"},
+		{Time: at.Add(2 * time.Second), Key: "api", Severity: logquery.Warn, Log: "slow"},
+	}
+	producer := &Producer{Brokers: []string{"127.0.0.1:1", broker.listener.Addr().String()}, Topic: "logs"}
+	assert.NoError(producer.Push(context.Background(), logs))
+
+	// The first broker is down, the second answers. Logs of a key stay in order in their partition
+	api := broker.records(partitionFor([]byte("api"), 3))
+	assert.Equal(2, len(api))
+	for i, want := range []logquery.Log{logs[0], logs[2]} {
+		assert.Equal("api", string(api[i].key))
+		assert.True(want.Time.Equal(api[i].time))
+		got := logquery.Log{}
+		assert.NoError(json.Unmarshal(api[i].value, &got))
+		assert.Equal(want.Log, got.Log)
+		assert.Equal(want.Severity, got.Severity)
+	}
+	total := 0
+	for id := 0; id < 3; id++ {
+		total += len(broker.records(id))
+	}
+	assert.Equal(3, total)
+
+	producer.Topic = "missing"
+	assert.Error(producer.Push(context.Background(), logs))
+}
+
+func TestTail(t *testing.T) {
+	assert := assert.New(t)
+	broker := newFakeBroker(t, "legacy-logs", 2)
+	at := time.Date(2020, 2, 28, 5, 20, 55, 0, time.UTC)
+	broker.append(0, line(at, "already here"))
+	logQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{
+		"legacy": broker.uri(),
+	}, logquery.WithSource(Scheme, &Source{}))
+	assert.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logs, err := logQuery.Tail(ctx, []string{"legacy"}, logquery.Info)
+	assert.NoError(err)
+	broker.append(1, line(at.Add(time.Second), "new"))
+	select {
+	case log := <-logs:
+		assert.Equal("new", log.Log)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for tailed log")
+	}
+	cancel()
+	for range logs {
+	}
+}
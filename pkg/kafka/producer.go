@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Producer publishes logs to a topic, every message holds a log as a logquery.Record in JSON with the
+// log's key as the message key and its time as the message timestamp. Logs of a key go to one partition,
+// picked like the Java client does, so they stay in order
+type Producer struct {
+	// Brokers are the bootstrap brokers like kafka:9092
+	Brokers []string
+	Topic   string
+	// Timeout bounds every request to a broker and defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// Push publishes logs with one request per partition leader, returning once every in-sync replica has
+// them
+func (p *Producer) Push(ctx context.Context, logs []logquery.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	c := &cluster{brokers: p.Brokers, timeout: p.Timeout}
+	partitions, err := c.partitions(ctx, p.Topic)
+	if err != nil {
+		return err
+	}
+	records := map[int32][]record{}
+	for _, log := range logs {
+		value, err := json.Marshal(log.Record())
+		if err != nil {
+			return err
+		}
+		key := []byte(log.Key)
+		partition := partitions[partitionFor(key, len(partitions))]
+		records[partition.id] = append(records[partition.id], record{time: log.Time, key: key, value: value})
+	}
+	return c.produce(ctx, p.Topic, partitions, records)
+}
+
+// Ship pushes every log from logs until the channel is closed, in batches of up to batchSize sent once
+// they have waited for interval. It stops at the first failed push
+func (p *Producer) Ship(ctx context.Context, logs <-chan logquery.Log, batchSize int, interval time.Duration) error {
+	for batch := range logquery.Batches(ctx, logs, batchSize, interval) {
+		if err := p.Push(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
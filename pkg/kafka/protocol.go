@@ -0,0 +1,185 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errTruncated is returned when a response ends before a field it should have
+var errTruncated = errors.New("truncated response")
+
+// encoder writes the fields of a request body in the Kafka protocol's big endian encoding
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.buf = append(e.buf, byte(uint16(v)>>8), byte(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], uint64(v))
+}
+
+// string writes a string with an int16 length
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// nullString writes the null string, used for optional strings like the transactional id
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+// bytes writes bytes with an int32 length
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// array writes the length of an array, its elements follow
+func (e *encoder) array(n int) {
+	e.int32(int32(n))
+}
+
+// decoder reads the fields of a response. The first error is kept and every read after it returns zero
+// values, so a response can be read field by field and checked once at the end
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errTruncated
+		return nil
+	}
+	rv := d.buf[:n]
+	d.buf = d.buf[n:]
+	return rv
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string with an int16 length, a null string is empty
+func (d *decoder) string() string {
+	n := d.int16()
+	if n == -1 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+// bytes reads bytes with an int32 length, null bytes are nil
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n == -1 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// array reads the length of an array, a null array is empty. Every element takes at least a byte so a
+// length longer than what is left is an error instead of a huge allocation
+func (d *decoder) array() int {
+	n := int(d.int32())
+	if n == -1 {
+		return 0
+	}
+	if d.err == nil && (n < 0 || n > len(d.buf)) {
+		d.err = errTruncated
+	}
+	if d.err != nil {
+		return 0
+	}
+	return n
+}
+
+// int32s skips an array of int32, like the replicas of a partition
+func (d *decoder) int32s() {
+	for n := d.array(); n > 0; n-- {
+		d.int32()
+	}
+}
+
+// varint reads a zigzag encoded varint as record fields are written
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("bad varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// varBytes reads bytes with a varint length, a length of -1 is null
+func (d *decoder) varBytes() []byte {
+	n := d.varint()
+	if n == -1 {
+		return nil
+	}
+	if n > int64(len(d.buf)) {
+		d.err = errTruncated
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// appendVarint appends v zigzag encoded like record fields are written
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+// appendVarBytes appends b with a varint length, nil is written as null
+func appendVarBytes(buf []byte, b []byte) []byte {
+	if b == nil {
+		return appendVarint(buf, -1)
+	}
+	return append(appendVarint(buf, int64(len(b))), b...)
+}
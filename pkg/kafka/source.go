@@ -0,0 +1,229 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Scheme is the scheme of paths read by a Source
+const Scheme = "kafka"
+
+// Source reads Kafka topics with paths like kafka://kafka-1:9092,kafka-2:9092/legacy-logs, naming the
+// bootstrap brokers and the topic. A topic reads as a file holding the value of every message followed by
+// a newline, partition after partition from their earliest message, and the logs are sorted by time when
+// they are loaded like the logs of any file. Refresh and Tail only fetch the messages produced since the
+// last read, so a topic is a live source next to local files. Register it with
+// logquery.WithSource(kafka.Scheme, source) and share one Source so it remembers where every topic got to
+type Source struct {
+	// Timeout bounds every request to a broker and defaults to 10 seconds
+	Timeout time.Duration
+
+	mutex sync.Mutex
+	// positions are how far the last complete read or Size of every topic got
+	positions map[string]position
+}
+
+var _ logquery.Source = &Source{}
+
+// position is where a read of a topic ended, size bytes into it with next the offset of the following
+// message of every partition. A Size that continued from an earlier position keeps the lines it read past
+// it, from the byte offset since, so the Open that usually follows doesn't fetch them again
+type position struct {
+	size  int64
+	next  map[int32]int64
+	since int64
+	added []byte
+}
+
+// Expand implements logquery.Source. Every path is a single topic, topics can't be listed
+func (s *Source) Expand(ctx context.Context, uri string) ([]string, bool, error) {
+	_, topic, err := parseURI(uri)
+	if err != nil {
+		return nil, false, err
+	}
+	if strings.ContainsAny(topic, "*?[") {
+		return nil, false, fmt.Errorf("%s, topic patterns aren't supported", uri)
+	}
+	return []string{uri}, false, nil
+}
+
+// Open implements logquery.Source. Reading from where the last read or Size got only fetches newer
+// messages, other offsets read the topic from the start and skip what is before from. The size isn't
+// known until the messages are read, so it is 0
+func (s *Source) Open(ctx context.Context, uri string, from int64) (io.ReadCloser, int64, error) {
+	r, err := s.reader(ctx, uri, from)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.done = func(pos position) {
+		s.store(uri, pos)
+	}
+	return r, 0, nil
+}
+
+// Size implements logquery.Source. It only lists offsets when nothing was produced since the last read,
+// otherwise it fetches the new messages to count their bytes and keeps them for the next Open
+func (s *Source) Size(ctx context.Context, uri string) (int64, error) {
+	r, err := s.reader(ctx, uri, -1)
+	if err != nil {
+		return 0, err
+	}
+	since := r.read
+	added, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	pos := position{size: r.read, next: r.next}
+	// A topic read from the start is read again by Open instead of being kept in memory
+	if since > 0 && len(added) > 0 {
+		pos.since, pos.added = since, added
+	}
+	s.store(uri, pos)
+	return r.read, nil
+}
+
+func (s *Source) store(uri string, pos position) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.positions == nil {
+		s.positions = map[string]position{}
+	}
+	s.positions[uri] = pos
+}
+
+// reader returns a reader of the messages of a topic from the byte offset from. A negative from
+// continues from the last read or Size without skipping anything
+func (s *Source) reader(ctx context.Context, uri string, from int64) (*topicReader, error) {
+	brokers, topic, err := parseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	c := &cluster{brokers: brokers, timeout: s.Timeout}
+	partitions, err := c.partitions(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	earliest, err := c.offsets(ctx, topic, partitions, earliestOffset)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := c.offsets(ctx, topic, partitions, latestOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	last, ok := s.positions[uri]
+	s.mutex.Unlock()
+	r := &topicReader{ctx: ctx, cluster: c, topic: topic, partitions: partitions, end: latest, next: map[int32]int64{}}
+	switch {
+	case ok && (from < 0 || from == last.size):
+		r.read = last.size
+	case ok && last.added != nil && from == last.since:
+		r.read, r.buf = last.since, append([]byte{}, last.added...)
+	case from > 0:
+		r.skip = from
+		ok = false
+	default:
+		ok = false
+	}
+	if ok {
+		for id, next := range last.next {
+			r.next[id] = next
+		}
+	}
+	for _, p := range partitions {
+		// Messages removed by retention since the last read are gone
+		if next, ok := r.next[p.id]; !ok || next < earliest[p.id] {
+			r.next[p.id] = earliest[p.id]
+		}
+	}
+	return r, nil
+}
+
+// topicReader reads the values of the messages of a topic as lines, up to the latest offsets when it
+// was opened
+type topicReader struct {
+	ctx        context.Context
+	cluster    *cluster
+	topic      string
+	partitions []partition
+	end        map[int32]int64
+	next       map[int32]int64
+	// current is the index of the partition being read
+	current int
+	buf     []byte
+	// skip is how many bytes are thrown away before the first one read, read how far into the topic
+	// the reader is
+	skip int64
+	read int64
+	// done is called with where the reader got once it read every message
+	done func(position)
+}
+
+func (r *topicReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 || r.skip > 0 {
+		if r.skip > 0 && len(r.buf) > 0 {
+			n := int64(len(r.buf))
+			if n > r.skip {
+				n = r.skip
+			}
+			r.buf, r.skip, r.read = r.buf[n:], r.skip-n, r.read+n
+			continue
+		}
+		if r.current == len(r.partitions) {
+			if r.done != nil {
+				r.done(position{size: r.read, next: r.next})
+				r.done = nil
+			}
+			return 0, io.EOF
+		}
+		partition := r.partitions[r.current]
+		next := r.next[partition.id]
+		if next >= r.end[partition.id] {
+			r.current++
+			continue
+		}
+		records, after, err := r.cluster.fetch(r.ctx, r.topic, partition, next)
+		if err != nil {
+			return 0, err
+		}
+		if after <= next && len(records) == 0 {
+			return 0, fmt.Errorf("fetching topic %s partition %d stopped at offset %d before %d", r.topic, partition.id, next, r.end[partition.id])
+		}
+		for _, record := range records {
+			if record.offset >= r.end[partition.id] {
+				break
+			}
+			// Messages without a value, like the tombstones of compacted topics, aren't lines
+			if record.value != nil {
+				r.buf = append(append(r.buf, record.value...), '\n')
+			}
+			next = record.offset + 1
+		}
+		// Offsets without a message, like transaction markers, are skipped up to the end of the fetch
+		if after > next {
+			next = after
+		}
+		if next > r.end[partition.id] {
+			next = r.end[partition.id]
+		}
+		r.next[partition.id] = next
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.read += int64(n)
+	return n, nil
+}
+
+// Close implements io.Closer, there is no connection left open between fetches
+func (r *topicReader) Close() error {
+	return nil
+}
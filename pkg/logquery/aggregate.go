@@ -0,0 +1,81 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bucket counts the logs of a key by severity for the bucket starting at Start
+type Bucket struct {
+	Start  time.Time
+	Counts map[LogLevel]int
+}
+
+// Total is the number of logs in the bucket across every severity
+func (b Bucket) Total() int {
+	rv := 0
+	for _, count := range b.Counts {
+		rv += count
+	}
+	return rv
+}
+
+// Aggregation maps a key to its buckets in time order. Buckets between the first and last log of a key
+// are always present, even when they are empty, so they can be graphed directly
+type Aggregation map[string][]Bucket
+
+// Aggregate counts the logs between start and end per severity in buckets of the given size for every
+// key. Buckets are aligned to multiples of bucket since the zero time, so 5m buckets start on :00, :05 etc
+func (l *LogQuery) Aggregate(ctx context.Context, start time.Time, end time.Time, logKeys []string, bucket time.Duration) (Aggregation, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bucket size must be positive")
+	}
+
+	wg := sync.WaitGroup{}
+	rv := Aggregation{}
+	errs := map[string]error{}
+	mutex := sync.Mutex{}
+
+	for _, logKey := range logKeys {
+		wg.Add(1)
+		go func(logKey string) {
+			defer wg.Done()
+			buckets := []Bucket{}
+			_, err := l.eachLog(ctx, logKey, start, func(log *Log) bool {
+				if !end.IsZero() && !log.Time.Before(end) {
+					return false
+				}
+				bucketStart := log.Time.Truncate(bucket)
+				// Fill in any empty buckets since the last log
+				for len(buckets) == 0 || buckets[len(buckets)-1].Start.Before(bucketStart) {
+					next := bucketStart
+					if len(buckets) > 0 {
+						next = buckets[len(buckets)-1].Start.Add(bucket)
+					}
+					buckets = append(buckets, Bucket{Start: next, Counts: map[LogLevel]int{}})
+				}
+				buckets[len(buckets)-1].Counts[log.Severity]++
+				return true
+			})
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs[logKey] = err
+				return
+			}
+			rv[logKey] = buckets
+		}(logKey)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return rv, &LoadError{Errors: errs}
+	}
+	return rv, nil
+}
@@ -0,0 +1,40 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	assert := assert.New(t)
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	})
+
+	aggregation, err := testQuery.Aggregate(context.Background(), time.Time{}, time.Time{}, []string{"server1", "db"}, time.Second)
+	assert.NoError(err)
+
+	server1 := aggregation["server1"]
+	assert.Equal(3, len(server1))
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 55, 0, time.UTC), server1[0].Start)
+	assert.Equal(map[LogLevel]int{Info: 1}, server1[0].Counts)
+	assert.Equal(map[LogLevel]int{Error: 1, Fatal: 1}, server1[2].Counts)
+	assert.Equal(2, server1[2].Total())
+
+	db := aggregation["db"]
+	assert.Equal(3, len(db))
+	assert.Equal(map[LogLevel]int{Info: 1, Warn: 1}, db[2].Counts)
+
+	// Gaps between logs still get a bucket
+	aggregation, err = testQuery.Aggregate(context.Background(), time.Time{}, time.Time{}, []string{"server1"}, 500*time.Millisecond)
+	assert.NoError(err)
+	assert.Equal(5, len(aggregation["server1"]))
+	assert.Equal(0, aggregation["server1"][1].Total())
+
+	_, err = testQuery.Aggregate(context.Background(), time.Time{}, time.Time{}, []string{"server1"}, 0)
+	assert.Error(err)
+}
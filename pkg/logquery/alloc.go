@@ -0,0 +1,73 @@
+package logquery
+
+import (
+	"bytes"
+)
+
+// estimateSample is how much of a file is looked at to estimate how many logs it holds
+const estimateSample = 64 * 1024
+
+// maxEstimatedLogs caps an estimate so a file with a misleading start can't reserve a huge slice
+const maxEstimatedLogs = 1 << 24
+
+// estimateLogs guesses how many logs the remaining bytes of a file hold from the average length of the
+// lines in sample, the start of what is left. A complete sample is all that is left so its lines are
+// counted exactly. Compressed files are estimated from their compressed size, which only underestimates
+// and leaves the rest to append
+func estimateLogs(remaining int64, sample []byte, complete bool) int {
+	if len(sample) == 0 {
+		return 0
+	}
+	lines := bytes.Count(sample, []byte("\n"))
+	if complete {
+		if sample[len(sample)-1] != '\n' {
+			lines++
+		}
+		return lines
+	}
+	if lines == 0 || remaining <= 0 {
+		return 1
+	}
+	rv := remaining / int64(len(sample)/lines)
+	if rv > maxEstimatedLogs {
+		return maxEstimatedLogs
+	}
+	return int(rv)
+}
+
+// maxLogBlock is the most logs a logAllocator allocates at once, bigger blocks save little and a single
+// log still in use keeps its whole block in memory
+const maxLogBlock = 1024
+
+// logAllocator hands out logs from blocks allocated together, so parsing a file takes one allocation per
+// block instead of one per line and leaves the garbage collector far fewer objects to track. It is only
+// worth it when nearly every log is kept, like when a whole file is loaded. It isn't safe to use from
+// several goroutines
+type logAllocator struct {
+	block []Log
+	// size is how many logs the next block holds
+	size int
+}
+
+// newLogAllocator returns an allocator whose first block fits the estimated number of logs
+func newLogAllocator(estimate int) *logAllocator {
+	if estimate <= 0 || estimate > maxLogBlock {
+		estimate = maxLogBlock
+	}
+	return &logAllocator{size: estimate}
+}
+
+// next returns the log the next line can be parsed into. It is only handed out for good by take, so a
+// line that fails to parse leaves it to be reused
+func (a *logAllocator) next() *Log {
+	if len(a.block) == 0 {
+		a.block = make([]Log, a.size)
+		a.size = maxLogBlock
+	}
+	return &a.block[0]
+}
+
+// take hands out the log returned by next
+func (a *logAllocator) take() {
+	a.block = a.block[1:]
+}
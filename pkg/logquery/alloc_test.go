@@ -0,0 +1,44 @@
+package logquery
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateLogs(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(0, estimateLogs(0, nil, true))
+	// Files that fit in the sample are counted exactly
+	assert.Equal(3, estimateLogs(20, []byte("one\ntwo\nthree"), true))
+	assert.Equal(2, estimateLogs(8, []byte("one\ntwo\n"), true))
+
+	line := "[02/28/2020 5:20:57.35][info] Request to open database my_db7\n"
+	sample := []byte(strings.Repeat(line, estimateSample/len(line)+1))[:estimateSample]
+	estimate := estimateLogs(int64(len(line)*100000), sample, false)
+	assert.InDelta(100000, estimate, 100)
+	assert.Equal(maxEstimatedLogs, estimateLogs(1<<40, sample, false))
+	// A sample that is one long line
+	assert.Equal(1, estimateLogs(1<<20, bytes.Repeat([]byte("a"), estimateSample), false))
+}
+
+func TestLogAllocator(t *testing.T) {
+	assert := assert.New(t)
+	alloc := newLogAllocator(2)
+	lines := &lineParser{parser: DefaultParser, key: "db", lenient: true, alloc: alloc}
+	first := lines.parse("[02/28/2020 5:20:55.17][info] first", 1, 0)
+	// Lines that fail leave their log to the next line
+	raw := lines.parse("  at main.go:12", 2, 36)
+	second := lines.parse("[02/28/2020 5:20:56.17][warn] second", 3, 52)
+	third := lines.parse("[02/28/2020 5:20:57.17][error] third", 4, 89)
+
+	assert.Equal("first", first.Log)
+	assert.Equal(Undefined, raw.Severity)
+	assert.Equal(first.Time, raw.Time)
+	assert.Equal(Log{Time: second.Time, Severity: Warn, Log: "second", Key: "db", LineNumber: 3, Offset: 52, TimeString: "[02/28/2020 5:20:56.17]", SeverityString: "[warn]"}, *second)
+	assert.Equal("third", third.Log)
+	// The first two logs fill the first block, the third starts a block of the full size
+	assert.Equal(maxLogBlock-1, len(alloc.block))
+}
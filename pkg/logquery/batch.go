@@ -0,0 +1,53 @@
+package logquery
+
+import (
+	"context"
+	"time"
+)
+
+// Batches groups the logs from a channel like the one from Tail into batches of up to size logs for
+// sinks that send many logs at once. A partial batch is sent once interval passes so a quiet file still
+// goes out promptly. The returned channel is closed after the last batch once logs is closed, or when
+// ctx is done
+func Batches(ctx context.Context, logs <-chan Log, size int, interval time.Duration) <-chan []Log {
+	rv := make(chan []Log)
+	go func() {
+		defer close(rv)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		batch := []Log{}
+		send := func() bool {
+			if len(batch) == 0 {
+				return true
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case rv <- batch:
+				batch = []Log{}
+				return true
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case log, ok := <-logs:
+				if !ok {
+					send()
+					return
+				}
+				batch = append(batch, log)
+				if len(batch) >= size && !send() {
+					return
+				}
+			case <-ticker.C:
+				if !send() {
+					return
+				}
+			}
+		}
+	}()
+	return rv
+}
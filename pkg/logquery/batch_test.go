@@ -0,0 +1,36 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatches(t *testing.T) {
+	assert := assert.New(t)
+	logs := make(chan Log)
+	batches := Batches(context.Background(), logs, 3, time.Hour)
+	go func() {
+		for i := 0; i < 8; i++ {
+			logs <- Log{Log: string(rune('a' + i))}
+		}
+		close(logs)
+	}()
+
+	sizes := []int{}
+	for batch := range batches {
+		sizes = append(sizes, len(batch))
+	}
+	assert.Equal([]int{3, 3, 2}, sizes)
+
+	// A partial batch goes out after the interval
+	logs = make(chan Log)
+	batches = Batches(context.Background(), logs, 3, 10*time.Millisecond)
+	logs <- Log{Log: "a"}
+	assert.Equal([]Log{{Log: "a"}}, <-batches)
+	close(logs)
+	_, ok := <-batches
+	assert.False(ok)
+}
@@ -0,0 +1,212 @@
+package logquery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithCache keeps the parsed logs of every local file, or file of a StatSource, in dir so the next
+// LogQuery over the same files doesn't parse them again. A cached file is parsed again when its size or
+// modification time changes, or it is read with a different parser type, severity aliases, clock offset,
+// time zone, field extractors, redactor names, level rules, lenient, ANSI or max line length setting.
+// Other parser settings aren't noticed, so clear dir when changing them
+func WithCache(dir string) Option {
+	return func(l *LogQuery) {
+		l.readConfig.cacheDir = dir
+	}
+}
+
+// cacheEntry is the parsed contents of a file as stored in the cache
+type cacheEntry struct {
+	// Path, Key, Parser, Lenient, StripANSI, Redactors, LevelRules, MaxLine, Size and ModTime have to match
+	// for the entry to be used
+	Path       string
+	Key        string
+	Parser     string
+	Lenient    bool
+	StripANSI  bool
+	Redactors  string
+	LevelRules string
+	MaxLine    int
+	Size       int64
+	ModTime    int64
+
+	Logs       []*Log
+	Offset     int64
+	Partial    int64
+	Lines      int
+	Compressed bool
+	Encoding   string
+	Skipped    int
+	Last       *Log
+	Failed     int
+	Reasons    map[string]int
+	Samples    []cachedFailure
+}
+
+// cachedFailure is a ParseFailure with the error as text since gob can't encode errors
+type cachedFailure struct {
+	Path string
+	Line string
+	Err  string
+}
+
+// loadFile parses a whole file, using the cached logs if the file hasn't changed since they were stored.
+// Only files of a StatSource that knows their modification time are cached
+func loadFile(ctx context.Context, path string, key string, parser LineParser, cfg readConfig) ([]*Log, fileOffset, error) {
+	if cfg.cacheDir == "" {
+		return processFile(ctx, path, fileOffset{}, key, parser, cfg)
+	}
+	info, ok, err := cfg.stat(ctx, path)
+	if err != nil {
+		return nil, fileOffset{}, err
+	}
+	if !ok {
+		return processFile(ctx, path, fileOffset{}, key, parser, cfg)
+	}
+	want := cacheEntry{
+		Path:       path,
+		Key:        key,
+		Parser:     parserID(parser),
+		Lenient:    cfg.lenient,
+		StripANSI:  cfg.stripANSI,
+		Redactors:  redactorNames(cfg.redactors),
+		LevelRules: levelRuleNames(cfg.levelRules),
+		MaxLine:    cfg.maxLine(),
+		Size:       info.Size,
+		ModTime:    info.ModTime.UnixNano(),
+	}
+	cachePath := filepath.Join(cfg.cacheDir, cacheName(path, key))
+	if entry, ok := readCache(cachePath, want); ok {
+		offset := entry.offset()
+		if cfg.isLocal(path) && offset.resumable() {
+			offset.stamp = stampFile(path, offset.offset)
+		}
+		return entry.Logs, offset, nil
+	}
+
+	logs, offset, err := processFile(ctx, path, fileOffset{}, key, parser, cfg)
+	if err != nil {
+		return nil, offset, err
+	}
+	// The file may have been appended to while it was parsed, only cache what matches the stat
+	if offset.size == want.Size {
+		// The cache only saves work, failing to write it shouldn't fail the load
+		_ = writeCache(cachePath, want.with(logs, offset))
+	}
+	return logs, offset, nil
+}
+
+// parserID identifies the parser of a cached file. The default format's severity aliases are included
+// since they change which lines parse, and so are the settings of the wrappers for clock offsets, time
+// zones and field extraction since they change the logs
+func parserID(parser LineParser) string {
+	switch p := parser.(type) {
+	case *BracketParser:
+		return fmt.Sprintf("%T%v", p, p.Severities)
+	case *clockParser:
+		return fmt.Sprintf("clock(%s)%s", p.offset, parserID(p.parser))
+	case *locationParser:
+		return fmt.Sprintf("location(%s)%s", p.loc, parserID(p.parser))
+	case *fieldParser:
+		extractors := make([]string, len(p.extractors))
+		for i, extractor := range p.extractors {
+			extractors[i] = fmt.Sprintf("%T", extractor)
+			if regex, ok := extractor.(RegexFields); ok {
+				extractors[i] += "(" + regex.Pattern.String() + ")"
+			}
+		}
+		return fmt.Sprintf("fields%v%s", extractors, parserID(p.parser))
+	}
+	return fmt.Sprintf("%T", parser)
+}
+
+// cacheName is the file name of a path's entry in the cache dir
+func cacheName(path string, key string) string {
+	// URIs of other sources are the same from every directory
+	if abs, err := filepath.Abs(path); err == nil && !strings.Contains(path, "://") {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(key + "\x00" + path))
+	return hex.EncodeToString(sum[:]) + ".gob"
+}
+
+// readCache returns the entry at cachePath if it was stored for the same file as want
+func readCache(cachePath string, want cacheEntry) (cacheEntry, bool) {
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	defer file.Close()
+	entry := cacheEntry{}
+	if err := gob.NewDecoder(file).Decode(&entry); err != nil {
+		return cacheEntry{}, false
+	}
+	if entry.Path != want.Path || entry.Key != want.Key || entry.Parser != want.Parser ||
+		entry.Lenient != want.Lenient || entry.StripANSI != want.StripANSI || entry.Redactors != want.Redactors ||
+		entry.LevelRules != want.LevelRules || entry.MaxLine != want.MaxLine || entry.Size != want.Size ||
+		entry.ModTime != want.ModTime {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// writeCache stores entry at cachePath, writing to a temp file first so concurrent readers never see
+// half an entry
+func writeCache(cachePath string, entry cacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(cachePath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := gob.NewEncoder(file).Encode(entry); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), cachePath)
+}
+
+// with returns a copy of the entry holding the parsed logs of the file
+func (e cacheEntry) with(logs []*Log, offset fileOffset) cacheEntry {
+	e.Logs = logs
+	e.Offset, e.Partial, e.Lines, e.Compressed, e.Encoding = offset.offset, offset.partial, offset.lines, offset.compressed, string(offset.encoding)
+	e.Skipped, e.Last = offset.skipped, offset.last
+	e.Failed, e.Reasons = offset.report.Failed, offset.report.Reasons
+	for _, sample := range offset.report.Samples {
+		e.Samples = append(e.Samples, cachedFailure{Path: sample.Path, Line: sample.Line, Err: sample.Err.Error()})
+	}
+	return e
+}
+
+// offset returns how far into the file the cached logs go
+func (e cacheEntry) offset() fileOffset {
+	report := ParseReport{Failed: e.Failed, Reasons: e.Reasons}
+	for _, sample := range e.Samples {
+		report.Samples = append(report.Samples, ParseFailure{Path: sample.Path, Line: sample.Line, Err: errors.New(sample.Err)})
+	}
+	return fileOffset{
+		offset:     e.Offset,
+		partial:    e.Partial,
+		lines:      e.Lines,
+		size:       e.Size,
+		compressed: e.Compressed,
+		encoding:   encoding(e.Encoding),
+		skipped:    e.Skipped,
+		last:       e.Last,
+		report:     report,
+	}
+}
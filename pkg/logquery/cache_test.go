@@ -0,0 +1,70 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	path := filepath.Join(dir, "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] first\nnot a log\n"), 0644))
+	modTime := time.Date(2020, 2, 28, 5, 21, 0, 0, time.UTC)
+	assert.NoError(os.Chtimes(path, modTime, modTime))
+
+	load := func(opts ...Option) (Logs, *LogQuery) {
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path}, append(opts, WithCache(cacheDir))...)
+		assert.NoError(err)
+		logs, err := testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		return logs, testQuery
+	}
+	logs, testQuery := load()
+	assert.Equal("first", logs[0].Log)
+	report := testQuery.ParseReport()["app"]
+	entries, err := os.ReadDir(cacheDir)
+	assert.NoError(err)
+	assert.Equal(1, len(entries))
+
+	// Same size and modification time reads the cache instead of the file
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] fixed\nnot a log\n"), 0644))
+	assert.NoError(os.Chtimes(path, modTime, modTime))
+	logs, testQuery = load()
+	assert.Equal("first", logs[0].Log)
+	assert.True(logs[0].Time.Equal(time.Date(2020, 2, 28, 5, 20, 55, 170000000, time.UTC)))
+	assert.Equal(report.Failed, testQuery.ParseReport()["app"].Failed)
+	assert.Equal(report.Samples[0].Err.Error(), testQuery.ParseReport()["app"].Samples[0].Err.Error())
+
+	// A different clock offset parses it again instead of reading logs with the old offset
+	logs, _ = load(WithClockOffset("app", time.Hour))
+	assert.Equal("fixed", logs[0].Log)
+	assert.True(logs[0].Time.Equal(time.Date(2020, 2, 28, 6, 20, 55, 170000000, time.UTC)))
+	logs, _ = load(WithClockOffset("app", 2*time.Hour))
+	assert.True(logs[0].Time.Equal(time.Date(2020, 2, 28, 7, 20, 55, 170000000, time.UTC)))
+	logs, _ = load(WithMaxLineLength(32))
+	assert.Equal("fi [truncated]", logs[0].Log)
+
+	// Touching the file parses it again
+	assert.NoError(os.Chtimes(path, modTime, modTime.Add(time.Second)))
+	logs, _ = load()
+	assert.Equal("fixed", logs[0].Log)
+
+	// Refresh carries on from the cached offset
+	_, testQuery = load()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(err)
+	_, err = file.WriteString("[02/28/2020 5:20:56.00][warn] second\n")
+	assert.NoError(err)
+	file.Close()
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs, _ = testQuery.QueryLogs(context.Background())
+	assert.Equal(2, len(logs))
+	assert.Equal("second", logs[1].Log)
+}
@@ -0,0 +1,324 @@
+package logquery
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// readConfig controls how files are read
+type readConfig struct {
+	// chunkSize turns on chunked parsing when it is positive, the file is read in chunks of about
+	// this many bytes which are parsed by workers goroutines
+	chunkSize int
+	workers   int
+	// largeFile is how many bytes a file needs left to read to be parsed in chunks without
+	// WithChunkedParsing, see WithLargeFileParsing
+	largeFile int64
+	// lenient keeps lines that can't be parsed, see WithLenientParsing
+	lenient bool
+	// stripANSI removes escape sequences from lines before they are parsed, see WithStripANSI
+	stripANSI bool
+	// retention bounds the logs kept per key, see WithRetention
+	retention Retention
+	// sources by URI scheme, see WithSource
+	sources map[string]Source
+	// cacheDir keeps parsed files between runs when it is set, see WithCache
+	cacheDir string
+	// maxLineLength is where long lines are cut, see WithMaxLineLength
+	maxLineLength int
+	// reorderWindow is how far out of order streamed logs can be, see WithReorderWindow
+	reorderWindow time.Duration
+	// redactors scrub every log as it is parsed, see WithRedactors
+	redactors []Redactor
+	// levelRules reclassify logs as they are parsed, see WithLevelRules
+	levelRules []LevelRule
+	// slots holds a token for every file being read when the number of files read at once is limited,
+	// see WithParallelism
+	slots chan struct{}
+}
+
+// limit runs read once a slot is free when the number of files read at once is limited
+func (c readConfig) limit(ctx context.Context, read func() ([]*Log, fileOffset, error)) ([]*Log, fileOffset, error) {
+	if c.slots == nil {
+		return read()
+	}
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fileOffset{}, ctx.Err()
+	}
+	defer func() { <-c.slots }()
+	return read()
+}
+
+// WithChunkedParsing reads files in chunks of chunkSize bytes cut at newlines and parses up to workers
+// chunks in parallel. At most 2*workers chunks are held in memory at once, so very large files are read
+// with bounded memory no matter how long they are
+func WithChunkedParsing(chunkSize int, workers int) Option {
+	return func(l *LogQuery) {
+		if workers < 1 {
+			workers = 1
+		}
+		l.readConfig.chunkSize = chunkSize
+		l.readConfig.workers = workers
+	}
+}
+
+// defaultLargeFile is the size from which files are parsed in chunks unless WithLargeFileParsing says
+// otherwise
+const defaultLargeFile = 64 << 20
+
+// largeFileChunkSize is the chunk size for large files read without WithChunkedParsing
+const largeFileChunkSize = 4 << 20
+
+// WithLargeFileParsing parses files with at least threshold bytes left to read in chunks cut at newlines
+// on a goroutine per CPU, so one big file isn't parsed by a single goroutine. Files of 64MB or more are
+// parsed this way by default and a threshold below 1 reads every file line by line. It does nothing with
+// WithChunkedParsing, which chunks every file
+func WithLargeFileParsing(threshold int64) Option {
+	return func(l *LogQuery) {
+		if threshold < 1 {
+			threshold = -1
+		}
+		l.readConfig.largeFile = threshold
+	}
+}
+
+// chunked returns the config to read a file with remaining bytes left in chunks, and false if the file
+// is read line by line
+func (c readConfig) chunked(remaining int64) (readConfig, bool) {
+	if c.chunkSize > 0 {
+		return c, true
+	}
+	threshold := c.largeFile
+	if threshold == 0 {
+		threshold = defaultLargeFile
+	}
+	if threshold < 0 || remaining < threshold {
+		return c, false
+	}
+	c.chunkSize, c.workers = largeFileChunkSize, runtime.NumCPU()
+	return c, true
+}
+
+type chunk struct {
+	index int
+	data  []byte
+	// offset and line are where data starts in the file and how many lines are before it
+	offset int64
+	line   int
+}
+
+type parsedChunk struct {
+	index   int
+	logs    []*Log
+	skipped int
+	report  ParseReport
+	// last is the chunk's parser before its last line, lastLogged is set when that line is the last log
+	last       lineUndo
+	lastLogged bool
+}
+
+// scanChunks parses r in parallel chunks and calls fn with the logs in file order until fn returns false
+// or ctx is done. r starts startOffset bytes and startLine lines into the file. It returns the number of
+// bytes and lines read
+func scanChunks(ctx context.Context, r io.Reader, lines *lineParser, cfg readConfig, startOffset int64, startLine int, fn func(*Log) bool) (int64, int, error) {
+	scanCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// tokens bounds how many chunks are read but not handed to fn yet
+	tokens := make(chan struct{}, 2*cfg.workers)
+	chunks := make(chan chunk)
+	results := make(chan parsedChunk)
+	readerDone := make(chan struct{})
+	var read int64
+	var readErr error
+	// lineCount is how many lines were handed over, a line cut at maxLine counts once
+	lineCount := 0
+
+	// Read the chunks in order, cutting each one after its last newline
+	go func() {
+		defer close(readerDone)
+		defer close(chunks)
+		rest := []byte{}
+		index := 0
+		// start is where the first byte of rest is in the file
+		start := startOffset
+		// skipping is set while the rest of a line that was cut is thrown away
+		skipping := false
+		for {
+			select {
+			case tokens <- struct{}{}:
+			case <-scanCtx.Done():
+				return
+			}
+
+			buf := make([]byte, len(rest)+cfg.chunkSize)
+			copy(buf, rest)
+			n, err := io.ReadFull(r, buf[len(rest):])
+			buf = buf[:len(rest)+n]
+			read += int64(n)
+			atEOF := err == io.EOF || err == io.ErrUnexpectedEOF
+			if err != nil && !atEOF {
+				readErr = err
+				return
+			}
+
+			if skipping {
+				newline := bytes.IndexByte(buf, '\n')
+				if newline == -1 && !atEOF {
+					start += int64(len(buf))
+					<-tokens
+					continue
+				}
+				skipping = false
+				if newline == -1 {
+					start += int64(len(buf))
+					buf = buf[:0]
+				} else {
+					start += int64(newline + 1)
+					buf = buf[newline+1:]
+				}
+			}
+
+			data := buf
+			rest = []byte{}
+			next := start + int64(len(buf))
+			if !atEOF {
+				cut := bytes.LastIndexByte(buf, '\n')
+				if cut == -1 && len(buf) > cfg.maxLine() {
+					// Hand over the start of the line and drop the rest of it
+					data = append(truncateLine(buf, cfg.maxLine()), '\n')
+					skipping = true
+				} else if cut == -1 {
+					// A line longer than the chunk, keep reading until it ends
+					rest = buf
+					<-tokens
+					continue
+				} else {
+					data, rest = buf[:cut+1], buf[cut+1:]
+					next = start + int64(cut+1)
+				}
+			}
+
+			select {
+			case chunks <- chunk{index: index, data: data, offset: start, line: startLine + lineCount}:
+			case <-scanCtx.Done():
+				return
+			}
+			lineCount += bytes.Count(data, []byte("\n"))
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				lineCount++
+			}
+			start = next
+			index++
+			if atEOF {
+				return
+			}
+		}
+	}()
+
+	// Parse the chunks in parallel, raw lines are placed once the chunks are back in order
+	wg := sync.WaitGroup{}
+	for i := 0; i < cfg.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chunkLines := &lineParser{parser: lines.parser, key: lines.key, path: lines.path, lenient: lines.lenient, stripANSI: lines.stripANSI, redactors: lines.redactors, levelRules: lines.levelRules, maxLine: lines.maxLine}
+			if lines.alloc != nil {
+				chunkLines.alloc = newLogAllocator(0)
+			}
+			for c := range chunks {
+				chunkLines.skipped, chunkLines.report = 0, ParseReport{}
+				logs, lastLogged := parseChunk(c, chunkLines)
+				select {
+				case results <- parsedChunk{index: c.index, logs: logs, skipped: chunkLines.skipped, report: chunkLines.report, last: chunkLines.undo, lastLogged: lastLogged}:
+				case <-scanCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Hand the logs to fn in file order, holding on to chunks that finished early
+	pending := map[int]parsedChunk{}
+	next := 0
+	stopped := false
+	for result := range results {
+		pending[result.index] = result
+		for parsed, ok := pending[next]; ok && !stopped; parsed, ok = pending[next] {
+			delete(pending, next)
+			next++
+			<-tokens
+			// The last line of the chunk is taken back by lines.undoLast if it turns out to be unfinished
+			undo := lineUndo{failed: lines.report.Failed + parsed.last.failed, samples: len(lines.report.Samples) + parsed.last.samples, reason: parsed.last.reason}
+			if undo.samples > maxParseSamples {
+				undo.samples = maxParseSamples
+			}
+			lines.skipped += parsed.skipped
+			lines.report = lines.report.merge(parsed.report)
+			for i, log := range parsed.logs {
+				if parsed.lastLogged && i == len(parsed.logs)-1 {
+					undo.skipped, undo.outOfOrder, undo.prev = lines.skipped, lines.report.OutOfOrder, lines.prev
+				}
+				if log = lines.place(log); log == nil {
+					continue
+				}
+				if !fn(log) {
+					stopped = true
+					cancel()
+					break
+				}
+			}
+			if !parsed.lastLogged {
+				// The last line was skipped
+				undo.skipped, undo.outOfOrder, undo.prev = lines.skipped-1, lines.report.OutOfOrder, lines.prev
+			}
+			lines.undo = undo
+		}
+	}
+
+	// read and readErr are only safe to use once the reader is done
+	cancel()
+	<-readerDone
+
+	if stopped {
+		return read, lineCount, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return read, lineCount, err
+	}
+	return read, lineCount, readErr
+}
+
+// parseChunk parses every line of a chunk. Raw lines are left at the zero time for lines.place. lastLogged
+// is true when the last line became the last log
+func parseChunk(c chunk, lines *lineParser) (logs []*Log, lastLogged bool) {
+	logs = []*Log{}
+	data, offset, number := c.data, c.offset, c.line
+	for len(data) > 0 {
+		line, next := data, int64(len(data))
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data, next = data[:i], data[i+1:], int64(i+1)
+		} else {
+			data = nil
+		}
+		line = truncateLine(bytes.TrimSuffix(line, []byte("\r")), lines.maxLine)
+		number++
+		lines.undo = lines.mark()
+		log := lines.parseLine(string(line), number, offset)
+		if lastLogged = log != nil; lastLogged {
+			logs = append(logs, log)
+		}
+		offset += next
+	}
+	return logs, lastLogged
+}
@@ -0,0 +1,91 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedParsing(t *testing.T) {
+	assert := assert.New(t)
+	lines := []string{}
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("[02/28/2020 5:%d:%d.00][info] line %d", 10+i/60, i%60, i))
+	}
+	path := filepath.Join(t.TempDir(), "big.log")
+	assert.NoError(os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0644))
+
+	// A chunk smaller than a line still works
+	for _, chunkSize := range []int{10, 100, 4096} {
+		logs, offset, err := processFile(context.Background(), path, fileOffset{}, "big", DefaultParser, readConfig{chunkSize: chunkSize, workers: 4})
+		assert.NoError(err)
+		assert.Equal(1000, len(logs))
+		lineOffset := int64(0)
+		for i, log := range logs {
+			assert.Equal(fmt.Sprintf("line %d", i), log.Log)
+			assert.Equal(i+1, log.LineNumber)
+			assert.Equal(lineOffset, log.Offset)
+			lineOffset += int64(len(lines[i]) + len("\r\n"))
+		}
+		// The last line has no newline, so the offset waits at its start in case it isn't finished
+		assert.Equal(offset.size, offset.read())
+		assert.Equal(int64(len(lines[999])), offset.partial)
+		assert.Equal(999, offset.lines)
+	}
+
+	// Chunks are redacted and reclassified like lines read one at a time
+	cfg := readConfig{chunkSize: 100, workers: 4, redactors: []Redactor{RedactIPs}, levelRules: []LevelRule{{To: Warn}}}
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] from 10.0.0.1\n"), 0644))
+	redacted, _, err := processFile(context.Background(), path, fileOffset{}, "big", DefaultParser, cfg)
+	assert.NoError(err)
+	assert.Equal("from [ip]", redacted[0].Log)
+	assert.Equal(Warn, redacted[0].Severity)
+
+	// Stopping early doesn't hang
+	assert.NoError(os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0644))
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{"big": path}, WithChunkedParsing(64, 4), WithLazyLoading(false))
+	logs, err := testQuery.QueryLogs(context.Background(), WithLimit(5), WithKeys("big"))
+	assert.NoError(err)
+	assert.Equal(5, len(logs))
+	assert.Equal("line 4", logs[4].Log)
+}
+
+func TestLargeFileParsing(t *testing.T) {
+	assert := assert.New(t)
+	cfg, ok := readConfig{}.chunked(defaultLargeFile - 1)
+	assert.False(ok)
+	cfg, ok = readConfig{}.chunked(defaultLargeFile)
+	assert.True(ok)
+	assert.Equal(largeFileChunkSize, cfg.chunkSize)
+	assert.True(cfg.workers > 0)
+	_, ok = readConfig{largeFile: -1}.chunked(1 << 40)
+	assert.False(ok)
+	cfg, ok = readConfig{largeFile: -1, chunkSize: 10, workers: 2}.chunked(0)
+	assert.True(ok)
+	assert.Equal(10, cfg.chunkSize)
+
+	lines := []string{}
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("[02/28/2020 5:%d:%d.00][info] line %d", 10+i/60, i%60, i))
+	}
+	path := filepath.Join(t.TempDir(), "big.log")
+	assert.NoError(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\nnot a log\n"), 0644))
+
+	// Every file counts as large, the logs come back in file order either way
+	for _, threshold := range []int64{1, 0} {
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"big": path}, WithLargeFileParsing(threshold), WithLenientParsing())
+		assert.NoError(err)
+		logs, err := testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		assert.Equal(1001, len(logs))
+		for i, log := range logs[:1000] {
+			assert.Equal(fmt.Sprintf("line %d", i), log.Log)
+		}
+		assert.Equal("not a log", logs[1000].Log)
+	}
+}
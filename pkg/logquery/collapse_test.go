@@ -0,0 +1,87 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapsedRepeats(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "worker.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:50.00][info] starting\n"+
+		"[02/28/2020 5:20:51.00][warn] retrying connection\n"+
+		"[02/28/2020 5:20:52.00][debug] backing off\n"+
+		"[02/28/2020 5:20:53.00][warn] retrying connection\n"+
+		"[02/28/2020 5:20:54.00][warn] retrying connection\n"+
+		"[02/28/2020 5:20:55.00][error] retrying connection\n"+
+		"[02/28/2020 5:20:56.00][info] connected\n"+
+		"[02/28/2020 5:20:57.00][info] connected\n"), 0644))
+
+	for _, lazy := range []bool{false, true} {
+		opts := []Option{}
+		if lazy {
+			opts = append(opts, WithLazyLoading(false))
+		}
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"worker": path}, opts...)
+		assert.NoError(err)
+
+		logs, err := testQuery.QueryLogs(context.Background(), WithCollapsedRepeats(), WithMinSeverity(Info))
+		assert.NoError(err)
+		assert.Equal("[02/28/2020 5:20:50.00][info][worker] starting\n"+
+			"[02/28/2020 5:20:51.00][warn][worker] retrying connection (repeated 2 times)\n"+
+			"[02/28/2020 5:20:55.00][error][worker] retrying connection\n"+
+			"[02/28/2020 5:20:56.00][info][worker] connected (repeated 1 time)", logs.String())
+
+		// Repeats after the last log of a limit are still counted
+		logs, err = testQuery.QueryLogs(context.Background(), WithCollapsedRepeats(), WithMinSeverity(Warn), WithLimit(1))
+		assert.NoError(err)
+		assert.Equal(1, len(logs))
+		assert.Equal(2, logs[0].Repeated)
+
+		// The debug log in between isn't a match so it doesn't break the run, but it is when it matches
+		logs, err = testQuery.QueryLogs(context.Background(), WithCollapsedRepeats())
+		assert.NoError(err)
+		assert.Equal(6, len(logs))
+		assert.Equal(0, logs[1].Repeated)
+		assert.Equal(1, logs[3].Repeated)
+
+		logs, err = testQuery.QueryLogs(context.Background(), WithCollapsedRepeats(), WithMinSeverity(Info), WithDescending(), WithLimit(2))
+		assert.NoError(err)
+		assert.Equal(2, len(logs))
+		assert.Equal("connected", logs[0].Log)
+		assert.Equal(1, logs[0].Repeated)
+		assert.Equal("retrying connection", logs[1].Log)
+		assert.Equal(Error, logs[1].Severity)
+
+		// Pages carry on after the repeats folded into the last log of the previous page
+		for _, descending := range []bool{false, true} {
+			pages := []string{}
+			cursor := ""
+			for i := 0; i < 6; i++ {
+				queryOpts := []QueryOption{WithCollapsedRepeats(), WithMinSeverity(Info), WithLimit(1), WithCursor(cursor)}
+				if descending {
+					queryOpts = append(queryOpts, WithDescending())
+				}
+				page, err := testQuery.QueryPage(context.Background(), queryOpts...)
+				assert.NoError(err)
+				for _, log := range page.Logs {
+					pages = append(pages, log.Log+log.RepeatedString())
+				}
+				if cursor = page.Cursor; cursor == "" {
+					break
+				}
+			}
+			want := []string{"starting", "retrying connection (repeated 2 times)", "retrying connection",
+				"connected (repeated 1 time)"}
+			if descending {
+				want = []string{"connected (repeated 1 time)", "retrying connection",
+					"retrying connection (repeated 2 times)", "starting"}
+			}
+			assert.Equal(want, pages, "descending %v", descending)
+		}
+	}
+}
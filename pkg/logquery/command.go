@@ -0,0 +1,111 @@
+package logquery
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// runCommand runs cmd writing its output to w, name is used in errors
+func runCommand(cmd *exec.Cmd, name string, w io.Writer) error {
+	stderr := bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = w, &stderr
+	return commandError(name, cmd.Run(), stderr.String())
+}
+
+// startCommand starts cmd and returns its output from the byte offset from, for sources that read
+// logs from the output of a command
+func startCommand(cmd *exec.Cmd, name string, from int64) (io.ReadCloser, error) {
+	r := &commandReader{cmd: cmd, name: name}
+	cmd.Stderr = &r.stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	r.stdout = stdout
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if from > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, from); err != nil {
+			r.Close()
+			if err == io.EOF {
+				err = fmt.Errorf("%s printed less than was already read", name)
+			}
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// commandError adds what the command printed to err
+func commandError(name string, err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		return fmt.Errorf("%s failed, %s", name, stderr)
+	}
+	return fmt.Errorf("%s failed, %s", name, err)
+}
+
+// commandReader reads the output of a command and returns its error once the output ends
+type commandReader struct {
+	cmd    *exec.Cmd
+	name   string
+	stdout io.Reader
+	stderr bytes.Buffer
+
+	once sync.Once
+	done bool
+	err  error
+}
+
+func (r *commandReader) Read(p []byte) (int, error) {
+	// The output is closed once the command exited, so later reads get the same result
+	if r.done {
+		if r.err != nil {
+			return 0, r.err
+		}
+		return 0, io.EOF
+	}
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		r.done = true
+		if waitErr := r.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close stops the command if the output wasn't read to the end
+func (r *commandReader) Close() error {
+	r.once.Do(func() {
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	})
+	return nil
+}
+
+// wait waits for the command to exit
+func (r *commandReader) wait() error {
+	r.once.Do(func() {
+		r.err = commandError(r.name, r.cmd.Wait(), r.stderr.String())
+	})
+	return r.err
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
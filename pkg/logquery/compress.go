@@ -0,0 +1,74 @@
+package logquery
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// openLog opens a log file and transparently decompresses it. Compression is detected from the magic
+// bytes so rotated files like app.log.1.gz work as well as compressed files without an extension.
+// UTF-16 and latin-1 logs are transcoded to UTF-8 and byte order marks are skipped. Reading starts at
+// the byte offset from, which has to be 0 for compressed and transcoded files
+func openLog(ctx context.Context, source Source, filePath string, from int64) (*logFile, error) {
+	file, size, err := source.Open(ctx, filePath, from)
+	if err != nil {
+		return nil, err
+	}
+	if from > 0 {
+		return &logFile{Reader: file, closers: []io.Closer{file}, size: size}, nil
+	}
+
+	rv := &logFile{closers: []io.Closer{file}, size: size}
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		rv.closers = []io.Closer{gzipReader, file}
+		rv.compressed = true
+		reader = bufio.NewReader(gzipReader)
+	case bytes.HasPrefix(magic, zstdMagic) || strings.HasSuffix(filePath, ".zst"):
+		file.Close()
+		return nil, fmt.Errorf("zstd compressed logs are not supported, decompress %s first", filePath)
+	}
+	rv.Reader, rv.encoding, rv.bom = detectEncoding(reader)
+	return rv, nil
+}
+
+// logFile reads the decompressed contents of a file and closes the decompressor and the underlying
+// file together
+type logFile struct {
+	io.Reader
+	closers []io.Closer
+
+	// size is the on disk size of the file when it was opened
+	size       int64
+	compressed bool
+	encoding   encoding
+	// bom is how many bytes of byte order mark were skipped before Reader
+	bom int64
+}
+
+func (d *logFile) Close() error {
+	var rv error
+	for _, closer := range d.closers {
+		if err := closer.Close(); err != nil && rv == nil {
+			rv = err
+		}
+	}
+	return rv
+}
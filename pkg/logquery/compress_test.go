@@ -0,0 +1,35 @@
+package logquery
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessGzipFile(t *testing.T) {
+	assert := assert.New(t)
+	raw, err := os.ReadFile("../../logs/server1.log")
+	assert.NoError(err)
+
+	path := filepath.Join(t.TempDir(), "server1.log.1.gz")
+	file, err := os.Create(path)
+	assert.NoError(err)
+	writer := gzip.NewWriter(file)
+	_, err = writer.Write(raw)
+	assert.NoError(err)
+	assert.NoError(writer.Close())
+	assert.NoError(file.Close())
+
+	logs, _, err := processFile(context.Background(), path, fileOffset{}, "server1", DefaultParser, readConfig{})
+	assert.NoError(err)
+	assert.Equal(4, len(logs))
+
+	zstdPath := filepath.Join(t.TempDir(), "server1.log.zst")
+	assert.NoError(os.WriteFile(zstdPath, append(zstdMagic, 0, 0), 0644))
+	_, _, err = processFile(context.Background(), zstdPath, fileOffset{}, "server1", DefaultParser, readConfig{})
+	assert.Error(err)
+}
@@ -0,0 +1,116 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// These are mostly for go test -race, they also check no logs are lost or read twice while refreshing
+
+func TestConcurrentQueryRefreshTail(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	line := func(i int) string {
+		return fmt.Sprintf("[02/28/2020 5:%02d:%02d.%02d][warn] line %d\n", 20+i/6000, i/100%60, i%100, i)
+	}
+	assert.NoError(os.WriteFile(path, []byte(line(0)), 0644))
+	extra := filepath.Join(dir, "extra.log")
+	assert.NoError(os.WriteFile(extra, []byte(line(0)), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path, "server1": "../../logs/server1.log"})
+	assert.NoError(err)
+	testQuery.pollInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tailed, err := testQuery.Tail(ctx, []string{"app"}, Info)
+	assert.NoError(err)
+
+	const lines = 300
+	wg := sync.WaitGroup{}
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		assert.NoError(err)
+		defer file.Close()
+		for i := 1; i < lines; i++ {
+			_, err := file.WriteString(line(i))
+			assert.NoError(err)
+			time.Sleep(50 * time.Microsecond)
+		}
+	}()
+	// until runs fn over and over until the writer is done
+	until := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				fn()
+			}
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		until(func() {
+			assert.NoError(testQuery.Refresh(ctx))
+		})
+	}
+	until(func() {
+		_, err := testQuery.QueryLogs(ctx, WithMinSeverity(Warn))
+		assert.NoError(err)
+	})
+	until(func() {
+		_, err := testQuery.QueryResult(ctx, WithGroupBy("key"), WithLimit(5))
+		assert.NoError(err)
+	})
+	until(func() {
+		it := testQuery.Iter(ctx, WithDescending())
+		for it.Next() {
+		}
+		assert.NoError(it.Err())
+		it.Close()
+	})
+	until(func() {
+		assert.NoError(testQuery.AddSource(ctx, "extra", extra))
+		testQuery.Keys()
+		testQuery.ParseReport()
+		assert.NoError(testQuery.RemoveSource("extra"))
+	})
+	wg.Wait()
+
+	assert.NoError(testQuery.Refresh(ctx))
+	logs, err := testQuery.QueryLogs(ctx, WithKeys("app"))
+	assert.NoError(err)
+	assert.Equal(lines, len(logs))
+	for i, log := range logs {
+		assert.Equal(fmt.Sprintf("line %d", i), log.Log)
+	}
+
+	// Every line written after Tail started comes through once
+	for i := 1; i < lines; i++ {
+		select {
+		case log := <-tailed:
+			assert.Equal(fmt.Sprintf("line %d", i), log.Log)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for tailed log")
+		}
+	}
+	cancel()
+	for range tailed {
+	}
+}
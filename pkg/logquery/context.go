@@ -0,0 +1,94 @@
+package logquery
+
+import (
+	"context"
+	"time"
+)
+
+// WithContext adds up to before logs ahead of every match and after logs following it from the same key,
+// like grep's -B and -A, so errors come with their lead-up and aftermath. The added logs have Context set,
+// they don't have to match the filters and don't count towards the limits. Iter doesn't add context
+func WithContext(before int, after int) QueryOption {
+	return func(o *QueryOptions) {
+		o.Before, o.After = before, after
+	}
+}
+
+// addContext adds the logs around the matches in logs from their keys, keeping the order of logs
+func (l *LogQuery) addContext(ctx context.Context, logs []Log, o QueryOptions) ([]Log, error) {
+	// The matches of every key in file order
+	matches := map[string][]Log{}
+	for _, log := range logs {
+		matches[log.Key] = append(matches[log.Key], log)
+	}
+	if o.Descending {
+		for key, keyMatches := range matches {
+			matches[key] = reverseLogs(keyMatches)
+		}
+	}
+
+	withContext := map[string][]Log{}
+	for key, keyMatches := range matches {
+		keyLogs := []Log{}
+		// recent holds the logs before the next match that may be its context
+		recent := []Log{}
+		trailing := 0
+		if _, err := l.eachLog(ctx, key, time.Time{}, func(log *Log) bool {
+			if len(keyMatches) > 0 && sameLog(&keyMatches[0], log) {
+				keyLogs = append(keyLogs, recent...)
+				keyLogs = append(keyLogs, keyMatches[0])
+				keyMatches, recent, trailing = keyMatches[1:], recent[:0], o.After
+				return true
+			}
+			if trailing > 0 {
+				trailing--
+				surrounding := *log
+				surrounding.Context = true
+				keyLogs = append(keyLogs, surrounding)
+				return true
+			}
+			if len(keyMatches) == 0 {
+				return false
+			}
+			if o.Before > 0 {
+				if len(recent) == o.Before {
+					recent = append(recent[:0], recent[1:]...)
+				}
+				surrounding := *log
+				surrounding.Context = true
+				recent = append(recent, surrounding)
+			}
+			return true
+		}); err != nil {
+			return logs, err
+		}
+		// Matches that couldn't be found again, like logs of a file that changed since, are kept as is
+		withContext[key] = append(keyLogs, keyMatches...)
+	}
+
+	total := 0
+	for _, keyLogs := range withContext {
+		total += len(keyLogs)
+	}
+	rv := logMerge(withContext, time.Time{}, total)
+	if o.Descending {
+		rv = reverseLogs(rv)
+	}
+	return rv, nil
+}
+
+// matchCount returns how many of logs matched, leaving out the logs WithContext added
+func matchCount(logs []Log) int {
+	n := 0
+	for _, log := range logs {
+		if !log.Context {
+			n++
+		}
+	}
+	return n
+}
+
+// sameLog returns true if match was made from log
+func sameLog(match *Log, log *Log) bool {
+	return match.Time.Equal(log.Time) && match.Severity == log.Severity && match.Log == log.Log
+}
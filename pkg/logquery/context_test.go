@@ -0,0 +1,51 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	for _, opts := range [][]Option{nil, {WithLazyLoading(false)}} {
+		testQuery, _ := NewLogQuery(context.Background(), testFileMappings, opts...)
+
+		// The lead up to the first error comes from its own key only
+		logs, err := testQuery.QueryLogs(context.Background(), WithMinSeverity(Error), WithLimit(1), WithContext(2, 0))
+		assert.NoError(err)
+		assert.Equal([]string{
+			"Opening database “my_db7” for write. ",
+			"Database “my_db7” did not exist, creating...",
+			"Could not create database “my_db7”. Database server rejected request. ",
+		}, messages(logs))
+		assert.Equal([]bool{true, true, false}, []bool{logs[0].Context, logs[1].Context, logs[2].Context})
+
+		// Context that overlaps the next match isn't repeated
+		logs, _ = testQuery.QueryLogs(context.Background(), WithKeys("db"), WithMinSeverity(Warn), WithContext(1, 1))
+		assert.Equal(4, len(logs))
+		assert.Equal([]bool{true, false, true, false}, []bool{logs[0].Context, logs[1].Context, logs[2].Context, logs[3].Context})
+
+		// Newest first keeps the context next to its match
+		logs, _ = testQuery.QueryLogs(context.Background(), WithKeys("server1"), WithMinSeverity(Fatal), WithDescending(), WithContext(1, 0))
+		assert.Equal(2, len(logs))
+		assert.Equal(Fatal, logs[0].Severity)
+		assert.True(logs[1].Context)
+	}
+
+	// Context logs don't count towards the page
+	testQuery, _ := NewLogQuery(context.Background(), testFileMappings)
+	page, err := testQuery.QueryPage(context.Background(), WithMinSeverity(Error), WithLimit(1), WithContext(1, 0))
+	assert.NoError(err)
+	assert.Equal(2, len(page.Logs))
+	page, _ = testQuery.QueryPage(context.Background(), WithMinSeverity(Error), WithLimit(1), WithContext(1, 0), WithCursor(page.Cursor))
+	assert.Equal(Fatal, page.Logs[1].Severity)
+	assert.Equal(Error, page.Logs[0].Severity)
+	assert.True(page.Logs[0].Context)
+}
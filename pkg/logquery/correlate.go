@@ -0,0 +1,11 @@
+package logquery
+
+import "context"
+
+// Correlate returns every log of every key whose field is value, merged in time order, so the logs of a
+// single request or trace can be followed from service to service. Only parsers with structured
+// fields, like JSON, logfmt or syslog, can be correlated. opts can narrow the query further, by default
+// there is no limit
+func (l *LogQuery) Correlate(ctx context.Context, field string, value string, opts ...QueryOption) (Logs, error) {
+	return l.QueryLogs(ctx, append(opts, FieldEquals(field, value))...)
+}
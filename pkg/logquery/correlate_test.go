@@ -0,0 +1,41 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelate(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	api, db := filepath.Join(dir, "api.log"), filepath.Join(dir, "db.log")
+	assert.NoError(os.WriteFile(api, []byte(
+		"ts=2020-02-28T05:20:55Z level=info msg=\"GET /orders\" request_id=abc\n"+
+			"ts=2020-02-28T05:20:56Z level=info msg=\"GET /users\" request_id=def\n"+
+			"ts=2020-02-28T05:20:58Z level=error msg=\"500 /orders\" request_id=abc\n"), 0644))
+	assert.NoError(os.WriteFile(db, []byte(
+		`{"ts": "2020-02-28T05:20:55.5Z", "level": "info", "msg": "select orders", "request_id": "abc"}`+"\n"+
+			`{"ts": "2020-02-28T05:20:56.5Z", "level": "info", "msg": "select users", "request_id": "def"}`+"\n"+
+			`{"ts": "2020-02-28T05:20:57Z", "level": "error", "msg": "deadlock", "request_id": "abc"}`+"\n"), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"api": api, "db": db},
+		WithParser("api", &LogfmtParser{}), WithParser("db", &JSONParser{}))
+	assert.NoError(err)
+
+	logs, err := testQuery.Correlate(context.Background(), "request_id", "abc")
+	assert.NoError(err)
+	journey := []string{}
+	for _, log := range logs {
+		journey = append(journey, log.Key+": "+log.Log)
+	}
+	assert.Equal([]string{"api: GET /orders", "db: select orders", "db: deadlock", "api: 500 /orders"}, journey)
+
+	logs, err = testQuery.Correlate(context.Background(), "request_id", "abc", WithMinSeverity(Error), WithKeys("db"))
+	assert.NoError(err)
+	assert.Equal(1, len(logs))
+	assert.Equal("deadlock", logs[0].Log)
+}
@@ -0,0 +1,143 @@
+package logquery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a cursor passed to WithCursor can't be used
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is one page of a paginated query
+type Page struct {
+	Logs Logs
+	// Cursor fetches the next page when passed to WithCursor, it is empty once there are no more logs
+	Cursor string
+	// Limited is true if the query stopped on one of its QueryLimits, the logs are the ones found before
+	Limited bool
+}
+
+// WithCursor continues a query from the Cursor of a previous Page. The other options should be the same
+// as the query that returned the cursor
+func WithCursor(cursor string) QueryOption {
+	return func(o *QueryOptions) {
+		o.Cursor = cursor
+	}
+}
+
+// QueryPage is the same as QueryLogs but also returns a cursor to fetch the next Limit logs without
+// going over the logs that were already returned
+func (l *LogQuery) QueryPage(ctx context.Context, opts ...QueryOption) (*Page, error) {
+	o := l.queryOptions(opts)
+	prev, err := decodeCursor(o.Cursor, o.Descending)
+	if err != nil {
+		return nil, err
+	}
+	logs, limited, err := l.query(ctx, o, prev, nil)
+	var loadErr *LoadError
+	if err != nil && !errors.As(err, &loadErr) {
+		return nil, err
+	}
+
+	page := &Page{Logs: logs, Limited: limited}
+	// A limited query can carry on from where it stopped like any other page
+	if matchCount(logs) == o.TotalLimit || (limited && len(logs) > 0) {
+		page.Cursor = nextCursor(prev, logs, o.Descending).encode()
+	}
+	return page, err
+}
+
+// cursor is where every key got to in the previous pages. It is sent to clients as base64 encoded JSON
+type cursor struct {
+	Descending bool                `json:"desc,omitempty"`
+	Positions  map[string]position `json:"keys"`
+}
+
+// position is the time of the last log returned for a key and how many matches from that exact time on
+// were returned, so logs sharing a timestamp are neither repeated nor dropped. Repeats folded into a log
+// by WithCollapsedRepeats are counted with it
+type position struct {
+	Time int64 `json:"t"`
+	Skip int   `json:"n"`
+}
+
+func decodeCursor(value string, descending bool) (*cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Descending != descending {
+		return nil, fmt.Errorf("%w, it is for a query in the other direction", ErrInvalidCursor)
+	}
+	return c, nil
+}
+
+// position returns where key got to, a nil cursor has no positions
+func (c *cursor) position(key string) (position, bool) {
+	if c == nil {
+		return position{}, false
+	}
+	pos, ok := c.Positions[key]
+	return pos, ok
+}
+
+func (c *cursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// nextCursor moves every key in prev past the logs of the page
+func nextCursor(prev *cursor, logs Logs, descending bool) *cursor {
+	next := &cursor{Descending: descending, Positions: map[string]position{}}
+	if prev != nil {
+		for key, pos := range prev.Positions {
+			next.Positions[key] = pos
+		}
+	}
+	for _, log := range logs {
+		// Context logs weren't counted as matches so the next page doesn't skip them
+		if log.Context {
+			continue
+		}
+		// A collapsed log stands for the matches it folded in too, they come right after it in a key so
+		// an ascending page skips them as well. A descending page ends before them anyway
+		count := 1
+		if !descending {
+			count += log.Repeated
+		}
+		pos := next.Positions[log.Key]
+		if t := log.Time.UnixNano(); pos.Time == t {
+			pos.Skip += count
+		} else {
+			pos = position{Time: t, Skip: count}
+		}
+		next.Positions[log.Key] = pos
+	}
+	return next
+}
+
+// resume moves the filter to a position from a cursor
+func (f *logFilter) resume(pos position, descending bool) {
+	t := time.Unix(0, pos.Time)
+	f.skip = pos.Skip
+	if descending {
+		f.end = t.Add(time.Nanosecond)
+	} else {
+		f.start = t.Add(-time.Nanosecond)
+	}
+	if f.latest {
+		// The window has to hold the skipped logs too as they're dropped from the end
+		f.entries += f.skip
+	}
+}
@@ -0,0 +1,59 @@
+package logquery
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryPage(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	// Several logs share a timestamp across and within files
+	assert.NoError(os.WriteFile(filepath.Join(dir, "a.log"), []byte(
+		"[02/28/2020 5:20:55.00][info] a1\n"+
+			"[02/28/2020 5:20:56.00][info] a2\n"+
+			"[02/28/2020 5:20:56.00][warn] a3\n"+
+			"[02/28/2020 5:20:56.00][info] a4\n"+
+			"[02/28/2020 5:20:58.00][info] a5\n"), 0644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "b.log"), []byte(
+		"[02/28/2020 5:20:56.00][info] b1\n"+
+			"[02/28/2020 5:20:57.00][info] b2\n"+
+			"[02/28/2020 5:20:59.00][info] b3\n"), 0644))
+	mappings := map[string]string{"a": filepath.Join(dir, "a.log"), "b": filepath.Join(dir, "b.log")}
+
+	for _, lazy := range []bool{false, true} {
+		opts := []Option{}
+		if lazy {
+			opts = append(opts, WithLazyLoading(false))
+		}
+		testQuery, err := NewLogQuery(context.Background(), mappings, opts...)
+		assert.NoError(err)
+
+		for _, descending := range []QueryOption{WithOptions(QueryOptions{}), WithDescending()} {
+			all, _ := testQuery.QueryLogs(context.Background(), descending)
+			assert.Equal(8, len(all))
+
+			paged := Logs{}
+			page := &Page{}
+			for i := 0; i == 0 || page.Cursor != ""; i++ {
+				page, err = testQuery.QueryPage(context.Background(), descending, WithLimit(3), WithCursor(page.Cursor))
+				assert.NoError(err)
+				paged = append(paged, page.Logs...)
+			}
+			// Logs from different keys at the same time can merge in either order
+			assert.ElementsMatch(all, paged)
+		}
+	}
+
+	testQuery, _ := NewLogQuery(context.Background(), mappings)
+	page, _ := testQuery.QueryPage(context.Background(), WithLimit(2))
+	_, err := testQuery.QueryPage(context.Background(), WithLimit(2), WithDescending(), WithCursor(page.Cursor))
+	assert.True(errors.Is(err, ErrInvalidCursor))
+	_, err = testQuery.QueryLogs(context.Background(), WithCursor("not a cursor"))
+	assert.True(errors.Is(err, ErrInvalidCursor))
+}
@@ -0,0 +1,131 @@
+package logquery
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DuplicatePolicy decides what happens when files end up under a key that already has files, like two
+// globs matching files with the same name, or when the same file is registered under two keys. Keys are
+// registered in sorted order so first and last are the same every time
+type DuplicatePolicy int
+
+const (
+	// DuplicateError fails with an error naming the key or file, this is the default
+	DuplicateError DuplicatePolicy = iota
+	// DuplicateMerge reads the files of both under the key, merged in time order. A file registered under
+	// two keys is only read under the first one
+	DuplicateMerge
+	// DuplicateOverride keeps the files registered last under a key. A file registered under two keys is
+	// only read under the last one
+	DuplicateOverride
+)
+
+var duplicatePolicyNames = map[DuplicatePolicy]string{
+	DuplicateError:    "error",
+	DuplicateMerge:    "merge",
+	DuplicateOverride: "override",
+}
+
+func (p DuplicatePolicy) String() string {
+	if name, ok := duplicatePolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+}
+
+// ParseDuplicatePolicy parses error, merge or override
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	for policy, name := range duplicatePolicyNames {
+		if strings.EqualFold(s, name) {
+			return policy, nil
+		}
+	}
+	return DuplicateError, fmt.Errorf("unknown duplicate policy %q, expected error, merge or override", s)
+}
+
+// WithDuplicatePolicy sets what happens to files registered under a key more than once or under more than
+// one key, by default it is an error. It applies to NewLogQuery and AddSource
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(l *LogQuery) {
+		l.duplicates = policy
+	}
+}
+
+// pathRegistry adds the files of keys following a DuplicatePolicy
+type pathRegistry struct {
+	policy   DuplicatePolicy
+	keyPaths map[string][]string
+	// owners is the key of every registered file
+	owners map[string]string
+}
+
+func newPathRegistry(policy DuplicatePolicy, keyPaths map[string][]string) *pathRegistry {
+	r := &pathRegistry{policy: policy, keyPaths: keyPaths, owners: map[string]string{}}
+	for key, paths := range keyPaths {
+		for _, path := range paths {
+			r.owners[path] = key
+		}
+	}
+	return r
+}
+
+// add registers paths under key, from is the file the key was named after if it came from a glob. Slices
+// in keyPaths are replaced instead of appended to since queries may be reading them
+func (r *pathRegistry) add(key string, paths []string, from string) error {
+	if existing, ok := r.keyPaths[key]; ok {
+		switch r.policy {
+		case DuplicateError:
+			if from != "" {
+				return fmt.Errorf("key %s from %s is used more than once", key, from)
+			}
+			return fmt.Errorf("key %s is used more than once", key)
+		case DuplicateOverride:
+			for _, path := range existing {
+				delete(r.owners, path)
+			}
+			delete(r.keyPaths, key)
+		}
+	}
+
+	kept := []string{}
+	for _, path := range paths {
+		owner, ok := r.owners[path]
+		switch {
+		case !ok:
+			kept = append(kept, path)
+			r.owners[path] = key
+		case owner == key || r.policy == DuplicateMerge:
+			// Already read under a key, or matched twice by the paths of key
+		case r.policy == DuplicateError:
+			return fmt.Errorf("%s is registered under both %s and %s", path, owner, key)
+		default:
+			r.remove(owner, path)
+			kept = append(kept, path)
+			r.owners[path] = key
+		}
+	}
+	_, ok := r.keyPaths[key]
+	if len(kept) == 0 && (ok || len(paths) > 0) {
+		// Every file is already read under another key
+		return nil
+	}
+	r.keyPaths[key] = append(append([]string{}, r.keyPaths[key]...), kept...)
+	return nil
+}
+
+// remove takes path away from key, dropping the key once it has no files left
+func (r *pathRegistry) remove(key string, path string) {
+	paths := []string{}
+	for _, p := range r.keyPaths[key] {
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+	delete(r.owners, path)
+	if len(paths) == 0 {
+		delete(r.keyPaths, key)
+		return
+	}
+	r.keyPaths[key] = paths
+}
@@ -0,0 +1,90 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicatePolicy(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	for _, sub := range []string{"a", "b"} {
+		assert.NoError(os.Mkdir(filepath.Join(dir, sub), 0755))
+		line := "[02/28/2020 5:20:55.17][info] from " + sub + "\n"
+		if sub == "b" {
+			line = "[02/28/2020 5:20:54.17][info] from b\n"
+		}
+		assert.NoError(os.WriteFile(filepath.Join(dir, sub, "app.log"), []byte(line), 0644))
+	}
+	globs := map[string]string{"a": filepath.Join(dir, "a", "*.log"), "b": filepath.Join(dir, "b", "*.log")}
+
+	// Both globs have an app.log
+	_, err := NewLogQuery(context.Background(), globs)
+	assert.EqualError(err, "key app from "+filepath.Join(dir, "b", "app.log")+" is used more than once")
+
+	testQuery, err := NewLogQuery(context.Background(), globs, WithDuplicatePolicy(DuplicateMerge))
+	assert.NoError(err)
+	logs, err := testQuery.Query(context.Background())
+	assert.NoError(err)
+	assert.Equal("[02/28/2020 5:20:54.17][info][app] from b\n[02/28/2020 5:20:55.17][info][app] from a", logs)
+
+	testQuery, err = NewLogQuery(context.Background(), globs, WithDuplicatePolicy(DuplicateOverride))
+	assert.NoError(err)
+	logs, err = testQuery.Query(context.Background())
+	assert.NoError(err)
+	assert.Equal("[02/28/2020 5:20:54.17][info][app] from b", logs)
+
+	// The same file under two keys
+	same := map[string]string{"first": "../../logs/db_server.log", "second": "../../logs/db_server.log"}
+	_, err = NewLogQuery(context.Background(), same)
+	assert.EqualError(err, "../../logs/db_server.log is registered under both first and second")
+	testQuery, err = NewLogQuery(context.Background(), same, WithDuplicatePolicy(DuplicateMerge))
+	assert.NoError(err)
+	assert.Equal([]string{"first"}, testQuery.Keys())
+	testQuery, err = NewLogQuery(context.Background(), same, WithDuplicatePolicy(DuplicateOverride))
+	assert.NoError(err)
+	assert.Equal([]string{"second"}, testQuery.Keys())
+}
+
+func TestAddSourceDuplicates(t *testing.T) {
+	assert := assert.New(t)
+	mapping := map[string]string{"server": "../../logs/server1.log"}
+
+	testQuery, err := NewLogQuery(context.Background(), mapping)
+	assert.NoError(err)
+	assert.EqualError(testQuery.AddSource(context.Background(), "server", "../../logs/db_server.log"), "key server is used more than once")
+
+	testQuery, err = NewLogQuery(context.Background(), mapping, WithDuplicatePolicy(DuplicateMerge))
+	assert.NoError(err)
+	before, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.NoError(testQuery.AddSource(context.Background(), "server", "../../logs/db_server.log"))
+	logs, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Len(logs, len(before)+4)
+
+	testQuery, err = NewLogQuery(context.Background(), mapping, WithDuplicatePolicy(DuplicateOverride))
+	assert.NoError(err)
+	assert.NoError(testQuery.AddSource(context.Background(), "server", "../../logs/db_server.log"))
+	logs, err = testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Len(logs, 4)
+	// Taking the only file of a key drops the key
+	assert.NoError(testQuery.AddSource(context.Background(), "db", "../../logs/db_server.log"))
+	assert.Equal([]string{"db"}, testQuery.Keys())
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	assert := assert.New(t)
+	for _, policy := range []DuplicatePolicy{DuplicateError, DuplicateMerge, DuplicateOverride} {
+		parsed, err := ParseDuplicatePolicy(policy.String())
+		assert.NoError(err)
+		assert.Equal(policy, parsed)
+	}
+	_, err := ParseDuplicatePolicy("last")
+	assert.Error(err)
+}
@@ -0,0 +1,264 @@
+package logquery
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Record is the flat form of a Log written by the encoders
+type Record struct {
+	Time     time.Time         `json:"time"`
+	Key      string            `json:"key"`
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Repeated int               `json:"repeated,omitempty"`
+	Context  bool              `json:"context,omitempty"`
+	// Path, Line and Offset locate the line the log was read from when they are known
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+}
+
+// Record returns the flat form of the log
+func (l Log) Record() Record {
+	return Record{
+		Time:     l.Time,
+		Key:      l.Key,
+		Severity: strings.ToLower(l.Severity.String()),
+		Message:  l.Log,
+		Fields:   l.Fields,
+		Repeated: l.Repeated,
+		Context:  l.Context,
+		Path:     l.Path,
+		Line:     l.LineNumber,
+		Offset:   l.Offset,
+	}
+}
+
+// Formats are the formats NewEncoder writes
+var Formats = []string{"text", "ndjson", "json", "csv", "parquet"}
+
+// Encoder writes logs one at a time in a format, so a result can be written without holding all of it
+// in memory
+type Encoder interface {
+	Encode(log Log) error
+	// Close finishes the output, like the closing bracket of a JSON array. It doesn't close the writer
+	Close() error
+}
+
+// NewEncoder returns an Encoder writing format to w. text is Log.String per line, ndjson a JSON
+// Record per line, json an array of Records, csv a header row and a row per log and parquet a Parquet
+// file. parquet holds the whole result in memory until Close
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	switch format {
+	case "text":
+		return &textEncoder{w: w}, nil
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return &ndjsonEncoder{encoder: encoder}, nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return &jsonEncoder{w: w, encoder: encoder}, nil
+	case "csv":
+		return &csvEncoder{writer: csv.NewWriter(w)}, nil
+	case "parquet":
+		return &parquetEncoder{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected %s", format, strings.Join(Formats, ", "))
+}
+
+// templateFuncs are the functions templates of NewTemplateEncoder can call on top of the text/template
+// builtins
+var templateFuncs = template.FuncMap{
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"sanitize": Sanitize,
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// NewTemplateEncoder returns an Encoder executing a text/template for every log, followed by a newline,
+// like `{{.Time.Format "15:04:05"}} {{.Key}} {{.SeverityString}} {{.Log}}`. The template sees the Log
+// and can call lower, upper, sanitize, which makes a value safe to print to a terminal, and json. The
+// output isn't sanitized, so it is exactly what the template says. The template is tried on an empty
+// log so typos like {{.Mesage}} are an error here instead of at the first log
+func NewTemplateEncoder(format string, w io.Writer) (Encoder, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(ioutil.Discard, Log{}); err != nil {
+		return nil, err
+	}
+	return &templateEncoder{w: w, tmpl: tmpl}, nil
+}
+
+type templateEncoder struct {
+	w    io.Writer
+	tmpl *template.Template
+	buf  bytes.Buffer
+}
+
+func (e *templateEncoder) Encode(log Log) error {
+	// A log is written whole or not at all when the template fails partway
+	e.buf.Reset()
+	if err := e.tmpl.Execute(&e.buf, log); err != nil {
+		return err
+	}
+	e.buf.WriteByte('\n')
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *templateEncoder) Close() error {
+	return nil
+}
+
+// FormatForPath picks the format of a file from its extension, .txt and .log are text, .ndjson and
+// .jsonl are ndjson, .json is json, .csv is csv and .parquet is parquet. It returns an empty string for
+// anything else
+func FormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt", ".log":
+		return "text"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case ".json":
+		return "json"
+	case ".csv":
+		return "csv"
+	case ".parquet":
+		return "parquet"
+	}
+	return ""
+}
+
+// Encode writes every log with e and closes it
+func (l Logs) Encode(e Encoder) error {
+	for _, log := range l {
+		if err := e.Encode(log); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+type textEncoder struct {
+	w io.Writer
+}
+
+func (e *textEncoder) Encode(log Log) error {
+	_, err := fmt.Fprintln(e.w, log.String())
+	return err
+}
+
+func (e *textEncoder) Close() error {
+	return nil
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(log Log) error {
+	return e.encoder.Encode(log.Record())
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// jsonEncoder writes a JSON array with a Record per line
+type jsonEncoder struct {
+	w       io.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+func (e *jsonEncoder) Encode(log Log) error {
+	separator := ","
+	if e.count == 0 {
+		separator = "["
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	// The encoder ends every Record with the newline between the elements
+	return e.encoder.Encode(log.Record())
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// csvHeader are the columns written by the csv format. Fields are written as a JSON object
+var csvHeader = []string{"time", "key", "severity", "message", "fields"}
+
+type csvEncoder struct {
+	writer *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) Encode(log Log) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	record := log.Record()
+	fields := ""
+	if len(record.Fields) > 0 {
+		encoded, err := json.Marshal(record.Fields)
+		if err != nil {
+			return err
+		}
+		fields = string(encoded)
+	}
+	return e.writer.Write([]string{record.Time.Format(time.RFC3339Nano), record.Key, record.Severity, record.Message, fields})
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.writer.Write(csvHeader)
+}
+
+func (e *csvEncoder) Close() error {
+	// The header is written even when there are no logs
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// EncodeNDJSON writes one JSON Record per line, ready to be piped into jq
+func (l Logs) EncodeNDJSON(w io.Writer) error {
+	e, _ := NewEncoder("ndjson", w)
+	return l.Encode(e)
+}
+
+// EncodeCSV writes the logs as CSV with a header row
+func (l Logs) EncodeCSV(w io.Writer) error {
+	e, _ := NewEncoder("csv", w)
+	return l.Encode(e)
+}
@@ -0,0 +1,100 @@
+package logquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoders(t *testing.T) {
+	assert := assert.New(t)
+	logs := Logs{
+		{Time: time.Date(2020, 2, 28, 5, 20, 57, 350000000, time.UTC), Severity: Error, Log: `say "hi", bye`, Key: "server1"},
+		{Time: time.Date(2020, 2, 28, 5, 20, 58, 0, time.UTC), Severity: Info, Log: "a <b>", Key: "db", Fields: map[string]string{"user": "42"}, Path: "db.log", LineNumber: 7, Offset: 420},
+	}
+
+	buf := bytes.Buffer{}
+	assert.NoError(logs.EncodeNDJSON(&buf))
+	assert.Equal(`{"time":"2020-02-28T05:20:57.35Z","key":"server1","severity":"error","message":"say \"hi\", bye"}
+{"time":"2020-02-28T05:20:58Z","key":"db","severity":"info","message":"a <b>","fields":{"user":"42"},"path":"db.log","line":7,"offset":420}
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(logs.EncodeCSV(&buf))
+	assert.Equal(`time,key,severity,message,fields
+2020-02-28T05:20:57.35Z,server1,error,"say ""hi"", bye",
+2020-02-28T05:20:58Z,db,info,a <b>,"{""user"":""42""}"
+`, buf.String())
+}
+
+func TestTemplateEncoder(t *testing.T) {
+	assert := assert.New(t)
+	logs := Logs{
+		{Time: time.Date(2020, 2, 28, 5, 20, 57, 0, time.UTC), Severity: Error, Log: "failed \x1b[2J", Key: "server1", SeverityString: "[error]", Fields: map[string]string{"user": "alice"}},
+		{Time: time.Date(2020, 2, 28, 5, 20, 58, 0, time.UTC), Severity: Info, Log: `say "hi"`, Key: "db", SeverityString: "[info]"},
+	}
+
+	buf := bytes.Buffer{}
+	e, err := NewTemplateEncoder(`{{.Time.Format "15:04:05"}} {{.Key}} {{.SeverityString}} {{.Log | sanitize}}`, &buf)
+	assert.NoError(err)
+	assert.NoError(logs.Encode(e))
+	assert.Equal("05:20:57 server1 [error] failed \n05:20:58 db [info] say \"hi\"\n", buf.String())
+
+	buf.Reset()
+	e, err = NewTemplateEncoder(`{{lower .Severity.String}},{{index .Fields "user"}},{{json .Log}}`, &buf)
+	assert.NoError(err)
+	assert.NoError(logs.Encode(e))
+	assert.Equal("error,alice,\"failed \\u001b[2J\"\ninfo,,\"say \\\"hi\\\"\"\n", buf.String())
+
+	for _, bad := range []string{"{{.Mesage}}", "{{.Log", "{{nope .Log}}"} {
+		_, err := NewTemplateEncoder(bad, &buf)
+		assert.Error(err, bad)
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	assert := assert.New(t)
+	logs := Logs{
+		{Time: time.Date(2020, 2, 28, 5, 20, 57, 0, time.UTC), Severity: Error, Log: "failed", Key: "server1", TimeString: "[02/28/2020 5:20:57.00]", SeverityString: "[error]"},
+		{Time: time.Date(2020, 2, 28, 5, 20, 58, 0, time.UTC), Severity: Info, Log: "a <b>", Key: "db", TimeString: "[02/28/2020 5:20:58.00]", SeverityString: "[info]"},
+	}
+
+	buf := bytes.Buffer{}
+	e, err := NewEncoder("json", &buf)
+	assert.NoError(err)
+	assert.NoError(logs.Encode(e))
+	assert.Equal(`[{"time":"2020-02-28T05:20:57Z","key":"server1","severity":"error","message":"failed"}
+,{"time":"2020-02-28T05:20:58Z","key":"db","severity":"info","message":"a <b>"}
+]
+`, buf.String())
+	decoded := []Record{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(2, len(decoded))
+
+	buf.Reset()
+	e, _ = NewEncoder("json", &buf)
+	assert.NoError(Logs{}.Encode(e))
+	assert.Equal("[]\n", buf.String())
+
+	buf.Reset()
+	e, _ = NewEncoder("csv", &buf)
+	assert.NoError(Logs{}.Encode(e))
+	assert.Equal("time,key,severity,message,fields\n", buf.String())
+
+	buf.Reset()
+	e, _ = NewEncoder("text", &buf)
+	assert.NoError(logs.Encode(e))
+	assert.Equal("[02/28/2020 5:20:57.00][error][server1] failed\n[02/28/2020 5:20:58.00][info][db] a <b>\n", buf.String())
+
+	_, err = NewEncoder("xml", &buf)
+	assert.Error(err)
+
+	assert.Equal("json", FormatForPath("out/results.JSON"))
+	assert.Equal("ndjson", FormatForPath("results.jsonl"))
+	assert.Equal("csv", FormatForPath("results.csv"))
+	assert.Equal("text", FormatForPath("results.txt"))
+	assert.Equal("", FormatForPath("results"))
+}
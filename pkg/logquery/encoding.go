@@ -0,0 +1,230 @@
+package logquery
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encoding is a text encoding logs are transcoded to UTF-8 from, the zero value is UTF-8 itself
+type encoding string
+
+const (
+	encodingUTF8    encoding = ""
+	encodingUTF16LE encoding = "utf-16le"
+	encodingUTF16BE encoding = "utf-16be"
+	encodingLatin1  encoding = "latin-1"
+)
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// encodingSample is how many bytes at the start of a file are looked at to detect its encoding
+const encodingSample = 4096
+
+// windows1252 maps the bytes 0x80 to 0x9f, which are control characters in latin-1 but punctuation like
+// curly quotes and the euro sign in the Windows code page most latin-1 logs are really written in. The
+// bytes Windows leaves undefined stay control characters
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// detectEncoding returns a reader of the UTF-8 text of r, the encoding it was transcoded from and how
+// many bytes of byte order mark were skipped. Byte order marks are trusted, UTF-16 without one is
+// recognized by the zero bytes of its ASCII characters, and text that isn't valid UTF-8 and has no
+// zero bytes is read as latin-1
+func detectEncoding(r *bufio.Reader) (io.Reader, encoding, int64) {
+	sample, err := r.Peek(encodingSample)
+	enc, bom := sniffEncoding(sample, err != nil)
+	if _, err := r.Discard(bom); err != nil {
+		return r, encodingUTF8, 0
+	}
+	if enc == encodingUTF8 {
+		return r, enc, int64(bom)
+	}
+	return &decodingReader{r: r, encoding: enc}, enc, int64(bom)
+}
+
+// sniffEncoding returns the encoding of a file starting with sample and the length of its byte order
+// mark. complete is true if sample is the whole file
+func sniffEncoding(sample []byte, complete bool) (encoding, int) {
+	switch {
+	case bytes.HasPrefix(sample, utf8BOM):
+		return encodingUTF8, len(utf8BOM)
+	case bytes.HasPrefix(sample, utf16LEBOM):
+		return encodingUTF16LE, len(utf16LEBOM)
+	case bytes.HasPrefix(sample, utf16BEBOM):
+		return encodingUTF16BE, len(utf16BEBOM)
+	}
+
+	// ASCII characters in UTF-16 have a zero byte, which is the second one in little endian
+	units := len(sample) / 2
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < units*2; i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	switch {
+	case units < 2:
+	case oddZeros > units/2 && evenZeros < units/10:
+		return encodingUTF16LE, 0
+	case evenZeros > units/2 && oddZeros < units/10:
+		return encodingUTF16BE, 0
+	}
+
+	if !complete {
+		// The sample may end in the middle of a character
+		for i := 1; i <= utf8.UTFMax && i <= len(sample); i++ {
+			if utf8.RuneStart(sample[len(sample)-i]) {
+				if !utf8.FullRune(sample[len(sample)-i:]) {
+					sample = sample[:len(sample)-i]
+				}
+				break
+			}
+		}
+	}
+	if !utf8.Valid(sample) && bytes.IndexByte(sample, 0) == -1 {
+		return encodingLatin1, 0
+	}
+	return encodingUTF8, 0
+}
+
+// fileEncoding returns the encoding of the local file at path
+func fileEncoding(path string) (encoding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return encodingUTF8, err
+	}
+	defer file.Close()
+	sample := make([]byte, encodingSample)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return encodingUTF8, err
+	}
+	enc, _ := sniffEncoding(sample[:n], n < len(sample))
+	return enc, nil
+}
+
+// lineEnd returns how many bytes of data go up to and including its last newline, 0 if it has none
+func (e encoding) lineEnd(data []byte) int {
+	switch e {
+	case encodingUTF16LE, encodingUTF16BE:
+		newline := []byte{'\n', 0}
+		if e == encodingUTF16BE {
+			newline = []byte{0, '\n'}
+		}
+		for i := len(data)&^1 - 2; i >= 0; i -= 2 {
+			if bytes.Equal(data[i:i+2], newline) {
+				return i + 2
+			}
+		}
+		return 0
+	}
+	return bytes.LastIndexByte(data, '\n') + 1
+}
+
+// decode appends the UTF-8 of src to dst and returns it with how many bytes of src were decoded. The
+// end of src is left when it could be the start of a character unless atEOF is set, and invalid
+// characters are replaced with U+FFFD
+func (e encoding) decode(dst []byte, src []byte, atEOF bool) ([]byte, int) {
+	switch e {
+	case encodingUTF16LE, encodingUTF16BE:
+		var order binary.ByteOrder = binary.LittleEndian
+		if e == encodingUTF16BE {
+			order = binary.BigEndian
+		}
+		i := 0
+		for ; i+2 <= len(src); i += 2 {
+			r := rune(order.Uint16(src[i:]))
+			if utf16.IsSurrogate(r) {
+				if i+4 > len(src) {
+					if !atEOF {
+						break
+					}
+					r = utf8.RuneError
+				} else if pair := utf16.DecodeRune(r, rune(order.Uint16(src[i+2:]))); pair != utf8.RuneError {
+					r = pair
+					i += 2
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			dst = appendRune(dst, r)
+		}
+		if atEOF && i < len(src) {
+			dst = appendRune(dst, utf8.RuneError)
+			i = len(src)
+		}
+		return dst, i
+	case encodingLatin1:
+		for _, b := range src {
+			if b < utf8.RuneSelf {
+				dst = append(dst, b)
+			} else if b < 0xa0 {
+				dst = appendRune(dst, windows1252[b-0x80])
+			} else {
+				dst = appendRune(dst, rune(b))
+			}
+		}
+		return dst, len(src)
+	}
+	return append(dst, src...), len(src)
+}
+
+// appendRune appends the UTF-8 of r to dst
+func appendRune(dst []byte, r rune) []byte {
+	buf := [utf8.UTFMax]byte{}
+	n := utf8.EncodeRune(buf[:], r)
+	return append(dst, buf[:n]...)
+}
+
+// decodingReader transcodes what it reads from r to UTF-8
+type decodingReader struct {
+	r        io.Reader
+	encoding encoding
+	buf, out []byte
+	// raw has the bytes read from r that weren't decoded yet, like half of a UTF-16 character
+	raw []byte
+	// pending has the decoded bytes that weren't returned yet
+	pending []byte
+	err     error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// fill reads from r and decodes what it can, the decoded bytes were all returned already
+func (d *decodingReader) fill() {
+	if d.buf == nil {
+		d.buf = make([]byte, encodingSample)
+	}
+	copy(d.buf, d.raw)
+	n, err := d.r.Read(d.buf[len(d.raw):])
+	data := d.buf[:len(d.raw)+n]
+	d.err = err
+	var used int
+	d.out, used = d.encoding.decode(d.out[:0], data, err != nil)
+	d.pending = d.out
+	d.raw = append(d.raw[:0], data[used:]...)
+}
@@ -0,0 +1,114 @@
+package logquery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeUTF16 returns s in UTF-16 with the byte order
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	rv := []byte{}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		rv = append(rv, 0, 0)
+		order.PutUint16(rv[len(rv)-2:], unit)
+	}
+	return rv
+}
+
+func TestDetectEncoding(t *testing.T) {
+	assert := assert.New(t)
+	text := "[02/28/2020 5:20:55.17][info] café 🚀 “quoted”\r\n[02/28/2020 5:20:56.17][error] ünïcode\r\n"
+	for name, test := range map[string]struct {
+		raw  []byte
+		enc  encoding
+		bom  int64
+		want string
+	}{
+		"utf-8":           {[]byte(text), encodingUTF8, 0, text},
+		"utf-8 bom":       {append(utf8BOM, text...), encodingUTF8, 3, text},
+		"utf-16le":        {append([]byte{0xff, 0xfe}, encodeUTF16(text, binary.LittleEndian)...), encodingUTF16LE, 2, text},
+		"utf-16be":        {append([]byte{0xfe, 0xff}, encodeUTF16(text, binary.BigEndian)...), encodingUTF16BE, 2, text},
+		"utf-16le no bom": {encodeUTF16(text, binary.LittleEndian), encodingUTF16LE, 0, text},
+		"utf-16be no bom": {encodeUTF16(text, binary.BigEndian), encodingUTF16BE, 0, text},
+		"latin-1":         {[]byte("caf\xe9 \x93quoted\x94 \x80 5\n"), encodingLatin1, 0, "café “quoted” € 5\n"},
+		"cut utf-16":      {[]byte{0xff, 0xfe, 'a', 0, 0x3d, 0xd8, 'b'}, encodingUTF16LE, 2, "a��"},
+	} {
+		// Reading a byte at a time splits the characters across reads
+		r, enc, bom := detectEncoding(bufio.NewReader(iotest.OneByteReader(bytes.NewReader(test.raw))))
+		assert.Equal(test.enc, enc, name)
+		assert.Equal(test.bom, bom, name)
+		decoded, err := ioutil.ReadAll(r)
+		assert.NoError(err, name)
+		assert.Equal(test.want, string(decoded), name)
+	}
+
+	// Valid UTF-8 cut off at the end of the sample isn't latin-1
+	long := append(bytes.Repeat([]byte("a"), encodingSample-1), "é"...)
+	enc, _ := sniffEncoding(long[:encodingSample], false)
+	assert.Equal(encodingUTF8, enc)
+}
+
+func TestEncodedLogs(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	utf16Path := filepath.Join(dir, "service.log")
+	latin1Path := filepath.Join(dir, "legacy.log")
+	bomPath := filepath.Join(dir, "bom.log")
+	assert.NoError(os.WriteFile(utf16Path, append([]byte{0xff, 0xfe}, encodeUTF16("[02/28/2020 5:20:55.17][info] Service started\r\n", binary.LittleEndian)...), 0644))
+	assert.NoError(os.WriteFile(latin1Path, []byte("[02/28/2020 5:20:56.17][warn] Caf\xe9 closed\n"), 0644))
+	assert.NoError(os.WriteFile(bomPath, []byte("\xef\xbb\xbf[02/28/2020 5:20:57.17][error] After the mark\n"), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"service": utf16Path, "legacy": latin1Path, "bom": bomPath})
+	assert.NoError(err)
+	messages := func() []string {
+		logs, err := testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		rv := []string{}
+		for _, log := range logs {
+			rv = append(rv, log.Log)
+		}
+		return rv
+	}
+	assert.Equal([]string{"Service started", "Café closed", "After the mark"}, messages())
+
+	// Transcoded files are read again when they grow, files with a UTF-8 byte order mark carry on
+	// after the last line
+	appendFile := func(path string, data []byte) {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		assert.NoError(err)
+		_, err = file.Write(data)
+		assert.NoError(err)
+		assert.NoError(file.Close())
+	}
+	appendFile(utf16Path, encodeUTF16("[02/28/2020 5:20:58.17][info] Service stopped\r\n", binary.LittleEndian))
+	appendFile(bomPath, []byte("[02/28/2020 5:20:59.17][info] Appended\n"))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"Service started", "Café closed", "After the mark", "Service stopped", "Appended"}, messages())
+}
+
+func TestTailEncoding(t *testing.T) {
+	assert := assert.New(t)
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		enc := encodingUTF16LE
+		if order == binary.BigEndian {
+			enc = encodingUTF16BE
+		}
+		data := encodeUTF16("one\r\ntwo\r\nthr", order)
+		end := enc.lineEnd(data)
+		assert.Equal(len(encodeUTF16("one\r\ntwo\r\n", order)), end)
+		text, _ := enc.decode(nil, data[:end], true)
+		assert.Equal("one\r\ntwo\r\n", string(text))
+		assert.Equal(0, enc.lineEnd(encodeUTF16("partial", order)))
+	}
+	assert.Equal(4, encodingLatin1.lineEnd([]byte("ab\r\ncd")))
+}
@@ -0,0 +1,26 @@
+package logquery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LoadError reports every key whose files couldn't be loaded and why
+type LoadError struct {
+	Errors map[string]error
+}
+
+func (e *LoadError) Error() string {
+	keys := []string{}
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rv := make([]string, len(keys))
+	for i, key := range keys {
+		rv[i] = fmt.Sprintf("%s: %s", key, e.Errors[key])
+	}
+	return "error loading logs, " + strings.Join(rv, "; ")
+}
@@ -0,0 +1,42 @@
+package logquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadError(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"missing": "../../logs/missing.log",
+	}
+
+	testQuery, err := NewLogQuery(context.Background(), testFileMappings)
+	var loadErr *LoadError
+	assert.True(errors.As(err, &loadErr))
+	assert.Equal([]string{"missing"}, keysOf(loadErr.Errors))
+	assert.Contains(err.Error(), "missing: open ../../logs/missing.log")
+	assert.NotNil(testQuery)
+	assert.Equal(4, len(testQuery.processedLogs["server1"]))
+
+	testQuery, err = NewLogQuery(context.Background(), testFileMappings, WithFailFast())
+	assert.Error(err)
+	assert.Nil(testQuery)
+
+	testQuery, _ = NewLogQuery(context.Background(), testFileMappings, WithLazyLoading(true))
+	logs, err := testQuery.QueryLogs(context.Background(), WithKeys("server1", "missing"))
+	assert.True(errors.As(err, &loadErr))
+	assert.Equal(4, len(logs))
+}
+
+func keysOf(errs map[string]error) []string {
+	rv := []string{}
+	for key := range errs {
+		rv = append(rv, key)
+	}
+	return rv
+}
@@ -0,0 +1,99 @@
+package logquery
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FieldExtractor pulls structured fields out of the message of a log, see WithFieldExtraction
+type FieldExtractor interface {
+	Extract(msg string) map[string]string
+}
+
+// RegexFields extracts the named capture groups of Pattern, like `took (?P<duration_ms>\d+)ms`. Groups
+// that aren't part of the match are left out
+type RegexFields struct {
+	Pattern *regexp.Regexp
+}
+
+// Extract implements FieldExtractor
+func (r RegexFields) Extract(msg string) map[string]string {
+	match := r.Pattern.FindStringSubmatchIndex(msg)
+	if match == nil {
+		return nil
+	}
+	rv := map[string]string{}
+	for i, name := range r.Pattern.SubexpNames() {
+		if name != "" && match[2*i] >= 0 {
+			rv[name] = msg[match[2*i]:match[2*i+1]]
+		}
+	}
+	return rv
+}
+
+// keyValuePair is a key=value pair inside free text, the value can be double quoted
+var keyValuePair = regexp.MustCompile(`(?:^|\s)([A-Za-z_][\w.-]*)=("(?:[^"\\]|\\.)*"|[^\s"=]\S*)?`)
+
+// KeyValueFields extracts every key=value pair in the message, like `user=alice path="/a b"`, wherever
+// they are in the text
+type KeyValueFields struct{}
+
+// Extract implements FieldExtractor
+func (KeyValueFields) Extract(msg string) map[string]string {
+	var rv map[string]string
+	for _, match := range keyValuePair.FindAllStringSubmatchIndex(msg, -1) {
+		// A pair has to end at a space, so `a==1` or `a="b"c` aren't pairs
+		if end := match[1]; end < len(msg) && !unicode.IsSpace(rune(msg[end])) {
+			continue
+		}
+		value := ""
+		if match[4] >= 0 {
+			value = msg[match[4]:match[5]]
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, `"`) {
+			value = unquoted
+		}
+		if rv == nil {
+			rv = map[string]string{}
+		}
+		rv[msg[match[2]:match[3]]] = value
+	}
+	return rv
+}
+
+// WithFieldExtraction extracts fields from the messages of key as they are parsed, so data inside the text
+// can be filtered like the fields of JSON lines, with FieldEquals or field.name in a query. Extractors
+// are applied in order and the first one to find a field wins, fields the parser set win over all of them
+func WithFieldExtraction(key string, extractors ...FieldExtractor) Option {
+	return func(l *LogQuery) {
+		l.extractors[key] = append(l.extractors[key], extractors...)
+	}
+}
+
+// fieldParser wraps a parser to extract fields from its messages
+type fieldParser struct {
+	parser     LineParser
+	extractors []FieldExtractor
+}
+
+// Parse implements LineParser
+func (p *fieldParser) Parse(raw string) (*Log, error) {
+	log, err := p.parser.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, extractor := range p.extractors {
+		for name, value := range extractor.Extract(log.Log) {
+			if _, ok := log.Fields[name]; ok {
+				continue
+			}
+			if log.Fields == nil {
+				log.Fields = map[string]string{}
+			}
+			log.Fields[name] = value
+		}
+	}
+	return log, nil
+}
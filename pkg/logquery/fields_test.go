@@ -0,0 +1,49 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldExtractors(t *testing.T) {
+	assert := assert.New(t)
+
+	took := RegexFields{Pattern: regexp.MustCompile(`took (?P<duration_ms>\d+)ms(?: for (?P<user>\w+))?`)}
+	assert.Equal(map[string]string{"duration_ms": "42"}, took.Extract("request took 42ms"))
+	assert.Equal(map[string]string{"duration_ms": "7", "user": "alice"}, took.Extract("took 7ms for alice"))
+	assert.Nil(took.Extract("no timing"))
+
+	assert.Equal(map[string]string{"user": "alice", "path": "/a b", "status": "500", "empty": ""},
+		KeyValueFields{}.Extract(`request failed user=alice path="/a b" status=500 empty=`))
+	assert.Equal(map[string]string{"b": "2"}, KeyValueFields{}.Extract(`1+1==2 a==1 b=2`))
+	assert.Nil(KeyValueFields{}.Extract("no pairs, x = y"))
+}
+
+func TestWithFieldExtraction(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "api.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] GET /users took 12ms user=alice\n"+
+		"[02/28/2020 5:20:56.00][error] GET /orders took 950ms user=bob duration_ms=1\n"+
+		"[02/28/2020 5:20:57.00][info] started\n"), 0644))
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"api": path, "db": "../../logs/db_server.log"},
+		WithFieldExtraction("api", RegexFields{Pattern: regexp.MustCompile(`(?P<method>GET|POST) (?P<path>\S+) took (?P<duration_ms>\d+)ms`)}),
+		WithFieldExtraction("api", KeyValueFields{}))
+	assert.NoError(err)
+
+	logs, err := testQuery.QueryLogs(context.Background(), WithKeys("api"))
+	assert.NoError(err)
+	assert.Equal(map[string]string{"method": "GET", "path": "/users", "duration_ms": "12", "user": "alice"}, logs[0].Fields)
+	// The first extractor to find a field wins
+	assert.Equal("950", logs[1].Fields["duration_ms"])
+	assert.Nil(logs[2].Fields)
+
+	logs, err = testQuery.QueryLogs(context.Background(), FieldEquals("user", "bob"))
+	assert.NoError(err)
+	assert.Equal(1, len(logs))
+	assert.Equal("/orders", logs[0].Fields["path"])
+}
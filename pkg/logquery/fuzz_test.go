@@ -0,0 +1,123 @@
+//go:build go1.18
+// +build go1.18
+
+package logquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// The fuzz targets need Go 1.18, run one with go test -run XXX -fuzz FuzzProcessLine ./pkg/logquery
+
+// fuzzSeeds are lines every target starts from, along with the ones of its own format
+var fuzzSeeds = []string{
+	"",
+	"[02/28/2020 5:20:55.17][info] Opening database",
+	"[02/28/2020 5:20:55.123456789 PM][WARN] nanos",
+	"[][] ",
+	"[[[[[[[[[[]]]]]]]]]]",
+	"[02/28/2020 5:20:55.17][info] \x1b[31mred\x1b[0m \x1b]0;title\x07",
+	"[02/28/2020 5:20:55.17][info] \xff\xfe invalid",
+	"[9999/99/9999 99:99:99.9999999999999][info] x",
+}
+
+func FuzzProcessLine(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		log, err := processLine(raw, "key", nil)
+		if err != nil {
+			return
+		}
+		// A parsed line parses the same way again from its parts
+		again, err := processLine(log.TimeString+log.SeverityString+" "+log.Log, "key", nil)
+		if err != nil {
+			t.Fatalf("%q parsed but its parts don't, %s", raw, err)
+		}
+		if !again.Time.Equal(log.Time) || again.Severity != log.Severity || again.Log != log.Log {
+			t.Fatalf("%q parsed to %v and then %v", raw, log, again)
+		}
+		checkSanitized(t, log.String())
+	})
+}
+
+func FuzzSplitBracketLine(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		matches := logLineRegex.FindStringSubmatch(raw)
+		for _, split := range []func(string) (string, string, string, bool){splitBracketLine, splitGreedyBracketLine} {
+			timeString, severityString, msg, ok := split(raw)
+			if ok && (matches == nil || !reflect.DeepEqual([]string{timeString, severityString, msg}, matches[1:])) {
+				t.Fatalf("%q split into %q %q %q instead of %q", raw, timeString, severityString, msg, matches)
+			}
+		}
+		if _, _, _, ok := splitGreedyBracketLine(raw); !ok && matches != nil {
+			t.Fatalf("%q wasn't split, the regex splits it into %q", raw, matches)
+		}
+	})
+}
+
+func FuzzParsers(f *testing.F) {
+	for _, seed := range append(fuzzSeeds,
+		`{"ts":"2020-02-28T05:20:55Z","level":"warn","msg":"json","user":{"id":1}}`,
+		`{"ts":1582867255.5,"level":40,"msg":"\u001b[31mjson"}`,
+		`ts=2020-02-28T05:20:55Z level=error msg="logfmt \"quoted\"" user=1`,
+		`<34>1 2020-02-28T05:20:55Z host app 1 ID47 [id@1 a="b"] syslog`,
+		`<13>Feb 28 05:20:55 host app[1]: bsd syslog`,
+		`{"version":"1.1","host":"h","short_message":"gelf","timestamp":1582867255.17,"level":3,"_user":"u"}`,
+		`{"__REALTIME_TIMESTAMP":"1582867255170000","PRIORITY":"3","MESSAGE":"journal","_PID":"1"}`,
+		`{"TimeCreated":"2020-02-28T05:20:55Z","LevelDisplayName":"Error","Message":"event","Id":1}`,
+	) {
+		f.Add(seed)
+	}
+	parsers := []LineParser{
+		&BracketParser{Severities: SeverityMap{"WARNING": Warn}},
+		&JSONParser{},
+		&LogfmtParser{},
+		&SyslogParser{Year: 2020},
+		&GELFParser{},
+		&JournaldParser{},
+		&WinEventParser{},
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		for _, parser := range parsers {
+			log, err := parser.Parse(raw)
+			if err != nil {
+				continue
+			}
+			if log == nil {
+				t.Fatalf("%T returned neither a log nor an error for %q", parser, raw)
+			}
+			checkSanitized(t, log.String())
+		}
+	})
+}
+
+func FuzzSanitize(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		sanitized := Sanitize(s)
+		checkSanitized(t, sanitized)
+		if Sanitize(sanitized) != sanitized {
+			t.Fatalf("sanitizing %q twice changed it", s)
+		}
+	})
+}
+
+// checkSanitized fails t if s could change the state of a terminal it is printed to
+func checkSanitized(t *testing.T, s string) {
+	if !utf8.ValidString(s) {
+		t.Fatalf("%q isn't valid UTF-8", s)
+	}
+	if i := strings.IndexFunc(s, isControl); i != -1 {
+		t.Fatalf("%q has a control character at %d", s, i)
+	}
+}
@@ -0,0 +1,116 @@
+package logquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GELFParser parses Graylog Extended Log Format messages, one JSON object per line like
+// `{"version":"1.1","host":"api-1","short_message":"timeout","timestamp":1582867257.45,"level":3}`.
+// Messages exported from Graylog's search, with message, source and an RFC3339 timestamp, are read
+// too. The level is a syslog severity, full_message and host are kept as fields and additional fields
+// like _user are kept without their leading underscore
+type GELFParser struct {
+	// DefaultSeverity is used for messages without a level and defaults to Info
+	DefaultSeverity LogLevel
+	// Severities adds upper case level names for exports whose levels are names instead of numbers
+	Severities SeverityMap
+}
+
+// gelfOwnFields are the fields that make up the log itself instead of Log.Fields
+var gelfOwnFields = map[string]bool{"version": true, "timestamp": true, "level": true, "short_message": true, "message": true}
+
+// Parse implements LineParser
+func (p *GELFParser) Parse(raw string) (*Log, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	object := map[string]interface{}{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("log is not a json object")
+	}
+
+	t, timeString, err := parseGELFTime(object["timestamp"])
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+
+	severity := p.DefaultSeverity
+	if severity == Undefined {
+		severity = Info
+	}
+	levelString := ""
+	if rawLevel, ok := object["level"]; ok {
+		levelString = jsonString(rawLevel)
+		if code, err := strconv.Atoi(levelString); err == nil && code >= 0 && code <= 7 {
+			severity, levelString = syslogSeverity(code), syslogSeverities[code]
+		} else if severity = p.Severities.Level(levelString); severity == Undefined {
+			return nil, fmt.Errorf("severity was not parseable")
+		}
+	}
+	if levelString == "" {
+		levelString = syslogSeverityName(severity)
+	}
+
+	msg, ok := object["short_message"]
+	if !ok {
+		msg = object["message"]
+	}
+	fields := map[string]string{}
+	for name, value := range object {
+		if gelfOwnFields[name] {
+			continue
+		}
+		// Additional fields start with an underscore, _id is reserved so it is kept as is
+		if strings.HasPrefix(name, "_") && name != "_id" {
+			name = name[1:]
+		}
+		fields[name] = jsonString(value)
+	}
+
+	return &Log{
+		Time:           t,
+		Severity:       severity,
+		Log:            jsonString(msg),
+		Fields:         fields,
+		TimeString:     "[" + timeString + "]",
+		SeverityString: "[" + levelString + "]",
+	}, nil
+}
+
+// parseGELFTime reads unix seconds with a fraction, or an RFC3339 time in Graylog's exports
+func parseGELFTime(rawTime interface{}) (time.Time, string, error) {
+	switch value := rawTime.(type) {
+	case json.Number:
+		t, err := unixDecimal(value.String())
+		return t, t.Format(time.RFC3339Nano), err
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		return t, value, err
+	}
+	return time.Time{}, "", fmt.Errorf("unsupported timestamp type %T", rawTime)
+}
+
+// unixDecimal reads unix seconds like 1582867257.451 exactly, without going through a float
+func unixDecimal(s string) (time.Time, error) {
+	whole, fraction := s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		whole, fraction = s[:dot], s[dot+1:]
+	}
+	seconds, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(fraction) > 9 {
+		fraction = fraction[:9]
+	}
+	nanos := int64(0)
+	if fraction != "" {
+		if nanos, err = strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
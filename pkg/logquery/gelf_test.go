@@ -0,0 +1,56 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGELFParser(t *testing.T) {
+	assert := assert.New(t)
+	p := &GELFParser{}
+
+	log, err := p.Parse(`{"version":"1.1","host":"api-1","short_message":"timeout","full_message":"timeout\n  at db.go:12","timestamp":1582867257.451,"level":3,"_user_id":9001,"_id":"x"}`)
+	assert.NoError(err)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 57, 451000000, time.UTC), log.Time)
+	assert.Equal(Error, log.Severity)
+	assert.Equal("timeout", log.Log)
+	assert.Equal(map[string]string{"host": "api-1", "full_message": "timeout\n  at db.go:12", "user_id": "9001", "_id": "x"}, log.Fields)
+	assert.Equal("[2020-02-28T05:20:57.451Z][err][] timeout", log.String())
+
+	// Graylog's own exports
+	log, err = p.Parse(`{"timestamp":"2020-02-28T05:20:57.000Z","source":"db-1","message":"slow query","level":"4"}`)
+	assert.NoError(err)
+	assert.Equal(Warn, log.Severity)
+	assert.Equal("slow query", log.Log)
+	assert.Equal(map[string]string{"source": "db-1"}, log.Fields)
+
+	log, err = p.Parse(`{"timestamp":1582867257,"short_message":"no level"}`)
+	assert.NoError(err)
+	assert.Equal(Info, log.Severity)
+	log, err = (&GELFParser{DefaultSeverity: Debug}).Parse(`{"timestamp":1582867257,"short_message":"no level","level":"debug"}`)
+	assert.NoError(err)
+	assert.Equal(Debug, log.Severity)
+
+	for _, raw := range []string{`not json`, `{"short_message":"no time"}`, `{"timestamp":"yesterday"}`, `{"timestamp":1,"level":9}`, `{"timestamp":1,"level":"loud"}`} {
+		_, err = p.Parse(raw)
+		assert.Error(err, raw)
+	}
+}
+
+func TestGELFQuery(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "graylog.json")
+	assert.NoError(os.WriteFile(path, []byte(`{"version":"1.1","host":"api-1","short_message":"started","timestamp":1582867255.1,"level":6}
+{"version":"1.1","host":"api-1","short_message":"crashed","timestamp":1582867256.2,"level":2,"_request_id":"abc"}
+`), 0644))
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"graylog": path}, WithParser("graylog", &GELFParser{}))
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background(), WithMinSeverity(Fatal), FieldEquals("request_id", "abc"))
+	assert.NoError(err)
+	assert.Equal([]string{"crashed"}, messages(logs))
+}
@@ -0,0 +1,143 @@
+package logquery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// expandPath turns a directory or glob into the files it matches. isPattern is false when path is
+// a plain file path, which is returned as is even if it doesn't exist so the error shows up on load
+func expandPath(path string) (paths []string, isPattern bool, err error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, true, err
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+		if len(paths) == 0 {
+			return nil, true, fmt.Errorf("no log files in directory %s", path)
+		}
+		return paths, true, nil
+	}
+
+	if !strings.ContainsAny(path, "*?[") {
+		return []string{path}, false, nil
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, true, fmt.Errorf("bad glob %s, %s", path, err)
+	}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, match)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, true, fmt.Errorf("no log files match %s", path)
+	}
+	sort.Strings(paths)
+	return paths, true, nil
+}
+
+// keyFromFileName derives a key from a file name by dropping the .gz and .log extensions, so
+// ./logs/app-1.log becomes app-1
+func keyFromFileName(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, ".log")
+	return name
+}
+
+// WithRotatedFiles also reads the rotated copies of every local file, so app.log is read together with
+// app.log.1, app.log.2.gz or app.log-20200228.gz under the same key. The rotated files are found when
+// the LogQuery is created
+func WithRotatedFiles() Option {
+	return func(l *LogQuery) {
+		l.rotated = true
+	}
+}
+
+// withRotations groups every file in paths with its rotated copies, the file itself is last in its
+// group. Rotated copies that are already in paths are dropped so they aren't read twice
+func withRotations(paths []string) ([][]string, error) {
+	rotations := map[string][]string{}
+	isRotation := map[string]bool{}
+	for _, path := range paths {
+		rotated, err := rotatedPaths(path)
+		if err != nil {
+			return nil, err
+		}
+		rotations[path] = rotated
+		for _, r := range rotated {
+			isRotation[r] = true
+		}
+	}
+
+	rv := [][]string{}
+	for _, path := range paths {
+		if !isRotation[path] {
+			rv = append(rv, append(rotations[path], path))
+		}
+	}
+	return rv, nil
+}
+
+// rotatedPaths finds the rotated copies of path, oldest first. Numbered copies like app.log.2.gz are
+// older the higher the number and dated copies like app.log-20200228 are older the lower the date
+func rotatedPaths(path string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		// Let the missing file show up when it is loaded
+		return nil, nil
+	}
+	base := filepath.Base(path)
+
+	type rotation struct {
+		path   string
+		dated  bool
+		number int64
+	}
+	rotations := []rotation{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || len(name) <= len(base)+1 || !strings.HasPrefix(name, base) {
+			continue
+		}
+		// A compressed copy of the file itself, like app.log.gz, leaves nothing to number
+		suffix := strings.TrimSuffix(name[len(base):], ".gz")
+		if len(suffix) < 2 || (suffix[0] != '.' && suffix[0] != '-') {
+			continue
+		}
+		number, err := strconv.ParseInt(suffix[1:], 10, 64)
+		if err != nil || number < 0 {
+			continue
+		}
+		rotations = append(rotations, rotation{path: filepath.Join(filepath.Dir(path), name), dated: suffix[0] == '-', number: number})
+	}
+
+	// Dated copies come before numbered ones, which follow logrotate's default of the newest being .1
+	sort.Slice(rotations, func(i, j int) bool {
+		a, b := rotations[i], rotations[j]
+		if a.dated != b.dated {
+			return a.dated
+		}
+		if a.dated {
+			return a.number < b.number
+		}
+		return a.number > b.number
+	})
+	rv := make([]string, len(rotations))
+	for i, r := range rotations {
+		rv[i] = r.path
+	}
+	return rv, nil
+}
@@ -0,0 +1,128 @@
+package logquery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogQueryGlob(t *testing.T) {
+	assert := assert.New(t)
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"all": "../../logs/*.log"})
+	assert.NoError(err)
+	assert.Equal(map[string][]string{
+		"db_server": {"../../logs/db_server.log"},
+		"server1":   {"../../logs/server1.log"},
+	}, testQuery.paths)
+
+	testQuery, err = NewLogQuery(context.Background(), map[string]string{"all": "../../logs"}, WithMergedGlobs())
+	assert.NoError(err)
+	logs, _ := testQuery.QueryLogs(context.Background(), WithKeys("all"))
+	assert.Equal(8, len(logs))
+	for i := 1; i < len(logs); i++ {
+		assert.Equal("all", logs[i].Key)
+		assert.False(logs[i].Time.Before(logs[i-1].Time))
+	}
+	// Every log knows which of the merged files it came from
+	assert.Equal("../../logs/server1.log:1", logs[0].Location())
+	assert.Equal("../../logs/db_server.log:1", logs[1].Location())
+	assert.Equal("", Log{}.Location())
+	assert.Equal("app.log", Log{Path: "app.log"}.Location())
+
+	_, err = NewLogQuery(context.Background(), map[string]string{"none": "../../logs/*.missing"})
+	assert.Error(err)
+	_, err = NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log", "all": "../../logs/*.log"})
+	assert.Error(err)
+}
+
+func TestKeyPaths(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"api-1.log": "[02/28/2020 5:20:55.00][info] one\n[02/28/2020 5:20:58.00][info] one again\n",
+		"api-2.log": "[02/28/2020 5:20:56.00][warn] two\n",
+		"api-3.log": "[02/28/2020 5:20:57.00][error] three\n",
+	} {
+		assert.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"},
+		WithKeyPaths("api", filepath.Join(dir, "api-1.log"), filepath.Join(dir, "api-2.log"), filepath.Join(dir, "api-3.log")))
+	assert.NoError(err)
+	assert.Equal([]string{"api", "server1"}, testQuery.Keys())
+	logs, err := testQuery.QueryLogs(context.Background(), WithKeys("api"))
+	assert.NoError(err)
+	assert.Equal("[02/28/2020 5:20:55.00][info][api] one\n"+
+		"[02/28/2020 5:20:56.00][warn][api] two\n"+
+		"[02/28/2020 5:20:57.00][error][api] three\n"+
+		"[02/28/2020 5:20:58.00][info][api] one again", logs.String())
+
+	// A glob keeps its files under the key, on top of the key's path in the mapping
+	testQuery, err = NewLogQuery(context.Background(), map[string]string{"api": filepath.Join(dir, "api-1.log")},
+		WithKeyPaths("api", filepath.Join(dir, "api-[23].log")))
+	assert.NoError(err)
+	assert.Equal([]string{"api"}, testQuery.Keys())
+	logs, err = testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Equal(4, len(logs))
+
+	// A file matched twice is only read once
+	testQuery, err = NewLogQuery(context.Background(), nil, WithKeyPaths("api", filepath.Join(dir, "api-1.log"), filepath.Join(dir, "*.log")))
+	assert.NoError(err)
+	logs, err = testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Equal(4, len(logs))
+	_, err = NewLogQuery(context.Background(), map[string]string{"other": filepath.Join(dir, "api-1.log")}, WithKeyPaths("api", filepath.Join(dir, "api-1.log")))
+	assert.Error(err)
+}
+
+func TestRotatedFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		assert.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("app.log", "[02/28/2020 5:20:59.00][info] current\n")
+	write("app.log.1", "[02/28/2020 5:20:58.00][info] yesterday\n")
+	compressed := bytes.Buffer{}
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("[02/28/2020 5:20:57.00][info] two days ago\n"))
+	gz.Close()
+	write("app.log.2.gz", compressed.String())
+	// A compressed copy of app.log itself isn't a rotation
+	write("app.log.gz", compressed.String())
+	write("app.log-20200101", "[02/28/2020 5:20:56.00][info] dated\n")
+	write("app.log.bak", "[02/28/2020 5:20:55.00][info] not a rotation\n")
+	write("db.log", "[02/28/2020 5:20:58.30][info] db\n")
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": filepath.Join(dir, "app.log")}, WithRotatedFiles())
+	assert.NoError(err)
+	assert.Equal([]string{"app.log-20200101", "app.log.2.gz", "app.log.1", "app.log"}, baseNames(testQuery.paths["app"]))
+	logs, _ := testQuery.QueryLogs(context.Background())
+	assert.Equal("[02/28/2020 5:20:56.00][info][app] dated\n"+
+		"[02/28/2020 5:20:57.00][info][app] two days ago\n"+
+		"[02/28/2020 5:20:58.00][info][app] yesterday\n"+
+		"[02/28/2020 5:20:59.00][info][app] current", logs.String())
+
+	// A glob keeps rotated copies under the key of the file they came from, app.log.gz would be a second
+	// app key
+	assert.NoError(os.Remove(filepath.Join(dir, "app.log.gz")))
+	testQuery, err = NewLogQuery(context.Background(), map[string]string{"all": filepath.Join(dir, "*.log*")}, WithRotatedFiles())
+	assert.NoError(err)
+	assert.Equal([]string{"app", "app.log.bak", "db"}, testQuery.Keys())
+	assert.Equal(4, len(testQuery.paths["app"]))
+}
+
+func baseNames(paths []string) []string {
+	rv := []string{}
+	for _, path := range paths {
+		rv = append(rv, filepath.Base(path))
+	}
+	return rv
+}
@@ -0,0 +1,147 @@
+package logquery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// groupMessages is how many of the most common messages a Group keeps
+const groupMessages = 5
+
+// ErrInvalidGroupBy is returned for a column passed to WithGroupBy that can't be grouped by
+var ErrInvalidGroupBy = errors.New("invalid group by")
+
+// Group is the matches of a query with the same values of QueryOptions.GroupBy, see WithGroupBy
+type Group struct {
+	// Values are the values of the GroupBy columns in order, a missing field is empty
+	Values []string
+	// Count is how many logs of the group matched before the limits were applied
+	Count int
+	// Messages are the most common messages of the group, the most common first
+	Messages []MessageCount
+	// Logs are the logs of the group in QueryResult.Logs, so they are limited like the result
+	Logs Logs
+}
+
+// MessageCount is how many logs of a group had a message
+type MessageCount struct {
+	Message string
+	Count   int
+}
+
+// WithGroupBy groups the matches of QueryResult by columns, each of key, severity or field.<name>, so
+// questions like which key had the most errors can be answered without exporting the logs. Every
+// match is counted, which reads past the limits like QueryResult does
+func WithGroupBy(columns ...string) QueryOption {
+	return func(o *QueryOptions) {
+		o.GroupBy = columns
+	}
+}
+
+// checkGroupBy makes sure every column can be grouped by
+func checkGroupBy(columns []string) error {
+	for _, column := range columns {
+		if column != "key" && column != "severity" && !(strings.HasPrefix(column, "field.") && len(column) > len("field.")) {
+			return fmt.Errorf("%w %q, expected key, severity or field.<name>", ErrInvalidGroupBy, column)
+		}
+	}
+	return nil
+}
+
+// groupValues returns the values of columns for log
+func groupValues(columns []string, log *Log) []string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "key":
+			values[i] = log.Key
+		case "severity":
+			values[i] = strings.ToLower(log.Severity.String())
+		default:
+			values[i] = log.Fields[column[len("field."):]]
+		}
+	}
+	return values
+}
+
+// grouper counts the matches of a query per group
+type grouper struct {
+	columns []string
+	groups  map[string]*groupCounts
+}
+
+// groupCounts are the counts of a group before its top messages are picked
+type groupCounts struct {
+	values   []string
+	count    int
+	messages map[string]int
+}
+
+func newGrouper(columns []string) *grouper {
+	return &grouper{columns: columns, groups: map[string]*groupCounts{}}
+}
+
+func (g *grouper) add(log *Log) {
+	values := groupValues(g.columns, log)
+	id := strings.Join(values, "\x00")
+	counts, ok := g.groups[id]
+	if !ok {
+		counts = &groupCounts{values: values, messages: map[string]int{}}
+		g.groups[id] = counts
+	}
+	counts.count++
+	counts.messages[log.Log]++
+}
+
+// merge adds the counts of other, the grouper of another key
+func (g *grouper) merge(other *grouper) {
+	for id, theirs := range other.groups {
+		counts, ok := g.groups[id]
+		if !ok {
+			g.groups[id] = theirs
+			continue
+		}
+		counts.count += theirs.count
+		for message, n := range theirs.messages {
+			counts.messages[message] += n
+		}
+	}
+}
+
+// result returns the groups, the largest first, with the logs of each from logs
+func (g *grouper) result(logs Logs) []Group {
+	groups := make([]Group, 0, len(g.groups))
+	index := map[string]int{}
+	for id, counts := range g.groups {
+		messages := make([]MessageCount, 0, len(counts.messages))
+		for message, n := range counts.messages {
+			messages = append(messages, MessageCount{Message: message, Count: n})
+		}
+		sort.Slice(messages, func(i, j int) bool {
+			if messages[i].Count != messages[j].Count {
+				return messages[i].Count > messages[j].Count
+			}
+			return messages[i].Message < messages[j].Message
+		})
+		if len(messages) > groupMessages {
+			messages = messages[:groupMessages]
+		}
+		index[id] = len(groups)
+		groups = append(groups, Group{Values: counts.values, Count: counts.count, Messages: messages})
+	}
+	for _, log := range logs {
+		// Context logs didn't match so they have no group
+		if i, ok := index[strings.Join(groupValues(g.columns, &log), "\x00")]; ok && !log.Context {
+			groups[i].Logs = append(groups[i].Logs, log)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return strings.Join(groups[i].Values, "\x00") < strings.Join(groups[j].Values, "\x00")
+	})
+	return groups
+}
@@ -0,0 +1,53 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupBy(t *testing.T) {
+	assert := assert.New(t)
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log", "db_server": "../../logs/db_server.log"})
+	assert.NoError(err)
+
+	result, err := testQuery.QueryResult(context.Background(), WithGroupBy("severity"), WithLimit(2))
+	assert.NoError(err)
+	assert.Equal(4, len(result.Groups))
+	values, counts := [][]string{}, []int{}
+	for _, group := range result.Groups {
+		values = append(values, group.Values)
+		counts = append(counts, group.Count)
+	}
+	assert.Equal([][]string{{"info"}, {"warn"}, {"error"}, {"fatal"}}, values)
+	assert.Equal([]int{3, 3, 1, 1}, counts)
+	// Only the logs of the result are in the groups
+	assert.Equal(2, len(result.Groups[0].Logs))
+	assert.Empty(result.Groups[1].Logs)
+	assert.Equal([]MessageCount{
+		{Message: "Database “my_db7” did not exist, creating...", Count: 1},
+		{Message: "Rejecting request: No such database. ", Count: 1},
+		{Message: "Rejecting request: User does not have sufficient quota to create database. ", Count: 1},
+	}, result.Groups[1].Messages)
+
+	result, err = testQuery.QueryResult(context.Background(), WithGroupBy("key", "severity"), WithMinSeverity(Warn))
+	assert.NoError(err)
+	values = [][]string{}
+	for _, group := range result.Groups {
+		values = append(values, group.Values)
+	}
+	assert.Equal([][]string{{"db_server", "warn"}, {"server1", "error"}, {"server1", "fatal"}, {"server1", "warn"}}, values)
+	assert.Equal(2, result.Groups[0].Count)
+
+	// Ungrouped results have no groups
+	result, err = testQuery.QueryResult(context.Background())
+	assert.NoError(err)
+	assert.Nil(result.Groups)
+
+	_, err = testQuery.QueryResult(context.Background(), WithGroupBy("host"))
+	assert.EqualError(err, `invalid group by "host", expected key, severity or field.<name>`)
+	assert.ErrorIs(err, ErrInvalidGroupBy)
+
+	assert.Equal([]string{"alice", ""}, groupValues([]string{"field.user", "field.db"}, &Log{Fields: map[string]string{"user": "alice"}}))
+}
@@ -0,0 +1,186 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HTTPSource reads logs published over HTTP or HTTPS like https://example.com/logs/app.log. Refresh only
+// downloads what was appended with Range requests, and size checks send the ETag or Last-Modified of the
+// last response so files that didn't change cost a 304. Servers that ignore ranges still work, the part
+// that was already read is downloaded and thrown away
+type HTTPSource struct {
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// Header is sent with every request, like an Authorization header
+	Header http.Header
+
+	mutex sync.Mutex
+	// validators are the ETag, Last-Modified and size of the last response for every url
+	validators map[string]httpValidator
+}
+
+// httpValidator is what a conditional request needs to know about the last response for a url
+type httpValidator struct {
+	etag         string
+	lastModified string
+	size         int64
+}
+
+// Expand implements Source. Every url is a single file, servers can't be listed
+func (s *HTTPSource) Expand(ctx context.Context, uri string) ([]string, bool, error) {
+	return []string{uri}, false, nil
+}
+
+// Open implements Source
+func (s *HTTPSource) Open(ctx context.Context, uri string, from int64) (io.ReadCloser, int64, error) {
+	req, err := s.request(ctx, http.MethodGet, uri)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", from))
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing past from, the size is in the Content-Range like bytes */200
+		resp.Body.Close()
+		size, ok := contentRangeSize(resp.Header.Get("Content-Range"))
+		if !ok {
+			if size, err = s.Size(ctx, uri); err != nil {
+				return nil, 0, err
+			}
+		}
+		return ioutil.NopCloser(strings.NewReader("")), size, nil
+	case http.StatusPartialContent:
+		size, ok := contentRangeSize(resp.Header.Get("Content-Range"))
+		if !ok {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("GET %s: bad Content-Range %q", uri, resp.Header.Get("Content-Range"))
+		}
+		s.remember(uri, resp, size)
+		return resp.Body, size, nil
+	}
+
+	// The server sent the whole file
+	s.remember(uri, resp, resp.ContentLength)
+	if from > 0 {
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, from); err != nil {
+			resp.Body.Close()
+			return nil, 0, err
+		}
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// Size implements Source. The request is conditional on the last response so an unchanged file isn't
+// sent again, servers that don't answer HEAD with a size are sent a GET
+func (s *HTTPSource) Size(ctx context.Context, uri string) (int64, error) {
+	req, err := s.request(ctx, http.MethodHead, uri)
+	if err != nil {
+		return 0, err
+	}
+	s.mutex.Lock()
+	last, ok := s.validators[uri]
+	s.mutex.Unlock()
+	if ok && last.etag != "" {
+		req.Header.Set("If-None-Match", last.etag)
+	} else if ok && last.lastModified != "" {
+		req.Header.Set("If-Modified-Since", last.lastModified)
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		return last.size, nil
+	case resp.StatusCode == http.StatusOK && resp.ContentLength >= 0:
+		s.remember(uri, resp, resp.ContentLength)
+		return resp.ContentLength, nil
+	case resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed:
+		return 0, fmt.Errorf("HEAD %s: %s", uri, resp.Status)
+	}
+
+	// Count the bytes of the whole file instead
+	body, size, err := s.Open(ctx, uri, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	if size < 0 {
+		size, err = io.Copy(ioutil.Discard, body)
+	}
+	return size, err
+}
+
+// request returns a request for uri with the source's headers. Responses aren't compressed in transit
+// so offsets are offsets into the file
+func (s *HTTPSource) request(ctx context.Context, method string, uri string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range s.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+	return req, nil
+}
+
+// do sends a request and turns error responses into errors
+func (s *HTTPSource) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *HTTPSource) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// remember keeps the validators of a response for the next conditional request
+func (s *HTTPSource) remember(uri string, resp *http.Response, size int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.validators == nil {
+		s.validators = map[string]httpValidator{}
+	}
+	s.validators[uri] = httpValidator{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		size:         size,
+	}
+}
+
+// contentRangeSize returns the full size from a Content-Range header like bytes 100-199/200
+func contentRangeSize(contentRange string) (int64, bool) {
+	i := strings.LastIndex(contentRange, "/")
+	if i == -1 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	return size, err == nil
+}
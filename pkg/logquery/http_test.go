@@ -0,0 +1,78 @@
+package logquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSource(t *testing.T) {
+	assert := assert.New(t)
+	mutex := sync.Mutex{}
+	content := []byte("[02/28/2020 5:20:56.00][warn] current\n[02/28/2020 5:20:57.00][error] latest\n")
+	ranges, notModified, ignoreRanges := []string{}, 0, false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.URL.Path != "/app.log" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+		etag := fmt.Sprintf(`"%d"`, len(content))
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+		}
+		if ignoreRanges {
+			r.Header.Del("Range")
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	source := &HTTPSource{}
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": server.URL + "/app.log"}, WithSource("http", source))
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Equal("[02/28/2020 5:20:56.00][warn][app] current\n"+
+		"[02/28/2020 5:20:57.00][error][app] latest", logs.String())
+
+	// Nothing changed so the size check is answered with a 304
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal(1, notModified)
+	assert.Equal([]string{""}, ranges)
+
+	// Appended data is read with a range request
+	mutex.Lock()
+	content = append(content, "[02/28/2020 5:20:59.00][info] appended\n"...)
+	mutex.Unlock()
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs, _ = testQuery.QueryLogs(context.Background())
+	assert.Equal(3, len(logs))
+	assert.Equal([]string{"", "bytes=76-"}, ranges)
+
+	// Servers that ignore ranges send the whole file and the part already read is skipped
+	mutex.Lock()
+	content = append(content, "[02/28/2020 5:21:00.00][info] again\n"...)
+	ignoreRanges = true
+	mutex.Unlock()
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs, _ = testQuery.QueryLogs(context.Background())
+	assert.Equal(4, len(logs))
+	assert.Equal("again", logs[3].Log)
+
+	_, err = NewLogQuery(context.Background(), map[string]string{"missing": server.URL + "/missing.log"}, WithSource("http", source), WithFailFast())
+	assert.Error(err)
+}
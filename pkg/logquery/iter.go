@@ -0,0 +1,184 @@
+package logquery
+
+import (
+	"context"
+)
+
+// LogIterator streams the results of a query one log at a time, see Iter. It has to be closed if it
+// isn't read to the end
+type LogIterator struct {
+	// parent is the caller's context, ctx is cancelled once the iterator is done
+	parent  context.Context
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    bool
+	sources []*iterSource
+	limit   int
+	count   int
+	errs    map[string]error
+	// budget is shared by the sources, nil without limits
+	budget *queryBudget
+
+	log Log
+	err error
+
+	// logs holds the results of queries that can't be streamed
+	logs Logs
+}
+
+// iterSource streams the matching logs of a single key
+type iterSource struct {
+	key  string
+	logs chan *Log
+	head *Log
+	done bool
+	// err is set before logs is closed
+	err error
+}
+
+// Iter runs a query like QueryLogs but hands the logs over one at a time as they are merged, so callers
+// can stop early without the whole result being built in memory. Lazily loaded keys are read as the
+// iterator advances. Descending, cursor and collapsed queries are run up front. Query limits end the
+// iteration like the end of the logs would, Limited tells them apart
+//
+//	it := l.Iter(ctx, WithKeys("server1", "db"))
+//	defer it.Close()
+//	for it.Next() {
+//		fmt.Println(it.Log())
+//	}
+//	if err := it.Err(); err != nil {
+func (l *LogQuery) Iter(ctx context.Context, opts ...QueryOption) *LogIterator {
+	o := l.queryOptions(opts)
+	it := &LogIterator{parent: ctx, limit: o.TotalLimit, errs: map[string]error{}, budget: newQueryBudget(o.Limits)}
+	ctx, it.cancel = context.WithCancel(ctx)
+	it.ctx = ctx
+	if o.Descending || o.Cursor != "" || o.CollapseRepeats {
+		c, err := decodeCursor(o.Cursor, o.Descending)
+		if err != nil {
+			it.err = err
+			return it
+		}
+		var limited bool
+		it.logs, limited, it.err = l.query(ctx, o, c, nil)
+		if limited {
+			it.budget.stop()
+		}
+		return it
+	}
+
+	for _, logKey := range o.Keys {
+		_, loaded := l.loadedLogs(logKey)
+		_, _, known := l.keySource(logKey)
+		if !loaded && !(l.lazy && known) {
+			continue
+		}
+		src := &iterSource{key: logKey, logs: make(chan *Log, 64)}
+		it.sources = append(it.sources, src)
+		go func(logKey string) {
+			defer close(src.logs)
+			filter := newLogFilter(o)
+			sent := 0
+			send := func(log *Log) bool {
+				if filter.pastEnd(log) {
+					return false
+				}
+				if !filter.matches(log) {
+					return true
+				}
+				select {
+				case src.logs <- log:
+					sent++
+					return sent < o.PerKeyLimit
+				case <-ctx.Done():
+					return false
+				}
+			}
+			_, src.err = l.eachLog(ctx, logKey, o.Start, it.budget.wrap(send, filter))
+		}(logKey)
+	}
+	return it
+}
+
+// Next moves to the next log, returning false once there are no more logs or the iterator failed
+func (it *LogIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if it.ctx.Err() != nil || it.count >= it.limit {
+		it.finish()
+		return false
+	}
+	if it.sources == nil {
+		if len(it.logs) == 0 {
+			it.finish()
+			return false
+		}
+		it.log, it.logs = it.logs[0], it.logs[1:]
+		it.count++
+		return true
+	}
+
+	// Pick the earliest head, ties go to the key that sorts first like logMerge
+	var next *iterSource
+	for _, src := range it.sources {
+		if src.head == nil && !src.done {
+			log, ok := <-src.logs
+			if !ok {
+				src.done = true
+				if src.err != nil && it.ctx.Err() == nil {
+					it.errs[src.key] = src.err
+				}
+				continue
+			}
+			src.head = log
+		}
+		if src.head != nil && (next == nil || src.head.Time.Before(next.head.Time) ||
+			src.head.Time.Equal(next.head.Time) && src.key < next.key) {
+			next = src
+		}
+	}
+	if next == nil {
+		it.finish()
+		return false
+	}
+	it.log = *next.head
+	next.head = nil
+	it.count++
+	return true
+}
+
+// Limited returns true if the iterator stopped on one of the query's QueryLimits, the logs it returned are
+// the ones found before that
+func (it *LogIterator) Limited() bool {
+	return it.budget.exceeded()
+}
+
+// Log returns the log Next moved to
+func (it *LogIterator) Log() Log {
+	return it.log
+}
+
+// Err returns the error that stopped the iterator. Like QueryLogs keys that failed to load are reported
+// as a *LoadError after the logs of the other keys
+func (it *LogIterator) Err() error {
+	return it.err
+}
+
+// Close stops reading any files, it is safe to call more than once
+func (it *LogIterator) Close() {
+	it.done = true
+	it.cancel()
+}
+
+// finish records why the iterator stopped and stops the sources
+func (it *LogIterator) finish() {
+	if it.err == nil {
+		if err := it.parent.Err(); err != nil {
+			it.err = err
+		} else if len(it.errs) > 0 {
+			it.err = &LoadError{Errors: it.errs}
+		}
+	}
+	it.done = true
+	it.cancel()
+}
@@ -0,0 +1,50 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIter(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	for _, opts := range [][]Option{nil, {WithLazyLoading(false)}} {
+		testQuery, _ := NewLogQuery(context.Background(), testFileMappings, opts...)
+		for _, queryOpts := range [][]QueryOption{
+			{WithMinSeverity(Warn)},
+			{WithMaxSeverity(Warn)},
+			{WithLimit(3), WithSubstring("database")},
+			{WithLimit(3), WithDescending()},
+		} {
+			expected, err := testQuery.QueryLogs(context.Background(), queryOpts...)
+			assert.NoError(err)
+
+			logs := Logs{}
+			it := testQuery.Iter(context.Background(), queryOpts...)
+			for it.Next() {
+				logs = append(logs, it.Log())
+			}
+			assert.NoError(it.Err())
+			assert.Equal(expected.String(), logs.String())
+			assert.False(it.Next())
+		}
+
+		// Stopping early
+		it := testQuery.Iter(context.Background())
+		assert.True(it.Next())
+		it.Close()
+		assert.False(it.Next())
+		assert.NoError(it.Err())
+	}
+
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{"missing": "../../logs/missing.log"}, WithLazyLoading(false))
+	it := testQuery.Iter(context.Background())
+	assert.False(it.Next())
+	assert.IsType(&LoadError{}, it.Err())
+}
@@ -0,0 +1,171 @@
+package logquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journaldScheme is the scheme of paths read from the systemd journal
+const journaldScheme = "journald"
+
+// ParserSource is a Source whose files all have the same format. Its parser is used for keys that don't
+// have one set with WithParser
+type ParserSource interface {
+	Source
+	Parser() LineParser
+}
+
+// JournaldSource reads the systemd journal through journalctl with paths like journald://nginx.service,
+// the unit is read under its key. A pattern like journald://*.service reads every unit it matches under a
+// key named after the unit. Entries are parsed by JournaldParser so they interleave with the logs of files
+type JournaldSource struct {
+	// Command is the journalctl binary and defaults to journalctl
+	Command string
+	// Args are passed to every journalctl call, like --user or --directory=/var/log/journal/remote
+	Args []string
+}
+
+var _ ParserSource = &JournaldSource{}
+
+// Parser implements ParserSource
+func (s *JournaldSource) Parser() LineParser {
+	return &JournaldParser{}
+}
+
+// Expand implements Source
+func (s *JournaldSource) Expand(ctx context.Context, uri string) ([]string, bool, error) {
+	unit := strings.TrimPrefix(uri, journaldScheme+"://")
+	if unit == "" {
+		return nil, false, fmt.Errorf("%s has no unit, expected journald://unit", uri)
+	}
+	if !strings.ContainsAny(unit, "*?[") {
+		return []string{uri}, false, nil
+	}
+
+	out := bytes.Buffer{}
+	if err := runCommand(s.command(ctx, "--field", "_SYSTEMD_UNIT"), "journalctl", &out); err != nil {
+		return nil, true, err
+	}
+	units := strings.Fields(out.String())
+	sort.Strings(units)
+	rv := []string{}
+	for _, name := range units {
+		matched, err := path.Match(unit, name)
+		if err != nil {
+			return nil, true, fmt.Errorf("bad unit pattern %s, %s", unit, err)
+		}
+		if matched {
+			rv = append(rv, journaldScheme+"://"+name)
+		}
+	}
+	return rv, true, nil
+}
+
+// Open implements Source. The size of a unit's entries isn't known until they are read, so it is 0
+func (s *JournaldSource) Open(ctx context.Context, uri string, from int64) (io.ReadCloser, int64, error) {
+	r, err := startCommand(s.command(ctx, s.entryArgs(uri)...), "journalctl", from)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s, %s", uri, err)
+	}
+	return r, 0, nil
+}
+
+// Size implements Source by reading every entry of the unit
+func (s *JournaldSource) Size(ctx context.Context, uri string) (int64, error) {
+	counter := &countingWriter{}
+	if err := runCommand(s.command(ctx, s.entryArgs(uri)...), "journalctl", counter); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// entryArgs are the journalctl arguments that print the entries of a unit
+func (s *JournaldSource) entryArgs(uri string) []string {
+	unit := strings.TrimPrefix(uri, journaldScheme+"://")
+	return []string{"--unit", unit, "--output", "json", "--no-pager", "--quiet"}
+}
+
+// command returns a journalctl command with the source's arguments and args
+func (s *JournaldSource) command(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, stringOrDefault(s.Command, "journalctl"), append(append([]string{}, s.Args...), args...)...)
+}
+
+// JournaldParser parses the entries of `journalctl --output json`. The priority is mapped to a level like
+// syslog's and the unit, syslog identifier, pid and host are kept as fields
+type JournaldParser struct{}
+
+// journalFields are the journal fields kept in Log.Fields and their names there
+var journalFields = map[string]string{
+	"_SYSTEMD_UNIT":     "unit",
+	"SYSLOG_IDENTIFIER": "identifier",
+	"_PID":              "pid",
+	"_HOSTNAME":         "host",
+}
+
+// Parse implements LineParser
+func (p *JournaldParser) Parse(raw string) (*Log, error) {
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		return nil, fmt.Errorf("log is not a json object")
+	}
+
+	micros, err := strconv.ParseInt(journalString(entry["__REALTIME_TIMESTAMP"]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+	t := time.Unix(0, micros*int64(time.Microsecond)).UTC()
+
+	// Entries without a priority are info like journald shows them
+	priority := 6
+	if rawPriority, ok := entry["PRIORITY"]; ok {
+		if priority, err = strconv.Atoi(journalString(rawPriority)); err != nil || priority < 0 || priority > 7 {
+			return nil, fmt.Errorf("severity was not parseable")
+		}
+	}
+
+	fields := map[string]string{}
+	for name, field := range journalFields {
+		if value, ok := entry[name]; ok {
+			fields[field] = journalString(value)
+		}
+	}
+	return &Log{
+		Time:           t,
+		Severity:       syslogSeverity(priority),
+		Log:            journalString(entry["MESSAGE"]),
+		Fields:         fields,
+		TimeString:     "[" + t.Format(time.RFC3339Nano) + "]",
+		SeverityString: "[" + syslogSeverities[priority] + "]",
+	}, nil
+}
+
+// journalString returns a journal field as a string. Fields that aren't valid UTF-8 are written as
+// arrays of bytes
+func journalString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		rv := make([]byte, 0, len(v))
+		for _, b := range v {
+			n, ok := b.(float64)
+			if !ok {
+				return jsonString(value)
+			}
+			rv = append(rv, byte(n))
+		}
+		return string(rv)
+	}
+	return jsonString(value)
+}
@@ -0,0 +1,94 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournaldParser(t *testing.T) {
+	assert := assert.New(t)
+	p := &JournaldParser{}
+
+	log, err := p.Parse(`{"__REALTIME_TIMESTAMP":"1582867257250000","PRIORITY":"3","MESSAGE":"Failed to start","_SYSTEMD_UNIT":"nginx.service","_PID":"42","_BOOT_ID":"abc"}`)
+	assert.NoError(err)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 57, 250000000, time.UTC), log.Time)
+	assert.Equal(Error, log.Severity)
+	assert.Equal("[err]", log.SeverityString)
+	assert.Equal("Failed to start", log.Log)
+	assert.Equal(map[string]string{"unit": "nginx.service", "pid": "42"}, log.Fields)
+
+	// Messages that aren't UTF-8 are arrays of bytes and entries without a priority are info
+	log, err = p.Parse(`{"__REALTIME_TIMESTAMP":"1582867257250000","MESSAGE":[104,105]}`)
+	assert.NoError(err)
+	assert.Equal("hi", log.Log)
+	assert.Equal(Info, log.Severity)
+
+	for _, raw := range []string{"-- No entries --", `{"MESSAGE":"no time"}`, `{"__REALTIME_TIMESTAMP":"1","PRIORITY":"9"}`} {
+		_, err = p.Parse(raw)
+		assert.Error(err, raw)
+	}
+}
+
+// fakeJournalctl writes a script that answers like journalctl for the units nginx.service and
+// cron.service
+func fakeJournalctl(t *testing.T) string {
+	script := `#!/bin/sh
+case "$*" in
+*"--field _SYSTEMD_UNIT"*)
+	printf 'nginx.service\ncron.service\n' ;;
+*"--unit nginx.service"*)
+	echo '{"__REALTIME_TIMESTAMP":"1582867255170000","PRIORITY":"6","MESSAGE":"started","_SYSTEMD_UNIT":"nginx.service"}'
+	echo '{"__REALTIME_TIMESTAMP":"1582867257250000","PRIORITY":"4","MESSAGE":"slow upstream","_SYSTEMD_UNIT":"nginx.service"}' ;;
+*"--unit cron.service"*)
+	echo '{"__REALTIME_TIMESTAMP":"1582867256000000","PRIORITY":"6","MESSAGE":"job ran","_SYSTEMD_UNIT":"cron.service"}' ;;
+*)
+	echo "Unit missing.service could not be found." >&2
+	exit 1 ;;
+esac
+`
+	path := filepath.Join(t.TempDir(), "journalctl")
+	assert.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return path
+}
+
+func TestJournaldSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake journalctl is a shell script")
+	}
+	assert := assert.New(t)
+	source := WithSource(journaldScheme, &JournaldSource{Command: fakeJournalctl(t)})
+
+	// Units interleave with files in one timeline
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{
+		"nginx": "journald://nginx.service",
+		"db":    "../../logs/db_server.log",
+	}, source, WithSeverityAliases(SeverityMap{"WARNING": Warn}))
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background(), WithLimit(3))
+	assert.NoError(err)
+	assert.Equal([]string{"nginx", "db", "db"}, []string{logs[0].Key, logs[1].Key, logs[2].Key})
+	logs, err = testQuery.QueryLogs(context.Background(), WithKeys("nginx"), WithMinSeverity(Warn))
+	assert.NoError(err)
+	assert.Len(logs, 1)
+	assert.Equal("slow upstream", logs[0].Log)
+
+	// A pattern gives every unit it matches a key
+	testQuery, err = NewLogQuery(context.Background(), map[string]string{"units": "journald://*.service"}, source)
+	assert.NoError(err)
+	assert.Equal([]string{"cron.service", "nginx.service"}, testQuery.Keys())
+
+	// Refresh reads the output again and only keeps the new entries
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs, err = testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Len(logs, 3)
+
+	_, err = NewLogQuery(context.Background(), map[string]string{"missing": "journald://missing.service"}, source)
+	assert.EqualError(err, "error loading logs, missing: journalctl failed, Unit missing.service could not be found.")
+}
@@ -0,0 +1,130 @@
+package logquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JSONParser parses logs written as one JSON object per line like
+// `{"ts": "2020-02-28T05:20:57Z", "level": "info", "msg": "hello"}`. Any other fields end up
+// in Log.Fields
+type JSONParser struct {
+	// Field names, these default to "ts", "level" and "msg"
+	TimeField    string
+	LevelField   string
+	MessageField string
+
+	// TimeLayout is used for string timestamps and defaults to time.RFC3339Nano. Numeric timestamps
+	// are always read as unix seconds
+	TimeLayout string
+
+	// DefaultSeverity is used when a line has no level field
+	DefaultSeverity LogLevel
+	// Severities adds level names other than debug, info, warn, error and fatal, keyed in upper case
+	Severities SeverityMap
+}
+
+// Parse implements LineParser
+func (p *JSONParser) Parse(raw string) (*Log, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	object := map[string]interface{}{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("log is not a json object")
+	}
+
+	timeField := stringOrDefault(p.TimeField, "ts")
+	levelField := stringOrDefault(p.LevelField, "level")
+	messageField := stringOrDefault(p.MessageField, "msg")
+
+	// parse time
+	rawTime, ok := object[timeField]
+	if !ok {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+	time, timeString, err := p.parseTime(rawTime)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+
+	// parse severity
+	severity := p.DefaultSeverity
+	levelString := ""
+	if rawLevel, ok := object[levelField]; ok {
+		levelString = jsonString(rawLevel)
+		severity = p.Severities.Level(levelString)
+	}
+	if severity == Undefined {
+		return nil, fmt.Errorf("severity was not parseable")
+	}
+	if levelString == "" {
+		levelString = strings.ToLower(severity.String())
+	}
+
+	msg := ""
+	if rawMsg, ok := object[messageField]; ok {
+		msg = jsonString(rawMsg)
+	}
+
+	// everything else is kept as a field
+	fields := map[string]string{}
+	for name, value := range object {
+		if name == timeField || name == levelField || name == messageField {
+			continue
+		}
+		fields[name] = jsonString(value)
+	}
+
+	return &Log{
+		Time:           time,
+		Severity:       severity,
+		Log:            msg,
+		Fields:         fields,
+		TimeString:     "[" + timeString + "]",
+		SeverityString: "[" + levelString + "]",
+	}, nil
+}
+
+func (p *JSONParser) parseTime(rawTime interface{}) (time.Time, string, error) {
+	switch value := rawTime.(type) {
+	case string:
+		t, err := time.Parse(stringOrDefault(p.TimeLayout, time.RFC3339Nano), value)
+		return t, value, err
+	case json.Number:
+		seconds, err := value.Float64()
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		nanos := int64(seconds * float64(time.Second))
+		return time.Unix(0, nanos).UTC(), value.String(), nil
+	}
+	return time.Time{}, "", fmt.Errorf("unsupported timestamp type %T", rawTime)
+}
+
+// jsonString turns a decoded json value back into a string. Strings are used as is and anything
+// else is re-encoded as json
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func stringOrDefault(s string, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
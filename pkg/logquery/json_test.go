@@ -0,0 +1,30 @@
+package logquery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONParser(t *testing.T) {
+	assert := assert.New(t)
+	parser := &JSONParser{}
+	log, err := parser.Parse(`{"ts": "2020-02-28T05:20:57.35Z", "level": "ERROR", "msg": "db rejected request", "user_id": 42, "tags": ["a", "b"]}`)
+	assert.NoError(err)
+	assert.Equal(Error, log.Severity)
+	assert.Equal("db rejected request", log.Log)
+	assert.True(log.Time.Equal(time.Date(2020, 2, 28, 5, 20, 57, 350000000, time.UTC)))
+	assert.Equal(map[string]string{"user_id": "42", "tags": `["a","b"]`}, log.Fields)
+
+	custom := &JSONParser{TimeField: "time", MessageField: "message", DefaultSeverity: Info}
+	log, err = custom.Parse(`{"time": 1582867257, "message": "no level"}`)
+	assert.NoError(err)
+	assert.Equal(Info, log.Severity)
+	assert.Equal(int64(1582867257), log.Time.Unix())
+
+	_, err = parser.Parse(`[02/28/2020 5:20:57.35][error] not json`)
+	assert.Error(err)
+	_, err = parser.Parse(`{"level": "info", "msg": "no time"}`)
+	assert.Error(err)
+}
@@ -0,0 +1,87 @@
+package logquery
+
+import (
+	"path"
+	"strings"
+)
+
+// WithoutKeys leaves keys out of the query, like a noisy service when querying every other key. Keys
+// can be patterns like WithKeys
+func WithoutKeys(keys ...string) QueryOption {
+	return func(o *QueryOptions) {
+		o.ExcludeKeys = append(o.ExcludeKeys, keys...)
+	}
+}
+
+// IsKeyPattern returns true if key is a pattern like `*` or `web-*` instead of a single key
+func IsKeyPattern(key string) bool {
+	return strings.ContainsAny(key, `*?[\`)
+}
+
+// MatchKey returns true if key is the pattern itself or matches it. Patterns use path.Match syntax so `*`
+// stops at a `/`, except for `*` on its own which matches every key
+func MatchKey(pattern string, key string) bool {
+	if !IsKeyPattern(pattern) {
+		return pattern == key
+	}
+	if pattern == "*" {
+		return true
+	}
+	matched, err := path.Match(pattern, key)
+	return err == nil && matched
+}
+
+// SelectKeys expands the patterns in include to the known keys they match and leaves out every key
+// matching exclude. Keys that aren't patterns are kept even if they aren't known. A nil include selects
+// every known key
+func SelectKeys(known []string, include []string, exclude []string) []string {
+	if include == nil {
+		include = known
+	}
+	rv := []string{}
+	seen := map[string]bool{}
+	add := func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		for _, pattern := range exclude {
+			if MatchKey(pattern, key) {
+				return
+			}
+		}
+		rv = append(rv, key)
+	}
+	for _, pattern := range include {
+		if !IsKeyPattern(pattern) {
+			add(pattern)
+			continue
+		}
+		for _, key := range known {
+			if MatchKey(pattern, key) {
+				add(key)
+			}
+		}
+	}
+	return rv
+}
+
+// matchAnyKey returns true if key matches any of patterns
+func matchAnyKey(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if MatchKey(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKeyPattern returns true if any of keys is a pattern
+func hasKeyPattern(keys []string) bool {
+	for _, key := range keys {
+		if IsKeyPattern(key) {
+			return true
+		}
+	}
+	return false
+}
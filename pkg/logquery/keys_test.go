@@ -0,0 +1,49 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectKeys(t *testing.T) {
+	assert := assert.New(t)
+	known := []string{"db_server", "web-1", "web-2", "worker"}
+
+	assert.Equal(known, SelectKeys(known, nil, nil))
+	assert.Equal(known, SelectKeys(known, []string{"*"}, nil))
+	assert.Equal([]string{"web-1", "web-2", "worker"}, SelectKeys(known, []string{"*"}, []string{"db_server"}))
+	assert.Equal([]string{"db_server", "worker"}, SelectKeys(known, nil, []string{"web-*"}))
+	assert.Equal([]string{"web-2", "web-1"}, SelectKeys(known, []string{"web-2", "web-?"}, nil))
+	// Plain keys are kept even if they aren't known, a pattern that matches nothing selects nothing
+	assert.Equal([]string{"missing"}, SelectKeys(known, []string{"missing", "api-*"}, nil))
+	assert.Equal([]string{}, SelectKeys(known, []string{"["}, nil))
+	assert.Equal([]string{"web/server1"}, SelectKeys([]string{"db/db", "web/server1"}, []string{"*"}, []string{"db/*"}))
+}
+
+func TestQueryKeyPatterns(t *testing.T) {
+	assert := assert.New(t)
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{
+		"server1":   "../../logs/server1.log",
+		"db_server": "../../logs/db_server.log",
+	})
+	assert.NoError(err)
+
+	all, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background(), WithKeys("*"))
+	assert.NoError(err)
+	assert.Equal(all, logs)
+
+	logs, err = testQuery.QueryLogs(context.Background(), WithoutKeys("db_server"))
+	assert.NoError(err)
+	assert.NotEmpty(logs)
+	for _, log := range logs {
+		assert.Equal("server1", log.Key)
+	}
+
+	logs, err = testQuery.QueryLogs(context.Background(), WithKeys("*_server"))
+	assert.NoError(err)
+	assert.Len(logs, 4)
+}
@@ -0,0 +1,115 @@
+package logquery
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithLabels attaches labels like env=prod or region=eu to the source registered under key, so queries
+// can pick sources with WithLabelSelector instead of encoding everything in key names. Files from a glob
+// get the labels of the key they were registered with, and so do sources added later with AddSource
+func WithLabels(key string, labels map[string]string) Option {
+	return func(l *LogQuery) {
+		l.labels[key] = copyLabels(labels)
+	}
+}
+
+// Labels returns the labels of key, an empty map if it has none
+func (l *LogQuery) Labels(key string) map[string]string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return copyLabels(l.labels[key])
+}
+
+// copyLabels returns a copy of labels so callers can't change the labels of a key
+func copyLabels(labels map[string]string) map[string]string {
+	rv := make(map[string]string, len(labels))
+	for name, value := range labels {
+		rv[name] = value
+	}
+	return rv
+}
+
+// LabelMatcher matches a single label of a source. A missing label is empty, so name!=value matches
+// sources without the label
+type LabelMatcher struct {
+	Name  string
+	Value string
+	// NotEqual matches sources whose label isn't Value
+	NotEqual bool
+}
+
+// Matches returns true if labels pass the matcher
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	return (labels[m.Name] == m.Value) != m.NotEqual
+}
+
+func (m LabelMatcher) String() string {
+	if m.NotEqual {
+		return m.Name + "!=" + m.Value
+	}
+	return m.Name + "=" + m.Value
+}
+
+// LabelSelector picks the sources whose labels pass every matcher
+type LabelSelector []LabelMatcher
+
+// ParseLabelSelector parses comma separated matchers like `env=prod,region!=eu`
+func ParseLabelSelector(selector string) (LabelSelector, error) {
+	rv := LabelSelector{}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		i := strings.Index(part, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("bad label selector %q, expected name=value or name!=value", part)
+		}
+		m := LabelMatcher{Name: strings.TrimSpace(part[:i]), Value: strings.TrimSpace(part[i+1:])}
+		if strings.HasSuffix(m.Name, "!") {
+			m.Name, m.NotEqual = strings.TrimSpace(strings.TrimSuffix(m.Name, "!")), true
+		}
+		if m.Name == "" {
+			return nil, fmt.Errorf("bad label selector %q, the label name is missing", part)
+		}
+		rv = append(rv, m)
+	}
+	return rv, nil
+}
+
+// Matches returns true if labels pass every matcher of the selector
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for _, m := range s {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s LabelSelector) String() string {
+	parts := make([]string, len(s))
+	for i, m := range s {
+		parts[i] = m.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// WithLabelSelector only queries the sources whose labels match selector, on top of the keys picked
+// with WithKeys and WithoutKeys
+func WithLabelSelector(selector LabelSelector) QueryOption {
+	return func(o *QueryOptions) {
+		o.Labels = selector
+	}
+}
+
+// labeledKeys returns the keys whose labels match selector, keeping their order
+func (l *LogQuery) labeledKeys(keys []string, selector LabelSelector) []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	rv := []string{}
+	for _, key := range keys {
+		if selector.Matches(l.labels[key]) {
+			rv = append(rv, key)
+		}
+	}
+	return rv
+}
@@ -0,0 +1,91 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	assert := assert.New(t)
+	selector, err := ParseLabelSelector("env=prod, region != eu")
+	assert.NoError(err)
+	assert.Equal(LabelSelector{{Name: "env", Value: "prod"}, {Name: "region", Value: "eu", NotEqual: true}}, selector)
+	assert.Equal("env=prod,region!=eu", selector.String())
+
+	assert.True(selector.Matches(map[string]string{"env": "prod", "region": "us"}))
+	// A missing label isn't eu
+	assert.True(selector.Matches(map[string]string{"env": "prod"}))
+	assert.False(selector.Matches(map[string]string{"env": "prod", "region": "eu"}))
+	assert.False(selector.Matches(nil))
+
+	for _, bad := range []string{"", "env", "=prod", "!=eu", "env=prod,"} {
+		_, err := ParseLabelSelector(bad)
+		assert.Error(err, bad)
+	}
+}
+
+func TestQueryLabels(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	for _, name := range []string{"web-1.log", "web-2.log"} {
+		assert.NoError(os.WriteFile(filepath.Join(dir, name), []byte("[02/28/2020 5:20:55.17][Info] "+name+"\n"), 0644))
+	}
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{
+		"server1":   "../../logs/server1.log",
+		"db_server": "../../logs/db_server.log",
+		"web":       filepath.Join(dir, "*.log"),
+	},
+		WithLabels("server1", map[string]string{"env": "prod", "region": "eu"}),
+		WithLabels("db_server", map[string]string{"env": "prod", "region": "us"}),
+		WithLabels("web", map[string]string{"env": "staging"}))
+	assert.NoError(err)
+
+	// Files from a glob get the labels of their key
+	assert.Equal(map[string]string{"env": "staging"}, testQuery.Labels("web-2"))
+	assert.Equal(map[string]string{}, testQuery.Labels("missing"))
+
+	keysOf := func(logs Logs) []string {
+		seen := map[string]bool{}
+		keys := []string{}
+		for _, log := range logs {
+			if !seen[log.Key] {
+				seen[log.Key] = true
+				keys = append(keys, log.Key)
+			}
+		}
+		return keys
+	}
+	selector, err := ParseLabelSelector("env=prod")
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background(), WithLabelSelector(selector))
+	assert.NoError(err)
+	assert.ElementsMatch([]string{"server1", "db_server"}, keysOf(logs))
+
+	// Selectors narrow down the keys picked by WithKeys
+	selector, err = ParseLabelSelector("env=prod,region!=us")
+	assert.NoError(err)
+	logs, err = testQuery.QueryLogs(context.Background(), WithKeys("*_server", "server1"), WithLabelSelector(selector))
+	assert.NoError(err)
+	assert.Equal([]string{"server1"}, keysOf(logs))
+
+	selector, err = ParseLabelSelector("env=dev")
+	assert.NoError(err)
+	logs, err = testQuery.QueryLogs(context.Background(), WithLabelSelector(selector))
+	assert.NoError(err)
+	assert.Empty(logs)
+
+	// Sources added later pick up the labels of their key
+	labeled, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"},
+		WithLabels("db_server", map[string]string{"env": "prod"}))
+	assert.NoError(err)
+	assert.NoError(labeled.AddSource(context.Background(), "db_server", "../../logs/db_server.log"))
+	selector, err = ParseLabelSelector("env=prod")
+	assert.NoError(err)
+	logs, err = labeled.QueryLogs(context.Background(), WithLabelSelector(selector))
+	assert.NoError(err)
+	assert.Equal([]string{"db_server"}, keysOf(logs))
+}
@@ -0,0 +1,154 @@
+package logquery
+
+// WithLenientParsing keeps lines that can't be parsed, like stack traces, instead of dropping them. They
+// become logs with an Undefined severity and the raw line as the message, at the time of the log before
+// them. Lines before the first log of a file are still skipped
+func WithLenientParsing() Option {
+	return func(l *LogQuery) {
+		l.readConfig.lenient = true
+	}
+}
+
+// SkippedLines returns how many lines of each key couldn't be parsed and were dropped. Lazily loaded keys
+// are only counted once they are kept in memory
+func (l *LogQuery) SkippedLines() map[string]int {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	rv := map[string]int{}
+	for key, paths := range l.paths {
+		for _, path := range paths {
+			if offset, ok := l.offsets[path]; ok {
+				rv[key] += offset.skipped
+			}
+		}
+	}
+	return rv
+}
+
+// lineParser parses the lines of a file in order, keeping track of the last log for lenient parsing and
+// the lines that failed
+type lineParser struct {
+	parser  LineParser
+	key     string
+	path    string
+	lenient bool
+	// stripANSI removes escape sequences before a line is parsed
+	stripANSI bool
+	// redactors scrub logs and failed lines before they are kept
+	redactors []Redactor
+	// levelRules reclassify parsed logs
+	levelRules []LevelRule
+	// maxLine is the longest line kept whole by readers that don't cut lines themselves
+	maxLine int
+	// alloc hands out the logs of parsers that can parse into one, nil allocates every log on its own
+	alloc *logAllocator
+
+	prev    *Log
+	skipped int
+	report  ParseReport
+	// undo is what the parser looked like before the last line, for undoLast
+	undo lineUndo
+}
+
+// lineUndo is the state of a lineParser before a line, reason is why the line failed if it did
+type lineUndo struct {
+	skipped    int
+	failed     int
+	samples    int
+	outOfOrder int
+	reason     string
+	prev       *Log
+}
+
+// mark returns the state of the parser before the next line
+func (p *lineParser) mark() lineUndo {
+	return lineUndo{skipped: p.skipped, failed: p.report.Failed, samples: len(p.report.Samples), outOfOrder: p.report.OutOfOrder, prev: p.prev}
+}
+
+// undoLast takes back what the last line added to the counts and report, for an unfinished line that is
+// parsed again once it is finished
+func (p *lineParser) undoLast() {
+	u := p.undo
+	if p.report.Failed > u.failed && u.reason != "" {
+		if p.report.Reasons[u.reason]--; p.report.Reasons[u.reason] <= 0 {
+			delete(p.report.Reasons, u.reason)
+		}
+	}
+	if len(p.report.Samples) > u.samples {
+		p.report.Samples = p.report.Samples[:u.samples]
+	}
+	p.skipped, p.report.Failed, p.report.OutOfOrder, p.prev = u.skipped, u.failed, u.outOfOrder, u.prev
+}
+
+// parse parses the line with the number at offset in the file, returning nil if it is skipped
+func (p *lineParser) parse(line string, number int, offset int64) *Log {
+	p.undo = p.mark()
+	log := p.parseLine(line, number, offset)
+	if log == nil {
+		return nil
+	}
+	return p.place(log)
+}
+
+// parseLine parses a line without placing it, raw lines are left at the zero time for place. It returns
+// nil if the line is skipped
+func (p *lineParser) parseLine(line string, number int, offset int64) *Log {
+	if p.stripANSI {
+		line = StripANSI(line)
+	}
+	log, err := p.parseLog(line)
+	if err != nil {
+		p.report.add(p.path, Redact(line, p.redactors), err)
+		p.undo.reason = err.Error()
+		log = p.raw(line)
+		if log == nil {
+			p.skipped++
+			return nil
+		}
+	}
+	log.Key = p.key
+	log.Path, log.LineNumber, log.Offset = p.path, number, offset
+	relevel(log, p.levelRules)
+	redact(log, p.redactors)
+	return log
+}
+
+// parseLog parses a line with the parser, into a log from alloc when there is one and the parser can
+func (p *lineParser) parseLog(line string) (*Log, error) {
+	into, ok := p.parser.(intoParser)
+	if !ok || p.alloc == nil {
+		return p.parser.Parse(line)
+	}
+	log := p.alloc.next()
+	if err := into.parseInto(line, log); err != nil {
+		return nil, err
+	}
+	p.alloc.take()
+	return log, nil
+}
+
+// raw returns the log for a line that couldn't be parsed, or nil if it is dropped
+func (p *lineParser) raw(line string) *Log {
+	if !p.lenient {
+		return nil
+	}
+	return &Log{Severity: Undefined, Log: line}
+}
+
+// place gives raw logs the time of the log before them and remembers parsed logs. Raw logs without a
+// log before them are skipped
+func (p *lineParser) place(log *Log) *Log {
+	if log.Severity != Undefined || !log.Time.IsZero() {
+		if p.prev != nil && log.Time.Before(p.prev.Time) {
+			p.report.OutOfOrder++
+		}
+		p.prev = log
+		return log
+	}
+	if p.prev == nil {
+		p.skipped++
+		return nil
+	}
+	log.Time, log.TimeString = p.prev.Time, p.prev.TimeString
+	return log
+}
@@ -0,0 +1,51 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLenientParsing(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	content := []byte("starting up\n" +
+		"[02/28/2020 5:20:55.17][info] first\n" +
+		"[02/28/2020 5:20:56.00][error] panic: nil map\n" +
+		"goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"[02/28/2020 5:20:57.00][info] recovered\n")
+	assert.NoError(os.WriteFile(path, content, 0644))
+
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{"app": path})
+	logs, _ := testQuery.QueryLogs(context.Background())
+	assert.Equal(3, len(logs))
+	assert.Equal(map[string]int{"app": 3}, testQuery.SkippedLines())
+
+	for _, opts := range [][]Option{{WithLenientParsing()}, {WithLenientParsing(), WithChunkedParsing(16, 3)}} {
+		assert.NoError(os.WriteFile(path, content, 0644))
+		testQuery, _ = NewLogQuery(context.Background(), map[string]string{"app": path}, opts...)
+		logs, _ = testQuery.QueryLogs(context.Background())
+		assert.Equal(5, len(logs))
+		assert.Equal(Undefined, logs[2].Severity)
+		assert.Equal("goroutine 1 [running]:", logs[2].Log)
+		assert.Equal(logs[1].Time, logs[3].Time)
+		assert.Equal("[02/28/2020 5:20:56.00][app] main.main()", logs[3].String())
+		assert.Equal(map[string]int{"app": 1}, testQuery.SkippedLines())
+
+		// Raw lines at the start of appended data go with the last log already loaded
+		file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		file.WriteString("\tmore trace\n")
+		file.Close()
+		assert.NoError(testQuery.Refresh(context.Background()))
+		logs, _ = testQuery.QueryLogs(context.Background())
+		assert.Equal(6, len(logs))
+		assert.Equal(logs[4].Time, logs[5].Time)
+
+		logs, _ = testQuery.QueryLogs(context.Background(), WithMinSeverity(Debug))
+		assert.Equal(3, len(logs))
+	}
+}
@@ -0,0 +1,96 @@
+package logquery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var levelNames = map[LogLevel]string{
+	Undefined: "UNDEFINED",
+	Debug:     "DEBUG",
+	Info:      "INFO",
+	Warn:      "WARN",
+	Error:     "ERROR",
+	Fatal:     "FATAL",
+}
+
+// String returns the upper case name of the level like "INFO"
+func (level LogLevel) String() string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(level))
+}
+
+// ParseLevel maps a case insensitive level name like "warn" to its LogLevel
+func ParseLevel(level string) (LogLevel, error) {
+	severity := parseSeverity(level)
+	if severity == Undefined {
+		return Undefined, fmt.Errorf("unknown level %q", level)
+	}
+	return severity, nil
+}
+
+// SeverityMap maps extra level names like "WARNING", "CRIT" or "TRACE" to the level they mean. Names can
+// only alias the five levels, so TRACE reads as Debug. Keys are upper case and names are looked up case
+// insensitively, NewSeverityMap and WithSeverityAliases upper case them. Names that aren't in the map fall
+// back to the standard debug, info, warn, error and fatal
+type SeverityMap map[string]LogLevel
+
+// NewSeverityMap returns aliases keyed by their upper case names. Names that only differ in case have to
+// mean the same level
+func NewSeverityMap(aliases map[string]LogLevel) (SeverityMap, error) {
+	rv := SeverityMap{}
+	for name, level := range aliases {
+		upper := strings.ToUpper(name)
+		if other, ok := rv[upper]; ok && other != level {
+			return nil, fmt.Errorf("level name %s is both %s and %s", upper, strings.ToLower(other.String()), strings.ToLower(level.String()))
+		}
+		rv[upper] = level
+	}
+	return rv, nil
+}
+
+// upper returns m keyed by upper case names. When names only differ in case the one that sorts last wins,
+// so the result doesn't depend on map order
+func (m SeverityMap) upper() SeverityMap {
+	if m == nil {
+		return nil
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rv := SeverityMap{}
+	for _, name := range names {
+		rv[strings.ToUpper(name)] = m[name]
+	}
+	return rv
+}
+
+// Level returns the level name maps to, or Undefined if it is not known
+func (m SeverityMap) Level(name string) LogLevel {
+	if level, ok := m[strings.ToUpper(name)]; ok {
+		return level
+	}
+	return parseSeverity(name)
+}
+
+// parseSeverity maps a level name like "info" to its LogLevel, or Undefined if it is not known
+func parseSeverity(level string) LogLevel {
+	switch strings.ToLower(level) {
+	case "debug":
+		return Debug
+	case "info":
+		return Info
+	case "warn":
+		return Warn
+	case "error":
+		return Error
+	case "fatal":
+		return Fatal
+	}
+	return Undefined
+}
@@ -0,0 +1,111 @@
+package logquery
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLimited is returned with partial results by calls that don't return a Page or QueryResult, like
+// Rate, when they stop on their QueryLimits
+var ErrLimited = errors.New("query stopped on its limits")
+
+// deadlineEvery is how many logs a limited query looks at between checks of its deadline, reading the
+// clock for every log would slow down the scan more than the check is worth
+const deadlineEvery = 256
+
+// QueryLimits caps how much work a single query can do so one expensive query can't starve the others.
+// A query that reaches a limit stops where it is and returns what it found so far marked as limited
+type QueryLimits struct {
+	// MaxScanBytes is how many bytes of logs the query can look at, 0 means no limit
+	MaxScanBytes int64
+	// MaxMatches is how many matching logs the query can find, 0 means no limit. Queries that count
+	// every match go past their limit so this is mostly for them
+	MaxMatches int
+	// Timeout is how long the query can scan for, 0 means no limit. Unlike a deadline on the context the
+	// query still returns its logs when it runs out of time
+	Timeout time.Duration
+}
+
+// WithQueryLimits stops the query once it reaches one of limits, see QueryLimits. It applies to Iter and
+// everything built on it like Rate too, LogIterator.Limited reports it
+func WithQueryLimits(limits QueryLimits) QueryOption {
+	return func(o *QueryOptions) {
+		o.Limits = limits
+	}
+}
+
+// queryBudget is what is left of the limits of a query, it is shared by the goroutines of every key
+type queryBudget struct {
+	limits   QueryLimits
+	deadline time.Time
+	// scanned is the bytes looked at, logs and matches are counts. They are all updated atomically
+	scanned int64
+	logs    int64
+	matches int64
+	limited int32
+}
+
+// newQueryBudget starts the budget of a query, it is nil when there are no limits
+func newQueryBudget(limits QueryLimits) *queryBudget {
+	if limits == (QueryLimits{}) {
+		return nil
+	}
+	b := &queryBudget{limits: limits}
+	if limits.Timeout > 0 {
+		b.deadline = time.Now().Add(limits.Timeout)
+	}
+	return b
+}
+
+// wrap returns add with the budget checked before every log, f is the filter add belongs to
+func (b *queryBudget) wrap(add func(*Log) bool, f *logFilter) func(*Log) bool {
+	if b == nil {
+		return add
+	}
+	return func(log *Log) bool {
+		if !b.scan(log) {
+			return false
+		}
+		if b.limits.MaxMatches > 0 && !f.pastEnd(log) && f.matches(log) &&
+			atomic.AddInt64(&b.matches, 1) > int64(b.limits.MaxMatches) {
+			b.stop()
+			return false
+		}
+		return add(log)
+	}
+}
+
+// scan charges log to the budget and returns false once the query has to stop
+func (b *queryBudget) scan(log *Log) bool {
+	if atomic.LoadInt32(&b.limited) != 0 {
+		return false
+	}
+	if b.limits.MaxScanBytes > 0 && atomic.AddInt64(&b.scanned, logSize(log)) > b.limits.MaxScanBytes {
+		b.stop()
+		return false
+	}
+	if !b.deadline.IsZero() && atomic.AddInt64(&b.logs, 1)%deadlineEvery == 1 && time.Now().After(b.deadline) {
+		b.stop()
+		return false
+	}
+	return true
+}
+
+func (b *queryBudget) stop() {
+	atomic.StoreInt32(&b.limited, 1)
+}
+
+// exceeded returns true if the query stopped on one of its limits
+func (b *queryBudget) exceeded() bool {
+	return b != nil && atomic.LoadInt32(&b.limited) != 0
+}
+
+// logSize is roughly how many bytes the line of a log took up
+func logSize(log *Log) int64 {
+	size := len(log.TimeString) + len(log.SeverityString) + len(log.Log) + 1
+	for name, value := range log.Fields {
+		size += len(name) + len(value)
+	}
+	return int64(size)
+}
@@ -0,0 +1,82 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryLimits(t *testing.T) {
+	assert := assert.New(t)
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"})
+	assert.NoError(err)
+	all, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+
+	// Without limits nothing changes
+	page, err := testQuery.QueryPage(context.Background(), WithQueryLimits(QueryLimits{MaxScanBytes: 1 << 20}))
+	assert.NoError(err)
+	assert.Equal(all, page.Logs)
+	assert.False(page.Limited)
+	assert.Empty(page.Cursor)
+
+	// The third log goes over the bytes of the first two
+	page, err = testQuery.QueryPage(context.Background(), WithQueryLimits(QueryLimits{MaxScanBytes: logSize(&all[0]) + logSize(&all[1])}))
+	assert.NoError(err)
+	assert.Equal(all[:2], page.Logs)
+	assert.True(page.Limited)
+	assert.NotEmpty(page.Cursor)
+
+	// The cursor carries on where the limit stopped
+	page, err = testQuery.QueryPage(context.Background(), WithCursor(page.Cursor))
+	assert.NoError(err)
+	assert.Equal(all[2:], page.Logs)
+
+	// Only warnings and up count towards the matches
+	result, err := testQuery.QueryResult(context.Background(), WithMinSeverity(Warn), WithQueryLimits(QueryLimits{MaxMatches: 2}))
+	assert.NoError(err)
+	assert.Equal(all[1:3], result.Logs)
+	assert.Equal(2, result.Matched)
+	assert.True(result.Limited)
+	result, err = testQuery.QueryResult(context.Background(), WithMinSeverity(Warn), WithQueryLimits(QueryLimits{MaxMatches: 3}))
+	assert.NoError(err)
+	assert.Equal(3, result.Matched)
+	assert.False(result.Limited)
+
+	page, err = testQuery.QueryPage(context.Background(), WithQueryLimits(QueryLimits{Timeout: time.Nanosecond}))
+	assert.NoError(err)
+	assert.Empty(page.Logs)
+	assert.True(page.Limited)
+}
+
+func TestIterLimits(t *testing.T) {
+	assert := assert.New(t)
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"})
+	assert.NoError(err)
+	all, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+
+	limits := WithQueryLimits(QueryLimits{MaxScanBytes: logSize(&all[0]) + logSize(&all[1])})
+	for _, opts := range [][]QueryOption{{limits}, {limits, WithDescending()}} {
+		it := testQuery.Iter(context.Background(), opts...)
+		logs := Logs{}
+		for it.Next() {
+			logs = append(logs, it.Log())
+		}
+		assert.NoError(it.Err())
+		if len(opts) == 1 {
+			assert.Equal(all[:2], logs)
+		}
+		// Descending queries walk back from the newest logs
+		assert.NotEmpty(logs)
+		assert.Less(len(logs), len(all))
+		assert.True(it.Limited())
+	}
+
+	it := testQuery.Iter(context.Background())
+	for it.Next() {
+	}
+	assert.False(it.Limited())
+}
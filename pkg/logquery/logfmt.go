@@ -0,0 +1,147 @@
+package logquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogfmtParser parses logfmt lines like `ts=2020-02-28T05:20:57Z level=info msg="hello there" user_id=42`.
+// Any other pairs end up in Log.Fields
+type LogfmtParser struct {
+	// Field names, these default to "ts", "level" and "msg"
+	TimeField    string
+	LevelField   string
+	MessageField string
+
+	// TimeLayout defaults to time.RFC3339Nano, timestamps that are plain numbers are read as unix seconds
+	TimeLayout string
+
+	// DefaultSeverity is used when a line has no level field
+	DefaultSeverity LogLevel
+	// Severities adds level names other than debug, info, warn, error and fatal, keyed in upper case
+	Severities SeverityMap
+}
+
+// Parse implements LineParser
+func (p *LogfmtParser) Parse(raw string) (*Log, error) {
+	pairs, err := splitLogfmt(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	timeField := stringOrDefault(p.TimeField, "ts")
+	levelField := stringOrDefault(p.LevelField, "level")
+	messageField := stringOrDefault(p.MessageField, "msg")
+
+	// parse time
+	timeString, ok := pairs[timeField]
+	if !ok {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+	time, err := p.parseTime(timeString)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+
+	// parse severity
+	severity := p.DefaultSeverity
+	levelString, ok := pairs[levelField]
+	if ok {
+		severity = p.Severities.Level(levelString)
+	}
+	if severity == Undefined {
+		return nil, fmt.Errorf("severity was not parseable")
+	}
+	if levelString == "" {
+		levelString = strings.ToLower(severity.String())
+	}
+
+	// everything else is kept as a field
+	fields := map[string]string{}
+	for name, value := range pairs {
+		if name == timeField || name == levelField || name == messageField {
+			continue
+		}
+		fields[name] = value
+	}
+
+	return &Log{
+		Time:           time,
+		Severity:       severity,
+		Log:            pairs[messageField],
+		Fields:         fields,
+		TimeString:     "[" + timeString + "]",
+		SeverityString: "[" + levelString + "]",
+	}, nil
+}
+
+func (p *LogfmtParser) parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))).UTC(), nil
+	}
+	return time.Parse(stringOrDefault(p.TimeLayout, time.RFC3339Nano), value)
+}
+
+// splitLogfmt splits a line into its key=value pairs. Values can be double quoted with go style
+// escapes and a key without a value is set to "true"
+func splitLogfmt(raw string) (map[string]string, error) {
+	pairs := map[string]string{}
+	line := strings.TrimSpace(raw)
+	for line != "" {
+		// key
+		end := strings.IndexAny(line, "= ")
+		if end == -1 {
+			end = len(line)
+		}
+		key := line[:end]
+		if key == "" {
+			return nil, fmt.Errorf("log is not logfmt")
+		}
+		line = line[end:]
+		if !strings.HasPrefix(line, "=") {
+			pairs[key] = "true"
+			line = strings.TrimLeft(line, " ")
+			continue
+		}
+		line = line[1:]
+
+		// value
+		value := ""
+		if strings.HasPrefix(line, `"`) {
+			end = closingQuote(line)
+			unquoted, err := strconv.Unquote(line[:end])
+			if err != nil {
+				return nil, fmt.Errorf("log is not logfmt")
+			}
+			value, line = unquoted, line[end:]
+		} else {
+			end = strings.IndexByte(line, ' ')
+			if end == -1 {
+				end = len(line)
+			}
+			value, line = line[:end], line[end:]
+		}
+		if line != "" && line[0] != ' ' {
+			return nil, fmt.Errorf("log is not logfmt")
+		}
+		pairs[key] = value
+		line = strings.TrimLeft(line, " ")
+	}
+	return pairs, nil
+}
+
+// closingQuote returns the index just past the quote that closes the one at the start of s, or len(s)
+// if it is never closed
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(s)
+}
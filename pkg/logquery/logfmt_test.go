@@ -0,0 +1,59 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogfmtParser(t *testing.T) {
+	assert := assert.New(t)
+	parser := &LogfmtParser{}
+	log, err := parser.Parse(`ts=2020-02-28T05:20:57.35Z level=warn msg="db said \"no\"" user_id=42 retry path=/api/v1`)
+	assert.NoError(err)
+	assert.Equal(Warn, log.Severity)
+	assert.Equal(`db said "no"`, log.Log)
+	assert.True(log.Time.Equal(time.Date(2020, 2, 28, 5, 20, 57, 350000000, time.UTC)))
+	assert.Equal(map[string]string{"user_id": "42", "retry": "true", "path": "/api/v1"}, log.Fields)
+
+	custom := &LogfmtParser{TimeField: "time", DefaultSeverity: Info}
+	log, err = custom.Parse(`time=1582867257 msg=hello`)
+	assert.NoError(err)
+	assert.Equal(Info, log.Severity)
+	assert.Equal(int64(1582867257), log.Time.Unix())
+
+	for _, line := range []string{
+		`[02/28/2020 5:20:57.35][error] not logfmt`,
+		`ts=2020-02-28T05:20:57.35Z level=info msg="unterminated`,
+		`level=info msg=no_time`,
+	} {
+		_, err = parser.Parse(line)
+		assert.Error(err, line)
+	}
+}
+
+func TestQueryFields(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "api.log")
+	assert.NoError(os.WriteFile(path, []byte(
+		"ts=2020-02-28T05:20:55Z level=info msg=start request_id=abc path=/api/users\n"+
+			"ts=2020-02-28T05:20:56Z level=info msg=query request_id=def path=/api/orders\n"+
+			"ts=2020-02-28T05:20:57Z level=error msg=failed request_id=abc path=/api/users/7\n"+
+			"ts=2020-02-28T05:20:58Z level=info msg=health\n"), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"api": path}, WithParser("api", &LogfmtParser{}))
+	assert.NoError(err)
+
+	logs, _ := testQuery.QueryLogs(context.Background(), FieldEquals("request_id", "abc"))
+	assert.Equal(2, len(logs))
+	logs, _ = testQuery.QueryLogs(context.Background(), FieldEquals("request_id", "abc"), FieldMatches("path", regexp.MustCompile(`/users/\d+$`)))
+	assert.Equal(1, len(logs))
+	assert.Equal("failed", logs[0].Log)
+	logs, _ = testQuery.QueryLogs(context.Background(), FieldMatches("path", regexp.MustCompile(``)))
+	assert.Equal(3, len(logs))
+}
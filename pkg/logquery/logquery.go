@@ -2,10 +2,14 @@ package logquery
 
 import (
 	"bufio"
+	"container/heap"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +30,8 @@ const (
 )
 
 var (
+	// logLineRegex defines how lines of the default format are split, splitBracketLine and
+	// splitGreedyBracketLine split them the same way without its cost
 	logLineRegex = regexp.MustCompile("(\\[.*\\])(\\[.*\\]) (.*)")
 )
 
@@ -36,241 +42,1099 @@ type Log struct {
 	Log      string
 	Key      string
 
+	// Fields holds any extra structured data from formats like JSON, logfmt or syslog
+	Fields map[string]string
+	// Repeated is how many more times the log was repeated right after itself, see WithCollapsedRepeats
+	Repeated int
+	// Context is set on logs that were added around a match instead of matching, see WithContext
+	Context bool
+
+	// Path, LineNumber and Offset locate the line the log was read from, so a result can be opened with
+	// `less +1234 app.log`. Lines are numbered from 1 and Offset is the byte offset of the start of the
+	// line, counted after decompressing and transcoding to UTF-8. They are zero when they aren't known,
+	// like the line numbers of logs from Tail, which starts at the end of a file without counting lines
+	Path       string
+	LineNumber int
+	Offset     int64
+
 	TimeString     string
 	SeverityString string
 }
 
+// String formats the log like the line it was read from with its key, sanitized for printing to a
+// terminal
 func (l Log) String() string {
-	return fmt.Sprintf("%s%s[%s] %s", l.TimeString, l.SeverityString, l.Key, l.Log)
+	return Sanitize(fmt.Sprintf("%s%s[%s] %s%s", l.TimeString, l.SeverityString, l.Key, l.Log, l.RepeatedString()))
+}
+
+// Location is where the log was read from as path:line like ./logs/app.log:1234, the path alone when the
+// line isn't known or empty when neither is
+func (l Log) Location() string {
+	if l.Path == "" || l.LineNumber == 0 {
+		return l.Path
+	}
+	return l.Path + ":" + strconv.Itoa(l.LineNumber)
+}
+
+// RepeatedString describes how many times the log was repeated like syslog does, or is empty if it wasn't
+func (l Log) RepeatedString() string {
+	if l.Repeated == 0 {
+		return ""
+	}
+	if l.Repeated == 1 {
+		return " (repeated 1 time)"
+	}
+	return fmt.Sprintf(" (repeated %d times)", l.Repeated)
+}
+
+// Logs is the result of a query, in time order
+type Logs []Log
+
+// String joins the logs with one log per line
+func (l Logs) String() string {
+	rv := make([]string, len(l))
+	for i, log := range l {
+		rv[i] = log.String()
+	}
+	return strings.Join(rv, "\n")
 }
 
 // Queryier is the interface that calls the Query. This is nice if we ever want to change
 // out the underlying implementation
 type Queryier interface {
-	Query(start time.Time, end time.Time, entries int, keys []string, minSeverity LogLevel) string
+	Query(ctx context.Context, opts ...QueryOption) (string, error)
+	QueryLogs(ctx context.Context, opts ...QueryOption) (Logs, error)
 }
 
-// LogQuery implements Queryier and will process the logs on creation
+// LogQuery implements Queryier and will process the logs on creation. It is safe for concurrent use,
+// queries, Tail, Refresh, AddSource and RemoveSource can run at the same time
 type LogQuery struct {
+	// processedLogs are kept in time order per key so they can be binary searched
 	processedLogs map[string][]*Log
+	// paths holds every file for a key, a key has more than one file when globs are merged
+	paths     map[string][]string
+	parsers   map[string]LineParser
+	locations map[string]*time.Location
+	// clockOffsets correct the timestamps of keys whose clock is off, see WithClockOffset
+	clockOffsets map[string]time.Duration
+	// extractors pull fields out of the messages of keys, see WithFieldExtraction
+	extractors map[string][]FieldExtractor
+	// labels of keys, see WithLabels
+	labels map[string]map[string]string
+	// keyPaths are the paths of keys from WithKeyPaths, read on top of the mapping of NewLogQuery
+	keyPaths map[string][]string
+	// tailErrors is told about files Tail fails to read, see WithTailErrors
+	tailErrors func(path string, err error)
+	// skewField and skewReference estimate clock offsets on load, see WithEstimatedClockOffsets
+	skewField     string
+	skewReference string
+	// offsets remembers how far into each path we've read so Refresh only parses new lines
+	offsets      map[string]fileOffset
+	pollInterval time.Duration
+	readConfig   readConfig
+	mergeGlobs   bool
+	rotated      bool
+	severities   SeverityMap
+	failFast     bool
+	duplicates   DuplicatePolicy
+
+	// lazy files are only read when a query needs them. With keepParsed the parsed logs are stored
+	// for the next query, otherwise every query re-scans the file and only keeps what matched
+	lazy       bool
+	keepParsed bool
+
+	// mutex guards processedLogs and offsets since lazy loading and Refresh write to them during queries,
+	// and paths and parsers since AddSource and RemoveSource replace them. The slices in processedLogs
+	// are never changed once stored, writers store a new slice so queries keep the one they started with
+	mutex sync.RWMutex
+	// registering makes AddSource and RemoveSource wait for each other
+	registering sync.Mutex
+	// refreshing makes calls to Refresh wait for each other, two refreshes of a key would both add their
+	// new lines to the same old logs and one of them would be lost
+	refreshing sync.Mutex
+}
+
+// Option configures a LogQuery in NewLogQuery
+type Option func(*LogQuery)
+
+// WithParser uses parser for the log file registered under key instead of DefaultParser
+func WithParser(key string, parser LineParser) Option {
+	return func(l *LogQuery) {
+		l.parsers[key] = parser
+	}
+}
+
+// WithSeverityAliases reads the default format with extra level names, like WARNING=Warn or
+// TRACE=Debug, for every key that doesn't have its own parser. Parsers set with WithParser take their
+// own Severities
+func WithSeverityAliases(aliases SeverityMap) Option {
+	return func(l *LogQuery) {
+		l.severities = aliases.upper()
+	}
+}
+
+// WithParallelism reads at most n files at once, by default every key is read at the same time which
+// thrashes the disk with hundreds of files. It applies to loading, lazy loading and Refresh, files read
+// as a stream by lazy queries without keepParsed, Iter and Tail aren't counted
+func WithParallelism(n int) Option {
+	return func(l *LogQuery) {
+		if n < 1 {
+			n = 1
+		}
+		l.readConfig.slots = make(chan struct{}, n)
+	}
+}
+
+// WithLazyLoading defers reading files until a query touches their key. If keepParsed is true the
+// whole file is parsed once and kept in memory, otherwise the file is scanned on every query and
+// only the matching logs are held, stopping as soon as the query's end time or limit is reached
+func WithLazyLoading(keepParsed bool) Option {
+	return func(l *LogQuery) {
+		l.lazy = true
+		l.keepParsed = keepParsed
+	}
+}
+
+// WithMergedGlobs keeps every file matched by a directory or glob under the key it was registered
+// with instead of giving each file its own key
+func WithMergedGlobs() Option {
+	return func(l *LogQuery) {
+		l.mergeGlobs = true
+	}
+}
+
+// WithKeyPaths reads every path under key and merges their logs in time order, like the instances of
+// a service that each write their own file. Paths can be directories or globs whose files all stay
+// under key, and they are read along with the path of key in the mapping of NewLogQuery if it has one
+func WithKeyPaths(key string, paths ...string) Option {
+	return func(l *LogQuery) {
+		l.keyPaths[key] = append(l.keyPaths[key], paths...)
+	}
+}
+
+// WithFailFast makes NewLogQuery give up on the first file that can't be loaded instead of loading
+// every other file and returning a LoadError
+func WithFailFast() Option {
+	return func(l *LogQuery) {
+		l.failFast = true
+	}
+}
+
+var _ Queryier = &LogQuery{}
+
+// NewLogQuery return a new LogQuery object. A path can also be a directory or a glob like
+// ./logs/app-*.log, every file it matches gets a key from its file name unless WithMergedGlobs is used.
+// Cancelling ctx stops the files from being processed and returns ctx's error.
+//
+// If some files fail to load a *LoadError is returned together with a LogQuery holding every key that
+// did load, so callers can decide whether a partial load is good enough. With WithFailFast the
+// LogQuery is nil instead
+func NewLogQuery(ctx context.Context, logMapping map[string]string, opts ...Option) (*LogQuery, error) {
+	l := &LogQuery{
+		paths:        map[string][]string{},
+		parsers:      map[string]LineParser{},
+		locations:    map[string]*time.Location{},
+		clockOffsets: map[string]time.Duration{},
+		extractors:   map[string][]FieldExtractor{},
+		labels:       map[string]map[string]string{},
+		keyPaths:     map[string][]string{},
+		offsets:      map[string]fileOffset{},
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	mapping := map[string][]string{}
+	for key, path := range logMapping {
+		mapping[key] = []string{path}
+	}
+	for key, paths := range l.keyPaths {
+		mapping[key] = append(mapping[key], paths...)
+	}
+	if l.severities != nil {
+		// Set before the keys are expanded so files from a glob pick up the parser of their key
+		keys := []string{}
+		for key := range mapping {
+			keys = append(keys, key)
+		}
+		if source, ok := l.readConfig.sources[readerScheme].(*readerSource); ok {
+			for key := range source.readers {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			ownFormat := len(mapping[key]) > 0 && l.hasOwnFormat(mapping[key][0])
+			if _, ok := l.parsers[key]; !ok && !ownFormat {
+				l.parsers[key] = &BracketParser{Severities: l.severities}
+			}
+		}
+	}
+	for key, loc := range l.locations {
+		l.parsers[key] = &locationParser{parser: parserFor(l.parsers, key), loc: loc}
+	}
+	for key, offset := range l.clockOffsets {
+		l.parsers[key] = &clockParser{parser: parserFor(l.parsers, key), offset: offset}
+	}
+	for key, extractors := range l.extractors {
+		l.parsers[key] = &fieldParser{parser: parserFor(l.parsers, key), extractors: extractors}
+	}
+	if err := l.addPaths(ctx, mapping, l.paths, l.parsers); err != nil {
+		return nil, err
+	}
+	if err := l.addReaders(); err != nil {
+		return nil, err
+	}
+	if l.lazy {
+		l.processedLogs = map[string][]*Log{}
+	} else {
+		logs, offsets, errs := processFiles(ctx, l.paths, l.parsers, l.readConfig, l.failFast)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		l.processedLogs = logs
+		l.offsets = offsets
+		if l.skewField != "" {
+			if err := l.estimateClockOffsets(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if len(errs) > 0 {
+			if l.failFast {
+				return nil, &LoadError{Errors: errs}
+			}
+			return l, &LoadError{Errors: errs}
+		}
+	}
+	return l, nil
+}
+
+// Keys returns every registered key in sorted order
+func (l *LogQuery) Keys() []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	rv := []string{}
+	for key := range l.paths {
+		rv = append(rv, key)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// addPaths expands the logMapping into the paths of every key, files from a glob get the parser of their
+// key in parsers. Keys with more than one path or from WithKeyPaths keep every file under them like
+// WithMergedGlobs
+func (l *LogQuery) addPaths(ctx context.Context, logMapping map[string][]string, keyPaths map[string][]string, parsers map[string]LineParser) error {
+	// Sort the keys so key collisions are reported the same way every time
+	keys := []string{}
+	for key := range logMapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	registry := newPathRegistry(l.duplicates, keyPaths)
+	for _, key := range keys {
+		_, listed := l.keyPaths[key]
+		merge := l.mergeGlobs || listed || len(logMapping[key]) > 1
+		// all are the files kept under key itself, register is true once a path put files there
+		all, register := []string{}, false
+		for _, path := range logMapping[key] {
+			if path == "-" {
+				WithReader(key, os.Stdin)(l)
+				path = readerScheme + "://" + key
+			}
+			paths, isPattern, err := l.readConfig.source(path).Expand(ctx, path)
+			if err != nil {
+				return err
+			}
+			// Every file is read on its own unless it has rotated copies
+			groups := make([][]string, len(paths))
+			for i, path := range paths {
+				groups[i] = []string{path}
+			}
+			if l.rotated && l.readConfig.isLocal(path) {
+				if groups, err = withRotations(paths); err != nil {
+					return err
+				}
+			}
+			if !isPattern || merge {
+				for _, group := range groups {
+					all = append(all, group...)
+				}
+				register = true
+				l.setSourceParser(parsers, key, path)
+				continue
+			}
+
+			for _, group := range groups {
+				path := group[len(group)-1]
+				fileKey := keyFromFileName(path)
+				if err := registry.add(fileKey, group, path); err != nil {
+					return err
+				}
+				// Files from a glob use the parser and labels of the key they were registered with
+				if parser, ok := parsers[key]; ok {
+					if _, ok := parsers[fileKey]; !ok {
+						parsers[fileKey] = parser
+					}
+				}
+				l.inheritLabels(key, fileKey)
+				l.setSourceParser(parsers, fileKey, path)
+			}
+		}
+		if register {
+			if err := registry.add(key, all, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inheritLabels gives fileKey the labels of key unless it has its own
+func (l *LogQuery) inheritLabels(key string, fileKey string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if labels, ok := l.labels[key]; ok {
+		if _, ok := l.labels[fileKey]; !ok {
+			l.labels[fileKey] = labels
+		}
+	}
+}
+
+// hasOwnFormat returns true if path is read from a ParserSource
+func (l *LogQuery) hasOwnFormat(path string) bool {
+	_, ok := l.readConfig.source(path).(ParserSource)
+	return ok
+}
+
+// setSourceParser uses the parser of the source of path for key if it doesn't have one
+func (l *LogQuery) setSourceParser(parsers map[string]LineParser, key string, path string) {
+	source, ok := l.readConfig.source(path).(ParserSource)
+	if !ok {
+		return
+	}
+	if _, ok := parsers[key]; !ok {
+		parsers[key] = source.Parser()
+	}
 }
 
-// NewLogQuery return a new LogQuery object
-func NewLogQuery(logMapping map[string]string) (*LogQuery, error) {
-	return &LogQuery{
-		processedLogs: processFiles(logMapping),
-	}, nil
+// addReaders adds the keys from WithReader, they don't have a path in the mapping
+func (l *LogQuery) addReaders() error {
+	if source, ok := l.readConfig.sources[readerScheme].(*readerSource); ok {
+		for key := range source.readers {
+			path := readerScheme + "://" + key
+			if paths, ok := l.paths[key]; ok && paths[0] != path {
+				return fmt.Errorf("key %s is used more than once", key)
+			}
+			l.paths[key] = []string{path}
+		}
+	}
+	return nil
 }
 
-// processLogs processes the logMapping and returns a map of file name to logs
-func processFiles(logMapping map[string]string) map[string][]*Log {
+// processLogs processes the paths of every key and returns a map of key to logs, a map of path to how far
+// it was read and a map of key to the error for keys that failed. With failFast the first error stops
+// every other key
+func processFiles(ctx context.Context, logMapping map[string][]string, parsers map[string]LineParser, cfg readConfig, failFast bool) (map[string][]*Log, map[string]fileOffset, map[string]error) {
 	rv := map[string][]*Log{}
+	offsets := map[string]fileOffset{}
+	errs := map[string]error{}
 	wg := sync.WaitGroup{}
 	mutex := sync.Mutex{}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Concurrently parse files in different go routines for better efficiency
-	for fileKey, path := range logMapping {
+	for fileKey, paths := range logMapping {
 		// Wait groups help us initiate a bunch of work and then wait for it to finish before returning to execution
 		wg.Add(1)
-		go func(fileKey, path string) {
+		go func(fileKey string, paths []string) {
 			defer wg.Done()
-			logs, err := processFile(path, fileKey)
-			if err != nil {
-				fmt.Printf("error processing log file %s, %s \n", path, err)
-				return
-			}
+			logs, keyOffsets, err := processKey(ctx, paths, fileKey, parserFor(parsers, fileKey), cfg)
 
 			mutex.Lock()
 			defer mutex.Unlock()
+			if err != nil {
+				// Other keys stop with a cancelled error once we fail fast, only keep the one that failed
+				if failFast && len(errs) > 0 {
+					return
+				}
+				errs[fileKey] = err
+				if failFast {
+					cancel()
+				}
+				return
+			}
 			rv[fileKey] = logs
-		}(fileKey, path)
+			for path, offset := range keyOffsets {
+				offsets[path] = offset
+			}
+		}(fileKey, paths)
 	}
 	wg.Wait()
 
-	return rv
+	return rv, offsets, errs
+}
+
+// processKey processes every file of a key and merges them in time order
+func processKey(ctx context.Context, paths []string, key string, parser LineParser, cfg readConfig) ([]*Log, map[string]fileOffset, error) {
+	rv := []*Log{}
+	offsets := map[string]fileOffset{}
+	for _, path := range paths {
+		logs, offset, err := cfg.limit(ctx, func() ([]*Log, fileOffset, error) {
+			return loadFile(ctx, path, key, parser, cfg)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		rv = append(rv, logs...)
+		offsets[path] = offset
+	}
+	// Files aren't always in order, buffered writers flush late and clocks get adjusted
+	sortByTime(rv)
+	return cfg.retention.retain(rv), offsets, nil
 }
 
-// processFile process the logs for an individual file and return an array of logs
-func processFile(filePath string, key string) ([]*Log, error) {
-	// Opens a file
-	file, err := os.Open(filePath)
+// processFile process the logs for an individual file from where a previous read left off and return an
+// array of logs along with how far the file was read
+func processFile(ctx context.Context, filePath string, from fileOffset, key string, parser LineParser, cfg readConfig) ([]*Log, fileOffset, error) {
+	var logs []*Log
+	reserve := func(estimate int) {
+		logs = make([]*Log, 0, estimate)
+	}
+	offset, err := scanFile(ctx, filePath, from, key, parser, cfg, reserve, func(log *Log) bool {
+		logs = append(logs, log)
+		return true
+	})
 	if err != nil {
-		return nil, err
+		return nil, offset, err
+	}
+	if cfg.isLocal(filePath) && offset.resumable() {
+		offset.stamp = stampFile(filePath, offset.offset)
+	}
+	return logs, offset, nil
+}
+
+// scanFile parses a file line by line starting where a previous read left off and calls fn with every
+// log until fn returns false or ctx is done. It returns how far into the file it read. reserve is called
+// with an estimate of how many logs are left before parsing starts, callers that pass it keep every log
+// so the logs are allocated in blocks
+func scanFile(ctx context.Context, filePath string, from fileOffset, key string, parser LineParser, cfg readConfig, reserve func(estimate int), fn func(*Log) bool) (fileOffset, error) {
+	// Opens a file, decompressing and transcoding it if needed
+	file, err := openLog(ctx, cfg.source(filePath), filePath, from.offset)
+	if err != nil {
+		return fileOffset{}, err
 	}
 	defer file.Close()
+	offset := from
+	offset.size, offset.compressed, offset.encoding = file.size, file.compressed, file.encoding
+	offset.offset += file.bom
+	lines := &lineParser{parser: parser, key: key, path: filePath, lenient: cfg.lenient, stripANSI: cfg.stripANSI, redactors: cfg.redactors, levelRules: cfg.levelRules, maxLine: cfg.maxLine(), prev: from.last}
 
-	// Creates a scanner that will let us itereate over each line
-	scanner := bufio.NewScanner(file)
-	logs := []*Log{}
+	ends := &lineEndReader{Reader: file, read: offset.offset, end: offset.offset}
+	var reader io.Reader = ends
+	if reserve != nil {
+		// Peeking doesn't consume the sample, read errors come back once the scan reads past it. Files
+		// that only grew a little since the last read get a small buffer
+		remaining := file.size - offset.offset
+		size := estimateSample
+		if !file.compressed && remaining >= 0 && remaining < estimateSample {
+			size = int(remaining) + 1
+		}
+		buffered := bufio.NewReaderSize(ends, size)
+		sample, err := buffered.Peek(size)
+		estimate := estimateLogs(remaining, sample, err == io.EOF)
+		reserve(estimate)
+		lines.alloc = newLogAllocator(estimate)
+		reader = buffered
+	}
+
+	if chunkCfg, ok := cfg.chunked(file.size - from.offset); ok {
+		read, lineCount, err := scanChunks(ctx, reader, lines, chunkCfg, offset.offset, offset.lines, fn)
+		offset.offset += read
+		offset.lines += lineCount
+		return offset.finish(from, lines, ends), err
+	}
+
+	// Creates a scanner that will let us itereate over each line, counting the bytes it consumes
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 4096), cfg.maxLine()+1)
+	var start int64
+	scanner.Split(scanLines(cfg.maxLine(), &offset.offset, &start))
 	for scanner.Scan() {
-		log, err := processLine(scanner.Text(), key)
-		if err != nil {
+		if err := ctx.Err(); err != nil {
+			return offset, err
+		}
+		offset.lines++
+		log := lines.parse(scanner.Text(), offset.lines, start)
+		if log == nil {
 			continue
 		}
-		logs = append(logs, log)
+		if !fn(log) {
+			break
+		}
 	}
-	return logs, nil
+	return offset.finish(from, lines, ends), scanner.Err()
 }
 
 // process a single line
-func processLine(rawLog string, key string) (*Log, error) {
-	matches := logLineRegex.FindStringSubmatch(rawLog)
-	if len(matches) != 4 {
-		return nil, fmt.Errorf("log does not have proper structure")
+func processLine(rawLog string, key string, severities SeverityMap) (*Log, error) {
+	log := &Log{}
+	if err := processLineInto(rawLog, key, severities, log); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// processLineInto processes a single line into log, which is only written if the line parses
+func processLineInto(rawLog string, key string, severities SeverityMap, log *Log) error {
+	timeString, severityString, msg, ok := splitBracketLine(rawLog)
+	if !ok {
+		// Lines with more brackets are split like the regex does, which is slower
+		timeString, severityString, msg, ok = splitGreedyBracketLine(rawLog)
+	}
+	if !ok {
+		return fmt.Errorf("log does not have proper structure")
 	}
 
 	// parse time
-	time, err := time.Parse(logFormat, matches[1][1:len(matches[1])-1])
+	time, err := parseBracketTime(timeString[1 : len(timeString)-1])
 	if err != nil {
-		return nil, fmt.Errorf("timestamp was not parseable")
+		return fmt.Errorf("timestamp was not parseable")
 	}
 
 	// parse severity
-	severity := Undefined
-	switch strings.ToLower(matches[2]) {
-	case "[debug]":
-		severity = Debug
-	case "[info]":
-		severity = Info
-	case "[warn]":
-		severity = Warn
-	case "[error]":
-		severity = Error
-	case "[fatal]":
-		severity = Fatal
-	}
+	severity := severities.Level(severityString[1 : len(severityString)-1])
 	if severity == Undefined {
-		return nil, fmt.Errorf("severity was not parseable")
+		return fmt.Errorf("severity was not parseable")
 	}
 
-	// return single log
-	return &Log{
+	*log = Log{
 		Time:           time,
 		Severity:       severity,
-		Log:            matches[3],
+		Log:            msg,
 		Key:            key,
-		TimeString:     matches[1],
-		SeverityString: matches[2],
-	}, nil
+		TimeString:     timeString,
+		SeverityString: severityString,
+	}
+	return nil
+}
+
+// splitBracketLine splits a `[time][level] message` line without a regex or allocating. It only handles
+// lines starting with the time whose only brackets are the four around the time and level, since those
+// are the lines where logLineRegex can only split one way. ok is false for any other line
+func splitBracketLine(raw string) (timeString string, severityString string, msg string, ok bool) {
+	if len(raw) == 0 || raw[0] != '[' {
+		return "", "", "", false
+	}
+	// The positions of the brackets after the first one, which have to be ][ and ]
+	brackets := [3]int{}
+	found := 0
+	for i := 1; i < len(raw); i++ {
+		if raw[i] == '\n' {
+			// The regex never matches across lines
+			return "", "", "", false
+		}
+		if raw[i] != '[' && raw[i] != ']' {
+			continue
+		}
+		if found == len(brackets) {
+			return "", "", "", false
+		}
+		brackets[found] = i
+		found++
+	}
+	timeEnd, levelStart, levelEnd := brackets[0], brackets[1], brackets[2]
+	if found != len(brackets) || raw[timeEnd] != ']' || levelStart != timeEnd+1 || raw[levelStart] != '[' ||
+		raw[levelEnd] != ']' || levelEnd+1 >= len(raw) || raw[levelEnd+1] != ' ' {
+		return "", "", "", false
+	}
+	return raw[:timeEnd+1], raw[levelStart : levelEnd+1], raw[levelEnd+2:], true
+}
+
+// splitGreedyBracketLine splits a line like logLineRegex for any line splitBracketLine can't. The time
+// is everything from the first [ to the last ][ that still has a ] and space after it, and the level
+// runs to the last ] followed by a space. Finding those with a few scans keeps lines with thousands of
+// brackets linear. Lines with a newline are left to the regex since its . doesn't match one
+func splitGreedyBracketLine(raw string) (timeString string, severityString string, msg string, ok bool) {
+	if strings.IndexByte(raw, '\n') != -1 {
+		matches := logLineRegex.FindStringSubmatch(raw)
+		if len(matches) != 4 {
+			return "", "", "", false
+		}
+		return matches[1], matches[2], matches[3], true
+	}
+	levelEnd := strings.LastIndex(raw, "] ")
+	if levelEnd == -1 {
+		return "", "", "", false
+	}
+	timeEnd := strings.LastIndex(raw[:levelEnd], "][")
+	start := strings.IndexByte(raw, '[')
+	if timeEnd == -1 || start >= timeEnd {
+		return "", "", "", false
+	}
+	return raw[start : timeEnd+1], raw[timeEnd+1 : levelEnd+1], raw[levelEnd+2:], true
 }
 
-// Query will get a range of logs from multiple files and interpolates them based on severity
-func (l *LogQuery) Query(start time.Time, entries int, logKeys []string, minSeverity LogLevel) string {
+// Query will get a range of logs from multiple files and interpolates them based on time. The query is
+// shaped with QueryOptions such as WithStart, WithLimit and WithKeys, without any options every log of
+// every key is returned. If ctx is done before the query finishes ctx's error is returned. When lazily
+// loaded files fail to load the logs from every other file are returned along with a *LoadError
+func (l *LogQuery) Query(ctx context.Context, opts ...QueryOption) (string, error) {
+	logs, err := l.QueryLogs(ctx, opts...)
+	return logs.String(), err
+}
+
+// QueryLogs is the same as Query but returns the logs themselves instead of a joined string
+func (l *LogQuery) QueryLogs(ctx context.Context, opts ...QueryOption) (Logs, error) {
+	o := l.queryOptions(opts)
+	c, err := decodeCursor(o.Cursor, o.Descending)
+	if err != nil {
+		return nil, err
+	}
+	logs, _, err := l.query(ctx, o, c, nil)
+	return logs, err
+}
+
+// query runs a query, keys in c continue from where the last page left off. If result isn't nil every
+// match is counted into it, which reads past the limits, and grouped when the query is grouped. limited
+// is true if the query stopped early on one of o.Limits
+func (l *LogQuery) query(ctx context.Context, o QueryOptions, c *cursor, result *QueryResult) (Logs, bool, error) {
+	budget := newQueryBudget(o.Limits)
 	wg := sync.WaitGroup{}
+	groups := newGrouper(o.GroupBy)
 	processedFiles := map[string][]Log{}
+	errs := map[string]error{}
 	mutex := sync.Mutex{}
 
 	// Filter logs for all files
-	for _, logKey := range logKeys {
-		if logs, ok := l.processedLogs[logKey]; ok {
-			wg.Add(1)
-			go func(logKey string, logs []*Log) {
-				defer wg.Done()
-				rv := []Log{}
-				for i, log := range logs {
-					// If we processed the max logs here, we don't need to iterate further
-					if i == entries {
+	for _, logKey := range o.Keys {
+		logs, loaded := l.loadedLogs(logKey)
+		_, _, known := l.keySource(logKey)
+		if !loaded && !(l.lazy && known) {
+			continue
+		}
+		wg.Add(1)
+		go func(logKey string, logs []*Log, loaded bool) {
+			defer wg.Done()
+			filter := newLogFilter(o)
+			if loaded && o.Descending {
+				filter.latest, filter.backward = false, true
+			}
+			if pos, ok := c.position(logKey); ok {
+				filter.resume(pos, o.Descending)
+			}
+			add := filter.add
+			if result != nil {
+				add = filter.countAll
+				if len(o.GroupBy) > 0 {
+					filter.groups = newGrouper(o.GroupBy)
+				}
+			}
+			add = budget.wrap(add, filter)
+			read := int64(0)
+			if loaded && o.Descending {
+				// Walk back from the end so we only touch the logs we return
+				for i := firstAtOrAfter(logs, filter.end) - 1; i >= 0 && logs[i].Time.After(filter.start); i-- {
+					if ctx.Err() != nil || !add(logs[i]) {
 						break
 					}
-					// Future optimization, we dont need to start our iteration at the beginning. We can
-					// do a search for the first time
-					if log.Time.After(start) && log.Severity >= minSeverity {
-						rv = append(rv, *log)
-					}
 				}
+				filter.rv = reverseLogs(filter.rv)
+			} else {
+				var err error
+				if read, err = l.eachLog(ctx, logKey, filter.start, add); err != nil {
+					mutex.Lock()
+					defer mutex.Unlock()
+					errs[logKey] = err
+					return
+				}
+			}
 
-				mutex.Lock()
-				defer mutex.Unlock()
-				processedFiles[logKey] = rv
-			}(logKey, logs)
-		}
+			mutex.Lock()
+			defer mutex.Unlock()
+			processedFiles[logKey] = filter.results()
+			if result != nil {
+				result.KeyCounts[logKey] = filter.counted()
+				result.Matched += filter.counted()
+				result.BytesRead += read
+				if filter.groups != nil {
+					groups.merge(filter.groups)
+				}
+			}
+		}(logKey, logs, loaded)
 	}
 	wg.Wait()
 
-	inOrderLogs := logMerge(processedFiles, entries)
-	rv := make([]string, len(inOrderLogs))
-	for i, log := range inOrderLogs {
-		rv[i] = log.String()
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
 	}
-	return strings.Join(rv, "\n")
+	var rv []Log
+	if o.Descending {
+		// Every key holds its latest entries so merge all of them and keep the newest
+		total := 0
+		for _, logs := range processedFiles {
+			total += len(logs)
+		}
+		rv = logMerge(processedFiles, o.End, total)
+		if len(rv) > o.TotalLimit {
+			rv = rv[len(rv)-o.TotalLimit:]
+		}
+		rv = reverseLogs(rv)
+	} else {
+		rv = logMerge(processedFiles, o.End, o.TotalLimit)
+	}
+	if o.Before > 0 || o.After > 0 {
+		var err error
+		if rv, err = l.addContext(ctx, rv, o); err != nil {
+			return nil, false, err
+		}
+	}
+	if result != nil && len(o.GroupBy) > 0 {
+		result.Groups = groups.result(rv)
+	}
+	if len(errs) > 0 {
+		return rv, budget.exceeded(), &LoadError{Errors: errs}
+	}
+	return rv, budget.exceeded(), nil
 }
 
-// ByTime fufills the sort.Interface so we can sort an array of logs by time using the sort package
-type ByTime []Log
+// loadedLogs returns the parsed logs for a key if they are in memory
+func (l *LogQuery) loadedLogs(logKey string) ([]*Log, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	logs, ok := l.processedLogs[logKey]
+	return logs, ok
+}
 
-func (b ByTime) Len() int           { return len(b) }
-func (b ByTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
-func (b ByTime) Less(i, j int) bool { return b[i].Time.Before(b[j].Time) }
+// eachLog calls fn with the logs of a key after start, in time order, until fn returns false. Keys that
+// haven't been loaded yet are lazily loaded, it returns how many bytes of their files were read
+func (l *LogQuery) eachLog(ctx context.Context, logKey string, start time.Time, fn func(*Log) bool) (int64, error) {
+	if logs, ok := l.loadedLogs(logKey); ok {
+		// Jump straight to the first log after start instead of scanning from the beginning
+		for _, log := range logs[firstAfter(logs, start):] {
+			if ctx.Err() != nil || !fn(log) {
+				break
+			}
+		}
+		return 0, nil
+	}
+	if _, _, ok := l.keySource(logKey); !ok || !l.lazy {
+		return 0, nil
+	}
+	return l.lazyLoad(ctx, logKey, start, fn)
+}
 
-// logMerge interpolates multiple file logs in order by time
-func logMerge(logsByKey map[string][]Log, limit int) []Log {
-	fileOrderByFirstLog := []Log{}
+// lazyLoad reads the file for a key that hasn't been loaded yet and calls fn with the logs after start
+func (l *LogQuery) lazyLoad(ctx context.Context, logKey string, start time.Time, fn func(*Log) bool) (int64, error) {
+	paths, parser, _ := l.keySource(logKey)
+	// A single file can be streamed, multiple files need to be merged first
+	if !l.keepParsed && len(paths) == 1 {
+		emit := func(log *Log) bool {
+			return !log.Time.After(start) || fn(log)
+		}
+		if l.readConfig.reorderWindow <= 0 {
+			offset, err := scanFile(ctx, paths[0], fileOffset{}, logKey, parser, l.readConfig, nil, emit)
+			return offset.read(), err
+		}
+		buffer := &reorder{window: l.readConfig.reorderWindow}
+		stopped := false
+		offset, err := scanFile(ctx, paths[0], fileOffset{}, logKey, parser, l.readConfig, nil, func(log *Log) bool {
+			stopped = !buffer.push(log, emit)
+			return !stopped
+		})
+		if err == nil && !stopped {
+			buffer.flush(emit)
+		}
+		return offset.read(), err
+	}
 
-	// Get the first log from each logs array
-	for _, logs := range logsByKey {
-		if len(logs) == 0 {
-			continue
+	logs, offsets, err := processKey(ctx, paths, logKey, parser, l.readConfig)
+	if err != nil {
+		return 0, err
+	}
+	read := int64(0)
+	for _, offset := range offsets {
+		read += offset.read()
+	}
+	if l.keepParsed {
+		l.storeLogs(logKey, paths, logs, offsets)
+	}
+
+	for _, log := range logs[firstAfter(logs, start):] {
+		if ctx.Err() != nil || !fn(log) {
+			break
 		}
-		firstLog := logs[0]
-		fileOrderByFirstLog = append(fileOrderByFirstLog, firstLog)
 	}
+	return read, nil
+}
 
-	// Sort the order of the first logs
-	sort.Sort(ByTime(fileOrderByFirstLog))
+// firstAtOrAfter binary searches the time ordered logs for the index of the first log at or after t.
+// A zero t is treated as no bound
+func firstAtOrAfter(logs []*Log, t time.Time) int {
+	if t.IsZero() {
+		return len(logs)
+	}
+	return sort.Search(len(logs), func(i int) bool {
+		return !logs[i].Time.Before(t)
+	})
+}
 
-	rv := []Log{}
-	for len(fileOrderByFirstLog) > 0 {
-		// Get the known earliest log
-		firstLog := fileOrderByFirstLog[0]
+// reverseLogs reverses logs in place
+func reverseLogs(logs []Log) []Log {
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+	return logs
+}
 
-		// Get the next log file's earliest time
-		var rangeTime *time.Time
-		if len(fileOrderByFirstLog) > 1 {
-			rangeTime = &fileOrderByFirstLog[1].Time
-		}
+// firstAfter binary searches the time ordered logs for the index of the first log after t
+func firstAfter(logs []*Log, t time.Time) int {
+	return sort.Search(len(logs), func(i int) bool {
+		return logs[i].Time.After(t)
+	})
+}
 
-		// Get the range of logs from a file up till the next end time
-		logsToAdd, endIndex := getRangeLogs(logsByKey[firstLog.Key], rangeTime, limit-len(rv))
+// newLogFilter returns a filter for the query options
+func newLogFilter(o QueryOptions) *logFilter {
+	return &logFilter{
+		start:       o.Start,
+		end:         o.End,
+		entries:     o.PerKeyLimit,
+		minSeverity: o.MinSeverity,
+		maxSeverity: o.MaxSeverity,
+		message:     o.Message,
+		fields:      o.Fields,
+		latest:      o.Descending,
+		collapse:    o.CollapseRepeats,
+		sampleRates: o.SampleRates,
+	}
+}
 
-		// Append the logs from the file
-		rv = append(rv, logsToAdd...)
+// logFilter collects the logs of a single file that match a query
+type logFilter struct {
+	start       time.Time
+	end         time.Time
+	entries     int
+	minSeverity LogLevel
+	maxSeverity LogLevel
+	message     *MessageFilter
+	fields      []FieldFilter
+	// latest keeps the last entries matches instead of stopping at the first ones
+	latest bool
+	// backward is set when logs are added newest first
+	backward bool
+	// skip is the number of matches already returned by a previous page
+	skip int
+	// collapse counts matches that repeat the last one instead of keeping them
+	collapse    bool
+	sampleRates map[LogLevel]int
+	// matched counts every match when countAll is used, stopped is set once add wants no more logs
+	matched int
+	stopped bool
+	// groups counts the matches countAll counts per group when the query is grouped
+	groups *grouper
 
-		// Remove the logs from the slice that were just added
-		logsByKey[firstLog.Key] = logsByKey[firstLog.Key][endIndex:]
-		if len(rv) == limit {
-			return rv
+	rv []Log
+}
+
+// MessageFilter matches the message of a log. When both Substring and Pattern are set a log has to
+// match both
+type MessageFilter struct {
+	Substring string
+	Pattern   *regexp.Regexp
+}
+
+// Match returns true if msg passes the filter, a nil filter matches everything
+func (m *MessageFilter) Match(msg string) bool {
+	if m == nil {
+		return true
+	}
+	if m.Substring != "" && !strings.Contains(msg, m.Substring) {
+		return false
+	}
+	if m.Pattern != nil && !m.Pattern.MatchString(msg) {
+		return false
+	}
+	return true
+}
+
+// add keeps log if it matches and returns false once no later log in the file can be added
+func (f *logFilter) add(log *Log) bool {
+	// If we processed the max logs here, we don't need to iterate further
+	if len(f.rv) == f.entries && !f.latest {
+		// Unless the last log may still repeat, those are counted up to the next different match
+		if !f.collapse || f.skip > 0 || f.pastEnd(log) {
+			return false
+		}
+		return !f.matches(log) || f.repeat(log)
+	}
+	// Logs are in time order so nothing after this will be in range either
+	if f.pastEnd(log) {
+		return false
+	}
+	if f.matches(log) {
+		if f.collapse && (f.skip == 0 || f.latest) && f.repeat(log) {
+			return true
 		}
+		if f.skip > 0 && !f.latest {
+			f.skip--
+			return true
+		}
+		if f.latest && len(f.rv) == f.entries {
+			// Slide the window forward, dropping the oldest match
+			if f.entries == 0 {
+				return true
+			}
+			f.rv = append(f.rv[1:], *log)
+			return true
+		}
+		f.rv = append(f.rv, *log)
+	}
+	return true
+}
 
-		// Get the next log from the file we just took logs out of and add to the FileOrderByFirstLog
-		if len(logsByKey[firstLog.Key]) == 0 {
-			fileOrderByFirstLog = fileOrderByFirstLog[1:]
-			delete(logsByKey, firstLog.Key)
-		} else {
-			nextLog := logsByKey[firstLog.Key][0]
-			fileOrderByFirstLog[0] = nextLog
-			sort.Sort(ByTime(fileOrderByFirstLog))
+// countAll is add for queries that count every match, it carries on past the limit until the end time
+func (f *logFilter) countAll(log *Log) bool {
+	if f.pastEnd(log) {
+		return false
+	}
+	matches, skip := f.matches(log), f.skip
+	if !f.stopped {
+		f.stopped = !f.add(log)
+	}
+	// Matches a previous page returned aren't counted again
+	if matches && f.skip == skip {
+		f.matched++
+		if f.groups != nil {
+			f.groups.add(log)
 		}
+	}
+	return true
+}
 
+// counted returns how many matches countAll counted that weren't returned by a previous page
+func (f *logFilter) counted() int {
+	if f.latest && f.skip > 0 {
+		if f.skip > f.matched {
+			return 0
+		}
+		return f.matched - f.skip
 	}
-	return rv
+	return f.matched
 }
 
-func getRangeLogs(logs []Log, endTime *time.Time, limit int) ([]Log, int) {
-	if endTime == nil {
-		endIndex := len(logs)
-		if limit < endIndex {
-			endIndex = limit
+// repeat counts log against the last match and returns true if it is the same log again
+func (f *logFilter) repeat(log *Log) bool {
+	if len(f.rv) == 0 {
+		return false
+	}
+	last := &f.rv[len(f.rv)-1]
+	if last.Key != log.Key || last.Severity != log.Severity || last.Log != log.Log {
+		return false
+	}
+	if f.backward {
+		// The first log of a run is kept whichever way it is read, so a cursor ends at the same log
+		repeated := last.Repeated
+		*last = *log
+		last.Repeated = repeated
+	}
+	last.Repeated++
+	return true
+}
+
+// pastEnd returns true if log is at or after the end of the query
+func (f *logFilter) pastEnd(log *Log) bool {
+	return !f.end.IsZero() && !log.Time.Before(f.end)
+}
+
+// matches returns true if log passes every filter other than the end time and limit
+func (f *logFilter) matches(log *Log) bool {
+	return log.Time.After(f.start) && log.Severity >= f.minSeverity &&
+		(f.maxSeverity == Undefined || log.Severity <= f.maxSeverity) && f.message.Match(log.Log) &&
+		matchFields(f.fields, log.Fields) && sampled(f.sampleRates, log)
+}
+
+// results returns the matches, dropping the newest ones a previous page returned when keeping the latest
+func (f *logFilter) results() []Log {
+	if !f.latest || f.skip == 0 {
+		return f.rv
+	}
+	if f.skip >= len(f.rv) {
+		return nil
+	}
+	return f.rv[:len(f.rv)-f.skip]
+}
+
+// ByTime fufills the sort.Interface so we can sort an array of logs by time using the sort package
+type ByTime []Log
+
+func (b ByTime) Len() int           { return len(b) }
+func (b ByTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b ByTime) Less(i, j int) bool { return b[i].Time.Before(b[j].Time) }
+
+// logMerge interpolates multiple file logs in order by time with a k-way merge over a heap of each
+// key's next log. Logs at the same time keep the order of their keys, sorted by name. Logs at or after
+// end are dropped unless end is the zero time
+func logMerge(logsByKey map[string][]Log, end time.Time, limit int) []Log {
+	keys := make([]string, 0, len(logsByKey))
+	for key, logs := range logsByKey {
+		if len(logs) > 0 {
+			keys = append(keys, key)
 		}
-		return logs[:endIndex], endIndex
 	}
+	sort.Strings(keys)
 
-	i := 1
-	for i < len(logs) {
-		log := logs[i]
-		if !endTime.After(log.Time) {
+	heads := mergeHeap{}
+	for rank, key := range keys {
+		heads = append(heads, mergeHead{logs: logsByKey[key], rank: rank})
+	}
+	heap.Init(&heads)
+
+	rv := []Log{}
+	for len(heads) > 0 && len(rv) < limit {
+		head := &heads[0]
+		log := head.logs[0]
+		// The earliest log is already past the end so every other log will be too
+		if !end.IsZero() && !log.Time.Before(end) {
 			break
 		}
-		i++
+		rv = append(rv, log)
+
+		head.logs = head.logs[1:]
+		if len(head.logs) == 0 {
+			heap.Pop(&heads)
+		} else {
+			heap.Fix(&heads, 0)
+		}
 	}
-	return logs[:i], i
+	return rv
+}
+
+// mergeHead is the logs of a key that haven't been merged yet
+type mergeHead struct {
+	logs []Log
+	// rank breaks ties between keys
+	rank int
+}
+
+// mergeHeap fufills heap.Interface with the key whose next log is earliest on top
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int      { return len(h) }
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h mergeHeap) Less(i, j int) bool {
+	a, b := h[i].logs[0].Time, h[j].logs[0].Time
+	if a.Equal(b) {
+		return h[i].rank < h[j].rank
+	}
+	return a.Before(b)
+}
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	rv := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return rv
 }
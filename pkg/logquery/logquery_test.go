@@ -1,8 +1,16 @@
 package logquery
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"testing/quick"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -14,33 +22,395 @@ import (
 func TestProcessLine(t *testing.T) {
 	assert := assert.New(t)
 	testLog := "[02/28/2020 5:20:57.35][error] Could not create database my_db7. Database server rejected request."
-	_, err := processLine(testLog, "hi")
+	_, err := processLine(testLog, "hi", nil)
 	assert.NoError(err)
 
 }
 
+func TestSplitBracketLine(t *testing.T) {
+	assert := assert.New(t)
+	timeString, severityString, msg, ok := splitBracketLine("[02/28/2020 5:20:57.35][error] Could not create database")
+	assert.True(ok)
+	assert.Equal("[02/28/2020 5:20:57.35]", timeString)
+	assert.Equal("[error]", severityString)
+	assert.Equal("Could not create database", msg)
+
+	// Lines the regex could split more than one way are left to it
+	for _, line := range []string{
+		"[02/28/2020 5:20:57.35][error] Could not read [config]",
+		"junk [02/28/2020 5:20:57.35][error] message",
+		"[02/28/2020 5:20:57.35] [error] message",
+		"[02/28/2020 5:20:57.35][error]",
+		"[02/28/2020 5:20:57.35][error]message",
+		"",
+	} {
+		_, _, _, ok := splitBracketLine(line)
+		assert.False(ok, line)
+	}
+
+	// Whenever the fast path splits a line it splits it the same way as the regex
+	property := func(parts []uint8) bool {
+		line := []byte{}
+		for _, part := range parts {
+			line = append(line, "[] ax:."[part%7])
+		}
+		timeString, severityString, msg, ok := splitBracketLine(string(line))
+		if !ok {
+			return true
+		}
+		return reflect.DeepEqual([]string{string(line), timeString, severityString, msg}, logLineRegex.FindStringSubmatch(string(line)))
+	}
+	assert.NoError(quick.Check(property, &quick.Config{MaxCount: 5000}))
+}
+
+func TestSplitGreedyBracketLine(t *testing.T) {
+	assert := assert.New(t)
+	timeString, severityString, msg, ok := splitGreedyBracketLine("junk [02/28/2020 5:20:57.35][error] Could not read [config] file")
+	assert.True(ok)
+	assert.Equal("[02/28/2020 5:20:57.35][error] Could not read [config]", timeString+severityString)
+	assert.Equal("file", msg)
+
+	// Every line is split the same way as the regex
+	property := func(parts []uint8) bool {
+		line := []byte{}
+		for _, part := range parts {
+			line = append(line, "[] a\n"[part%5])
+		}
+		timeString, severityString, msg, ok := splitGreedyBracketLine(string(line))
+		matches := logLineRegex.FindStringSubmatch(string(line))
+		if !ok {
+			return matches == nil
+		}
+		return reflect.DeepEqual([]string{timeString, severityString, msg}, matches[1:])
+	}
+	assert.NoError(quick.Check(property, &quick.Config{MaxCount: 20000}))
+}
+
 func TestProcessFile(t *testing.T) {
 	assert := assert.New(t)
 	testFilePath := "../../logs/server1.log"
-	_, err := processFile(testFilePath, "hi")
+	_, _, err := processFile(context.Background(), testFilePath, fileOffset{}, "hi", DefaultParser, readConfig{})
 	assert.NoError(err)
 }
 
 func TestProcessFiles(t *testing.T) {
+	testFileMappings := map[string][]string{
+		"server1": {"../../logs/server1.log"},
+		"db":      {"../../logs/db_server.log"},
+	}
+	_, _, _ = processFiles(context.Background(), testFileMappings, nil, readConfig{}, false)
+}
+
+func TestQuery(t *testing.T) {
 	testFileMappings := map[string]string{
 		"server1": "../../logs/server1.log",
 		"db":      "../../logs/db_server.log",
 	}
-	_ = processFiles(testFileMappings)
+
+	testQuery, _ := NewLogQuery(context.Background(), testFileMappings)
+	logs, _ := testQuery.Query(context.Background(), WithKeys("server1", "db"))
+	fmt.Printf(logs)
 }
 
-func TestQuery(t *testing.T) {
+func TestQueryEndTime(t *testing.T) {
+	assert := assert.New(t)
 	testFileMappings := map[string]string{
 		"server1": "../../logs/server1.log",
 		"db":      "../../logs/db_server.log",
 	}
 
-	testQuery, _ := NewLogQuery(testFileMappings)
-	logs := testQuery.Query(time.Time{}, 100, []string{"server1", "db"}, Debug)
-	fmt.Printf(logs)
+	testQuery, _ := NewLogQuery(context.Background(), testFileMappings)
+	start := time.Date(2020, 2, 28, 5, 20, 56, 0, time.UTC)
+	end := time.Date(2020, 2, 28, 5, 20, 57, 300000000, time.UTC)
+	logs, _ := testQuery.Query(context.Background(), WithStart(start), WithEnd(end), WithKeys("server1", "db"))
+	assert.Equal(4, len(strings.Split(logs, "\n")))
+	assert.NotContains(logs, "5:20:55")
+	assert.NotContains(logs, "5:20:57.35")
+}
+
+func TestQueryLogs(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	testQuery, _ := NewLogQuery(context.Background(), testFileMappings)
+	logs, _ := testQuery.QueryLogs(context.Background(), WithKeys("server1", "db"), WithMinSeverity(Error))
+	assert.Equal(2, len(logs))
+	for i, log := range logs {
+		assert.Equal("server1", log.Key)
+		assert.True(log.Severity >= Error)
+		if i > 0 {
+			assert.False(log.Time.Before(logs[i-1].Time))
+		}
+	}
+
+	// Only warnings, leaving out the errors above them
+	logs, _ = testQuery.QueryLogs(context.Background(), WithMinSeverity(Warn), WithMaxSeverity(Warn))
+	assert.Equal(3, len(logs))
+	for _, log := range logs {
+		assert.Equal(Warn, log.Severity)
+	}
+	logs, _ = testQuery.QueryLogs(context.Background(), WithMaxSeverity(Info))
+	assert.Equal(3, len(logs))
+}
+
+func TestQueryLazy(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	for _, keepParsed := range []bool{true, false} {
+		testQuery, _ := NewLogQuery(context.Background(), testFileMappings, WithLazyLoading(keepParsed))
+		assert.Empty(testQuery.processedLogs)
+
+		logs, _ := testQuery.QueryLogs(context.Background(), WithKeys("server1"))
+		assert.Equal(4, len(logs))
+		_, loaded := testQuery.processedLogs["server1"]
+		assert.Equal(keepParsed, loaded)
+		_, loaded = testQuery.processedLogs["db"]
+		assert.False(loaded)
+
+		logs, _ = testQuery.QueryLogs(context.Background(), WithKeys("server1", "db"))
+		assert.Equal(8, len(logs))
+	}
+}
+
+func TestFirstAfter(t *testing.T) {
+	assert := assert.New(t)
+	logs, _, err := processFile(context.Background(), "../../logs/server1.log", fileOffset{}, "server1", DefaultParser, readConfig{})
+	assert.NoError(err)
+
+	assert.Equal(0, firstAfter(logs, time.Time{}))
+	assert.Equal(1, firstAfter(logs, logs[0].Time))
+	assert.Equal(2, firstAfter(logs, logs[1].Time.Add(time.Millisecond)))
+	assert.Equal(len(logs), firstAfter(logs, logs[len(logs)-1].Time))
+}
+
+func TestQueryMessageFilter(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	testQuery, _ := NewLogQuery(context.Background(), testFileMappings)
+	logs, _ := testQuery.QueryLogs(context.Background(), WithKeys("server1", "db"), WithSubstring("database"))
+	assert.Equal(7, len(logs))
+
+	logs, _ = testQuery.QueryLogs(context.Background(), WithOptions(QueryOptions{
+		MinSeverity: Warn,
+		Message: &MessageFilter{
+			Substring: "database",
+			Pattern:   regexp.MustCompile("^Rejecting"),
+		},
+	}))
+	assert.Equal(2, len(logs))
+	for _, log := range logs {
+		assert.Equal("db", log.Key)
+	}
+}
+
+func TestQueryDefaults(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	testQuery, _ := NewLogQuery(context.Background(), testFileMappings)
+	all, _ := testQuery.QueryLogs(context.Background())
+	logs, _ := testQuery.QueryLogs(context.Background(), WithKeys("server1", "db"), WithLimit(1000))
+	assert.Equal(len(logs), len(all))
+
+	logs, _ = testQuery.QueryLogs(context.Background(), WithPattern(regexp.MustCompile("^Rejecting")), WithSubstring("database"))
+	assert.Equal(2, len(logs))
+}
+
+func TestCancelledContext(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewLogQuery(ctx, testFileMappings)
+	assert.Equal(context.Canceled, err)
+
+	testQuery, _ := NewLogQuery(context.Background(), testFileMappings, WithLazyLoading(false))
+	_, err = testQuery.QueryLogs(ctx, WithKeys("server1"))
+	assert.Equal(context.Canceled, err)
+}
+
+func TestQueryDescending(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	for _, lazy := range []bool{false, true} {
+		opts := []Option{}
+		if lazy {
+			opts = append(opts, WithLazyLoading(false))
+		}
+		testQuery, _ := NewLogQuery(context.Background(), testFileMappings, opts...)
+		logs, err := testQuery.QueryLogs(context.Background(), WithLimit(3), WithKeys("server1", "db"), WithMinSeverity(Warn), WithDescending())
+		assert.NoError(err)
+		assert.Equal(3, len(logs))
+		assert.Equal("Unable to write to database “my_db7”. Exiting. ", logs[0].Log)
+		assert.Equal(Error, logs[1].Severity)
+		assert.Equal("db", logs[2].Key)
+		for i := 1; i < len(logs); i++ {
+			assert.True(logs[i].Time.Before(logs[i-1].Time))
+		}
+	}
+}
+
+func TestLogMerge(t *testing.T) {
+	base := time.Date(2020, 2, 28, 5, 20, 0, 0, time.UTC)
+	// naiveMerge is the baseline, every log sorted at once with ties in key order
+	naiveMerge := func(logsByKey map[string][]Log, end time.Time, limit int) []Log {
+		keys := []string{}
+		for key := range logsByKey {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		all := []Log{}
+		for _, key := range keys {
+			all = append(all, logsByKey[key]...)
+		}
+		sort.Stable(ByTime(all))
+		rv := []Log{}
+		for _, log := range all {
+			if len(rv) == limit || !end.IsZero() && !log.Time.Before(end) {
+				break
+			}
+			rv = append(rv, log)
+		}
+		return rv
+	}
+
+	property := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		logsByKey := map[string][]Log{}
+		for k := r.Intn(6); k > 0; k-- {
+			key := fmt.Sprintf("key%d", k)
+			logs := []Log{}
+			// Few distinct seconds so there are plenty of ties
+			second := 0
+			for i := r.Intn(20); i > 0; i-- {
+				second += r.Intn(3)
+				logs = append(logs, Log{Time: base.Add(time.Duration(second) * time.Second), Key: key, Log: fmt.Sprint(i)})
+			}
+			logsByKey[key] = logs
+		}
+		end := time.Time{}
+		if r.Intn(2) == 0 {
+			end = base.Add(time.Duration(r.Intn(30)) * time.Second)
+		}
+		limit := 1 + r.Intn(60)
+
+		expected := naiveMerge(logsByKey, end, limit)
+		return reflect.DeepEqual(expected, logMerge(logsByKey, end, limit))
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 500}))
+}
+
+func TestQueryPerKeyLimit(t *testing.T) {
+	assert := assert.New(t)
+	testFileMappings := map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}
+
+	for _, opts := range [][]Option{nil, {WithLazyLoading(false)}} {
+		testQuery, _ := NewLogQuery(context.Background(), testFileMappings, opts...)
+		logs, _ := testQuery.QueryLogs(context.Background(), WithPerKeyLimit(2), WithTotalLimit(3))
+		assert.Equal(3, len(logs))
+		logs, _ = testQuery.QueryLogs(context.Background(), WithPerKeyLimit(2))
+		assert.Equal(4, len(logs))
+		logs, _ = testQuery.QueryLogs(context.Background(), WithPerKeyLimit(1), WithDescending())
+		assert.Equal(2, len(logs))
+		assert.Equal("[02/28/2020 5:20:57.45][fatal][server1] Unable to write to database “my_db7”. Exiting. ", logs[0].String())
+
+		count := 0
+		it := testQuery.Iter(context.Background(), WithPerKeyLimit(2))
+		for it.Next() {
+			count++
+		}
+		assert.Equal(4, count)
+	}
+}
+
+func BenchmarkProcessLine(b *testing.B) {
+	lines := map[string]string{
+		"Simple":   "[02/28/2020 5:20:57.35][error] Could not create database my_db7. Database server rejected request.",
+		"Brackets": "[02/28/2020 5:20:57.35][error] Could not create database [my_db7]. Database server rejected request.",
+	}
+	for name, line := range lines {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := processLine(line, "db", nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProcessFile(b *testing.B) {
+	path := b.TempDir() + "/bench.log"
+	lines := strings.Builder{}
+	start := time.Date(2020, 2, 28, 5, 0, 0, 0, time.UTC)
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&lines, "[%s][info] Request %d to open database my_db7\n", start.Add(time.Duration(i)*time.Second).Format("01/02/2006 3:04:05.00"), i)
+	}
+	if err := os.WriteFile(path, []byte(lines.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Preallocated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := processFile(context.Background(), path, fileOffset{}, "db", DefaultParser, readConfig{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// Without an estimate the slice grows as it goes and every log is allocated on its own
+	b.Run("Unsized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logs := []*Log{}
+			_, err := scanFile(context.Background(), path, fileOffset{}, "db", DefaultParser, readConfig{}, nil, func(log *Log) bool {
+				logs = append(logs, log)
+				return true
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkLogMerge(b *testing.B) {
+	logsByKey := map[string][]Log{}
+	start := time.Date(2020, 2, 28, 5, 0, 0, 0, time.UTC)
+	for k := 0; k < 10; k++ {
+		logs := make([]Log, 10000)
+		for i := range logs {
+			logs[i] = Log{Time: start.Add(time.Duration(i*10+k) * time.Millisecond), Key: fmt.Sprintf("server%d", k)}
+		}
+		logsByKey[fmt.Sprintf("server%d", k)] = logs
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logMerge(logsByKey, time.Time{}, 1000)
+	}
 }
@@ -0,0 +1,90 @@
+package logquery
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// defaultMaxLineLength is the longest line kept whole unless WithMaxLineLength says otherwise
+const defaultMaxLineLength = 1 << 20
+
+// truncatedMarker is appended to lines that were cut at the max line length
+const truncatedMarker = " [truncated]"
+
+// WithMaxLineLength cuts lines longer than n bytes down to n bytes followed by " [truncated]" and skips
+// the rest of the line, instead of giving up on the file. Lines are cut at 1MB by default
+func WithMaxLineLength(n int) Option {
+	return func(l *LogQuery) {
+		if n < 1 {
+			n = 1
+		}
+		l.readConfig.maxLineLength = n
+	}
+}
+
+// maxLine returns the longest line that is kept whole
+func (c readConfig) maxLine() int {
+	if c.maxLineLength > 0 {
+		return c.maxLineLength
+	}
+	return defaultMaxLineLength
+}
+
+// truncateLine cuts line down to max bytes with the truncated marker if it is longer
+func truncateLine(line []byte, max int) []byte {
+	if len(line) <= max {
+		return line
+	}
+	return append(line[:max:max], truncatedMarker...)
+}
+
+// scanLines is a bufio.SplitFunc like bufio.ScanLines that cuts lines longer than max instead of failing
+// with bufio.ErrTooLong, so the scanner's buffer has to hold at least max+1 bytes. read is increased by
+// the bytes every token consumes and start is set to where the last token began
+func scanLines(max int, read *int64, start *int64) bufio.SplitFunc {
+	// skipping is set while the rest of a cut line is thrown away
+	skipping := false
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		newline := bytes.IndexByte(data, '\n')
+		if skipping {
+			if newline == -1 {
+				*read += int64(len(data))
+				return len(data), nil, nil
+			}
+			skipping = false
+			*read += int64(newline + 1)
+			return newline + 1, nil, nil
+		}
+		if newline == -1 && len(data) > max {
+			skipping = true
+			*start = *read
+			*read += int64(len(data))
+			return len(data), truncateLine(data, max), nil
+		}
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		*start = *read
+		*read += int64(advance)
+		return advance, truncateLine(token, max), err
+	}
+}
+
+// lineEndReader remembers where the last line it read ended, so a last line without a newline can be
+// told apart from finished ones
+type lineEndReader struct {
+	io.Reader
+	// read is where in the file the next byte read is, end is just past the last newline read
+	read int64
+	end  int64
+	eof  bool
+}
+
+func (r *lineEndReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if i := bytes.LastIndexByte(p[:n], '\n'); i != -1 {
+		r.end = r.read + int64(i+1)
+	}
+	r.read += int64(n)
+	r.eof = r.eof || err == io.EOF
+	return n, err
+}
@@ -0,0 +1,49 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxLineLength(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "long.log")
+	long := "[02/28/2020 5:20:56.45][warn] " + strings.Repeat("x", 200*1024)
+	content := "[02/28/2020 5:20:55.17][info] before\n" + long + "\n[02/28/2020 5:20:57.35][error] after\n"
+	assert.NoError(os.WriteFile(path, []byte(content), 0644))
+
+	for _, opts := range [][]Option{nil, {WithChunkedParsing(1024, 2)}} {
+		// Lines longer than bufio's default 64KB are kept whole
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path}, opts...)
+		assert.NoError(err)
+		logs, _ := testQuery.QueryLogs(context.Background())
+		assert.Equal(3, len(logs))
+		assert.Equal(200*1024, len(logs[1].Log))
+
+		// Longer lines are cut and the file keeps going after them
+		testQuery, err = NewLogQuery(context.Background(), map[string]string{"app": path}, append(opts, WithMaxLineLength(40))...)
+		assert.NoError(err)
+		logs, _ = testQuery.QueryLogs(context.Background())
+		assert.Equal(3, len(logs))
+		assert.Equal("xxxxxxxxxx [truncated]", logs[1].Log)
+		assert.Equal("after", logs[2].Log)
+		assert.Equal(3, logs[2].LineNumber)
+		assert.Equal(int64(len(content)-len("[02/28/2020 5:20:57.35][error] after\n")), logs[2].Offset)
+		assert.Equal(int64(len(content)), testQuery.offsets[path].offset)
+	}
+
+	// A file ending in a cut line
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] before\n"+long), 0644))
+	for _, opts := range [][]Option{nil, {WithChunkedParsing(1024, 2)}} {
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path}, append(opts, WithMaxLineLength(40))...)
+		assert.NoError(err)
+		logs, _ := testQuery.QueryLogs(context.Background())
+		assert.Equal(2, len(logs))
+		assert.Equal("xxxxxxxxxx [truncated]", logs[1].Log)
+	}
+}
@@ -0,0 +1,118 @@
+package logquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemorySource serves files kept in memory under paths like mem://app.log, for tests and for programs
+// that already hold their logs. Register it with WithSource("mem", source). Files can be written and
+// appended to while the LogQuery is in use and Refresh picks up the changes like it does for files
+type MemorySource struct {
+	mutex sync.Mutex
+	files map[string]memoryFile
+}
+
+var _ StatSource = &MemorySource{}
+
+// memoryFile is a file of a MemorySource, data is only ever appended to or replaced so readers can keep
+// the slice they got
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemorySource returns a MemorySource without any files
+func NewMemorySource() *MemorySource {
+	return &MemorySource{files: map[string]memoryFile{}}
+}
+
+// WriteFile replaces the contents of the file at path, creating it if needed
+func (s *MemorySource) WriteFile(path string, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.files[path] = memoryFile{data: append([]byte{}, data...), modTime: time.Now()}
+}
+
+// AppendFile adds data to the end of the file at path, creating it if needed
+func (s *MemorySource) AppendFile(path string, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	file := s.files[path]
+	s.files[path] = memoryFile{data: append(file.data, data...), modTime: time.Now()}
+}
+
+// Remove deletes the file at path
+func (s *MemorySource) Remove(path string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.files, path)
+}
+
+// Expand matches globs like mem://app-*.log against the paths of the files
+func (s *MemorySource) Expand(ctx context.Context, pattern string) ([]string, bool, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, false, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	paths := []string{}
+	for name := range s.files {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return nil, true, fmt.Errorf("bad glob %s, %s", pattern, err)
+		}
+		if matched {
+			paths = append(paths, name)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, true, fmt.Errorf("no log files match %s", pattern)
+	}
+	sort.Strings(paths)
+	return paths, true, nil
+}
+
+func (s *MemorySource) Open(ctx context.Context, path string, from int64) (io.ReadCloser, int64, error) {
+	file, err := s.file("open", path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from > int64(len(file.data)) {
+		from = int64(len(file.data))
+	}
+	return ioutil.NopCloser(bytes.NewReader(file.data[from:])), int64(len(file.data)), nil
+}
+
+func (s *MemorySource) Size(ctx context.Context, path string) (int64, error) {
+	file, err := s.file("stat", path)
+	return int64(len(file.data)), err
+}
+
+func (s *MemorySource) Stat(ctx context.Context, path string) (SourceInfo, error) {
+	file, err := s.file("stat", path)
+	if err != nil {
+		return SourceInfo{}, err
+	}
+	return SourceInfo{Size: int64(len(file.data)), ModTime: file.modTime}, nil
+}
+
+// file returns the file at path, or the same error as the os package for a missing file
+func (s *MemorySource) file(op string, path string) (memoryFile, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	file, ok := s.files[path]
+	if !ok {
+		return memoryFile{}, &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+	return file, nil
+}
@@ -0,0 +1,67 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySource(t *testing.T) {
+	assert := assert.New(t)
+	source := NewMemorySource()
+	source.WriteFile("mem://api-1.log", []byte("[02/28/2020 5:20:55.00][info] one\n[02/28/2020 5:20:57.00][warn] three\n"))
+	source.WriteFile("mem://api-2.log", []byte("[02/28/2020 5:20:56.00][error] two\n"))
+	source.WriteFile("mem://other.log", []byte("[02/28/2020 5:20:58.00][info] other\n"))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"api": "mem://api-*.log"}, WithSource("mem", source), WithMergedGlobs())
+	assert.NoError(err)
+	messages := func() []string {
+		logs, err := testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		rv := []string{}
+		for _, log := range logs {
+			rv = append(rv, log.Log)
+		}
+		return rv
+	}
+	assert.Equal([]string{"one", "two", "three"}, messages())
+
+	// Appended lines are picked up by Refresh and shorter files are read again
+	source.AppendFile("mem://api-2.log", []byte("[02/28/2020 5:20:59.00][info] four\n"))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"one", "two", "three", "four"}, messages())
+	source.WriteFile("mem://api-1.log", []byte("[02/28/2020 5:21:00.00][info] five\n"))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"two", "four", "five"}, messages())
+
+	source.Remove("mem://api-1.log")
+	assert.True(os.IsNotExist(testQuery.Refresh(context.Background()).(*LoadError).Errors["api"]))
+	_, err = NewLogQuery(context.Background(), map[string]string{"api": "mem://nope-*.log"}, WithSource("mem", source))
+	assert.Error(err)
+}
+
+func TestMemorySourceCache(t *testing.T) {
+	assert := assert.New(t)
+	cacheDir := t.TempDir()
+	source := NewMemorySource()
+	source.WriteFile("mem://app.log", []byte("[02/28/2020 5:20:55.00][info] first\n"))
+
+	load := func() Logs {
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": "mem://app.log"}, WithSource("mem", source), WithCache(cacheDir))
+		assert.NoError(err)
+		logs, err := testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		return logs
+	}
+	assert.Equal("first", load()[0].Log)
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*.gob"))
+	assert.NoError(err)
+	assert.Equal(1, len(entries))
+
+	// A new modification time parses the file again
+	source.WriteFile("mem://app.log", []byte("[02/28/2020 5:20:55.00][info] again\n"))
+	assert.Equal("again", load()[0].Log)
+}
@@ -0,0 +1,69 @@
+package logquery
+
+import (
+	"sort"
+	"time"
+)
+
+// WithReorderWindow puts back in order logs that are up to window out of order in files that are streamed
+// instead of kept, like keys loaded with WithLazyLoading(false). Streamed logs are held back until a log
+// window later than them is read. Keys kept in memory are always sorted once they are read, so it only
+// bounds how far streamed files can be out of order
+func WithReorderWindow(window time.Duration) Option {
+	return func(l *LogQuery) {
+		l.readConfig.reorderWindow = window
+	}
+}
+
+// sortByTime stable sorts logs by time, keeping the file order of logs with the same time. Logs that are
+// already in order are left alone
+func sortByTime(logs []*Log) {
+	less := func(i, j int) bool {
+		return logs[i].Time.Before(logs[j].Time)
+	}
+	if !sort.SliceIsSorted(logs, less) {
+		sort.SliceStable(logs, less)
+	}
+}
+
+// reorder holds streamed logs back until a log window later than them is read and releases them in time
+// order, logs at the same time keep their file order
+type reorder struct {
+	window  time.Duration
+	pending []*Log
+	newest  time.Time
+}
+
+// push adds a log and calls fn with the logs that can't be passed by a later one anymore. It returns false
+// once fn does
+func (r *reorder) push(log *Log, fn func(*Log) bool) bool {
+	i := sort.Search(len(r.pending), func(i int) bool {
+		return r.pending[i].Time.After(log.Time)
+	})
+	r.pending = append(r.pending, nil)
+	copy(r.pending[i+1:], r.pending[i:])
+	r.pending[i] = log
+	if log.Time.After(r.newest) {
+		r.newest = log.Time
+	}
+
+	cutoff := r.newest.Add(-r.window)
+	for len(r.pending) > 0 && !r.pending[0].Time.After(cutoff) {
+		next := r.pending[0]
+		r.pending = r.pending[1:]
+		if !fn(next) {
+			return false
+		}
+	}
+	return true
+}
+
+// flush calls fn with every log still held back
+func (r *reorder) flush(fn func(*Log) bool) {
+	for _, log := range r.pending {
+		if !fn(log) {
+			break
+		}
+	}
+	r.pending = nil
+}
@@ -0,0 +1,76 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Lines flushed late by a buffered writer
+const disorderedLog = "[02/28/2020 5:20:55.00][info] first\n" +
+	"[02/28/2020 5:20:57.00][info] third\n" +
+	"[02/28/2020 5:20:56.00][warn] second\n" +
+	"[02/28/2020 5:20:58.00][info] fourth\n" +
+	"[02/28/2020 5:20:57.50][error] late\n"
+
+func TestOutOfOrderFiles(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte(disorderedLog), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path})
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Equal([]string{"first", "second", "third", "late", "fourth"}, messages(logs))
+	assert.Equal(2, testQuery.ParseReport()["app"].OutOfOrder)
+
+	// Appended logs that go back in time are sorted in too
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString("[02/28/2020 5:20:55.50][info] appended\n")
+	file.Close()
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs, _ = testQuery.QueryLogs(context.Background())
+	assert.Equal([]string{"first", "appended", "second", "third", "late", "fourth"}, messages(logs))
+	assert.Equal(3, testQuery.ParseReport()["app"].OutOfOrder)
+
+	// Streamed files are put back in order within the window
+	testQuery, _ = NewLogQuery(context.Background(), map[string]string{"app": path}, WithLazyLoading(false), WithReorderWindow(3*time.Second))
+	logs, err = testQuery.QueryLogs(context.Background(), WithLimit(4))
+	assert.NoError(err)
+	assert.Equal([]string{"first", "appended", "second", "third"}, messages(logs))
+	logs, _ = testQuery.QueryLogs(context.Background(), WithStart(time.Date(2020, 2, 28, 5, 20, 56, 0, time.UTC)))
+	assert.Equal([]string{"third", "late", "fourth"}, messages(logs))
+}
+
+func TestReorder(t *testing.T) {
+	assert := assert.New(t)
+	at := func(seconds int, msg string) *Log {
+		return &Log{Time: time.Date(2020, 2, 28, 5, 20, seconds, 0, time.UTC), Log: msg}
+	}
+	buffer := &reorder{window: 2 * time.Second}
+	released := []string{}
+	collect := func(log *Log) bool {
+		released = append(released, log.Log)
+		return true
+	}
+	for _, log := range []*Log{at(1, "a"), at(3, "c"), at(2, "b"), at(3, "c2"), at(6, "e"), at(4, "d")} {
+		assert.True(buffer.push(log, collect))
+	}
+	// d was further behind than the window allows
+	assert.Equal([]string{"a", "b", "c", "c2", "d"}, released)
+	buffer.flush(collect)
+	assert.Equal([]string{"a", "b", "c", "c2", "d", "e"}, released)
+}
+
+func messages(logs Logs) []string {
+	rv := []string{}
+	for _, log := range logs {
+		rv = append(rv, log.Log)
+	}
+	return rv
+}
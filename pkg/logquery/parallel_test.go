@@ -0,0 +1,98 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingSource reads local files under count:// and remembers how many were open at once. A #fragment
+// lets the same file be registered under several keys
+type countingSource struct {
+	mutex   sync.Mutex
+	open    int
+	maxOpen int
+}
+
+func (s *countingSource) Expand(ctx context.Context, path string) ([]string, bool, error) {
+	return []string{path}, false, nil
+}
+
+func (s *countingSource) Open(ctx context.Context, path string, from int64) (io.ReadCloser, int64, error) {
+	file, size, err := fileSource{}.Open(ctx, countPath(path), from)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.mutex.Lock()
+	s.open++
+	if s.open > s.maxOpen {
+		s.maxOpen = s.open
+	}
+	s.mutex.Unlock()
+	// Stay open long enough for the other files to be opened if nothing limits them
+	time.Sleep(10 * time.Millisecond)
+	return &countingFile{ReadCloser: file, source: s}, size, nil
+}
+
+func (s *countingSource) Size(ctx context.Context, path string) (int64, error) {
+	info, err := os.Stat(countPath(path))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// countPath returns the local path of a count:// path
+func countPath(path string) string {
+	path = strings.TrimPrefix(path, "count://")
+	if i := strings.Index(path, "#"); i != -1 {
+		path = path[:i]
+	}
+	return path
+}
+
+type countingFile struct {
+	io.ReadCloser
+	source *countingSource
+}
+
+func (f *countingFile) Close() error {
+	f.source.mutex.Lock()
+	f.source.open--
+	f.source.mutex.Unlock()
+	return f.ReadCloser.Close()
+}
+
+func TestParallelism(t *testing.T) {
+	assert := assert.New(t)
+	mapping := map[string]string{}
+	for i := 0; i < 12; i++ {
+		mapping[fmt.Sprintf("server%d", i)] = fmt.Sprintf("count://../../logs/server1.log#%d", i)
+	}
+
+	source := &countingSource{}
+	testQuery, err := NewLogQuery(context.Background(), mapping, WithSource("count", source), WithParallelism(3))
+	assert.NoError(err)
+	assert.Equal(12, len(testQuery.Keys()))
+	assert.True(source.maxOpen <= 3, "%d files were open at once", source.maxOpen)
+	logs, _ := testQuery.QueryLogs(context.Background())
+	assert.Equal(48, len(logs))
+
+	source = &countingSource{}
+	_, err = NewLogQuery(context.Background(), mapping, WithSource("count", source))
+	assert.NoError(err)
+	assert.True(source.maxOpen > 3)
+
+	// A cancelled load doesn't wait for a slot
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewLogQuery(ctx, mapping, WithSource("count", &countingSource{}), WithParallelism(1))
+	assert.Equal(context.Canceled, err)
+}
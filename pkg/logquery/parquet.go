@@ -0,0 +1,384 @@
+package logquery
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// parquetRowGroupRows is the most rows in a row group, every column of a row group is written as a
+// single page
+const parquetRowGroupRows = 1 << 17
+
+// Parquet physical and converted types, repetitions and encodings from parquet.thrift
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// parquetEncoder holds every Record until Close, the columns of a Parquet file can only be written
+// once all the rows are known. Fields become optional string columns of a fields group, one per name
+// seen in any log
+type parquetEncoder struct {
+	w       io.Writer
+	records []Record
+}
+
+func (e *parquetEncoder) Encode(log Log) error {
+	e.records = append(e.records, log.Record())
+	return nil
+}
+
+// parquetColumn is a leaf of the schema with how to read its value from a Record. Columns with an
+// int64Value are INT64, the rest are UTF8 strings that are null when stringValue returns false
+type parquetColumn struct {
+	path        []string
+	optional    bool
+	int64Value  func(r Record) int64
+	stringValue func(r Record) (string, bool)
+}
+
+func (c parquetColumn) physical() int32 {
+	if c.int64Value != nil {
+		return parquetInt64
+	}
+	return parquetByteArray
+}
+
+func parquetColumns(fields []string) []parquetColumn {
+	columns := []parquetColumn{
+		{path: []string{"time"}, int64Value: func(r Record) int64 {
+			return r.Time.Unix()*1e6 + int64(r.Time.Nanosecond()/1e3)
+		}},
+		{path: []string{"key"}, stringValue: func(r Record) (string, bool) { return r.Key, true }},
+		{path: []string{"severity"}, stringValue: func(r Record) (string, bool) { return r.Severity, true }},
+		{path: []string{"message"}, stringValue: func(r Record) (string, bool) { return r.Message, true }},
+	}
+	for _, field := range fields {
+		field := field
+		columns = append(columns, parquetColumn{path: []string{"fields", field}, optional: true, stringValue: func(r Record) (string, bool) {
+			value, ok := r.Fields[field]
+			return value, ok
+		}})
+	}
+	return columns
+}
+
+// page returns the body of the data page holding rows, the definition levels of an optional column
+// followed by its PLAIN encoded values
+func (c parquetColumn) page(rows []Record) []byte {
+	var body []byte
+	if c.optional {
+		set := make([]bool, len(rows))
+		for i, r := range rows {
+			_, set[i] = c.stringValue(r)
+		}
+		levels := parquetLevels(set)
+		body = make([]byte, 4, 4+len(levels))
+		binary.LittleEndian.PutUint32(body, uint32(len(levels)))
+		body = append(body, levels...)
+	}
+	var scratch [8]byte
+	for _, r := range rows {
+		if c.int64Value != nil {
+			binary.LittleEndian.PutUint64(scratch[:], uint64(c.int64Value(r)))
+			body = append(body, scratch[:8]...)
+			continue
+		}
+		value, ok := c.stringValue(r)
+		if !ok {
+			continue
+		}
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(value)))
+		body = append(body, scratch[:4]...)
+		body = append(body, value...)
+	}
+	return body
+}
+
+// parquetLevels encodes definition levels of bit width 1 as runs of the RLE/bit-packing hybrid
+func parquetLevels(set []bool) []byte {
+	var levels []byte
+	for i := 0; i < len(set); {
+		run := 1
+		for i+run < len(set) && set[i+run] == set[i] {
+			run++
+		}
+		levels = appendUvarint(levels, uint64(run)<<1)
+		if set[i] {
+			levels = append(levels, 1)
+		} else {
+			levels = append(levels, 0)
+		}
+		i += run
+	}
+	return levels
+}
+
+// parquetChunk is where a column chunk was written, for the footer
+type parquetChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+func (e *parquetEncoder) Close() error {
+	names := map[string]bool{}
+	for _, r := range e.records {
+		for name := range r.Fields {
+			names[name] = true
+		}
+	}
+	fields := make([]string, 0, len(names))
+	for name := range names {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	columns := parquetColumns(fields)
+
+	buffered := bufio.NewWriter(e.w)
+	w := &offsetWriter{w: buffered}
+	w.Write([]byte("PAR1"))
+	var groups [][]parquetChunk
+	for start := 0; start < len(e.records); start += parquetRowGroupRows {
+		end := start + parquetRowGroupRows
+		if end > len(e.records) {
+			end = len(e.records)
+		}
+		rows := e.records[start:end]
+		chunks := make([]parquetChunk, len(columns))
+		for i, column := range columns {
+			body := column.page(rows)
+			header := parquetPageHeader(len(rows), len(body))
+			chunks[i] = parquetChunk{offset: w.n, size: int64(len(header) + len(body)), values: int64(len(rows))}
+			w.Write(header)
+			w.Write(body)
+		}
+		groups = append(groups, chunks)
+	}
+	footer := parquetFooter(columns, fields, groups, int64(len(e.records)))
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	w.Write(footer)
+	w.Write(length[:])
+	w.Write([]byte("PAR1"))
+	if w.err != nil {
+		return w.err
+	}
+	return buffered.Flush()
+}
+
+func parquetPageHeader(values, size int) []byte {
+	t := &thriftWriter{}
+	t.begin()
+	t.int32Field(1, 0) // DATA_PAGE
+	t.int32Field(2, int32(size))
+	t.int32Field(3, int32(size))
+	t.structField(5)
+	t.int32Field(1, int32(values))
+	t.int32Field(2, parquetPlain)
+	t.int32Field(3, parquetRLE)
+	t.int32Field(4, parquetRLE)
+	t.end()
+	t.end()
+	return t.buf
+}
+
+// parquetFooter is the FileMetaData of the file, the schema and where every column chunk is
+func parquetFooter(columns []parquetColumn, fields []string, groups [][]parquetChunk, rows int64) []byte {
+	t := &thriftWriter{}
+	t.begin()
+	t.int32Field(1, 1)
+
+	// The schema is flattened depth first, the root and fields groups only have children
+	elements := 1 + len(columns)
+	children := len(columns)
+	if len(fields) > 0 {
+		elements++
+		children -= len(fields) - 1
+	}
+	t.listField(2, thriftStruct, elements)
+	t.begin()
+	t.stringField(4, "schema")
+	t.int32Field(5, int32(children))
+	t.end()
+	grouped := false
+	for _, column := range columns {
+		if len(column.path) > 1 && !grouped {
+			grouped = true
+			t.begin()
+			t.int32Field(3, parquetRequired)
+			t.stringField(4, column.path[0])
+			t.int32Field(5, int32(len(fields)))
+			t.end()
+		}
+		t.begin()
+		t.int32Field(1, column.physical())
+		repetition := int32(parquetRequired)
+		if column.optional {
+			repetition = parquetOptional
+		}
+		t.int32Field(3, repetition)
+		t.stringField(4, column.path[len(column.path)-1])
+		if column.int64Value != nil {
+			t.int32Field(6, parquetTimestampMicros)
+		} else {
+			t.int32Field(6, parquetUTF8)
+		}
+		t.end()
+	}
+
+	t.int64Field(3, rows)
+	t.listField(4, thriftStruct, len(groups))
+	for _, chunks := range groups {
+		t.begin()
+		t.listField(1, thriftStruct, len(chunks))
+		var size int64
+		for i, chunk := range chunks {
+			size += chunk.size
+			column := columns[i]
+			t.begin()
+			t.int64Field(2, chunk.offset)
+			t.structField(3)
+			t.int32Field(1, column.physical())
+			t.listField(2, thriftI32, 2)
+			t.appendUvarint(zigzag(parquetPlain))
+			t.appendUvarint(zigzag(parquetRLE))
+			t.listField(3, thriftBinary, len(column.path))
+			for _, name := range column.path {
+				t.appendString(name)
+			}
+			t.int32Field(4, 0) // UNCOMPRESSED
+			t.int64Field(5, chunk.values)
+			t.int64Field(6, chunk.size)
+			t.int64Field(7, chunk.size)
+			t.int64Field(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.int64Field(2, size)
+		t.int64Field(3, chunks[0].values)
+		t.end()
+	}
+	t.stringField(6, "logparser")
+	t.end()
+	return t.buf
+}
+
+// offsetWriter keeps the offset of the next write and the first error, so the writes of a file can be
+// checked once at the end
+type offsetWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *offsetWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes the Thrift compact protocol Parquet metadata is encoded with. Field ids are
+// written as deltas from the previous field of the same struct, so nested structs keep a stack of them
+type thriftWriter struct {
+	buf   []byte
+	last  int16
+	stack []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.appendUvarint(zigzag(int64(id)))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) int32Field(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.appendUvarint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) int64Field(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.appendUvarint(zigzag(v))
+}
+
+func (t *thriftWriter) stringField(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.appendString(s)
+}
+
+// structField starts a struct field, its fields follow until end
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// listField starts a list field of n elements, which follow it
+func (t *thriftWriter) listField(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.appendUvarint(uint64(n))
+}
+
+// begin starts a struct, a list element or the top level one
+func (t *thriftWriter) begin() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+// end stops the struct begun last
+func (t *thriftWriter) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftWriter) appendString(s string) {
+	t.appendUvarint(uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftWriter) appendUvarint(v uint64) {
+	t.buf = appendUvarint(t.buf, v)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	return append(buf, scratch[:binary.PutUvarint(scratch[:], v)]...)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -0,0 +1,122 @@
+package logquery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readThrift decodes a compact protocol struct into its fields by id, lists become []interface{} and
+// binaries strings
+func readThrift(r *bytes.Reader) map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header, _ := r.ReadByte()
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0f
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			id, _ := binary.ReadUvarint(r)
+			last = int16(int64(id>>1) ^ -int64(id&1))
+		}
+		fields[last] = readThriftValue(r, typ)
+	}
+}
+
+func readThriftValue(r *bytes.Reader, typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		v, _ := binary.ReadUvarint(r)
+		return int64(v>>1) ^ -int64(v&1)
+	case thriftBinary:
+		n, _ := binary.ReadUvarint(r)
+		b := make([]byte, n)
+		r.Read(b)
+		return string(b)
+	case thriftList:
+		header, _ := r.ReadByte()
+		n := uint64(header >> 4)
+		if n == 15 {
+			n, _ = binary.ReadUvarint(r)
+		}
+		list := []interface{}{}
+		for i := uint64(0); i < n; i++ {
+			list = append(list, readThriftValue(r, header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return readThrift(r)
+	}
+	panic("unexpected thrift type")
+}
+
+func TestParquetEncoder(t *testing.T) {
+	assert := assert.New(t)
+	logs := Logs{
+		{Time: time.Date(2020, 2, 28, 5, 20, 57, 350000000, time.UTC), Severity: Error, Log: "failed", Key: "server1"},
+		{Time: time.Date(2020, 2, 28, 5, 20, 58, 0, time.UTC), Severity: Info, Log: "login", Key: "db", Fields: map[string]string{"user": "42"}},
+		{Time: time.Date(2020, 2, 28, 5, 20, 59, 0, time.UTC), Severity: Info, Log: "logout", Key: "db", Fields: map[string]string{"user": "7", "ip": "10.0.0.1"}},
+	}
+	assert.Equal("parquet", FormatForPath("results.parquet"))
+
+	buf := bytes.Buffer{}
+	e, err := NewEncoder("parquet", &buf)
+	assert.NoError(err)
+	assert.NoError(logs.Encode(e))
+	file := buf.Bytes()
+	assert.Equal("PAR1", string(file[:4]))
+	assert.Equal("PAR1", string(file[len(file)-4:]))
+	length := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := bytes.NewReader(file[len(file)-8-length : len(file)-8])
+	meta := readThrift(footer)
+	assert.Equal(0, footer.Len())
+	assert.Equal(int64(3), meta[3])
+
+	names := []string{}
+	for _, element := range meta[2].([]interface{}) {
+		names = append(names, element.(map[int16]interface{})[4].(string))
+	}
+	assert.Equal([]string{"schema", "time", "key", "severity", "message", "fields", "ip", "user"}, names)
+
+	groups := meta[4].([]interface{})
+	assert.Equal(1, len(groups))
+	chunks := groups[0].(map[int16]interface{})[1].([]interface{})
+	assert.Equal(6, len(chunks))
+
+	// page reads the header and body of a column chunk's page
+	page := func(i int) (map[int16]interface{}, []byte) {
+		column := chunks[i].(map[int16]interface{})[3].(map[int16]interface{})
+		r := bytes.NewReader(file[column[9].(int64):])
+		header := readThrift(r)
+		body := make([]byte, header[2].(int64))
+		r.Read(body)
+		return header, body
+	}
+	_, body := page(0)
+	assert.Equal(logs[0].Time.UnixNano()/1e3, int64(binary.LittleEndian.Uint64(body)))
+	_, body = page(1)
+	assert.Equal("\x07\x00\x00\x00server1\x02\x00\x00\x00db\x02\x00\x00\x00db", string(body))
+
+	// user is null in the first row, its levels are a run of one 0 and a run of two 1s
+	header, body := page(5)
+	assert.Equal(int64(3), header[5].(map[int16]interface{})[1])
+	assert.Equal("\x04\x00\x00\x00\x02\x00\x04\x01\x02\x00\x00\x0042\x01\x00\x00\x007", string(body))
+	column := chunks[5].(map[int16]interface{})[3].(map[int16]interface{})
+	assert.Equal([]interface{}{"fields", "user"}, column[3])
+
+	buf.Reset()
+	e, _ = NewEncoder("parquet", &buf)
+	assert.NoError(Logs{}.Encode(e))
+	meta = readThrift(bytes.NewReader(buf.Bytes()[4 : buf.Len()-8]))
+	assert.Equal(int64(0), meta[3])
+	assert.Equal(5, len(meta[2].([]interface{})))
+}
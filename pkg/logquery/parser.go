@@ -0,0 +1,114 @@
+package logquery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LineParser turns a single raw line of a log file into a Log. The Key of the returned log is
+// filled in by the caller
+type LineParser interface {
+	Parse(raw string) (*Log, error)
+}
+
+// intoParser is implemented by parsers that can parse a line into a log they are given instead of
+// allocating one, so a file can be parsed into blocks of logs. log is only written when the line parses
+type intoParser interface {
+	parseInto(raw string, log *Log) error
+}
+
+// LineParserFunc lets a plain function be used as a LineParser
+type LineParserFunc func(raw string) (*Log, error)
+
+// Parse calls f(raw)
+func (f LineParserFunc) Parse(raw string) (*Log, error) {
+	return f(raw)
+}
+
+// DefaultParser parses the `[01/02/2006 3:4:5.00][info] message` format and is used for any
+// file that doesn't have a parser set
+var DefaultParser LineParser = &BracketParser{}
+
+// BracketParser parses the default `[01/02/2006 3:4:5.00][info] message` format. The fraction of a second
+// can have any number of digits or none, and times can be 24-hour or 12-hour with an AM or PM. Severities
+// adds level names other than debug, info, warn, error and fatal, keyed in upper case
+type BracketParser struct {
+	Severities SeverityMap
+}
+
+// Parse implements LineParser
+func (p *BracketParser) Parse(raw string) (*Log, error) {
+	return processLine(raw, "", p.Severities)
+}
+
+// parseInto implements intoParser
+func (p *BracketParser) parseInto(raw string, log *Log) error {
+	return processLineInto(raw, "", p.Severities, log)
+}
+
+// RegexParser parses lines using the named capture groups "time", "level" and "msg" of Regex.
+// If there is no "msg" group the whole line is used as the message and if there is no "level"
+// group every log gets DefaultSeverity
+type RegexParser struct {
+	Regex           *regexp.Regexp
+	TimeLayout      string
+	DefaultSeverity LogLevel
+	// Severities adds level names other than debug, info, warn, error and fatal, keyed in upper case
+	Severities SeverityMap
+}
+
+// Parse implements LineParser
+func (p *RegexParser) Parse(raw string) (*Log, error) {
+	matches := p.Regex.FindStringSubmatch(raw)
+	if matches == nil {
+		return nil, fmt.Errorf("log does not have proper structure")
+	}
+
+	timeString, levelString, msg := "", "", raw
+	hasLevel := false
+	for i, name := range p.Regex.SubexpNames() {
+		switch name {
+		case "time":
+			timeString = matches[i]
+		case "level":
+			levelString = matches[i]
+			hasLevel = true
+		case "msg":
+			msg = matches[i]
+		}
+	}
+
+	time, err := time.Parse(p.TimeLayout, timeString)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+
+	severity := p.DefaultSeverity
+	if hasLevel {
+		severity = p.Severities.Level(levelString)
+	}
+	if severity == Undefined {
+		return nil, fmt.Errorf("severity was not parseable")
+	}
+	if levelString == "" {
+		levelString = strings.ToLower(severity.String())
+	}
+
+	return &Log{
+		Time:           time,
+		Severity:       severity,
+		Log:            msg,
+		TimeString:     "[" + timeString + "]",
+		SeverityString: "[" + levelString + "]",
+	}, nil
+}
+
+// parserFor returns the parser registered for key or DefaultParser
+func parserFor(parsers map[string]LineParser, key string) LineParser {
+	if parser, ok := parsers[key]; ok && parser != nil {
+		return parser
+	}
+	return DefaultParser
+}
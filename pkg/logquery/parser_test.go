@@ -0,0 +1,102 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexParser(t *testing.T) {
+	assert := assert.New(t)
+	nginx := &RegexParser{
+		Regex:           regexp.MustCompile(`^\S+ \S+ \S+ \[(?P<time>[^\]]+)\] "(?P<msg>[^"]*)"`),
+		TimeLayout:      "02/Jan/2006:15:04:05 -0700",
+		DefaultSeverity: Info,
+	}
+	log, err := nginx.Parse(`127.0.0.1 - - [28/Feb/2020:05:20:56 +0000] "GET /index.html HTTP/1.1" 200 512`)
+	assert.NoError(err)
+	assert.Equal("GET /index.html HTTP/1.1", log.Log)
+	assert.Equal(Info, log.Severity)
+	assert.True(log.Time.Equal(time.Date(2020, 2, 28, 5, 20, 56, 0, time.UTC)))
+
+	_, err = nginx.Parse("not an access log")
+	assert.Error(err)
+}
+
+func TestWithParser(t *testing.T) {
+	assert := assert.New(t)
+	parser := &RegexParser{
+		Regex:      regexp.MustCompile(`^\[(?P<time>[^\]]+)\]\[(?P<level>\w+)\] (?P<msg>.*)$`),
+		TimeLayout: logFormat,
+	}
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{
+		"server1": "../../logs/server1.log",
+	}, WithParser("server1", parser))
+	logs, _ := testQuery.QueryLogs(context.Background(), WithKeys("server1"))
+	assert.Equal(4, len(logs))
+	assert.Equal("server1", logs[0].Key)
+}
+
+func TestParseLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	level, err := ParseLevel("Warn")
+	assert.Nil(err)
+	assert.Equal(Warn, level)
+	assert.Equal("WARN", level.String())
+
+	_, err = ParseLevel("verbose")
+	assert.NotNil(err)
+	assert.Equal("UNDEFINED", Undefined.String())
+	assert.Equal("LogLevel(9)", LogLevel(9).String())
+}
+
+func TestSeverityAliases(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "legacy.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.00][TRACE] entering\n"+
+		"[02/28/2020 5:20:56.00][WARNING] slow\n"+
+		"[02/28/2020 5:20:57.00][ERR] failed\n"+
+		"[02/28/2020 5:20:58.00][CRIT] down\n"+
+		"[02/28/2020 5:20:59.00][info] back\n"), 0644))
+
+	// Without aliases only the info line parses
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"legacy": path})
+	assert.NoError(err)
+	logs, _ := testQuery.QueryLogs(context.Background())
+	assert.Equal(1, len(logs))
+
+	aliases, err := NewSeverityMap(map[string]LogLevel{"trace": Debug, "WARNING": Warn, "err": Error, "crit": Fatal})
+	assert.NoError(err)
+	testQuery, err = NewLogQuery(context.Background(), map[string]string{"all": filepath.Join(dir, "*.log")}, WithSeverityAliases(aliases))
+	assert.NoError(err)
+	logs, _ = testQuery.QueryLogs(context.Background(), WithMinSeverity(Warn))
+	assert.Equal("[02/28/2020 5:20:56.00][WARNING][legacy] slow\n"+
+		"[02/28/2020 5:20:57.00][ERR][legacy] failed\n"+
+		"[02/28/2020 5:20:58.00][CRIT][legacy] down", logs.String())
+
+	assert.Equal(Debug, aliases.Level("Trace"))
+	assert.Equal(Info, aliases.Level("INFO"))
+	assert.Equal(Undefined, aliases.Level("notice"))
+
+	// Names that only differ in case can't mean different levels, WithSeverityAliases picks one the same
+	// way every time
+	_, err = NewSeverityMap(map[string]LogLevel{"Warning": Warn, "WARNING": Error})
+	assert.Error(err)
+	_, err = NewSeverityMap(map[string]LogLevel{"Warning": Warn, "WARNING": Warn})
+	assert.NoError(err)
+	for i := 0; i < 10; i++ {
+		assert.Equal(Warn, SeverityMap{"Warning": Warn, "WARNING": Error}.upper().Level("warning"))
+	}
+
+	parser := &JSONParser{Severities: aliases}
+	log, err := parser.Parse(`{"ts": "2020-02-28T05:20:57Z", "level": "CRIT", "msg": "down"}`)
+	assert.NoError(err)
+	assert.Equal(Fatal, log.Severity)
+}
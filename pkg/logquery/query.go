@@ -0,0 +1,266 @@
+package logquery
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"time"
+)
+
+// QueryOptions are the filters of a query. They are usually built with the With* query options but
+// WithOptions can set them all at once
+type QueryOptions struct {
+	// Logs have to be after Start and before End, a zero time means no bound
+	Start time.Time
+	End   time.Time
+	// TotalLimit is the max number of logs returned, 0 means no limit
+	TotalLimit int
+	// PerKeyLimit is the max number of logs taken from each key before they are merged, 0 means
+	// only TotalLimit applies. With Descending these are the most recent logs of each key
+	PerKeyLimit int
+	// Keys to query, nil means every key. Keys can be patterns like `*` or `web-*`, see SelectKeys
+	Keys []string
+	// ExcludeKeys are left out of Keys, they can be patterns too
+	ExcludeKeys []string
+	// Labels picks the keys whose labels match, see WithLabelSelector. Match can't see labels so it
+	// ignores them
+	Labels      LabelSelector
+	MinSeverity LogLevel
+	// MaxSeverity is the highest level returned, Undefined means there is no highest level
+	MaxSeverity LogLevel
+	// Message filters on the message text, nil matches every message
+	Message *MessageFilter
+	// Fields filters on Log.Fields, a log has to match every filter
+	Fields []FieldFilter
+	// Descending returns the most recent logs first
+	Descending bool
+	// Cursor continues from a previous Page, see WithCursor
+	Cursor string
+	// CollapseRepeats turns runs of the same log into one, see WithCollapsedRepeats
+	CollapseRepeats bool
+	// SampleRates keeps 1 in every n matching logs of a level, see WithSampleRate
+	SampleRates map[LogLevel]int
+	// Before and After are how many logs around every match are added, see WithContext
+	Before int
+	After  int
+	// GroupBy are the columns QueryResult groups the matches by, see WithGroupBy
+	GroupBy []string
+	// Limits stops the query early, see WithQueryLimits
+	Limits QueryLimits
+}
+
+// QueryOption sets one of the QueryOptions
+type QueryOption func(*QueryOptions)
+
+// WithOptions replaces every option with opts
+func WithOptions(opts QueryOptions) QueryOption {
+	return func(o *QueryOptions) {
+		*o = opts
+	}
+}
+
+// WithStart only returns logs after start
+func WithStart(start time.Time) QueryOption {
+	return func(o *QueryOptions) {
+		o.Start = start
+	}
+}
+
+// WithEnd only returns logs before end
+func WithEnd(end time.Time) QueryOption {
+	return func(o *QueryOptions) {
+		o.End = end
+	}
+}
+
+// WithLimit returns at most limit logs, it is the same as WithTotalLimit
+func WithLimit(limit int) QueryOption {
+	return WithTotalLimit(limit)
+}
+
+// WithTotalLimit returns at most limit logs across every key
+func WithTotalLimit(limit int) QueryOption {
+	return func(o *QueryOptions) {
+		o.TotalLimit = limit
+	}
+}
+
+// WithPerKeyLimit takes at most limit logs from each key, so one busy key can't crowd out the others
+func WithPerKeyLimit(limit int) QueryOption {
+	return func(o *QueryOptions) {
+		o.PerKeyLimit = limit
+	}
+}
+
+// WithKeys only queries the given keys. Keys can be patterns like `*` for every key or `web-*`
+func WithKeys(keys ...string) QueryOption {
+	return func(o *QueryOptions) {
+		o.Keys = keys
+	}
+}
+
+// WithMinSeverity only returns logs at or above level
+func WithMinSeverity(level LogLevel) QueryOption {
+	return func(o *QueryOptions) {
+		o.MinSeverity = level
+	}
+}
+
+// WithMaxSeverity only returns logs at or below level, so warnings can be looked at without the errors
+// that already alert elsewhere. Lines kept by WithLenientParsing have no level and aren't hidden by it
+func WithMaxSeverity(level LogLevel) QueryOption {
+	return func(o *QueryOptions) {
+		o.MaxSeverity = level
+	}
+}
+
+// WithSubstring only returns logs whose message contains substring
+func WithSubstring(substring string) QueryOption {
+	return func(o *QueryOptions) {
+		o.Message = o.Message.clone()
+		o.Message.Substring = substring
+	}
+}
+
+// WithPattern only returns logs whose message matches pattern
+func WithPattern(pattern *regexp.Regexp) QueryOption {
+	return func(o *QueryOptions) {
+		o.Message = o.Message.clone()
+		o.Message.Pattern = pattern
+	}
+}
+
+// FieldEquals only returns logs whose field name is exactly value
+func FieldEquals(name, value string) QueryOption {
+	return func(o *QueryOptions) {
+		o.Fields = append(o.Fields, FieldFilter{Name: name, Value: value})
+	}
+}
+
+// FieldMatches only returns logs with a field name that matches pattern
+func FieldMatches(name string, pattern *regexp.Regexp) QueryOption {
+	return func(o *QueryOptions) {
+		o.Fields = append(o.Fields, FieldFilter{Name: name, Pattern: pattern})
+	}
+}
+
+// WithDescending returns the most recent logs first
+func WithDescending() QueryOption {
+	return func(o *QueryOptions) {
+		o.Descending = true
+	}
+}
+
+// WithCollapsedRepeats turns a run of logs of a key with the same severity and message into the first of
+// them with Repeated set to how many followed it, like syslog's "last message repeated N times". Only
+// logs matching the query are compared so a spammy retry loop collapses even with other logs in between.
+// Limits count the collapsed logs
+func WithCollapsedRepeats() QueryOption {
+	return func(o *QueryOptions) {
+		o.CollapseRepeats = true
+	}
+}
+
+// WithSampleRate keeps 1 in every rate matching logs of levels, or of every level if none are given,
+// so huge time ranges can be explored without returning every log. Which logs are kept is decided by
+// a hash of the log, so the same query always returns the same sample and pages line up
+func WithSampleRate(rate int, levels ...LogLevel) QueryOption {
+	return func(o *QueryOptions) {
+		if len(levels) == 0 {
+			levels = []LogLevel{Undefined, Debug, Info, Warn, Error, Fatal}
+		}
+		// Copy so options don't change a map the caller still holds
+		rates := map[LogLevel]int{}
+		for level, rate := range o.SampleRates {
+			rates[level] = rate
+		}
+		for _, level := range levels {
+			rates[level] = rate
+		}
+		o.SampleRates = rates
+	}
+}
+
+// sampled returns true if log is in the sample of its level
+func sampled(rates map[LogLevel]int, log *Log) bool {
+	rate := rates[log.Severity]
+	if rate <= 1 {
+		return true
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(log.Key))
+	binary.Write(hash, binary.LittleEndian, log.Time.UnixNano())
+	hash.Write([]byte(log.Log))
+	return hash.Sum64()%uint64(rate) == 0
+}
+
+// Match returns true if log passes the filters of the options on its own: keys, time range, levels,
+// message, fields and sampling. Limits, cursors and context need the logs around it and are ignored
+func (o QueryOptions) Match(log Log) bool {
+	if (o.Keys != nil && !matchAnyKey(o.Keys, log.Key)) || matchAnyKey(o.ExcludeKeys, log.Key) {
+		return false
+	}
+	f := newLogFilter(o)
+	return !f.pastEnd(&log) && f.matches(&log)
+}
+
+// queryOptions applies opts and fills in the defaults
+func (l *LogQuery) queryOptions(opts []QueryOption) QueryOptions {
+	o := QueryOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Keys == nil || o.ExcludeKeys != nil || hasKeyPattern(o.Keys) {
+		o.Keys = SelectKeys(l.Keys(), o.Keys, o.ExcludeKeys)
+	}
+	if len(o.Labels) > 0 {
+		o.Keys = l.labeledKeys(o.Keys, o.Labels)
+	}
+	if o.TotalLimit <= 0 {
+		o.TotalLimit = math.MaxInt32
+	}
+	if o.PerKeyLimit <= 0 || o.PerKeyLimit > o.TotalLimit {
+		o.PerKeyLimit = o.TotalLimit
+	}
+	return o
+}
+
+// clone returns a copy of the filter so options don't change a filter the caller still holds
+func (m *MessageFilter) clone() *MessageFilter {
+	if m == nil {
+		return &MessageFilter{}
+	}
+	rv := *m
+	return &rv
+}
+
+// FieldFilter matches a single field of a log. Logs without the field never match
+type FieldFilter struct {
+	Name string
+	// Value has to equal the field unless Pattern is set
+	Value   string
+	Pattern *regexp.Regexp
+}
+
+// Match returns true if the field in fields passes the filter
+func (f FieldFilter) Match(fields map[string]string) bool {
+	value, ok := fields[f.Name]
+	if !ok {
+		return false
+	}
+	if f.Pattern != nil {
+		return f.Pattern.MatchString(value)
+	}
+	return value == f.Value
+}
+
+// matchFields returns true if fields passes every filter
+func matchFields(filters []FieldFilter, fields map[string]string) bool {
+	for _, filter := range filters {
+		if !filter.Match(fields) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package logquery
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryOptionsMatch(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2020, 2, 28, 5, 20, 57, 0, time.UTC)
+	log := Log{Time: now, Severity: Error, Log: "connection timeout", Key: "web-1", Fields: map[string]string{"user": "alice"}}
+
+	assert.True(QueryOptions{}.Match(log))
+	assert.True(QueryOptions{Keys: []string{"db", "web-*"}, MinSeverity: Warn, MaxSeverity: Error}.Match(log))
+	assert.False(QueryOptions{Keys: []string{"db"}}.Match(log))
+	assert.False(QueryOptions{ExcludeKeys: []string{"web-*"}}.Match(log))
+	assert.False(QueryOptions{MinSeverity: Fatal}.Match(log))
+	assert.False(QueryOptions{MaxSeverity: Warn}.Match(log))
+	assert.True(QueryOptions{Start: now.Add(-time.Second), End: now.Add(time.Second)}.Match(log))
+	assert.False(QueryOptions{End: now}.Match(log))
+	assert.True(QueryOptions{Message: &MessageFilter{Pattern: regexp.MustCompile("time.ut")}}.Match(log))
+	assert.False(QueryOptions{Message: &MessageFilter{Substring: "refused"}}.Match(log))
+	assert.False(QueryOptions{Fields: []FieldFilter{{Name: "user", Value: "bob"}}}.Match(log))
+}
@@ -0,0 +1,126 @@
+package logquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxRatePoints is the most points Rate returns, so a tiny step over a long range can't build a huge result
+const MaxRatePoints = 10000
+
+// ErrTooManyPoints is returned by Rate when the range has more than MaxRatePoints steps
+var ErrTooManyPoints = errors.New("too many rate points")
+
+// RatePoint is the rate of logs in the window ending at Time
+type RatePoint struct {
+	Time      time.Time
+	Count     int
+	PerSecond float64
+}
+
+// Rate returns the logs per second of key at or above severity over a rolling window, with a point every
+// step, or every window if step is 0. Points are at multiples of step since the zero time and each
+// counts the logs in the window before it, so a 5m window with a 1m step is a 5 minute moving average
+// updated every minute. Points run from the start to the end of opts, or from the first to the last
+// matching log when they aren't set, and ErrTooManyPoints is returned if that is more than MaxRatePoints
+// steps. Filters in opts like WithSubstring and WithQueryLimits apply, limits on the number of logs and
+// ordering don't. A query that stops on its QueryLimits returns the points up to the last log it read
+// with ErrLimited
+func (l *LogQuery) Rate(ctx context.Context, key string, severity LogLevel, window, step time.Duration, opts ...QueryOption) ([]RatePoint, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("window must be positive")
+	}
+	if step < 0 {
+		return nil, fmt.Errorf("step can't be negative")
+	}
+	if step == 0 {
+		step = window
+	}
+	known := false
+	for _, k := range l.Keys() {
+		known = known || k == key
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown key %q", key)
+	}
+	o := QueryOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.Keys = []string{key}
+	if severity > o.MinSeverity {
+		o.MinSeverity = severity
+	}
+	o.TotalLimit, o.PerKeyLimit, o.Descending, o.Cursor, o.CollapseRepeats, o.Before, o.After = 0, 0, false, "", false, 0, 0
+
+	// A range that is set can be checked before reading anything
+	if !o.Start.IsZero() && !o.End.IsZero() {
+		if err := checkRatePoints(o.Start, o.End, step); err != nil {
+			return nil, err
+		}
+	}
+
+	times := []time.Time{}
+	it := l.Iter(ctx, WithOptions(o))
+	defer it.Close()
+	for it.Next() {
+		times = append(times, it.Log().Time)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	limited := it.Limited()
+
+	first, last := o.Start, o.End
+	if limited {
+		// Points past the last log read would count logs that weren't looked at
+		if len(times) == 0 {
+			return []RatePoint{}, ErrLimited
+		}
+		last = time.Time{}
+	}
+	if first.IsZero() {
+		if len(times) == 0 {
+			return []RatePoint{}, nil
+		}
+		first = times[0]
+	}
+	if last.IsZero() {
+		if len(times) == 0 {
+			return []RatePoint{}, nil
+		}
+		// The window of the last point has to take in the last log
+		last = times[len(times)-1].Add(step)
+	}
+
+	if err := checkRatePoints(first, last, step); err != nil {
+		return nil, err
+	}
+
+	points := []RatePoint{}
+	// from and to index the logs in the window [t-window, t)
+	from, to := 0, 0
+	for t := first.Truncate(step).Add(step); !t.After(last); t = t.Add(step) {
+		for to < len(times) && times[to].Before(t) {
+			to++
+		}
+		for from < to && times[from].Before(t.Add(-window)) {
+			from++
+		}
+		points = append(points, RatePoint{Time: t, Count: to - from, PerSecond: float64(to-from) / window.Seconds()})
+	}
+	if limited {
+		return points, ErrLimited
+	}
+	return points, nil
+}
+
+// checkRatePoints returns ErrTooManyPoints if there are more than MaxRatePoints steps from first to last
+func checkRatePoints(first, last time.Time, step time.Duration) error {
+	if last.Sub(first.Truncate(step))/step > MaxRatePoints {
+		return fmt.Errorf("%w, the range has more than %d steps, use a larger step", ErrTooManyPoints, MaxRatePoints)
+	}
+	return nil
+}
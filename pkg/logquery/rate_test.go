@@ -0,0 +1,60 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRate(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:05.00][info] one\n"+
+		"[02/28/2020 5:20:10.00][error] two\n"+
+		"[02/28/2020 5:20:40.00][info] three\n"+
+		"[02/28/2020 5:21:10.00][error] four\n"+
+		"[02/28/2020 5:23:00.00][error] five\n"), 0644))
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path})
+	assert.NoError(err)
+	at := func(min, sec int) time.Time {
+		return time.Date(2020, 2, 28, 5, min, sec, 0, time.UTC)
+	}
+
+	points, err := testQuery.Rate(context.Background(), "app", Undefined, time.Minute, 0)
+	assert.NoError(err)
+	assert.Equal([]RatePoint{
+		{Time: at(21, 0), Count: 3, PerSecond: 0.05},
+		{Time: at(22, 0), Count: 1, PerSecond: 1.0 / 60},
+		{Time: at(23, 0), Count: 0, PerSecond: 0},
+		{Time: at(24, 0), Count: 1, PerSecond: 1.0 / 60},
+	}, points)
+
+	// A rolling 2 minute window of errors every 30s
+	points, err = testQuery.Rate(context.Background(), "app", Error, 2*time.Minute, 30*time.Second, WithStart(at(20, 0)), WithEnd(at(22, 0)))
+	assert.NoError(err)
+	counts := []int{}
+	for _, point := range points {
+		counts = append(counts, point.Count)
+	}
+	assert.Equal([]int{1, 1, 2, 2}, counts)
+	assert.Equal(at(20, 30), points[0].Time)
+	assert.Equal(2.0/120, points[3].PerSecond)
+
+	points, err = testQuery.Rate(context.Background(), "app", Fatal, time.Minute, 0)
+	assert.NoError(err)
+	assert.Empty(points)
+
+	_, err = testQuery.Rate(context.Background(), "nope", Info, time.Minute, 0)
+	assert.Error(err)
+	_, err = testQuery.Rate(context.Background(), "app", Info, 0, 0)
+	assert.Error(err)
+	// Points are capped between the first and last logs too, not only for a set range
+	_, err = testQuery.Rate(context.Background(), "app", Undefined, time.Millisecond, time.Microsecond)
+	assert.ErrorIs(err, ErrTooManyPoints)
+	_, err = testQuery.Rate(context.Background(), "app", Undefined, time.Millisecond, time.Microsecond, WithStart(at(20, 0)), WithEnd(at(22, 0)))
+	assert.ErrorIs(err, ErrTooManyPoints)
+}
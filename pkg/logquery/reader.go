@@ -0,0 +1,79 @@
+package logquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+const readerScheme = "reader"
+
+// WithReader reads the logs for key from r, like piped input. The path "-" in the log mapping does the
+// same with os.Stdin. The whole input is kept in memory the first time it is read so it can be queried
+// and refreshed like a file, but it can't be tailed
+func WithReader(key string, r io.Reader) Option {
+	return func(l *LogQuery) {
+		l.readerSource().readers[key] = r
+	}
+}
+
+// readerSource returns the source for WithReader keys, registering it the first time
+func (l *LogQuery) readerSource() *readerSource {
+	if source, ok := l.readConfig.sources[readerScheme].(*readerSource); ok {
+		return source
+	}
+	source := &readerSource{readers: map[string]io.Reader{}, data: map[string][]byte{}}
+	WithSource(readerScheme, source)(l)
+	return source
+}
+
+// readerSource serves the input of io.Readers under paths like reader://key
+type readerSource struct {
+	mutex   sync.Mutex
+	readers map[string]io.Reader
+	data    map[string][]byte
+}
+
+func (s *readerSource) Expand(ctx context.Context, path string) ([]string, bool, error) {
+	return []string{path}, false, nil
+}
+
+func (s *readerSource) Open(ctx context.Context, path string, from int64) (io.ReadCloser, int64, error) {
+	data, err := s.read(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from > int64(len(data)) {
+		from = int64(len(data))
+	}
+	return ioutil.NopCloser(bytes.NewReader(data[from:])), int64(len(data)), nil
+}
+
+func (s *readerSource) Size(ctx context.Context, path string) (int64, error) {
+	data, err := s.read(path)
+	return int64(len(data)), err
+}
+
+// read reads everything from the reader for path the first time it is called
+func (s *readerSource) read(path string) ([]byte, error) {
+	key := strings.TrimPrefix(path, readerScheme+"://")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if data, ok := s.data[key]; ok {
+		return data, nil
+	}
+	r, ok := s.readers[key]
+	if !ok {
+		return nil, fmt.Errorf("no reader for %s", key)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s.data[key] = data
+	return data, nil
+}
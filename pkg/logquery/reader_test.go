@@ -0,0 +1,34 @@
+package logquery
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithReader(t *testing.T) {
+	assert := assert.New(t)
+	piped := strings.NewReader("[02/28/2020 5:20:56.00][warn] piped\n[02/28/2020 5:20:58.00][info] input\n")
+
+	for _, opts := range [][]Option{nil, {WithLazyLoading(false)}} {
+		piped.Seek(0, 0)
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"}, append(opts, WithReader("api", piped))...)
+		assert.NoError(err)
+		assert.Equal([]string{"api", "server1"}, testQuery.Keys())
+
+		// Readers can be read more than once
+		for i := 0; i < 2; i++ {
+			logs, err := testQuery.QueryLogs(context.Background(), WithKeys("api"))
+			assert.NoError(err)
+			assert.Equal("[02/28/2020 5:20:56.00][warn][api] piped\n[02/28/2020 5:20:58.00][info][api] input", logs.String())
+		}
+		logs, _ := testQuery.QueryLogs(context.Background())
+		assert.Equal(6, len(logs))
+		assert.NoError(testQuery.Refresh(context.Background()))
+	}
+
+	_, err := NewLogQuery(context.Background(), map[string]string{"api": "../../logs/server1.log"}, WithReader("api", piped))
+	assert.Error(err)
+}
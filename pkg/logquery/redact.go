@@ -0,0 +1,115 @@
+package logquery
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redactor replaces sensitive data in logs, like email addresses, before they are printed, exported or
+// served
+type Redactor struct {
+	// Name identifies the redactor, files cached with different redactors are parsed again
+	Name    string
+	Pattern *regexp.Regexp
+	// Replacement is what every match is replaced with
+	Replacement string
+	// Valid checks a match before it is replaced, nil replaces every match. It lets patterns stay simple
+	// where a check in code is more precise, like the checksum of a card number
+	Valid func(match string) bool
+}
+
+var (
+	// RedactEmails replaces email addresses
+	RedactEmails = Redactor{
+		Name:        "email",
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[email]",
+	}
+	// RedactIPs replaces IPv4 addresses and full IPv6 addresses
+	RedactIPs = Redactor{
+		Name:        "ip",
+		Pattern:     regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b|\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b`),
+		Replacement: "[ip]",
+	}
+	// RedactCreditCards replaces card numbers of 13 to 19 digits that may be split by spaces or dashes and
+	// pass the Luhn check
+	RedactCreditCards = Redactor{
+		Name:        "credit-card",
+		Pattern:     regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Replacement: "[credit card]",
+		Valid:       luhn,
+	}
+)
+
+// BuiltinRedactors are the redactors that come with the package by name
+var BuiltinRedactors = map[string]Redactor{
+	RedactEmails.Name:      RedactEmails,
+	RedactIPs.Name:         RedactIPs,
+	RedactCreditCards.Name: RedactCreditCards,
+}
+
+// WithRedactors runs the redactors over the message and fields of every log as it is parsed, so nothing
+// read from the files, including lines that fail to parse, is kept unredacted. Filters like WithSubstring
+// see the redacted message
+func WithRedactors(redactors ...Redactor) Option {
+	return func(l *LogQuery) {
+		l.readConfig.redactors = append(l.readConfig.redactors, redactors...)
+	}
+}
+
+// Redact returns s with every match of the redactors replaced
+func Redact(s string, redactors []Redactor) string {
+	for _, r := range redactors {
+		if r.Valid == nil {
+			s = r.Pattern.ReplaceAllLiteralString(s, r.Replacement)
+			continue
+		}
+		s = r.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if r.Valid(match) {
+				return r.Replacement
+			}
+			return match
+		})
+	}
+	return s
+}
+
+// redact replaces sensitive data in the message and fields of log
+func redact(log *Log, redactors []Redactor) {
+	if len(redactors) == 0 {
+		return
+	}
+	log.Log = Redact(log.Log, redactors)
+	for name, value := range log.Fields {
+		log.Fields[name] = Redact(value, redactors)
+	}
+}
+
+// redactorNames identifies a list of redactors for the cache
+func redactorNames(redactors []Redactor) string {
+	names := make([]string, len(redactors))
+	for i, r := range redactors {
+		names[i] = r.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// luhn returns true if the digits in s pass the Luhn checksum card numbers use
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
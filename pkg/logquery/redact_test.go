@@ -0,0 +1,56 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	assert := assert.New(t)
+	builtin := []Redactor{RedactEmails, RedactIPs, RedactCreditCards}
+	assert.Equal("login by [email] from [ip]", Redact("login by alice.smith+test@example.co.uk from 10.20.0.255", builtin))
+	assert.Equal("charged [credit card] and [credit card]", Redact("charged 4111 1111 1111 1111 and 5500-0000-0000-0004", builtin))
+	// Numbers that fail the checksum aren't card numbers
+	assert.Equal("order 4111111111111112 and version 1.2.3", Redact("order 4111111111111112 and version 1.2.3", builtin))
+	assert.Equal("fe80 [ip]", Redact("fe80 2001:0db8:85a3:0000:0000:8a2e:0370:7334", builtin))
+}
+
+func TestWithRedactors(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.log")
+	assert.NoError(os.WriteFile(path, []byte(`[02/28/2020 5:20:55.17][info] Signup from bob@example.com token=abc123
+not a log line from carol@example.com
+`), 0644))
+	tokens := Redactor{Name: "token", Pattern: regexp.MustCompile(`token=\w+`), Replacement: "token=[redacted]"}
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"users": path},
+		WithRedactors(RedactEmails, tokens), WithLenientParsing(), WithCache(filepath.Join(dir, "cache")))
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Equal(2, len(logs))
+	assert.Equal("Signup from [email] token=[redacted]", logs[0].Log)
+	assert.Equal("not a log line from [email]", logs[1].Log)
+	assert.Equal("not a log line from [email]", testQuery.ParseReport()["users"].Samples[0].Line)
+
+	// A cache written without the redactors isn't used with them
+	testQuery, err = NewLogQuery(context.Background(), map[string]string{"users": path}, WithCache(filepath.Join(dir, "cache")))
+	assert.NoError(err)
+	logs, _ = testQuery.QueryLogs(context.Background())
+	assert.Equal("Signup from bob@example.com token=abc123", logs[0].Log)
+
+	parser := &JSONParser{}
+	testQuery, err = NewLogQuery(context.Background(), nil,
+		WithReader("json", strings.NewReader(`{"ts":"2020-02-28T05:20:55Z","level":"info","msg":"hi","client":"192.168.1.1"}`)),
+		WithParser("json", parser), WithRedactors(RedactIPs))
+	assert.NoError(err)
+	logs, _ = testQuery.QueryLogs(context.Background())
+	assert.Equal("[ip]", logs[0].Fields["client"])
+}
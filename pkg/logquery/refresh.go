@@ -0,0 +1,254 @@
+package logquery
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+)
+
+// stampHead is how many bytes at the start of a file are hashed to notice it was rewritten
+const stampHead = 1024
+
+// fileOffset remembers how much of a file has been loaded
+type fileOffset struct {
+	// offset is how many bytes of the decompressed file were read
+	offset int64
+	// size is the on disk size of the file when it was read
+	size       int64
+	compressed bool
+	// encoding is what the file was transcoded to UTF-8 from, offset counts the UTF-8 bytes then
+	encoding encoding
+	// lines is how many lines there are before offset, the next line read is lines+1
+	lines int
+	// skipped is how many lines before offset couldn't be parsed
+	skipped int
+	// last is the last log before offset, raw lines at the start of the next read go at its time
+	last *Log
+	// report has the lines before offset that failed to parse
+	report ParseReport
+	// stamp identifies local files that were read, nil for other files
+	stamp *fileStamp
+	// partial is how many bytes of a last line without a newline were read past offset. A writer may be
+	// in the middle of it, so its log is replaced by reading the line again on the next refresh
+	partial int64
+}
+
+// read returns how many bytes of the decompressed file were read, an unfinished last line included
+func (o fileOffset) read() int64 {
+	return o.offset + o.partial
+}
+
+// holdPartial moves a resumable offset back to the start of an unfinished last line the scan read, so
+// the line is read again once it is finished
+func (o fileOffset) holdPartial(ends *lineEndReader) fileOffset {
+	o.partial = 0
+	if o.resumable() && ends.eof && ends.end < o.offset {
+		o.partial = o.offset - ends.end
+		o.offset = ends.end
+		o.lines--
+	}
+	return o
+}
+
+// finish adds what lines parsed since from to the offset of a scan, holding back an unfinished last line
+// along with its skip or parse failure since it is counted when it is read again
+func (o fileOffset) finish(from fileOffset, lines *lineParser, ends *lineEndReader) fileOffset {
+	o = o.holdPartial(ends)
+	if o.partial > 0 {
+		lines.undoLast()
+	}
+	o.skipped, o.last = from.skipped+lines.skipped, lines.prev
+	o.report = from.report.merge(lines.report)
+	return o
+}
+
+// resumable returns true if lines appended to the file can be read starting at offset, compressed and
+// transcoded files have to be read again from the start
+func (o fileOffset) resumable() bool {
+	return !o.compressed && o.encoding == encodingUTF8
+}
+
+// fileStamp identifies the file that was read at a path, so a file that was replaced, or truncated and
+// written past where it was read like copytruncate rotation does, is noticed even though it didn't shrink
+type fileStamp struct {
+	info os.FileInfo
+	// head is a hash of the first headSize bytes of the file
+	head     uint64
+	headSize int64
+}
+
+// stampFile returns the stamp of the first offset bytes of the file at path, or nil if it can't be read
+func stampFile(path string, offset int64) *fileStamp {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	if offset > stampHead {
+		offset = stampHead
+	}
+	head, err := hashHead(file, offset)
+	if err != nil {
+		return nil
+	}
+	return &fileStamp{info: info, head: head, headSize: offset}
+}
+
+// hashHead hashes the first n bytes of r
+func hashHead(r io.Reader, n int64) (uint64, error) {
+	hash := fnv.New64a()
+	if _, err := io.CopyN(hash, r, n); err != nil {
+		return 0, err
+	}
+	return hash.Sum64(), nil
+}
+
+// replaced returns true if path is no longer the file that was stamped: another file was moved in its
+// place or the start of the file was rewritten. A nil stamp is never replaced
+func (s *fileStamp) replaced(path string) bool {
+	if s == nil {
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		// Reading the file will report the error
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	if !os.SameFile(s.info, info) {
+		return true
+	}
+	if info.Size() == s.info.Size() && info.ModTime().Equal(s.info.ModTime()) {
+		return false
+	}
+	head, err := hashHead(file, s.headSize)
+	return err != nil || head != s.head
+}
+
+// Refresh picks up lines appended to the loaded files since they were last read, only parsing the new
+// data. Files that shrank were truncated or replaced, compressed files can't be appended to and
+// transcoded ones can't be read from the middle, so if any of them changes the whole key is reloaded.
+// Local files are also reloaded when another file took their place or their first bytes changed, like
+// after copytruncate rotation, so no stale or duplicated logs are kept. Keys that failed are reported in
+// a *LoadError and keep their old logs. A Refresh called while another one runs waits for it, and
+// queries see the old logs of a key until it is done
+func (l *LogQuery) Refresh(ctx context.Context) error {
+	l.refreshing.Lock()
+	defer l.refreshing.Unlock()
+	wg := sync.WaitGroup{}
+	errs := map[string]error{}
+	mutex := sync.Mutex{}
+
+	for _, logKey := range l.Keys() {
+		if _, loaded := l.loadedLogs(logKey); !loaded {
+			// Lazy keys that haven't been queried yet are read fresh when they are
+			continue
+		}
+		wg.Add(1)
+		go func(logKey string) {
+			defer wg.Done()
+			if err := l.refreshKey(ctx, logKey); err != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				errs[logKey] = err
+			}
+		}(logKey)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &LoadError{Errors: errs}
+	}
+	return nil
+}
+
+// refreshKey appends the new logs of every file of a key
+func (l *LogQuery) refreshKey(ctx context.Context, logKey string) error {
+	// The logs and offsets are read together so the new lines start right after the logs they are
+	// added to
+	l.mutex.RLock()
+	logs := l.processedLogs[logKey]
+	paths := l.paths[logKey]
+	parser := parserFor(l.parsers, logKey)
+	offsets := make(map[string]fileOffset, len(paths))
+	for _, path := range paths {
+		if offset, ok := l.offsets[path]; ok {
+			offsets[path] = offset
+		}
+	}
+	l.mutex.RUnlock()
+
+	newLogs := []*Log{}
+	newOffsets := map[string]fileOffset{}
+	for _, path := range paths {
+		offset, ok := offsets[path]
+
+		size, err := l.readConfig.source(path).Size(ctx, path)
+		if err != nil {
+			return err
+		}
+		if !ok || (!offset.resumable() && size != offset.size) || (offset.resumable() && size < offset.offset) || offset.stamp.replaced(path) {
+			return l.reloadKey(ctx, logKey)
+		}
+		if !offset.resumable() || size == offset.read() {
+			continue
+		}
+
+		pathLogs, newOffset, err := processFile(ctx, path, offset, logKey, parser, l.readConfig)
+		if err != nil {
+			return err
+		}
+		if offset.partial > 0 {
+			// The unfinished line was read again, drop what it was last time
+			logs = withoutLogsFrom(logs, path, offset.offset)
+		}
+		newLogs = append(newLogs, pathLogs...)
+		newOffsets[path] = newOffset
+	}
+	if len(newLogs) == 0 && len(newOffsets) == 0 {
+		return nil
+	}
+
+	// Copy instead of appending in place so queries holding the old slice aren't affected
+	rv := make([]*Log, 0, len(logs)+len(newLogs))
+	rv = append(rv, logs...)
+	rv = append(rv, newLogs...)
+	sortByTime(rv)
+	l.storeLogs(logKey, paths, l.readConfig.retention.retain(rv), newOffsets)
+	return nil
+}
+
+// reloadKey parses every file of a key from scratch
+func (l *LogQuery) reloadKey(ctx context.Context, logKey string) error {
+	paths, parser, _ := l.keySource(logKey)
+	logs, offsets, err := processKey(ctx, paths, logKey, parser, l.readConfig)
+	if err != nil {
+		return err
+	}
+	l.storeLogs(logKey, paths, logs, offsets)
+	return nil
+}
+
+// withoutLogsFrom returns logs without the ones read from path at or after offset
+func withoutLogsFrom(logs []*Log, path string, offset int64) []*Log {
+	rv := make([]*Log, 0, len(logs))
+	for _, log := range logs {
+		if log.Path != path || log.Offset < offset {
+			rv = append(rv, log)
+		}
+	}
+	return rv
+}
@@ -0,0 +1,159 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefresh(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] first\n"), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path})
+	assert.NoError(err)
+	query := func() Logs {
+		logs, err := testQuery.QueryLogs(context.Background(), WithKeys("app"))
+		assert.NoError(err)
+		return logs
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(err)
+	_, err = file.WriteString("[02/28/2020 5:20:56.00][warn] second\n[02/28/2020 5:20:57.00][error] third\n")
+	assert.NoError(err)
+	file.Close()
+
+	assert.Equal(1, len(query()))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs := query()
+	assert.Equal(3, len(logs))
+	assert.Equal("third", logs[2].Log)
+	// Numbering carries on from where the last read stopped
+	assert.Equal(path, logs[2].Path)
+	assert.Equal(3, logs[2].LineNumber)
+	assert.Equal(int64(len("[02/28/2020 5:20:55.17][info] first\n[02/28/2020 5:20:56.00][warn] second\n")), logs[2].Offset)
+
+	// Nothing new means nothing changes
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal(3, len(query()))
+
+	// A truncated file is read again from the start
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:21:00.00][info] rotated\n"), 0644))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs = query()
+	assert.Equal(1, len(logs))
+	assert.Equal("rotated", logs[0].Log)
+}
+
+func TestRefreshPartialLine(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] first\n"), 0644))
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path}, WithLenientParsing())
+	assert.NoError(err)
+	messages := func() []string {
+		logs, err := testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		rv := []string{}
+		for _, log := range logs {
+			rv = append(rv, log.Log)
+		}
+		return rv
+	}
+
+	// A refresh lands while the writer is in the middle of a line
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(err)
+	defer file.Close()
+	_, err = file.WriteString("[02/28/2020 5:20:56.00][warn] disk al")
+	assert.NoError(err)
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"first", "disk al"}, messages())
+
+	// The finished line replaces what was read of it
+	_, err = file.WriteString("most full\n[02/28/2020 5:20:57.00][info] third\n")
+	assert.NoError(err)
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"first", "disk almost full", "third"}, messages())
+	logs, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	assert.Equal(2, logs[1].LineNumber)
+	assert.Equal(3, logs[2].LineNumber)
+	assert.Empty(testQuery.SkippedLines()["app"])
+}
+
+func TestRefreshPartialLineReport(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithChunkedParsing(16, 2)}} {
+		assert := assert.New(t)
+		path := filepath.Join(t.TempDir(), "app.log")
+		assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] first\nnot a log\n"), 0644))
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path}, opts...)
+		assert.NoError(err)
+
+		// The refresh cuts the timestamp short so the line fails to parse until it is finished
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		assert.NoError(err)
+		_, err = file.WriteString("[02/28/2020 5:2")
+		assert.NoError(err)
+		assert.NoError(testQuery.Refresh(context.Background()))
+		_, err = file.WriteString("0:56.00][warn] disk full\n")
+		assert.NoError(err)
+		file.Close()
+		assert.NoError(testQuery.Refresh(context.Background()))
+
+		logs, err := testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		assert.Equal(2, len(logs))
+		report := testQuery.ParseReport()["app"]
+		assert.Equal(1, report.Failed)
+		assert.Equal(1, len(report.Samples))
+		assert.Equal("not a log", report.Samples[0].Line)
+		assert.Equal(1, testQuery.SkippedLines()["app"])
+	}
+}
+
+func TestRefreshRotated(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.00][info] first\n"), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path})
+	assert.NoError(err)
+	query := func() []string {
+		logs, err := testQuery.QueryLogs(context.Background(), WithKeys("app"))
+		assert.NoError(err)
+		messages := []string{}
+		for _, log := range logs {
+			messages = append(messages, log.Log)
+		}
+		return messages
+	}
+
+	// copytruncate copies the file away and truncates it, by the next refresh it can be longer than before
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:21:00.00][info] after rotation\n[02/28/2020 5:21:01.00][info] more\n"), 0644))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"after rotation", "more"}, query())
+
+	// A new file moved into place is read from the start even if it starts the same way
+	replacement := filepath.Join(dir, "app.log.new")
+	assert.NoError(os.WriteFile(replacement, []byte("[02/28/2020 5:21:00.00][info] after rotation\n[02/28/2020 5:21:05.00][info] other\n[02/28/2020 5:21:06.00][info] file\n"), 0644))
+	assert.NoError(os.Rename(replacement, path))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"after rotation", "other", "file"}, query())
+
+	// Appends are still only read once
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(err)
+	_, err = file.WriteString("[02/28/2020 5:21:07.00][info] appended\n")
+	assert.NoError(err)
+	file.Close()
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"after rotation", "other", "file", "appended"}, query())
+}
@@ -0,0 +1,104 @@
+package logquery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LevelRule changes the level of the logs it matches as they are parsed, like downgrading a noisy
+// "deprecated" error to a warning without touching the service that logs it
+type LevelRule struct {
+	// Key limits the rule to the logs of one key, empty matches every key
+	Key string
+	// Pattern is matched against the message, nil matches every message
+	Pattern *regexp.Regexp
+	// From limits the rule to logs at this level, Undefined matches every level
+	From LogLevel
+	// To is the level matched logs get
+	To LogLevel
+}
+
+// WithLevelRules reclassifies logs as they are parsed, the first rule that matches a log sets its level.
+// Lines that couldn't be parsed, which have no level, are left alone. Filters like WithMinSeverity and
+// everything after them see the new level
+func WithLevelRules(rules ...LevelRule) Option {
+	return func(l *LogQuery) {
+		l.readConfig.levelRules = append(l.readConfig.levelRules, rules...)
+	}
+}
+
+// ParseLevelRule parses a rule written as from:to=pattern, like error:warn=deprecated, or to=pattern to
+// match logs at any level
+func ParseLevelRule(s string) (LevelRule, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return LevelRule{}, fmt.Errorf("expected from:to=pattern or to=pattern, got %q", s)
+	}
+	rule := LevelRule{}
+	levels, pattern := s[:i], s[i+1:]
+	if j := strings.Index(levels, ":"); j != -1 {
+		from, err := ParseLevel(levels[:j])
+		if err != nil {
+			return LevelRule{}, err
+		}
+		rule.From, levels = from, levels[j+1:]
+	}
+	to, err := ParseLevel(levels)
+	if err != nil {
+		return LevelRule{}, err
+	}
+	rule.To = to
+	if pattern != "" {
+		if rule.Pattern, err = regexp.Compile(pattern); err != nil {
+			return LevelRule{}, err
+		}
+	}
+	return rule, nil
+}
+
+// matches returns true if the rule applies to log
+func (r LevelRule) matches(log *Log) bool {
+	return (r.Key == "" || r.Key == log.Key) &&
+		(r.From == Undefined || r.From == log.Severity) &&
+		(r.Pattern == nil || r.Pattern.MatchString(log.Log))
+}
+
+// String identifies the rule, in the format ParseLevelRule reads with the key in front when it has one
+func (r LevelRule) String() string {
+	rv := ""
+	if r.Key != "" {
+		rv = r.Key + "/"
+	}
+	if r.From != Undefined {
+		rv += strings.ToLower(r.From.String()) + ":"
+	}
+	rv += strings.ToLower(r.To.String()) + "="
+	if r.Pattern != nil {
+		rv += r.Pattern.String()
+	}
+	return rv
+}
+
+// relevel gives log the level of the first rule that matches it
+func relevel(log *Log, rules []LevelRule) {
+	if log.Severity == Undefined {
+		return
+	}
+	for _, rule := range rules {
+		if rule.matches(log) {
+			log.Severity = rule.To
+			log.SeverityString = "[" + strings.ToLower(rule.To.String()) + "]"
+			return
+		}
+	}
+}
+
+// levelRuleNames identifies a list of rules for the cache
+func levelRuleNames(rules []LevelRule) string {
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.String()
+	}
+	return strings.Join(names, "\n")
+}
@@ -0,0 +1,62 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevelRule(t *testing.T) {
+	assert := assert.New(t)
+	rule, err := ParseLevelRule("error:warn=deprecated (api|flag)")
+	assert.NoError(err)
+	assert.Equal(LevelRule{Pattern: regexp.MustCompile("deprecated (api|flag)"), From: Error, To: Warn}, rule)
+	assert.Equal("error:warn=deprecated (api|flag)", rule.String())
+	rule, err = ParseLevelRule("debug=")
+	assert.NoError(err)
+	assert.Equal(LevelRule{To: Debug}, rule)
+	for _, bad := range []string{"deprecated", "=x", "warn", "loud=x", "severe:warn=x", "warn=("} {
+		_, err := ParseLevelRule(bad)
+		assert.Error(err, bad)
+	}
+}
+
+func TestLevelRules(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "api.log")
+	assert.NoError(os.WriteFile(path, []byte(`[02/28/2020 5:20:55.17][error] deprecated endpoint /v1 called
+[02/28/2020 5:20:56.17][error] database unreachable
+[02/28/2020 5:20:57.17][info] deprecated flag --old set
+  at main.go:12
+[02/28/2020 5:20:58.17][warn] cache miss
+`), 0644))
+	rules := []LevelRule{
+		{Key: "other", Pattern: regexp.MustCompile("unreachable"), To: Debug},
+		{Pattern: regexp.MustCompile("deprecated"), From: Error, To: Warn},
+		{Pattern: regexp.MustCompile("deprecated"), To: Debug},
+		{Pattern: regexp.MustCompile("cache"), To: Error},
+		// Lines without a level are never matched
+		{Pattern: regexp.MustCompile("main.go"), To: Fatal},
+	}
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"api": path}, WithLevelRules(rules...), WithLenientParsing())
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+	levels := []LogLevel{}
+	for _, log := range logs {
+		levels = append(levels, log.Severity)
+	}
+	assert.Equal([]LogLevel{Warn, Error, Debug, Undefined, Error}, levels)
+	assert.Equal("[02/28/2020 5:20:55.17][warn][api] deprecated endpoint /v1 called", logs[0].String())
+
+	// Filters see the new levels
+	logs, err = testQuery.QueryLogs(context.Background(), WithMinSeverity(Error))
+	assert.NoError(err)
+	assert.Equal(2, len(logs))
+	assert.Equal("database unreachable", logs[0].Log)
+	assert.Equal("cache miss", logs[1].Log)
+}
@@ -0,0 +1,75 @@
+package logquery
+
+const maxParseSamples = 5
+
+// ParseReport describes the lines of a key that its parser couldn't parse, so a change in a file's format
+// shows up as failures instead of quietly returning fewer logs
+type ParseReport struct {
+	// Failed is how many lines couldn't be parsed, including lines kept by WithLenientParsing
+	Failed int
+	// Reasons counts the failures by parse error, like "timestamp was not parseable"
+	Reasons map[string]int
+	// Samples are the first few lines that failed
+	Samples []ParseFailure
+	// OutOfOrder is how many logs were earlier than the log before them in their file. Kept keys are
+	// sorted so they are still queried in order
+	OutOfOrder int
+}
+
+// ParseFailure is a line that couldn't be parsed
+type ParseFailure struct {
+	Path string
+	Line string
+	Err  error
+}
+
+// ParseReport returns a report for every key with the lines that failed to parse. Lazily loaded keys are
+// only reported once they are kept in memory
+func (l *LogQuery) ParseReport() map[string]ParseReport {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	rv := map[string]ParseReport{}
+	for key, paths := range l.paths {
+		report := ParseReport{}
+		for _, path := range paths {
+			if offset, ok := l.offsets[path]; ok {
+				report = report.merge(offset.report)
+			}
+		}
+		rv[key] = report
+	}
+	return rv
+}
+
+// add records a line that failed
+func (r *ParseReport) add(path string, line string, err error) {
+	if r.Reasons == nil {
+		r.Reasons = map[string]int{}
+	}
+	r.Failed++
+	r.Reasons[err.Error()]++
+	if len(r.Samples) < maxParseSamples {
+		r.Samples = append(r.Samples, ParseFailure{Path: path, Line: line, Err: err})
+	}
+}
+
+// merge returns a new report with the failures of both, r's samples come first
+func (r ParseReport) merge(other ParseReport) ParseReport {
+	rv := ParseReport{Failed: r.Failed + other.Failed, OutOfOrder: r.OutOfOrder + other.OutOfOrder}
+	for _, reasons := range []map[string]int{r.Reasons, other.Reasons} {
+		for reason, count := range reasons {
+			if rv.Reasons == nil {
+				rv.Reasons = map[string]int{}
+			}
+			rv.Reasons[reason] += count
+		}
+	}
+	for _, samples := range [][]ParseFailure{r.Samples, other.Samples} {
+		for _, sample := range samples {
+			if len(rv.Samples) < maxParseSamples {
+				rv.Samples = append(rv.Samples, sample)
+			}
+		}
+	}
+	return rv
+}
@@ -0,0 +1,39 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReport(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	content := "[02/28/2020 5:20:55.17][info] first\n" +
+		"[2020-02-28 5:20:56][info] new time format\n" +
+		"[02/28/2020 5:20:57.00][notice] unknown level\n" +
+		"no brackets at all\n"
+	for i := 0; i < 6; i++ {
+		content += fmt.Sprintf("[02/28/2020 5:21:0%d.00][trace] trace %d\n", i, i)
+	}
+	assert.NoError(os.WriteFile(path, []byte(content), 0644))
+
+	for _, opts := range [][]Option{nil, {WithChunkedParsing(32, 2)}} {
+		testQuery, _ := NewLogQuery(context.Background(), map[string]string{"app": path}, opts...)
+		report := testQuery.ParseReport()["app"]
+		assert.Equal(9, report.Failed)
+		assert.Equal(map[string]int{
+			"timestamp was not parseable":        1,
+			"severity was not parseable":         7,
+			"log does not have proper structure": 1,
+		}, report.Reasons)
+		assert.Equal(maxParseSamples, len(report.Samples))
+		assert.Equal("[2020-02-28 5:20:56][info] new time format", report.Samples[0].Line)
+		assert.Equal(path, report.Samples[0].Path)
+		assert.EqualError(report.Samples[2].Err, "log does not have proper structure")
+	}
+}
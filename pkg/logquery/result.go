@@ -0,0 +1,67 @@
+package logquery
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// QueryResult is the logs of a query along with how they were found, so callers can tell users how much
+// of the data they are seeing
+type QueryResult struct {
+	Logs Logs
+	// Cursor fetches the next page when passed to WithCursor, it is empty once there are no more logs
+	Cursor string
+	// Matched is how many logs matched before the limits were applied. A query continuing from a cursor
+	// only counts the logs from the cursor on
+	Matched int
+	// KeyCounts is how many logs of each key matched before the limits were applied
+	KeyCounts map[string]int
+	// Truncated is true if the limits left out logs that matched
+	Truncated bool
+	// Limited is true if the query stopped on one of its QueryLimits, Matched and KeyCounts only count
+	// the logs found before it did
+	Limited bool
+	// Duration is how long the query took
+	Duration time.Duration
+	// BytesRead is how many bytes of files the query read. Logs that are already in memory aren't read
+	// again, so it is 0 unless lazily loaded files were read
+	BytesRead int64
+	// Groups are the matches grouped by WithGroupBy, the largest group first
+	Groups []Group
+}
+
+// QueryResult is the same as QueryPage but also counts every matching log, which means reading past the
+// limits to the end of the query
+func (l *LogQuery) QueryResult(ctx context.Context, opts ...QueryOption) (*QueryResult, error) {
+	started := time.Now()
+	o := l.queryOptions(opts)
+	if err := checkGroupBy(o.GroupBy); err != nil {
+		return nil, err
+	}
+	prev, err := decodeCursor(o.Cursor, o.Descending)
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{KeyCounts: map[string]int{}}
+	logs, limited, err := l.query(ctx, o, prev, result)
+	var loadErr *LoadError
+	if err != nil && !errors.As(err, &loadErr) {
+		return nil, err
+	}
+
+	result.Logs = logs
+	result.Limited = limited
+	returned := 0
+	for _, log := range logs {
+		if !log.Context {
+			returned += 1 + log.Repeated
+		}
+	}
+	result.Truncated = result.Matched > returned
+	if (result.Truncated || limited) && len(logs) > 0 {
+		result.Cursor = nextCursor(prev, logs, o.Descending).encode()
+	}
+	result.Duration = time.Since(started)
+	return result, err
+}
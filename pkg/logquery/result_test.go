@@ -0,0 +1,64 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryResult(t *testing.T) {
+	assert := assert.New(t)
+	mapping := map[string]string{"server1": "../../logs/server1.log", "db_server": "../../logs/db_server.log"}
+	testQuery, err := NewLogQuery(context.Background(), mapping)
+	assert.NoError(err)
+	all, err := testQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+
+	result, err := testQuery.QueryResult(context.Background(), WithLimit(3))
+	assert.NoError(err)
+	assert.Len(result.Logs, 3)
+	assert.Equal(len(all), result.Matched)
+	assert.Equal(4, result.KeyCounts["db_server"])
+	assert.Equal(len(all)-4, result.KeyCounts["server1"])
+	assert.True(result.Truncated)
+	assert.NotEmpty(result.Cursor)
+	assert.Equal(int64(0), result.BytesRead)
+
+	result, err = testQuery.QueryResult(context.Background(), WithMinSeverity(Warn), WithKeys("db_server"))
+	assert.NoError(err)
+	assert.Equal(2, result.Matched)
+	assert.False(result.Truncated)
+	assert.Empty(result.Cursor)
+
+	// Every page counts what is left
+	for _, descending := range []bool{false, true} {
+		seen, cursor := 0, ""
+		for {
+			opts := []QueryOption{WithLimit(3), WithCursor(cursor)}
+			if descending {
+				opts = append(opts, WithDescending())
+			}
+			result, err := testQuery.QueryResult(context.Background(), opts...)
+			assert.NoError(err)
+			assert.Equal(len(all)-seen, result.Matched)
+			seen += len(result.Logs)
+			if !result.Truncated {
+				break
+			}
+			cursor = result.Cursor
+		}
+		assert.Equal(len(all), seen)
+	}
+
+	// Lazily loaded files are read by the query
+	lazy, err := NewLogQuery(context.Background(), mapping, WithLazyLoading(false))
+	assert.NoError(err)
+	result, err = lazy.QueryResult(context.Background(), WithLimit(1))
+	assert.NoError(err)
+	assert.Equal(len(all), result.Matched)
+	info, err := os.Stat("../../logs/db_server.log")
+	assert.NoError(err)
+	assert.True(result.BytesRead >= info.Size())
+}
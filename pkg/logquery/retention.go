@@ -0,0 +1,42 @@
+package logquery
+
+import (
+	"sort"
+	"time"
+)
+
+// Retention bounds the logs of a key held in memory, so a long running server or browse session
+// reading files that keep growing doesn't grow without bound. Zero fields don't limit anything
+type Retention struct {
+	// MaxEntries is how many of the newest logs of a key are kept
+	MaxEntries int
+	// MaxAge drops the logs of a key that are this much older than its newest log
+	MaxAge time.Duration
+}
+
+// WithRetention drops the oldest logs of every key once it has more than the retention allows, as files
+// are loaded and every time Refresh reads new lines. Dropped logs aren't read again unless their file is
+// reloaded, queries only see the retained ones. Lazy keys are only bounded with keepParsed since
+// otherwise nothing is held
+func WithRetention(retention Retention) Option {
+	return func(l *LogQuery) {
+		l.readConfig.retention = retention
+	}
+}
+
+// retain returns the logs of a key the retention keeps, logs have to be in time order. The kept logs
+// are copied when some are dropped so the dropped ones can be freed
+func (r Retention) retain(logs []*Log) []*Log {
+	start := 0
+	if r.MaxAge > 0 && len(logs) > 0 {
+		cutoff := logs[len(logs)-1].Time.Add(-r.MaxAge)
+		start = sort.Search(len(logs), func(i int) bool { return !logs[i].Time.Before(cutoff) })
+	}
+	if r.MaxEntries > 0 && len(logs)-start > r.MaxEntries {
+		start = len(logs) - r.MaxEntries
+	}
+	if start == 0 {
+		return logs
+	}
+	return append([]*Log{}, logs[start:]...)
+}
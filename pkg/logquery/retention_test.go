@@ -0,0 +1,57 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention(t *testing.T) {
+	assert := assert.New(t)
+	at := func(sec int) *Log {
+		return &Log{Time: time.Date(2020, 2, 28, 5, 20, sec, 0, time.UTC)}
+	}
+	logs := []*Log{at(0), at(10), at(20), at(30), at(40)}
+
+	assert.Equal(logs, Retention{}.retain(logs))
+	assert.Equal(logs[2:], Retention{MaxEntries: 3}.retain(logs))
+	assert.Equal(logs[3:], Retention{MaxAge: 15 * time.Second}.retain(logs))
+	// Logs exactly MaxAge older than the newest are kept
+	assert.Equal(logs[1:], Retention{MaxAge: 30 * time.Second}.retain(logs))
+	assert.Equal(logs[4:], Retention{MaxEntries: 1, MaxAge: time.Minute}.retain(logs))
+	assert.Empty(Retention{MaxEntries: 1}.retain(nil))
+}
+
+func TestQueryRetention(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.00][info] one\n[02/28/2020 5:20:56.00][info] two\n[02/28/2020 5:20:57.00][info] three\n"), 0644))
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path, "server1": "../../logs/server1.log"}, WithRetention(Retention{MaxEntries: 2}))
+	assert.NoError(err)
+	messages := func(key string) []string {
+		logs, err := testQuery.QueryLogs(context.Background(), WithKeys(key))
+		assert.NoError(err)
+		rv := []string{}
+		for _, log := range logs {
+			rv = append(rv, log.Log)
+		}
+		return rv
+	}
+	assert.Equal([]string{"two", "three"}, messages("app"))
+	// Every key keeps its own newest logs
+	assert.Equal(2, len(messages("server1")))
+
+	// New lines push out the oldest ones without the dropped lines being read again
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(err)
+	_, err = file.WriteString("[02/28/2020 5:20:58.00][info] four\n")
+	assert.NoError(err)
+	file.Close()
+	assert.NoError(testQuery.Refresh(context.Background()))
+	assert.Equal([]string{"three", "four"}, messages("app"))
+}
@@ -0,0 +1,351 @@
+package logquery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the hash of an empty request body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Source reads logs from S3 or an S3 compatible store with paths like s3://bucket/logs/app.log. A path
+// ending in / lists every object under the prefix and globs like s3://bucket/logs/app-*.log.gz are
+// matched against the listed keys. Objects are streamed and gzipped objects are decompressed
+type S3Source struct {
+	Region string
+	// Endpoint defaults to https://s3.<Region>.amazonaws.com, buckets are always addressed by path
+	Endpoint string
+	// Requests are only signed when AccessKeyID is set, so public buckets work without credentials
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+
+	// now is swapped out in tests
+	now func() time.Time
+}
+
+// NewS3SourceFromEnv returns an S3Source configured from the standard AWS_* environment variables.
+// AWS_ENDPOINT_URL can point it at an S3 compatible store
+func NewS3SourceFromEnv() *S3Source {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Source{
+		Region:          region,
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Expand implements Source
+func (s *S3Source) Expand(ctx context.Context, uri string) ([]string, bool, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, false, err
+	}
+
+	glob := strings.IndexAny(key, "*?[")
+	if glob == -1 && key != "" && !strings.HasSuffix(key, "/") {
+		return []string{uri}, false, nil
+	}
+	prefix := key
+	if glob != -1 {
+		prefix = key[:glob]
+	}
+
+	keys, err := s.list(ctx, bucket, prefix)
+	if err != nil {
+		return nil, true, err
+	}
+	paths := []string{}
+	for _, listed := range keys {
+		if glob != -1 {
+			if ok, err := path.Match(key, listed); err != nil {
+				return nil, true, fmt.Errorf("bad glob %s, %s", uri, err)
+			} else if !ok {
+				continue
+			}
+		} else if strings.HasSuffix(listed, "/") {
+			continue
+		}
+		paths = append(paths, "s3://"+bucket+"/"+listed)
+	}
+	if len(paths) == 0 {
+		return nil, true, fmt.Errorf("no log files match %s", uri)
+	}
+	sort.Strings(paths)
+	return paths, true, nil
+}
+
+// Open implements Source
+func (s *S3Source) Open(ctx context.Context, uri string, from int64) (io.ReadCloser, int64, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := s.request(ctx, http.MethodGet, bucket, key, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", from))
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// Nothing past from, S3 refuses ranges starting at the end of the object
+		resp.Body.Close()
+		size, err := s.Size(ctx, uri)
+		return io.NopCloser(strings.NewReader("")), size, err
+	}
+
+	size := resp.ContentLength
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		// bytes 100-199/200
+		if i := strings.LastIndex(contentRange, "/"); i != -1 {
+			size, _ = strconv.ParseInt(contentRange[i+1:], 10, 64)
+		}
+	}
+	return resp.Body, size, nil
+}
+
+// Size implements Source
+func (s *S3Source) Size(ctx context.Context, uri string) (int64, error) {
+	info, err := s.Stat(ctx, uri)
+	return info.Size, err
+}
+
+// Stat implements StatSource with the Content-Length and Last-Modified of a HEAD request, objects are
+// replaced as a whole so they are cached until a new object is uploaded
+func (s *S3Source) Stat(ctx context.Context, uri string) (SourceInfo, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return SourceInfo{}, err
+	}
+	req, err := s.request(ctx, http.MethodHead, bucket, key, nil)
+	if err != nil {
+		return SourceInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return SourceInfo{}, err
+	}
+	resp.Body.Close()
+	info := SourceInfo{Size: resp.ContentLength}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modified
+	}
+	return info, nil
+}
+
+// list returns every key under prefix, following continuation tokens
+func (s *S3Source) list(ctx context.Context, bucket, prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.request(ctx, http.MethodGet, bucket, "", query)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+		result := struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bad list response for s3://%s/%s, %s", bucket, prefix, err)
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// request builds a signed request for an object, or the bucket when key is empty
+func (s *S3Source) request(ctx context.Context, method, bucket, key string, query url.Values) (*http.Request, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("bad s3 endpoint %s, %s", endpoint, err)
+	}
+	u.Path += "/" + bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = awsEscape(u.Path, true)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.AccessKeyID != "" {
+		s.sign(req)
+	}
+	return req, nil
+}
+
+// do sends a request and turns error responses into errors
+func (s *S3Source) do(req *http.Request) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS signature version 4 Authorization header to req, which must not have a body
+func (s *S3Source) sign(req *http.Request) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+		headers = append(headers, "x-amz-security-token")
+	}
+
+	canonicalHeaders := ""
+	for _, header := range headers {
+		value := req.Header.Get(header)
+		if header == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders += header + ":" + strings.TrimSpace(value) + "\n"
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonicalRequest)
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery encodes query sorted by name the way AWS signatures expect
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []string{}
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent encodes everything other than unreserved characters, and / when keepSlash is set
+func awsEscape(s string, keepSlash bool) string {
+	rv := strings.Builder{}
+	for _, b := range []byte(s) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && keepSlash:
+			rv.WriteByte(b)
+		default:
+			fmt.Fprintf(&rv, "%%%02X", b)
+		}
+	}
+	return rv.String()
+}
+
+// parseS3URI splits s3://bucket/key
+func parseS3URI(uri string) (bucket, key string, err error) {
+	rest := strings.TrimPrefix(uri, "s3://")
+	if rest == uri {
+		return "", "", fmt.Errorf("%s is not an s3:// path", uri)
+	}
+	parts := strings.SplitN(rest, "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("%s has no bucket", uri)
+	}
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], parts[1], nil
+}
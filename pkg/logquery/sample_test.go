@@ -0,0 +1,57 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleRate(t *testing.T) {
+	assert := assert.New(t)
+	lines := []string{}
+	for i := 0; i < 1000; i++ {
+		level := "debug"
+		if i%100 == 0 {
+			level = "error"
+		}
+		lines = append(lines, fmt.Sprintf("[02/28/2020 5:%02d:%02d.%02d][%s] tick %d", i/600, i/10%60, i%10*10, level, i))
+	}
+	path := filepath.Join(t.TempDir(), "busy.log")
+	assert.NoError(os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"busy": path})
+	assert.NoError(err)
+
+	logs, err := testQuery.QueryLogs(context.Background(), WithSampleRate(10, Debug))
+	assert.NoError(err)
+	errorCount, debugs := 0, 0
+	for _, log := range logs {
+		if log.Severity == Error {
+			errorCount++
+		} else {
+			debugs++
+		}
+	}
+	// Every error is kept and roughly 1 in 10 debug logs
+	assert.Equal(10, errorCount)
+	assert.InDelta(99, debugs, 30)
+
+	// The same query returns the same sample, and pages of it line up
+	again, err := testQuery.QueryLogs(context.Background(), WithSampleRate(10, Debug))
+	assert.NoError(err)
+	assert.Equal(logs, again)
+	page, err := testQuery.QueryPage(context.Background(), WithSampleRate(10, Debug), WithLimit(20))
+	assert.NoError(err)
+	assert.Equal(logs[:20], page.Logs)
+	page, err = testQuery.QueryPage(context.Background(), WithSampleRate(10, Debug), WithLimit(20), WithCursor(page.Cursor))
+	assert.NoError(err)
+	assert.Equal(logs[20:40], page.Logs)
+
+	logs, err = testQuery.QueryLogs(context.Background(), WithSampleRate(1000))
+	assert.NoError(err)
+	assert.True(len(logs) < 10)
+}
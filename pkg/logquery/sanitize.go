@@ -0,0 +1,126 @@
+package logquery
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sanitize makes s safe to print to a terminal. ANSI escape sequences, like the colors some programs
+// log with, are removed, other control characters are escaped like \x07 and invalid UTF-8 is replaced
+// with U+FFFD. Tabs are kept. A log line could otherwise move the cursor, retitle the window or hide
+// the lines before it
+func Sanitize(s string) string {
+	if !needsSanitizing(s) {
+		return s
+	}
+	b := strings.Builder{}
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\x1b' || r == '\u009b':
+			i += escapeLength(s[i:])
+			continue
+		case r == utf8.RuneError && size == 1:
+			b.WriteRune(utf8.RuneError)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case isControl(r) && r < utf8.RuneSelf:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case isControl(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// StripANSI removes the ANSI escape sequences from s, like the colors of logs captured from a terminal,
+// and leaves everything else as it is
+func StripANSI(s string) string {
+	i := strings.IndexAny(s, "\x1b\u009b")
+	if i == -1 {
+		return s
+	}
+	b := strings.Builder{}
+	b.Grow(len(s))
+	for i != -1 {
+		b.WriteString(s[:i])
+		s = s[i+escapeLength(s[i:]):]
+		i = strings.IndexAny(s, "\x1b\u009b")
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// WithStripANSI removes ANSI escape sequences from every line before it is parsed, so colored logs
+// captured from a terminal match filters and are stored, cached and output without them
+func WithStripANSI() Option {
+	return func(l *LogQuery) {
+		l.readConfig.stripANSI = true
+	}
+}
+
+// needsSanitizing returns true if Sanitize would change s
+func needsSanitizing(s string) bool {
+	for _, r := range s {
+		if isControl(r) {
+			return true
+		}
+	}
+	return !utf8.ValidString(s)
+}
+
+// isControl returns true for the C0 and C1 control characters other than tab, and DEL
+func isControl(r rune) bool {
+	return (r < ' ' && r != '\t') || (r >= 0x7f && r <= 0x9f)
+}
+
+// escapeLength returns how many bytes the escape sequence at the start of s takes up. CSI sequences like
+// colors run to their final byte, OSC sequences like window titles to a BEL or ST, and anything else is
+// the escape, its intermediate bytes and one final byte. A sequence cut off by the end of s runs to the
+// end
+func escapeLength(s string) int {
+	switch {
+	case strings.HasPrefix(s, "\u009b"):
+		return len("\u009b") + csiLength(s[len("\u009b"):])
+	case strings.HasPrefix(s, "\x1b["):
+		return 2 + csiLength(s[2:])
+	case strings.HasPrefix(s, "\x1b]"):
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if strings.HasPrefix(s[i:], "\x1b\\") {
+				return i + 2
+			}
+		}
+		return len(s)
+	}
+	i := 1
+	for i < len(s) && s[i] >= 0x20 && s[i] <= 0x2f {
+		i++
+	}
+	if i < len(s) && s[i] >= 0x30 && s[i] <= 0x7e {
+		i++
+	}
+	return i
+}
+
+// csiLength returns how many bytes the parameters, intermediate bytes and final byte of the CSI sequence
+// at the start of s take up
+func csiLength(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= 0x20 && s[i] <= 0x3f {
+		i++
+	}
+	if i < len(s) && s[i] >= 0x40 && s[i] <= 0x7e {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,58 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	assert := assert.New(t)
+	for in, want := range map[string]string{
+		"plain “quoted” text\twith a tab": "plain “quoted” text\twith a tab",
+		"\x1b[1;31mred\x1b[0m":            "red",
+		"\x1b]0;title\x07after":           "after",
+		"\x1b]8;;http://x\x1b\\link":      "link",
+		"bell\x07 and\r\nbreak":           `bell\x07 and\r\nbreak`,
+		"c1 \u009b2Jcsi \u0085next":       `c1 csi \u0085next`,
+		"bad \xff utf8":                   "bad � utf8",
+		"cut off \x1b[31":                 "cut off ",
+		"\x1b":                            "",
+	} {
+		assert.Equal(want, Sanitize(in), in)
+	}
+
+	log := Log{Time: time.Now(), TimeString: "[02/28/2020 5:20:55.17]", SeverityString: "[info]", Key: "app", Log: "\x1b[2Jcleared"}
+	assert.Equal("[02/28/2020 5:20:55.17][info][app] cleared", log.String())
+}
+
+func TestStripANSI(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("plain", StripANSI("plain"))
+	assert.Equal("red and bold\x07", StripANSI("\x1b[31mred\x1b[0m and \x1b[1mbold\x1b[0m\x07"))
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][\x1b[31merror\x1b[0m] \x1b[1mdisk\x1b[0m full\n"), 0644))
+	for _, strip := range []bool{false, true} {
+		opts := []Option{}
+		if strip {
+			opts = append(opts, WithStripANSI())
+		}
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"app": path}, opts...)
+		assert.NoError(err)
+		logs, err := testQuery.QueryLogs(context.Background(), WithSubstring("disk full"))
+		assert.NoError(err)
+		if !strip {
+			// The colored level doesn't parse
+			assert.Empty(logs)
+			continue
+		}
+		assert.Equal(1, len(logs))
+		assert.Equal(Error, logs[0].Severity)
+		assert.Equal("disk full", logs[0].Log)
+	}
+}
@@ -0,0 +1,135 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// WithClockOffset adds offset to the timestamps of key, for a host whose clock runs offset behind the
+// others, so its logs interleave in the order they really happened. A negative offset corrects a clock
+// that runs ahead. Log.Time is corrected while TimeString keeps the time the line was written with
+func WithClockOffset(key string, offset time.Duration) Option {
+	return func(l *LogQuery) {
+		l.clockOffsets[key] = offset
+	}
+}
+
+// WithEstimatedClockOffsets corrects the clocks of every key against reference using the logs they share
+// a field value with, like a request id that is logged by every service it passes through. See
+// EstimateClockOffsets. Offsets set with WithClockOffset are applied first and the estimates are added to
+// them. It does nothing with lazy loading since the logs have to be read up front to compare them
+func WithEstimatedClockOffsets(field string, reference string) Option {
+	return func(l *LogQuery) {
+		l.skewField, l.skewReference = field, reference
+	}
+}
+
+// ClockOffsets returns the offset added to the timestamps of every key whose clock is corrected
+func (l *LogQuery) ClockOffsets() map[string]time.Duration {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	rv := map[string]time.Duration{}
+	for key, offset := range l.clockOffsets {
+		rv[key] = offset
+	}
+	return rv
+}
+
+// EstimateClockOffsets estimates how far the clock of every key is behind reference from the logs they
+// share a value of field with. For every value logged by both, the first log of the key is compared with
+// the first log of reference and the median difference is the key's offset. The time a request takes to
+// get from one service to the next is part of the difference, so the estimate is only as good as that
+// latency is small. Keys without a value in common with reference are left out
+func (l *LogQuery) EstimateClockOffsets(ctx context.Context, field string, reference string) (map[string]time.Duration, error) {
+	if _, _, ok := l.keySource(reference); !ok {
+		return nil, fmt.Errorf("unknown clock reference key %s", reference)
+	}
+	// firsts is the time of the first log of every value by key
+	firsts := map[string]map[string]time.Time{}
+	for _, key := range l.Keys() {
+		keyFirsts := map[string]time.Time{}
+		if _, err := l.eachLog(ctx, key, time.Time{}, func(log *Log) bool {
+			value, ok := log.Fields[field]
+			if first, seen := keyFirsts[value]; ok && value != "" && (!seen || log.Time.Before(first)) {
+				keyFirsts[value] = log.Time
+			}
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		firsts[key] = keyFirsts
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rv := map[string]time.Duration{}
+	for key, keyFirsts := range firsts {
+		if key == reference {
+			continue
+		}
+		diffs := []time.Duration{}
+		for value, first := range keyFirsts {
+			if referenceFirst, ok := firsts[reference][value]; ok {
+				diffs = append(diffs, referenceFirst.Sub(first))
+			}
+		}
+		if len(diffs) > 0 {
+			rv[key] = medianDuration(diffs)
+		}
+	}
+	return rv, nil
+}
+
+// estimateClockOffsets corrects the loaded keys with the estimates of WithEstimatedClockOffsets. Parsers
+// are wrapped too so logs read later by Refresh are corrected the same way
+func (l *LogQuery) estimateClockOffsets(ctx context.Context) error {
+	offsets, err := l.EstimateClockOffsets(ctx, l.skewField, l.skewReference)
+	if err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for key, offset := range offsets {
+		if offset == 0 {
+			continue
+		}
+		// Every log moves by the same amount so the order of the key doesn't change
+		for _, log := range l.processedLogs[key] {
+			log.Time = log.Time.Add(offset)
+		}
+		l.clockOffsets[key] += offset
+		l.parsers[key] = &clockParser{parser: parserFor(l.parsers, key), offset: offset}
+	}
+	return nil
+}
+
+// medianDuration returns the median of durations, sorting them in place
+func medianDuration(durations []time.Duration) time.Duration {
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	mid := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[mid-1] + durations[mid]) / 2
+	}
+	return durations[mid]
+}
+
+// clockParser wraps a parser for a host whose clock is offset behind
+type clockParser struct {
+	parser LineParser
+	offset time.Duration
+}
+
+// Parse implements LineParser
+func (p *clockParser) Parse(raw string) (*Log, error) {
+	log, err := p.parser.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	log.Time = log.Time.Add(p.offset)
+	return log, nil
+}
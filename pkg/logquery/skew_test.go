@@ -0,0 +1,53 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockOffset(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	api := filepath.Join(dir, "api.log")
+	db := filepath.Join(dir, "db.log")
+	assert.NoError(os.WriteFile(api, []byte(`{"ts":"2020-02-28T05:20:10Z","level":"info","msg":"request","request_id":"a"}
+{"ts":"2020-02-28T05:20:20Z","level":"info","msg":"request","request_id":"b"}
+{"ts":"2020-02-28T05:20:30Z","level":"info","msg":"request","request_id":"c"}
+`), 0644))
+	// The db clock runs 5s behind, the second query is 1s slower than the others
+	assert.NoError(os.WriteFile(db, []byte(`{"ts":"2020-02-28T05:20:05.1Z","level":"info","msg":"query","request_id":"a"}
+{"ts":"2020-02-28T05:20:16Z","level":"info","msg":"query","request_id":"b"}
+{"ts":"2020-02-28T05:20:25.1Z","level":"info","msg":"query","request_id":"c"}
+`), 0644))
+	mapping := map[string]string{"api": api, "db": db}
+	parsers := []Option{WithParser("api", &JSONParser{}), WithParser("db", &JSONParser{})}
+
+	testQuery, err := NewLogQuery(context.Background(), mapping, append(parsers, WithClockOffset("db", 5*time.Second))...)
+	assert.NoError(err)
+	logs, _ := testQuery.QueryLogs(context.Background())
+	assert.Equal([]string{"request", "query", "request", "query", "request", "query"}, messages(logs))
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 10, 100000000, time.UTC), logs[1].Time)
+
+	estimates, err := testQuery.EstimateClockOffsets(context.Background(), "request_id", "api")
+	assert.NoError(err)
+	assert.Equal(map[string]time.Duration{"db": -100 * time.Millisecond}, estimates)
+	_, err = testQuery.EstimateClockOffsets(context.Background(), "request_id", "missing")
+	assert.Error(err)
+
+	// Estimated offsets apply to logs read later too
+	testQuery, err = NewLogQuery(context.Background(), mapping, append(parsers, WithEstimatedClockOffsets("request_id", "api"))...)
+	assert.NoError(err)
+	assert.Equal(map[string]time.Duration{"db": 4900 * time.Millisecond}, testQuery.ClockOffsets())
+	file, _ := os.OpenFile(db, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"ts":"2020-02-28T05:20:35.1Z","level":"info","msg":"later"}` + "\n")
+	file.Close()
+	assert.NoError(testQuery.Refresh(context.Background()))
+	logs, _ = testQuery.QueryLogs(context.Background())
+	assert.Equal([]string{"request", "query", "request", "query", "request", "query", "later"}, messages(logs))
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 40, 0, time.UTC), logs[6].Time)
+}
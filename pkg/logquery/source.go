@@ -0,0 +1,138 @@
+package logquery
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Source lists and opens log files. Paths for sources other than the local file system are URIs like
+// s3://bucket/prefix/*.log and the source is picked by the scheme
+type Source interface {
+	// Expand turns a path, directory or glob into the files it refers to. isPattern is false when path
+	// is a single file
+	Expand(ctx context.Context, path string) (paths []string, isPattern bool, err error)
+	// Open opens a file for reading from the byte offset from and returns the full size of the file
+	Open(ctx context.Context, path string, from int64) (io.ReadCloser, int64, error)
+	// Size returns the current size of a file
+	Size(ctx context.Context, path string) (int64, error)
+}
+
+// SourceInfo is the metadata of a file of a Source
+type SourceInfo struct {
+	Size int64
+	// ModTime is when the file last changed, the zero time if the source can't tell
+	ModTime time.Time
+}
+
+// StatSource is a Source that knows when its files changed. Files from a StatSource are cached in the
+// WithCache directory like local files, keyed on their size and modification time
+type StatSource interface {
+	Source
+	Stat(ctx context.Context, path string) (SourceInfo, error)
+}
+
+var _ StatSource = fileSource{}
+
+// WithSource reads paths starting with scheme:// from source. s3:// paths use an S3Source configured
+// from the environment, journald:// paths a JournaldSource, winevent:// paths a WinEventSource and http://
+// and https:// paths an HTTPSource unless another source is set for them
+func WithSource(scheme string, source Source) Option {
+	return func(l *LogQuery) {
+		if l.readConfig.sources == nil {
+			l.readConfig.sources = map[string]Source{}
+		}
+		l.readConfig.sources[scheme] = source
+	}
+}
+
+// defaultHTTPSource reads http:// and https:// paths, it is shared so every LogQuery remembers the
+// validators of the urls it read
+var defaultHTTPSource = &HTTPSource{}
+
+// source returns the source for path
+func (c readConfig) source(path string) Source {
+	i := strings.Index(path, "://")
+	if i == -1 {
+		return fileSource{}
+	}
+	scheme := path[:i]
+	if source, ok := c.sources[scheme]; ok {
+		return source
+	}
+	if scheme == "s3" {
+		return NewS3SourceFromEnv()
+	}
+	if scheme == journaldScheme {
+		return &JournaldSource{}
+	}
+	if scheme == wineventScheme {
+		return &WinEventSource{}
+	}
+	if scheme == "http" || scheme == "https" {
+		return defaultHTTPSource
+	}
+	return fileSource{}
+}
+
+// stat returns the metadata of path, ok is false if its source can't tell when it changed
+func (c readConfig) stat(ctx context.Context, path string) (info SourceInfo, ok bool, err error) {
+	source, ok := c.source(path).(StatSource)
+	if !ok {
+		return SourceInfo{}, false, nil
+	}
+	if info, err = source.Stat(ctx, path); err != nil {
+		return SourceInfo{}, false, err
+	}
+	return info, !info.ModTime.IsZero(), nil
+}
+
+// isLocal returns true if path is on the local file system
+func (c readConfig) isLocal(path string) bool {
+	_, ok := c.source(path).(fileSource)
+	return ok
+}
+
+// fileSource reads from the local file system
+type fileSource struct{}
+
+func (fileSource) Expand(ctx context.Context, path string) ([]string, bool, error) {
+	return expandPath(path)
+}
+
+func (fileSource) Open(ctx context.Context, path string, from int64) (io.ReadCloser, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if from > 0 {
+		if _, err := file.Seek(from, io.SeekStart); err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+	}
+	return file, info.Size(), nil
+}
+
+func (fileSource) Size(ctx context.Context, path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (fileSource) Stat(ctx context.Context, path string) (SourceInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return SourceInfo{}, err
+	}
+	return SourceInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
@@ -0,0 +1,140 @@
+package logquery
+
+import (
+	"context"
+	"fmt"
+)
+
+// AddSource registers path under key while the LogQuery is in use, so long running servers can pick up
+// new files without loading every other file again. The path can be a directory or glob like in
+// NewLogQuery and the files are loaded before AddSource returns, unless lazy loading is on. Parsers,
+// labels and locations set for key when the LogQuery was created are used, and a key that is already
+// registered is handled by WithDuplicatePolicy. If a file fails to load nothing is registered and the
+// error is a *LoadError
+func (l *LogQuery) AddSource(ctx context.Context, key string, path string) error {
+	l.registering.Lock()
+	defer l.registering.Unlock()
+
+	// Work on copies so queries running meanwhile keep seeing the old keys
+	l.mutex.RLock()
+	keyPaths := make(map[string][]string, len(l.paths)+1)
+	for k, paths := range l.paths {
+		keyPaths[k] = paths
+	}
+	parsers := make(map[string]LineParser, len(l.parsers)+1)
+	for k, parser := range l.parsers {
+		parsers[k] = parser
+	}
+	l.mutex.RUnlock()
+
+	if _, ok := parsers[key]; !ok && l.severities != nil && !l.hasOwnFormat(path) {
+		parsers[key] = &BracketParser{Severities: l.severities}
+	}
+	old := make(map[string][]string, len(keyPaths))
+	for k, paths := range keyPaths {
+		old[k] = paths
+	}
+	if err := l.addPaths(ctx, map[string][]string{key: {path}}, keyPaths, parsers); err != nil {
+		return err
+	}
+	// Keys get new files when they are merged or overridden, and lose them to overrides of other keys
+	changed := map[string][]string{}
+	for k, paths := range keyPaths {
+		if oldPaths, ok := old[k]; !ok || !samePaths(oldPaths, paths) {
+			changed[k] = paths
+		}
+	}
+
+	logs, offsets := map[string][]*Log{}, map[string]fileOffset{}
+	if !l.lazy {
+		var errs map[string]error
+		logs, offsets, errs = processFiles(ctx, changed, parsers, l.readConfig, false)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			return &LoadError{Errors: errs}
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.paths, l.parsers = keyPaths, parsers
+	for k := range old {
+		if _, ok := keyPaths[k]; !ok {
+			delete(l.processedLogs, k)
+		}
+	}
+	for k := range changed {
+		// Lazy keys are read again on their next query
+		delete(l.processedLogs, k)
+	}
+	for k, keyLogs := range logs {
+		l.processedLogs[k] = keyLogs
+	}
+	for path, offset := range offsets {
+		l.offsets[path] = offset
+	}
+	return nil
+}
+
+// RemoveSource unregisters key and drops its logs. Files added from a glob have a key each, which are
+// removed one by one
+func (l *LogQuery) RemoveSource(key string) error {
+	l.registering.Lock()
+	defer l.registering.Unlock()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	paths, ok := l.paths[key]
+	if !ok {
+		return fmt.Errorf("unknown log key %s", key)
+	}
+	keyPaths := make(map[string][]string, len(l.paths))
+	for k, p := range l.paths {
+		if k != key {
+			keyPaths[k] = p
+		}
+	}
+	l.paths = keyPaths
+	delete(l.processedLogs, key)
+	for _, path := range paths {
+		delete(l.offsets, path)
+	}
+	return nil
+}
+
+// keySource returns the paths and parser of a key, ok is false if it isn't registered
+func (l *LogQuery) keySource(key string) (paths []string, parser LineParser, ok bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	paths, ok = l.paths[key]
+	return paths, parserFor(l.parsers, key), ok
+}
+
+// storeLogs keeps the logs and offsets read from the paths of a key, unless the key was removed or
+// registered again with other paths while they were read
+func (l *LogQuery) storeLogs(key string, paths []string, logs []*Log, offsets map[string]fileOffset) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if current, ok := l.paths[key]; !ok || !samePaths(current, paths) {
+		return
+	}
+	l.processedLogs[key] = logs
+	for path, offset := range offsets {
+		l.offsets[path] = offset
+	}
+}
+
+// samePaths returns true if a and b hold the same paths in the same order
+func samePaths(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package logquery
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddSource(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		assert := assert.New(t)
+		opts := []Option{}
+		if lazy {
+			opts = append(opts, WithLazyLoading(true))
+		}
+		testQuery, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"}, opts...)
+		assert.NoError(err)
+
+		assert.NoError(testQuery.AddSource(context.Background(), "db_server", "../../logs/db_server.log"))
+		assert.Equal([]string{"db_server", "server1"}, testQuery.Keys())
+		logs, err := testQuery.QueryLogs(context.Background(), WithKeys("db_server"))
+		assert.NoError(err)
+		assert.Len(logs, 4)
+
+		// A key can only be registered once
+		assert.Error(testQuery.AddSource(context.Background(), "server1", "../../logs/db_server.log"))
+		// Files that don't load aren't registered
+		err = testQuery.AddSource(context.Background(), "missing", filepath.Join(t.TempDir(), "missing.log"))
+		if lazy {
+			// Lazy files are only read once they are queried
+			assert.NoError(err)
+			assert.NoError(testQuery.RemoveSource("missing"))
+		} else {
+			var loadErr *LoadError
+			assert.True(errors.As(err, &loadErr))
+		}
+		assert.Equal([]string{"db_server", "server1"}, testQuery.Keys())
+
+		assert.NoError(testQuery.RemoveSource("db_server"))
+		assert.Error(testQuery.RemoveSource("db_server"))
+		logs, err = testQuery.QueryLogs(context.Background())
+		assert.NoError(err)
+		assert.NotEmpty(logs)
+		for _, log := range logs {
+			assert.Equal("server1", log.Key)
+		}
+		logs, err = testQuery.QueryLogs(context.Background(), WithKeys("db_server"))
+		assert.NoError(err)
+		assert.Empty(logs)
+	}
+}
+
+func TestAddSourceWhileQuerying(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"})
+	assert.NoError(err)
+
+	wg := sync.WaitGroup{}
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_, err := testQuery.QueryLogs(context.Background())
+			assert.NoError(err)
+			assert.NoError(testQuery.Refresh(context.Background()))
+		}
+	}()
+	for _, key := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, key+".log")
+		assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] started\n"), 0644))
+		assert.NoError(testQuery.AddSource(context.Background(), key, path))
+	}
+	assert.NoError(testQuery.RemoveSource("b"))
+	close(done)
+	wg.Wait()
+
+	logs, err := testQuery.QueryLogs(context.Background(), WithKeys("a", "b", "c"))
+	assert.NoError(err)
+	assert.Len(logs, 2)
+}
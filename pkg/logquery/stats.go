@@ -0,0 +1,103 @@
+package logquery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyStats summarizes the logs of a key, see Stats
+type KeyStats struct {
+	// Logs is how many logs were parsed and Failed how many lines couldn't be, see ParseReport. Lines of a
+	// lazily loaded key that failed aren't counted
+	Logs   int
+	Failed int
+	// First and Last are the times of the earliest and latest logs
+	First time.Time
+	Last  time.Time
+	// Counts are the logs of each severity
+	Counts map[LogLevel]int
+	// BusiestMinute is the start of the minute with the most logs and BusiestCount its logs
+	BusiestMinute time.Time
+	BusiestCount  int
+	// MessageBytes is the total length of the messages, see AverageLength
+	MessageBytes int64
+}
+
+// Lines is every line of the key, the logs and the lines that failed
+func (s KeyStats) Lines() int {
+	return s.Logs + s.Failed
+}
+
+// Span is the time between the first and last logs
+func (s KeyStats) Span() time.Duration {
+	return s.Last.Sub(s.First)
+}
+
+// AverageLength is the average length of a message in bytes
+func (s KeyStats) AverageLength() float64 {
+	if s.Logs == 0 {
+		return 0
+	}
+	return float64(s.MessageBytes) / float64(s.Logs)
+}
+
+// Stats reads every log of the keys once and summarizes each of them, a cheap look at what is in the
+// files before querying them. Keys that failed to load are reported in a *LoadError along with the stats
+// of the others
+func (l *LogQuery) Stats(ctx context.Context, logKeys []string) (map[string]KeyStats, error) {
+	wg := sync.WaitGroup{}
+	rv := map[string]KeyStats{}
+	errs := map[string]error{}
+	mutex := sync.Mutex{}
+
+	for _, logKey := range logKeys {
+		wg.Add(1)
+		go func(logKey string) {
+			defer wg.Done()
+			stats := KeyStats{Counts: map[LogLevel]int{}}
+			minute, inMinute := time.Time{}, 0
+			_, err := l.eachLog(ctx, logKey, time.Time{}, func(log *Log) bool {
+				if stats.Logs == 0 {
+					stats.First = log.Time
+				}
+				stats.Logs++
+				stats.Last = log.Time
+				stats.Counts[log.Severity]++
+				stats.MessageBytes += int64(len(log.Log))
+				// Logs are in time order so a minute is done once a log is past it
+				if start := log.Time.Truncate(time.Minute); !start.Equal(minute) {
+					minute, inMinute = start, 0
+				}
+				inMinute++
+				if inMinute > stats.BusiestCount {
+					stats.BusiestMinute, stats.BusiestCount = minute, inMinute
+				}
+				return true
+			})
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs[logKey] = err
+				return
+			}
+			rv[logKey] = stats
+		}(logKey)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for key, report := range l.ParseReport() {
+		if stats, ok := rv[key]; ok {
+			stats.Failed = report.Failed
+			rv[key] = stats
+		}
+	}
+	if len(errs) > 0 {
+		return rv, &LoadError{Errors: errs}
+	}
+	return rv, nil
+}
@@ -0,0 +1,46 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] one\n"+
+		"no brackets at all\n"+
+		"[02/28/2020 5:21:00.00][warn] three\n"+
+		"[02/28/2020 5:21:30.00][error] five!\n"+
+		"[02/28/2020 5:22:00.00][info] seven\n"), 0644))
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{
+		"app": path,
+		"db":  "../../logs/db_server.log",
+	})
+
+	stats, err := testQuery.Stats(context.Background(), []string{"app", "db"})
+	assert.NoError(err)
+	app := stats["app"]
+	assert.Equal(4, app.Logs)
+	assert.Equal(1, app.Failed)
+	assert.Equal(5, app.Lines())
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 55, 170000000, time.UTC), app.First)
+	assert.Equal(time.Date(2020, 2, 28, 5, 22, 0, 0, time.UTC), app.Last)
+	assert.Equal(65*time.Second-170*time.Millisecond, app.Span())
+	assert.Equal(map[LogLevel]int{Info: 2, Warn: 1, Error: 1}, app.Counts)
+	assert.Equal(time.Date(2020, 2, 28, 5, 21, 0, 0, time.UTC), app.BusiestMinute)
+	assert.Equal(2, app.BusiestCount)
+	assert.Equal(4.5, app.AverageLength())
+
+	db := stats["db"]
+	assert.Equal(4, db.Lines())
+	assert.Equal(map[LogLevel]int{Info: 2, Warn: 2}, db.Counts)
+	assert.Equal(4, db.BusiestCount)
+
+	assert.Equal(0.0, KeyStats{}.AverageLength())
+}
@@ -0,0 +1,140 @@
+package logquery
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	// <165>1 2003-10-11T22:14:15.003Z host app procid msgid [structured data] msg
+	syslog5424Regex = regexp.MustCompile(`^<(\d{1,3})>1 (\S+) (\S+) (\S+) (\S+) (\S+) (-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: (.*))?$`)
+	// <34>Oct 11 22:14:15 host tag[pid]: msg, files written by rsyslog usually leave out the <34>
+	syslog3164Regex = regexp.MustCompile(`^(?:<(\d{1,3})>)?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) (?:([^\s:\[]+)(?:\[([^\]]*)\])?: )?(.*)$`)
+
+	syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+	syslogFacilities = []string{
+		"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv",
+		"ftp", "ntp", "security", "console", "solaris-cron",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+	}
+)
+
+// SyslogParser parses RFC5424 and RFC3164 syslog lines, like those in /var/log/messages or forwarded by
+// rsyslog. The severity comes from the priority and the host, app, pid, msgid and facility end up in
+// Log.Fields. RFC3164 timestamps have no zone so they are read as UTC, use WithLocation to change that
+type SyslogParser struct {
+	// Year is used for RFC3164 timestamps which don't have one, 0 means the current year
+	Year int
+	// DefaultSeverity is used for RFC3164 lines without a priority and defaults to Info
+	DefaultSeverity LogLevel
+}
+
+// Parse implements LineParser
+func (p *SyslogParser) Parse(raw string) (*Log, error) {
+	if matches := syslog5424Regex.FindStringSubmatch(raw); matches != nil {
+		return p.parse5424(matches)
+	}
+	if matches := syslog3164Regex.FindStringSubmatch(raw); matches != nil {
+		return p.parse3164(matches)
+	}
+	return nil, fmt.Errorf("log does not have proper structure")
+}
+
+func (p *SyslogParser) parse5424(matches []string) (*Log, error) {
+	time, err := time.Parse(time.RFC3339Nano, matches[2])
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+	log, err := p.newLog(matches[1], time, matches[2], matches[8])
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range []string{"host", "app", "pid", "msgid", "data"} {
+		if value := matches[3+i]; value != "-" {
+			log.Fields[name] = value
+		}
+	}
+	return log, nil
+}
+
+func (p *SyslogParser) parse3164(matches []string) (*Log, error) {
+	parsed, err := time.Parse(time.Stamp, matches[2])
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+	year := p.Year
+	if year == 0 {
+		year = time.Now().Year()
+	}
+	parsed = time.Date(year, parsed.Month(), parsed.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, time.UTC)
+
+	log, err := p.newLog(matches[1], parsed, matches[2], matches[6])
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range []string{"host", "app", "pid"} {
+		if value := matches[3+i]; value != "" {
+			log.Fields[name] = value
+		}
+	}
+	return log, nil
+}
+
+// newLog decodes the priority, an empty priority gets DefaultSeverity
+func (p *SyslogParser) newLog(priority string, t time.Time, timeString string, msg string) (*Log, error) {
+	log := &Log{
+		Time:       t,
+		Log:        msg,
+		Fields:     map[string]string{},
+		TimeString: "[" + timeString + "]",
+	}
+	if priority == "" {
+		log.Severity = p.DefaultSeverity
+		if log.Severity == Undefined {
+			log.Severity = Info
+		}
+		log.SeverityString = "[" + syslogSeverityName(log.Severity) + "]"
+		return log, nil
+	}
+
+	pri, err := strconv.Atoi(priority)
+	if err != nil || pri >= len(syslogFacilities)*8 {
+		return nil, fmt.Errorf("severity was not parseable")
+	}
+	log.Severity = syslogSeverity(pri % 8)
+	log.SeverityString = "[" + syslogSeverities[pri%8] + "]"
+	log.Fields["facility"] = syslogFacilities[pri/8]
+	return log, nil
+}
+
+// syslogSeverity maps a syslog severity code to a LogLevel, everything worse than err is Fatal
+func syslogSeverity(code int) LogLevel {
+	switch {
+	case code <= 2:
+		return Fatal
+	case code == 3:
+		return Error
+	case code == 4:
+		return Warn
+	case code <= 6:
+		return Info
+	}
+	return Debug
+}
+
+// syslogSeverityName is the syslog name closest to level
+func syslogSeverityName(level LogLevel) string {
+	switch level {
+	case Fatal:
+		return "crit"
+	case Error:
+		return "err"
+	case Warn:
+		return "warning"
+	case Debug:
+		return "debug"
+	}
+	return "info"
+}
@@ -0,0 +1,47 @@
+package logquery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogParser(t *testing.T) {
+	assert := assert.New(t)
+	parser := &SyslogParser{Year: 2020}
+
+	log, err := parser.Parse(`<165>1 2020-02-28T05:20:57.35Z db01 postgres 811 ID47 [meta user="a\]b"] database “my_db7” created`)
+	assert.NoError(err)
+	assert.Equal(Info, log.Severity)
+	assert.Equal("[notice]", log.SeverityString)
+	assert.Equal("database “my_db7” created", log.Log)
+	assert.True(log.Time.Equal(time.Date(2020, 2, 28, 5, 20, 57, 350000000, time.UTC)))
+	assert.Equal(map[string]string{
+		"facility": "local4",
+		"host":     "db01",
+		"app":      "postgres",
+		"pid":      "811",
+		"msgid":    "ID47",
+		"data":     `[meta user="a\]b"]`,
+	}, log.Fields)
+
+	log, err = parser.Parse(`<34>Feb  8 05:20:57 server1 sshd[1022]: Failed password for root`)
+	assert.NoError(err)
+	assert.Equal(Fatal, log.Severity)
+	assert.Equal("Failed password for root", log.Log)
+	assert.Equal(time.Date(2020, 2, 8, 5, 20, 57, 0, time.UTC), log.Time)
+	assert.Equal(map[string]string{"facility": "auth", "host": "server1", "app": "sshd", "pid": "1022"}, log.Fields)
+
+	// rsyslog files leave out the priority
+	log, err = parser.Parse(`Feb 28 05:20:57 server1 kernel: eth0: link up`)
+	assert.NoError(err)
+	assert.Equal(Info, log.Severity)
+	assert.Equal("eth0: link up", log.Log)
+	assert.Equal("kernel", log.Fields["app"])
+
+	_, err = parser.Parse(`<999>Feb 28 05:20:57 server1 kernel: bad priority`)
+	assert.Error(err)
+	_, err = parser.Parse(`[02/28/2020 5:20:57.35][error] not syslog`)
+	assert.Error(err)
+}
@@ -0,0 +1,164 @@
+package logquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+const defaultPollInterval = 500 * time.Millisecond
+
+// WithTailErrors calls fn with the path and error when Tail fails to read a file it follows, like when
+// the file is removed. Tail keeps following the file either way, without fn the error is dropped
+func WithTailErrors(fn func(path string, err error)) Option {
+	return func(l *LogQuery) {
+		l.tailErrors = fn
+	}
+}
+
+// Tail follows the files for logKeys like `tail -f` and sends every new log at or above minSeverity
+// on the returned channel. Files of other sources, like Kafka topics, are followed by polling their size
+// too, only piped input can't be tailed. Logs found in the same poll are merged in time order. The
+// channel is closed once ctx is done
+func (l *LogQuery) Tail(ctx context.Context, logKeys []string, minSeverity LogLevel) (<-chan Log, error) {
+	tailers := []*tailer{}
+	for _, logKey := range logKeys {
+		paths, parser, ok := l.keySource(logKey)
+		if !ok {
+			return nil, fmt.Errorf("unknown log key %s", logKey)
+		}
+		for _, path := range paths {
+			source := l.readConfig.source(path)
+			if _, ok := source.(*readerSource); ok {
+				return nil, fmt.Errorf("can't tail %s, piped input can't be tailed", logKey)
+			}
+			size, err := source.Size(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			// Files of other sources are read as UTF-8 like when they are loaded
+			enc := encodingUTF8
+			if l.readConfig.isLocal(path) {
+				if enc, err = fileEncoding(path); err != nil {
+					return nil, err
+				}
+			}
+			// Only lines appended from now on are sent
+			tailers = append(tailers, &tailer{
+				key:      logKey,
+				path:     path,
+				source:   source,
+				lines:    &lineParser{parser: parser, key: logKey, path: path, lenient: l.readConfig.lenient, stripANSI: l.readConfig.stripANSI, redactors: l.readConfig.redactors, levelRules: l.readConfig.levelRules, maxLine: l.readConfig.maxLine()},
+				offset:   size,
+				encoding: enc,
+			})
+		}
+	}
+
+	rv := make(chan Log)
+	go func() {
+		defer close(rv)
+		ticker := time.NewTicker(l.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			newLogs := []Log{}
+			for _, t := range tailers {
+				logs, err := t.poll(ctx)
+				if err != nil {
+					if l.tailErrors != nil {
+						l.tailErrors(t.path, err)
+					}
+					continue
+				}
+				for _, log := range logs {
+					if log.Severity >= minSeverity {
+						newLogs = append(newLogs, *log)
+					}
+				}
+			}
+			sort.Stable(ByTime(newLogs))
+
+			for _, log := range newLogs {
+				select {
+				case <-ctx.Done():
+					return
+				case rv <- log:
+				}
+			}
+		}
+	}()
+	return rv, nil
+}
+
+// tailer keeps track of how far into a file we have read
+type tailer struct {
+	key    string
+	path   string
+	source Source
+	lines  *lineParser
+	offset int64
+	// encoding is what the new lines are transcoded to UTF-8 from
+	encoding encoding
+}
+
+// poll reads any complete lines appended since the last poll. A partially written line is left
+// for the next poll
+func (t *tailer) poll(ctx context.Context) ([]*Log, error) {
+	size, err := t.source.Size(ctx, t.path)
+	if err != nil {
+		return nil, err
+	}
+	// The file got truncated so start again from the beginning
+	if size < t.offset {
+		t.offset = 0
+	}
+	if size == t.offset {
+		return nil, nil
+	}
+
+	r, _, err := t.source.Open(ctx, t.path, t.offset)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	end := t.encoding.lineEnd(data)
+	if end == 0 {
+		return nil, nil
+	}
+	text, _ := t.encoding.decode(nil, data[:end], true)
+	// offset is where the next line starts, it is only known for files that weren't transcoded
+	offset := t.offset
+	if t.offset == 0 && bytes.HasPrefix(text, utf8BOM) {
+		// A file written again from the start may begin with a byte order mark
+		text = text[len(utf8BOM):]
+		offset += int64(len(utf8BOM))
+	}
+	t.offset += int64(end)
+
+	logs := []*Log{}
+	for _, line := range bytes.Split(text[:len(text)-1], []byte("\n")) {
+		lineOffset := offset
+		if t.encoding != encodingUTF8 {
+			lineOffset = 0
+		}
+		offset += int64(len(line) + 1)
+		// Lines aren't numbered since the tail starts at the end of the file without counting them
+		if log := t.lines.parse(string(truncateLine(line, t.lines.maxLine)), 0, lineOffset); log != nil {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
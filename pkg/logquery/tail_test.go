@@ -0,0 +1,83 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTail(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	err := os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] already here\n"), 0644)
+	assert.NoError(err)
+
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{"app": path})
+	testQuery.pollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logs, err := testQuery.Tail(ctx, []string{"app"}, Warn)
+	assert.NoError(err)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(err)
+	_, err = file.WriteString("[02/28/2020 5:20:56.00][info] too low\n[02/28/2020 5:20:57.00][error] new error\n[02/28/2020 5:20:58")
+	assert.NoError(err)
+	file.Close()
+
+	select {
+	case log := <-logs:
+		assert.Equal("new error", log.Log)
+		assert.Equal(Error, log.Severity)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for tailed log")
+	}
+
+	cancel()
+	for range logs {
+	}
+}
+
+func TestTailErrors(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(os.WriteFile(path, []byte("[02/28/2020 5:20:55.17][info] already here\n"), 0644))
+
+	failed := make(chan string, 1)
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{"app": path}, WithTailErrors(func(path string, err error) {
+		select {
+		case failed <- path:
+		default:
+		}
+	}))
+	testQuery.pollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logs, err := testQuery.Tail(ctx, []string{"app"}, Debug)
+	assert.NoError(err)
+	assert.NoError(os.Remove(path))
+
+	select {
+	case failedPath := <-failed:
+		assert.Equal(path, failedPath)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the tail error")
+	}
+
+	cancel()
+	for range logs {
+	}
+}
+
+func TestTailUnknownKey(t *testing.T) {
+	assert := assert.New(t)
+	testQuery, _ := NewLogQuery(context.Background(), map[string]string{})
+	_, err := testQuery.Tail(context.Background(), []string{"missing"}, Debug)
+	assert.Error(err)
+}
@@ -0,0 +1,104 @@
+package logquery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseBracketTime parses the timestamp of the default format, like 02/28/2020 5:20:57.45. It is more
+// forgiving than logFormat: the fraction can have any number of digits up to nanoseconds or be left
+// out, hours go up to 23 and a 12-hour time can end in AM or PM. Every digit of the fraction is kept
+func parseBracketTime(s string) (time.Time, error) {
+	bad := fmt.Errorf("timestamp was not parseable")
+	// An AM or PM marker decides the half of the day for 12-hour times
+	pm, twelveHour := false, false
+	if upper := strings.ToUpper(s); strings.HasSuffix(upper, " AM") || strings.HasSuffix(upper, " PM") {
+		pm, twelveHour = strings.HasSuffix(upper, " PM"), true
+		s = s[:len(s)-3]
+	}
+
+	p := timeScanner{s: s, ok: true}
+	month := p.number('/')
+	day := p.number('/')
+	year := p.number(' ')
+	hour := p.number(':')
+	minute := p.number(':')
+	second := p.number('.')
+	nanos := 0
+	if p.sep == '.' {
+		nanos = p.fraction()
+	}
+	if !p.ok || p.i != len(s) || year < 1000 || month < 1 || month > 12 || day < 1 || minute > 59 || second > 59 {
+		return time.Time{}, bad
+	}
+	if twelveHour {
+		if hour < 1 || hour > 12 {
+			return time.Time{}, bad
+		}
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	} else if hour > 23 {
+		return time.Time{}, bad
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, nanos, time.UTC)
+	// time.Date moves days past the end of the month into the next one
+	if t.Day() != day {
+		return time.Time{}, bad
+	}
+	return t, nil
+}
+
+// timeScanner reads the numbers of a timestamp, ok is false once anything doesn't match
+type timeScanner struct {
+	s   string
+	i   int
+	ok  bool
+	sep byte
+}
+
+// number reads up to 4 digits followed by sep or the end of the string, which is left in p.sep
+func (p *timeScanner) number(sep byte) int {
+	if !p.ok {
+		return 0
+	}
+	n, digits := 0, 0
+	for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' && digits < 4 {
+		n = n*10 + int(p.s[p.i]-'0')
+		p.i++
+		digits++
+	}
+	p.sep = 0
+	if p.i < len(p.s) && p.s[p.i] == sep {
+		p.sep = sep
+		p.i++
+	} else if p.i < len(p.s) || sep != '.' {
+		// Only the seconds can end the timestamp
+		p.ok = false
+	}
+	if digits == 0 {
+		p.ok = false
+	}
+	return n
+}
+
+// fraction reads the digits after the seconds as nanoseconds, digits past nanoseconds are dropped
+func (p *timeScanner) fraction() int {
+	nanos, digits := 0, 0
+	for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+		if digits < 9 {
+			nanos = nanos*10 + int(p.s[p.i]-'0')
+		}
+		p.i++
+		digits++
+	}
+	if digits == 0 {
+		p.ok = false
+	}
+	for ; digits < 9; digits++ {
+		nanos *= 10
+	}
+	return nanos
+}
@@ -0,0 +1,45 @@
+package logquery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBracketTime(t *testing.T) {
+	assert := assert.New(t)
+	at := func(hour, minute, second, nanos int) time.Time {
+		return time.Date(2020, 2, 28, hour, minute, second, nanos, time.UTC)
+	}
+	for raw, expected := range map[string]time.Time{
+		"02/28/2020 5:20:57.45":         at(5, 20, 57, 450000000),
+		"02/28/2020 5:20:57":            at(5, 20, 57, 0),
+		"02/28/2020 5:20:57.123":        at(5, 20, 57, 123000000),
+		"02/28/2020 17:20:57.123456":    at(17, 20, 57, 123456000),
+		"02/28/2020 05:20:57.123456789": at(5, 20, 57, 123456789),
+		"02/28/2020 5:20:57.1234567891": at(5, 20, 57, 123456789),
+		"02/28/2020 0:00:00.0":          at(0, 0, 0, 0),
+		"02/28/2020 5:20:57.45 PM":      at(17, 20, 57, 450000000),
+		"02/28/2020 12:20:57 am":        at(0, 20, 57, 0),
+		"02/28/2020 12:20:57 PM":        at(12, 20, 57, 0),
+		"2/28/2020 5:20:57":             at(5, 20, 57, 0),
+	} {
+		parsed, err := parseBracketTime(raw)
+		assert.NoError(err, raw)
+		assert.Equal(expected, parsed, raw)
+	}
+	for _, raw := range []string{
+		"", "02/28/2020", "02/28/2020 24:00:00", "02/28/2020 13:00:00 PM", "02/30/2020 5:20:57",
+		"13/28/2020 5:20:57", "02/28/2020 5:60:00", "02/28/2020 5:20:57.", "02/28/2020 5:20:57.4x",
+		"02-28-2020 5:20:57", "02/28/2020 5:20",
+	} {
+		_, err := parseBracketTime(raw)
+		assert.Error(err, raw)
+	}
+
+	// Logs a few microseconds apart keep their order
+	first, _ := DefaultParser.Parse("[02/28/2020 17:20:57.000001][info] first")
+	second, _ := DefaultParser.Parse("[02/28/2020 17:20:57.000002][info] second")
+	assert.True(first.Time.Before(second.Time))
+}
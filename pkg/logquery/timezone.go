@@ -0,0 +1,44 @@
+package logquery
+
+import "time"
+
+// displayFormat is used when logs are converted to another time zone for display
+const displayFormat = "01/02/2006 15:04:05.000 MST"
+
+// WithLocation reads the timestamps of the file registered under key in loc instead of UTC. It is meant
+// for formats whose timestamps have no zone, the wall clock time the parser read is kept as is and
+// moved into loc
+func WithLocation(key string, loc *time.Location) Option {
+	return func(l *LogQuery) {
+		l.locations[key] = loc
+	}
+}
+
+// locationParser wraps a parser whose timestamps have no zone so they are read in loc
+type locationParser struct {
+	parser LineParser
+	loc    *time.Location
+}
+
+// Parse implements LineParser
+func (p *locationParser) Parse(raw string) (*Log, error) {
+	log, err := p.parser.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	t := log.Time
+	log.Time = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), p.loc)
+	return log, nil
+}
+
+// In returns a copy of the logs with their times converted to loc, so logs from servers in different
+// zones all display in one zone
+func (l Logs) In(loc *time.Location) Logs {
+	rv := make(Logs, len(l))
+	for i, log := range l {
+		log.Time = log.Time.In(loc)
+		log.TimeString = "[" + log.Time.Format(displayFormat) + "]"
+		rv[i] = log
+	}
+	return rv
+}
@@ -0,0 +1,40 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLocation(t *testing.T) {
+	assert := assert.New(t)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}, WithLocation("db", newYork))
+	assert.NoError(err)
+
+	// db_server is now 5 hours behind so all of server1 comes first
+	logs, err := testQuery.QueryLogs(context.Background(), WithKeys("server1", "db"))
+	assert.NoError(err)
+	assert.Equal(8, len(logs))
+	for i, log := range logs {
+		if i < 4 {
+			assert.Equal("server1", log.Key)
+		} else {
+			assert.Equal("db", log.Key)
+		}
+	}
+	assert.Equal(10, logs[4].Time.UTC().Hour())
+
+	utc := logs.In(time.UTC)
+	assert.Equal("[02/28/2020 10:20:55.370 UTC]", utc[4].TimeString)
+	assert.Equal("[02/28/2020 5:20:55.37]", logs[4].TimeString)
+}
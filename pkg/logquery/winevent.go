@@ -0,0 +1,141 @@
+package logquery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wineventScheme is the scheme of paths read from Windows event logs
+const wineventScheme = "winevent"
+
+// winEventScript prints every event of a log as a JSON line, oldest first so new events are appended.
+// An empty log isn't an error
+const winEventScript = `$ErrorActionPreference = 'Stop'
+[Console]::OutputEncoding = [Text.Encoding]::UTF8
+try {
+	Get-WinEvent -LogName '%s' -Oldest | ForEach-Object {
+		[pscustomobject]@{
+			time = $_.TimeCreated.ToUniversalTime().ToString('o'); level = $_.Level; provider = $_.ProviderName
+			id = $_.Id; record = $_.RecordId; machine = $_.MachineName; msg = $_.FormatDescription()
+		} | ConvertTo-Json -Compress
+	}
+} catch {
+	if ($_.FullyQualifiedErrorId -notlike 'NoMatchingEventsFound*') { throw }
+}`
+
+// WinEventSource reads Windows event logs like winevent://Application or winevent://System through
+// PowerShell's Get-WinEvent. Events are parsed by WinEventParser, so Windows hosts get the same queries,
+// merging and exports as log files
+type WinEventSource struct {
+	// Command is the PowerShell binary and defaults to powershell
+	Command string
+}
+
+var _ ParserSource = &WinEventSource{}
+
+// Parser implements ParserSource
+func (s *WinEventSource) Parser() LineParser {
+	return &WinEventParser{}
+}
+
+// Expand implements Source. Every path is a single log, patterns aren't supported
+func (s *WinEventSource) Expand(ctx context.Context, uri string) ([]string, bool, error) {
+	if logName(uri) == "" {
+		return nil, false, fmt.Errorf("%s has no log name, expected winevent://Application", uri)
+	}
+	return []string{uri}, false, nil
+}
+
+// Open implements Source. The size of a log's events isn't known until they are read, so it is 0
+func (s *WinEventSource) Open(ctx context.Context, uri string, from int64) (io.ReadCloser, int64, error) {
+	r, err := startCommand(s.command(ctx, uri), "Get-WinEvent", from)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s, %s", uri, err)
+	}
+	return r, 0, nil
+}
+
+// Size implements Source by reading every event of the log
+func (s *WinEventSource) Size(ctx context.Context, uri string) (int64, error) {
+	counter := &countingWriter{}
+	if err := runCommand(s.command(ctx, uri), "Get-WinEvent", counter); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// command returns the PowerShell command that prints the events of the log at uri
+func (s *WinEventSource) command(ctx context.Context, uri string) *exec.Cmd {
+	script := fmt.Sprintf(winEventScript, strings.ReplaceAll(logName(uri), "'", "''"))
+	return exec.CommandContext(ctx, stringOrDefault(s.Command, "powershell"), "-NoProfile", "-NonInteractive", "-Command", script)
+}
+
+// logName returns the event log name of a winevent:// path
+func logName(uri string) string {
+	return strings.TrimPrefix(uri, wineventScheme+"://")
+}
+
+// WinEventParser parses the events printed by WinEventSource. Levels map critical to Fatal, error,
+// warning and information to Error, Warn and Info and verbose to Debug. The provider, event id, record
+// number and machine are kept as fields
+type WinEventParser struct{}
+
+// winEventLevels are the names of the event levels, 0 is LogAlways which is shown as information
+var winEventLevels = []struct {
+	name  string
+	level LogLevel
+}{
+	{"information", Info}, {"critical", Fatal}, {"error", Error}, {"warning", Warn}, {"information", Info}, {"verbose", Debug},
+}
+
+// winEvent is a line printed by WinEventSource
+type winEvent struct {
+	Time     string  `json:"time"`
+	Level    *int    `json:"level"`
+	Provider string  `json:"provider"`
+	ID       int     `json:"id"`
+	Record   int64   `json:"record"`
+	Machine  string  `json:"machine"`
+	Msg      *string `json:"msg"`
+}
+
+// Parse implements LineParser
+func (p *WinEventParser) Parse(raw string) (*Log, error) {
+	event := winEvent{}
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		return nil, fmt.Errorf("log is not a json object")
+	}
+	t, err := time.Parse(time.RFC3339Nano, event.Time)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp was not parseable")
+	}
+	if event.Level == nil || *event.Level < 0 || *event.Level >= len(winEventLevels) {
+		return nil, fmt.Errorf("severity was not parseable")
+	}
+	level := winEventLevels[*event.Level]
+
+	// Events without a message for the current locale still say where they came from
+	msg := fmt.Sprintf("event %d", event.ID)
+	if event.Msg != nil {
+		msg = *event.Msg
+	}
+	return &Log{
+		Time:     t.UTC(),
+		Severity: level.level,
+		Log:      msg,
+		Fields: map[string]string{
+			"provider": event.Provider,
+			"event_id": strconv.Itoa(event.ID),
+			"record":   strconv.FormatInt(event.Record, 10),
+			"machine":  event.Machine,
+		},
+		TimeString:     "[" + event.Time + "]",
+		SeverityString: "[" + level.name + "]",
+	}, nil
+}
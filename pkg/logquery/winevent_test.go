@@ -0,0 +1,74 @@
+package logquery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWinEventParser(t *testing.T) {
+	assert := assert.New(t)
+	p := &WinEventParser{}
+
+	log, err := p.Parse(`{"time":"2020-02-28T05:20:57.2500000Z","level":2,"provider":"MSSQLSERVER","id":17058,"record":981,"machine":"db1","msg":"Could not open error log file"}`)
+	assert.NoError(err)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 57, 250000000, time.UTC), log.Time)
+	assert.Equal(Error, log.Severity)
+	assert.Equal("[error]", log.SeverityString)
+	assert.Equal("Could not open error log file", log.Log)
+	assert.Equal(map[string]string{"provider": "MSSQLSERVER", "event_id": "17058", "record": "981", "machine": "db1"}, log.Fields)
+
+	for level, want := range map[int]LogLevel{0: Info, 1: Fatal, 3: Warn, 4: Info, 5: Debug} {
+		log, err = p.Parse(`{"time":"2020-02-28T05:20:57Z","level":` + strconv.Itoa(level) + `,"id":7,"msg":null}`)
+		assert.NoError(err)
+		assert.Equal(want, log.Severity)
+		assert.Equal("event 7", log.Log)
+	}
+
+	for _, raw := range []string{"not json", `{"level":2}`, `{"time":"2020-02-28T05:20:57Z"}`, `{"time":"2020-02-28T05:20:57Z","level":9}`} {
+		_, err = p.Parse(raw)
+		assert.Error(err, raw)
+	}
+}
+
+func TestWinEventSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake powershell is a shell script")
+	}
+	assert := assert.New(t)
+	script := `#!/bin/sh
+case "$*" in
+*"-LogName 'Application'"*)
+	echo '{"time":"2020-02-28T05:20:55.0000000Z","level":4,"provider":"App","id":1,"record":1,"machine":"web1","msg":"started"}'
+	echo '{"time":"2020-02-28T05:20:56.5000000Z","level":2,"provider":"App","id":2,"record":2,"machine":"web1","msg":"crashed"}' ;;
+*)
+	echo "The specified channel could not be found." >&2
+	exit 1 ;;
+esac
+`
+	command := filepath.Join(t.TempDir(), "powershell")
+	assert.NoError(os.WriteFile(command, []byte(script), 0755))
+	source := WithSource(wineventScheme, &WinEventSource{Command: command})
+
+	testQuery, err := NewLogQuery(context.Background(), map[string]string{
+		"app": "winevent://Application",
+		"db":  "../../logs/db_server.log",
+	}, source)
+	assert.NoError(err)
+	logs, err := testQuery.QueryLogs(context.Background(), WithMinSeverity(Error))
+	assert.NoError(err)
+	assert.Equal("app", logs[0].Key)
+	assert.Equal("crashed", logs[0].Log)
+	assert.Equal("web1", logs[0].Fields["machine"])
+
+	_, err = NewLogQuery(context.Background(), map[string]string{"nope": "winevent://Nope"}, source)
+	assert.EqualError(err, "error loading logs, nope: Get-WinEvent failed, The specified channel could not be found.")
+	_, err = NewLogQuery(context.Background(), map[string]string{"empty": "winevent://"}, source)
+	assert.Error(err)
+}
@@ -0,0 +1,283 @@
+package logquery
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Log has one wire format so agents, exporters and other tools agree on it. In JSON it is a Record,
+// described by proto/logquery/v1/log.schema.json, and in protobuf the logquery.v1.Log message of
+// proto/logquery/v1/logquery.proto. The protobuf encoding is written by hand so the module doesn't need
+// to depend on the protobuf runtime
+
+// recordTimeFormat is the time shown for logs read back from a Record since the text they were written
+// with isn't in it
+const recordTimeFormat = "01/02/2006 15:04:05.000 MST"
+
+// Log returns the log a Record was made from. The time and level are shown in a standard format since the
+// text they were written with isn't kept, and levels that aren't known are Undefined
+func (r Record) Log() Log {
+	severity, _ := ParseLevel(r.Severity)
+	log := Log{
+		Time:       r.Time,
+		Severity:   severity,
+		Log:        r.Message,
+		Key:        r.Key,
+		Fields:     r.Fields,
+		Repeated:   r.Repeated,
+		Context:    r.Context,
+		Path:       r.Path,
+		LineNumber: r.Line,
+		Offset:     r.Offset,
+	}
+	if !r.Time.IsZero() {
+		log.TimeString = "[" + r.Time.Format(recordTimeFormat) + "]"
+	}
+	if severity != Undefined {
+		log.SeverityString = "[" + strings.ToLower(severity.String()) + "]"
+	}
+	return log
+}
+
+// MarshalJSON writes the log as its Record
+func (l Log) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.Record())
+}
+
+// UnmarshalJSON reads a log written as a Record
+func (l *Log) UnmarshalJSON(data []byte) error {
+	record := Record{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	*l = record.Log()
+	return nil
+}
+
+// Field numbers of logquery.v1.Log
+const (
+	protoTime           = 1
+	protoSeverity       = 2
+	protoMessage        = 3
+	protoKey            = 4
+	protoFields         = 5
+	protoTimeString     = 6
+	protoSeverityString = 7
+	protoRepeatCount    = 8
+	protoContext        = 9
+	protoPath           = 10
+	protoLine           = 11
+	protoOffset         = 12
+)
+
+// Protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// MarshalProto encodes the log as a logquery.v1.Log protobuf message. Fields are written in order with
+// map entries sorted by key, so the same log always encodes to the same bytes
+func (l Log) MarshalProto() []byte {
+	buf := []byte{}
+	if !l.Time.IsZero() {
+		timestamp := appendProtoVarint(nil, 1, uint64(l.Time.Unix()))
+		timestamp = appendProtoVarint(timestamp, 2, uint64(l.Time.Nanosecond()))
+		buf = appendProtoBytes(buf, protoTime, timestamp)
+	}
+	buf = appendProtoVarint(buf, protoSeverity, uint64(l.Severity))
+	buf = appendProtoBytes(buf, protoMessage, []byte(l.Log))
+	buf = appendProtoBytes(buf, protoKey, []byte(l.Key))
+	names := make([]string, 0, len(l.Fields))
+	for name := range l.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := appendProtoBytes(nil, 1, []byte(name))
+		entry = appendProtoBytes(entry, 2, []byte(l.Fields[name]))
+		// Entries are written even when empty so a field with an empty value isn't lost
+		buf = appendUvarint(buf, protoFields<<3|protoBytes)
+		buf = appendUvarint(buf, uint64(len(entry)))
+		buf = append(buf, entry...)
+	}
+	buf = appendProtoBytes(buf, protoTimeString, []byte(l.TimeString))
+	buf = appendProtoBytes(buf, protoSeverityString, []byte(l.SeverityString))
+	buf = appendProtoVarint(buf, protoRepeatCount, uint64(int64(l.Repeated)))
+	if l.Context {
+		buf = appendProtoVarint(buf, protoContext, 1)
+	}
+	buf = appendProtoBytes(buf, protoPath, []byte(l.Path))
+	buf = appendProtoVarint(buf, protoLine, uint64(int64(l.LineNumber)))
+	buf = appendProtoVarint(buf, protoOffset, uint64(l.Offset))
+	return buf
+}
+
+// UnmarshalProto decodes a logquery.v1.Log protobuf message, fields it doesn't know are skipped
+func UnmarshalProto(data []byte) (Log, error) {
+	log := Log{}
+	err := readProto(data, func(field protoField) error {
+		if want, ok := protoWireTypes[field.number]; ok && want != field.wireType {
+			return fmt.Errorf("field %d: wire type %d, expected %d", field.number, field.wireType, want)
+		}
+		switch field.number {
+		case protoTime:
+			var seconds, nanos int64
+			err := readProto(field.bytes, func(field protoField) error {
+				switch field.number {
+				case 1:
+					seconds = int64(field.varint)
+				case 2:
+					nanos = int64(int32(field.varint))
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("time: %w", err)
+			}
+			log.Time = time.Unix(seconds, nanos)
+		case protoSeverity:
+			log.Severity = LogLevel(int32(field.varint))
+		case protoMessage:
+			log.Log = string(field.bytes)
+		case protoKey:
+			log.Key = string(field.bytes)
+		case protoFields:
+			var name, value string
+			err := readProto(field.bytes, func(field protoField) error {
+				switch field.number {
+				case 1:
+					name = string(field.bytes)
+				case 2:
+					value = string(field.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("fields: %w", err)
+			}
+			if log.Fields == nil {
+				log.Fields = map[string]string{}
+			}
+			log.Fields[name] = value
+		case protoTimeString:
+			log.TimeString = string(field.bytes)
+		case protoSeverityString:
+			log.SeverityString = string(field.bytes)
+		case protoRepeatCount:
+			log.Repeated = int(int32(field.varint))
+		case protoContext:
+			log.Context = field.varint != 0
+		case protoPath:
+			log.Path = string(field.bytes)
+		case protoLine:
+			log.LineNumber = int(int64(field.varint))
+		case protoOffset:
+			log.Offset = int64(field.varint)
+		}
+		return nil
+	})
+	if err != nil {
+		return Log{}, fmt.Errorf("decoding protobuf log: %w", err)
+	}
+	return log, nil
+}
+
+// protoField is a field read from a protobuf message, varint holds the value of varint and fixed fields
+// and bytes the value of length delimited ones
+type protoField struct {
+	number   int
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+// protoWireTypes are the wire types the fields of logquery.v1.Log are written with
+var protoWireTypes = map[int]int{
+	protoTime:           protoBytes,
+	protoSeverity:       protoVarint,
+	protoMessage:        protoBytes,
+	protoKey:            protoBytes,
+	protoFields:         protoBytes,
+	protoTimeString:     protoBytes,
+	protoSeverityString: protoBytes,
+	protoRepeatCount:    protoVarint,
+	protoContext:        protoVarint,
+	protoPath:           protoBytes,
+	protoLine:           protoVarint,
+	protoOffset:         protoVarint,
+}
+
+// readProto calls fn with every field of a protobuf message in order
+func readProto(data []byte, fn func(field protoField) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("bad field tag")
+		}
+		data = data[n:]
+		field := protoField{number: int(tag >> 3), wireType: int(tag & 7)}
+		if field.number <= 0 || tag>>3 > math.MaxInt32 {
+			return fmt.Errorf("bad field number %d", tag>>3)
+		}
+		switch field.wireType {
+		case protoVarint:
+			if field.varint, n = binary.Uvarint(data); n <= 0 {
+				return fmt.Errorf("field %d: bad varint", field.number)
+			}
+			data = data[n:]
+		case protoFixed64, protoFixed32:
+			size := 8
+			if field.wireType == protoFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return fmt.Errorf("field %d: truncated", field.number)
+			}
+			if size == 8 {
+				field.varint = binary.LittleEndian.Uint64(data)
+			} else {
+				field.varint = uint64(binary.LittleEndian.Uint32(data))
+			}
+			data = data[size:]
+		case protoBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return fmt.Errorf("field %d: truncated", field.number)
+			}
+			field.bytes, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return fmt.Errorf("field %d: unsupported wire type %d", field.number, field.wireType)
+		}
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendProtoVarint appends a varint field, leaving it out when it is 0 like proto3 does
+func appendProtoVarint(buf []byte, number int, v uint64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendUvarint(buf, uint64(number)<<3|protoVarint)
+	return appendUvarint(buf, v)
+}
+
+// appendProtoBytes appends a length delimited field, leaving it out when it is empty like proto3 does
+func appendProtoBytes(buf []byte, number int, v []byte) []byte {
+	if len(v) == 0 {
+		return buf
+	}
+	buf = appendUvarint(buf, uint64(number)<<3|protoBytes)
+	buf = appendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
@@ -0,0 +1,108 @@
+package logquery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogJSON(t *testing.T) {
+	assert := assert.New(t)
+	log := Log{
+		Time: time.Date(2020, 2, 28, 5, 20, 55, 170000000, time.UTC), Severity: Warn, Log: "disk almost full", Key: "server1",
+		Fields: map[string]string{"disk": "/dev/sda"}, Repeated: 2, Path: "./logs/server1.log", LineNumber: 12, Offset: 830,
+		TimeString: "[02/28/2020 5:20:55.17]", SeverityString: "[warn]",
+	}
+	encoded, err := json.Marshal(log)
+	assert.NoError(err)
+	record, err := json.Marshal(log.Record())
+	assert.NoError(err)
+	assert.Equal(string(record), string(encoded))
+
+	decoded := Log{}
+	assert.NoError(json.Unmarshal(encoded, &decoded))
+	want := log
+	want.TimeString = "[02/28/2020 05:20:55.170 UTC]"
+	assert.Equal(want, decoded)
+
+	// Unknown levels are Undefined without a level shown
+	assert.NoError(json.Unmarshal([]byte(`{"time":"0001-01-01T00:00:00Z","key":"k","severity":"undefined","message":"  at main.go:12"}`), &decoded))
+	assert.Equal(Log{Key: "k", Log: "  at main.go:12"}, decoded)
+}
+
+func TestLogProto(t *testing.T) {
+	assert := assert.New(t)
+	// The bytes protoc generated code writes for the same message
+	log := Log{Severity: Warn, Log: "hi", Key: "api", Fields: map[string]string{"a": "b"}, LineNumber: 3}
+	golden := []byte{0x10, 0x03, 0x1a, 0x02, 'h', 'i', 0x22, 0x03, 'a', 'p', 'i', 0x2a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b', 0x58, 0x03}
+	assert.Equal(golden, log.MarshalProto())
+	decoded, err := UnmarshalProto(golden)
+	assert.NoError(err)
+	assert.Equal(log, decoded)
+
+	log = Log{
+		Time: time.Date(2020, 2, 28, 5, 20, 55, 170000000, time.UTC), Severity: Fatal, Log: "out of memory", Key: "server1",
+		Fields: map[string]string{"pid": "42", "empty": ""}, Repeated: 1, Context: true, Path: "./logs/server1.log",
+		LineNumber: 120000, Offset: 1 << 40, TimeString: "[02/28/2020 5:20:55.17]", SeverityString: "[fatal]",
+	}
+	decoded, err = UnmarshalProto(log.MarshalProto())
+	assert.NoError(err)
+	assert.True(log.Time.Equal(decoded.Time))
+	decoded.Time = log.Time
+	assert.Equal(log, decoded)
+	assert.Empty(Log{}.MarshalProto())
+
+	// Fields added to the message later are skipped
+	withUnknown := append(golden, 0xa8, 0x01, 0x07, 0x9d, 0x01, 1, 2, 3, 4)
+	decoded, err = UnmarshalProto(withUnknown)
+	assert.NoError(err)
+	assert.Equal("api", decoded.Key)
+
+	for name, bad := range map[string][]byte{
+		"truncated":       golden[:len(golden)-3],
+		"long length":     {0x1a, 0x05, 'h'},
+		"bad varint":      {0x10, 0xff},
+		"wrong wire type": {0x18, 0x01},
+		"field zero":      {0x00, 0x01},
+		"group":           {0x1b},
+	} {
+		_, err := UnmarshalProto(bad)
+		assert.Error(err, name)
+	}
+}
+
+func TestLogSchema(t *testing.T) {
+	assert := assert.New(t)
+	raw, err := ioutil.ReadFile("../../proto/logquery/v1/log.schema.json")
+	assert.NoError(err)
+	schema := struct {
+		Required   []string
+		Properties map[string]json.RawMessage
+	}{}
+	assert.NoError(json.Unmarshal(raw, &schema))
+
+	// The schema describes every field of Record and only those
+	properties, required := []string{}, []string{}
+	recordType := reflect.TypeOf(Record{})
+	for i := 0; i < recordType.NumField(); i++ {
+		tag := strings.Split(recordType.Field(i).Tag.Get("json"), ",")
+		properties = append(properties, tag[0])
+		if len(tag) == 1 {
+			required = append(required, tag[0])
+		}
+	}
+	names := []string{}
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(properties)
+	assert.Equal(properties, names)
+	assert.ElementsMatch(required, schema.Required)
+}
@@ -0,0 +1,115 @@
+package logsql
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// formatRows returns the rows of result as text
+func formatRows(result *Result) [][]string {
+	rows := [][]string{}
+	for _, row := range result.Rows {
+		formatted := make([]string, len(row))
+		for i, v := range row {
+			formatted[i] = Format(v)
+		}
+		rows = append(rows, formatted)
+	}
+	return rows
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.json")
+	assert.NoError(os.WriteFile(path, []byte(`{"ts":"2020-02-28T05:20:55Z","level":"info","msg":"login","user":"alice"}
+{"ts":"2020-02-28T05:20:56Z","level":"error","msg":"timeout talking to db","user":"bob"}
+{"ts":"2020-02-28T05:20:58Z","level":"error","msg":"timeout talking to cache","user":"alice"}
+{"ts":"2020-02-28T05:20:59Z","level":"info","msg":"logout"}
+`), 0644))
+	l, err := logquery.NewLogQuery(ctx, map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+		"app":     path,
+	}, logquery.WithParser("app", &logquery.JSONParser{}))
+	assert.NoError(err)
+
+	run := func(statement string) [][]string {
+		stmt, err := Parse(statement)
+		if !assert.NoError(err, statement) {
+			return nil
+		}
+		result, err := stmt.Run(ctx, l)
+		if !assert.NoError(err, statement) {
+			return nil
+		}
+		return formatRows(result)
+	}
+
+	assert.Equal([][]string{{"app", "2"}, {"server1", "2"}}, run(`SELECT key, count(*) FROM logs WHERE level >= 'error' GROUP BY key`))
+	assert.Equal([][]string{{"info", "5"}, {"error", "3"}, {"warn", "3"}}, run(
+		`select level, COUNT(*) as n from logs where level <= 'error' group by level order by n desc, level desc`))
+	assert.Equal([][]string{{"db", "warn", "Rejecting request: No such database. "}}, run(
+		`SELECT key, level, message FROM logs WHERE key IN ('db', 'api') AND message LIKE '%No such%'`))
+	assert.Equal([][]string{{"2020-02-28T05:20:55Z", "app", "info", "login"}}, run(`SELECT * FROM logs WHERE key = 'app' LIMIT 1;`))
+	assert.Equal([][]string{{"timeout talking to cache"}, {"timeout talking to db"}}, run(
+		`SELECT message FROM logs WHERE message LIKE 'timeout%' ORDER BY 1`))
+
+	// Missing fields are their own group and aren't counted
+	assert.Equal([][]string{{"", "0", "2020-02-28T05:20:59Z"}, {"alice", "2", "2020-02-28T05:20:58Z"}, {"bob", "1", "2020-02-28T05:20:56Z"}}, run(
+		`SELECT fields.user, count(fields.user), max(time) FROM logs WHERE key = 'app' GROUP BY fields.user`))
+	assert.Equal([][]string{{"alice"}}, run(`SELECT fields.user FROM logs WHERE fields.user LIKE 'a%' AND time > '2020-02-28T05:20:57Z'`))
+	// Inclusive bounds take in the logs stamped exactly at them
+	assert.Equal([][]string{{"bob"}, {"alice"}}, run(
+		`SELECT fields.user FROM logs WHERE key = 'app' AND time >= '2020-02-28T05:20:56Z' AND time <= '2020-02-28T05:20:58Z'`))
+	assert.Equal([][]string{}, run(
+		`SELECT fields.user FROM logs WHERE key = 'app' AND time > '2020-02-28T05:20:56Z' AND time < '2020-02-28T05:20:58Z'`))
+	assert.Equal([][]string{{"0", ""}}, run(`SELECT count(*), min(level) FROM logs WHERE key = 'nothing'`))
+	assert.Equal([][]string{{"info", "fatal"}}, run(`SELECT min(level), max(level) FROM logs WHERE key = 'server1'`))
+
+	stmt, _ := Parse(`SELECT key, count(*) AS logs FROM logs GROUP BY key ORDER BY logs DESC, key LIMIT 2`)
+	assert.Equal([]string{"key", "logs"}, stmt.Columns())
+	result, err := stmt.Run(ctx, l)
+	assert.NoError(err)
+	assert.Equal([]interface{}{"app", int64(4)}, result.Rows[0])
+	assert.Equal(2, len(result.Rows))
+
+	stmt, _ = Parse(`SELECT time, level FROM logs WHERE key = 'server1' ORDER BY time DESC LIMIT 1`)
+	result, _ = stmt.Run(ctx, l)
+	assert.Equal([]interface{}{time.Date(2020, 2, 28, 5, 20, 57, 450000000, time.UTC), logquery.Fatal}, result.Rows[0])
+}
+
+func TestParseErrors(t *testing.T) {
+	assert := assert.New(t)
+	for statement, msg := range map[string]string{
+		"DELETE FROM logs":                                               `expected SELECT, got "DELETE" at column 1`,
+		"SELECT key FROM events":                                         `unknown table "events", the only table is logs at column 17`,
+		"SELECT host FROM logs":                                          `unknown column "host", expected time, key, level, message or fields.<name> at column 8`,
+		"SELECT avg(time) FROM logs":                                     `unknown function "avg", expected count, min or max at column 8`,
+		"SELECT key, count(*) FROM logs":                                 "key has to be in GROUP BY or in an aggregate like count(*)",
+		"SELECT * FROM logs WHERE level >= 'warn' OR key = 'a'":          "only AND is supported between conditions at column 42",
+		"SELECT * FROM logs WHERE level != 'warn'":                       `expected >= or > or <= or < or =, got "!=" at column 32`,
+		"SELECT * FROM logs WHERE level >= warn":                         `expected a quoted string, got "warn" at column 35`,
+		"SELECT * FROM logs WHERE level >= 'loud'":                       `unknown level "loud" at column 35`,
+		"SELECT * FROM logs WHERE message = 'a":                          "unterminated string at column 36",
+		"SELECT * FROM logs WHERE message LIKE 'a' AND message LIKE 'b'": "message can only be compared once at column 55",
+		"SELECT * FROM logs WHERE time >= 'yesterday'":                   "time must be RFC3339 like '2020-02-28T05:20:00Z' at column 34",
+		"SELECT key FROM logs ORDER BY message":                          `ORDER BY message isn't in the select list at column 31`,
+		"SELECT key FROM logs ORDER BY 2":                                "ORDER BY position 2 isn't in the select list at column 31",
+		"SELECT key FROM logs WHERE":                                     "expected a column, got end of statement at column 27",
+		"SELECT key FROM logs LIMIT 0":                                   `LIMIT takes a positive number, got "0" at column 28`,
+		"SELECT key FROM logs LIMIT 5 key":                               `unexpected "key" at column 30`,
+		"SELECT * FROM logs WHERE level >= 'error' AND level <= 'warn'":  "the lowest level must be at or below the highest level",
+	} {
+		_, err := Parse(statement)
+		if assert.Error(err, statement) {
+			assert.Equal(msg, err.Error(), statement)
+		}
+	}
+}
@@ -0,0 +1,700 @@
+// Package logsql runs a small read only subset of SQL over the logs of a logquery.LogQuery, for people
+// who think in SQL rather than in query flags
+//
+//	SELECT key, count(*) FROM logs WHERE level >= 'error' GROUP BY key ORDER BY count(*) DESC LIMIT 5
+//
+// There is one table, logs, with the columns time, key, level, message and fields.<name> for each
+// structured field. The select list takes columns, * and the aggregates count(*), count(column),
+// min(column) and max(column), with an optional AS name. WHERE takes conditions joined with AND
+//
+//	level >= 'warn'                        any of =, >=, >, <= and < on a level
+//	key = 'db', key IN ('db', 'api')       keys to query, patterns like 'web-*' work too
+//	message LIKE '%timeout%'               % is any text and _ any single character
+//	message = 'connection refused'         the whole message
+//	fields.user = 'alice'                  = and LIKE on a structured field
+//	time >= '2020-02-28T05:20:00Z'         RFC3339 start with > or >=, end with < or <=
+//
+// The conditions become logquery.QueryOptions, so filtering works like any other query. GROUP BY,
+// ORDER BY and LIMIT are done in memory on the matching logs
+package logsql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// SyntaxError is a statement that couldn't be parsed
+type SyntaxError struct {
+	// Pos is the byte offset of the problem in the statement
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Pos+1)
+}
+
+// Statement is a parsed SELECT, see Parse
+type Statement struct {
+	items   []selectItem
+	opts    logquery.QueryOptions
+	groupBy []string
+	orderBy []orderItem
+	limit   int
+	// grouped is set when the statement has aggregates or a GROUP BY, so it returns a row per group
+	// rather than per log
+	grouped bool
+}
+
+// expr is a column like key or an aggregate like count(*), fn is empty for a column and column is
+// empty for count(*)
+type expr struct {
+	fn     string
+	column string
+}
+
+func (e expr) String() string {
+	if e.fn == "" {
+		return e.column
+	}
+	if e.column == "" {
+		return e.fn + "(*)"
+	}
+	return e.fn + "(" + e.column + ")"
+}
+
+type selectItem struct {
+	expr
+	name string
+}
+
+// orderItem sorts on the output column at index
+type orderItem struct {
+	index      int
+	descending bool
+}
+
+// columns are the columns of the logs table besides fields.<name>
+var columns = []string{"time", "key", "level", "message"}
+
+// Parse parses a SELECT statement over the logs table
+func Parse(statement string) (*Statement, error) {
+	tokens, err := lex(statement)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, stmt: &Statement{}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	o := p.stmt.opts
+	if !o.Start.IsZero() && !o.End.IsZero() && !o.Start.Before(o.End) {
+		return nil, fmt.Errorf("the start time must be before the end time")
+	}
+	if o.MaxSeverity != logquery.Undefined && o.MinSeverity > o.MaxSeverity {
+		return nil, fmt.Errorf("the lowest level must be at or below the highest level")
+	}
+	return p.stmt, nil
+}
+
+// Columns returns the names of the columns the statement returns
+func (s *Statement) Columns() []string {
+	names := make([]string, len(s.items))
+	for i, item := range s.items {
+		names[i] = item.name
+	}
+	return names
+}
+
+// Options returns the filters of the WHERE clause
+func (s *Statement) Options() logquery.QueryOptions {
+	return s.opts
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokStar
+	tokSemicolon
+)
+
+type token struct {
+	kind tokenKind
+	// text is the word, operator or unquoted string
+	text string
+	pos  int
+}
+
+// describe names the token for error messages
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return "end of statement"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lex splits statement into tokens. Strings are single quoted, a quote inside one is written twice
+func lex(statement string) ([]token, error) {
+	tokens := []token{}
+	single := map[byte]tokenKind{'(': tokLParen, ')': tokRParen, ',': tokComma, '*': tokStar, ';': tokSemicolon}
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case single[c] != tokEOF:
+			tokens = append(tokens, token{kind: single[c], text: string(c), pos: i})
+			i++
+		case c == '<' || c == '>' || c == '=' || c == '!':
+			op := string(c)
+			if i+1 < len(statement) && (statement[i+1] == '=' || c == '<' && statement[i+1] == '>') {
+				op += string(statement[i+1])
+			}
+			if op == "!" {
+				return nil, &SyntaxError{Pos: i, Msg: "expected !="}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		case c == '\'':
+			text := strings.Builder{}
+			end := i + 1
+			for ; ; end++ {
+				if end >= len(statement) {
+					return nil, &SyntaxError{Pos: i, Msg: "unterminated string"}
+				}
+				if statement[end] == '\'' {
+					if end+1 < len(statement) && statement[end+1] == '\'' {
+						text.WriteByte('\'')
+						end++
+						continue
+					}
+					break
+				}
+				text.WriteByte(statement[end])
+			}
+			tokens = append(tokens, token{kind: tokString, text: text.String(), pos: i})
+			i = end + 1
+		default:
+			start := i
+			for i < len(statement) && !strings.ContainsRune(" \t\n\r(),*;<>=!'", rune(statement[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokWord, text: statement[start:i], pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(statement)}), nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	stmt   *Statement
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// isKeyword returns true if t is the case insensitive word keyword
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+// keyword reads the words of keywords, like GROUP BY
+func (p *parser) keyword(keywords ...string) error {
+	for _, keyword := range keywords {
+		if t := p.next(); !isKeyword(t, keyword) {
+			return errorAt(t, "expected %s, got %s", strings.ToUpper(keyword), t.describe())
+		}
+	}
+	return nil
+}
+
+func errorAt(t token, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parse reads SELECT ... FROM logs and the optional clauses in order
+func (p *parser) parse() error {
+	if err := p.keyword("select"); err != nil {
+		return err
+	}
+	if err := p.selectList(); err != nil {
+		return err
+	}
+	if err := p.keyword("from"); err != nil {
+		return err
+	}
+	if t := p.next(); !isKeyword(t, "logs") {
+		return errorAt(t, "unknown table %s, the only table is logs", t.describe())
+	}
+	if isKeyword(p.peek(), "where") {
+		p.next()
+		if err := p.where(); err != nil {
+			return err
+		}
+	}
+	if isKeyword(p.peek(), "group") {
+		p.next()
+		if err := p.group(); err != nil {
+			return err
+		}
+	}
+	if err := p.checkGroups(); err != nil {
+		return err
+	}
+	if isKeyword(p.peek(), "order") {
+		p.next()
+		if err := p.order(); err != nil {
+			return err
+		}
+	}
+	if isKeyword(p.peek(), "limit") {
+		p.next()
+		t := p.next()
+		limit, err := strconv.Atoi(t.text)
+		if t.kind != tokWord || err != nil || limit <= 0 {
+			return errorAt(t, "LIMIT takes a positive number, got %s", t.describe())
+		}
+		p.stmt.limit = limit
+	}
+	if p.peek().kind == tokSemicolon {
+		p.next()
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return errorAt(t, "unexpected %s", t.describe())
+	}
+	return nil
+}
+
+func (p *parser) selectList() error {
+	for {
+		if t := p.peek(); t.kind == tokStar {
+			p.next()
+			for _, column := range columns {
+				p.stmt.items = append(p.stmt.items, selectItem{expr: expr{column: column}, name: column})
+			}
+		} else {
+			e, err := p.expr()
+			if err != nil {
+				return err
+			}
+			item := selectItem{expr: e, name: e.String()}
+			if isKeyword(p.peek(), "as") {
+				p.next()
+				alias := p.next()
+				if alias.kind != tokWord {
+					return errorAt(alias, "expected a name after AS, got %s", alias.describe())
+				}
+				item.name = alias.text
+			}
+			if e.fn != "" {
+				p.stmt.grouped = true
+			}
+			p.stmt.items = append(p.stmt.items, item)
+		}
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// expr reads a column or an aggregate of one
+func (p *parser) expr() (expr, error) {
+	t := p.next()
+	fn := strings.ToLower(t.text)
+	if t.kind != tokWord || p.peek().kind != tokLParen {
+		column, err := columnName(t)
+		return expr{column: column}, err
+	}
+	if fn != "count" && fn != "min" && fn != "max" {
+		return expr{}, errorAt(t, "unknown function %s, expected count, min or max", t.describe())
+	}
+	p.next()
+	e := expr{fn: fn}
+	if arg := p.next(); arg.kind == tokStar && fn == "count" {
+		e.column = ""
+	} else {
+		column, err := columnName(arg)
+		if err != nil {
+			return expr{}, err
+		}
+		e.column = column
+	}
+	if t := p.next(); t.kind != tokRParen {
+		return expr{}, errorAt(t, "expected ), got %s", t.describe())
+	}
+	return e, nil
+}
+
+// columnName returns the name of the column t refers to, column names are case insensitive but field
+// names aren't
+func columnName(t token) (string, error) {
+	if t.kind != tokWord {
+		return "", errorAt(t, "expected a column, got %s", t.describe())
+	}
+	for _, column := range columns {
+		if strings.EqualFold(t.text, column) {
+			return column, nil
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(t.text), "fields.") && len(t.text) > len("fields.") {
+		return "fields." + t.text[len("fields."):], nil
+	}
+	return "", errorAt(t, "unknown column %s, expected time, key, level, message or fields.<name>", t.describe())
+}
+
+// where reads conditions joined with AND
+func (p *parser) where() error {
+	for {
+		if err := p.condition(); err != nil {
+			return err
+		}
+		t := p.peek()
+		if isKeyword(t, "or") || isKeyword(t, "not") {
+			return errorAt(t, "only AND is supported between conditions")
+		}
+		if !isKeyword(t, "and") {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// op reads an operator that has to be one of ops, LIKE and IN included
+func (p *parser) op(ops ...string) (token, error) {
+	t := p.next()
+	if t.kind == tokOp || t.kind == tokWord {
+		for _, op := range ops {
+			if strings.EqualFold(t.text, op) {
+				t.text = op
+				return t, nil
+			}
+		}
+	}
+	return t, errorAt(t, "expected %s, got %s", strings.Join(ops, " or "), t.describe())
+}
+
+// value reads a string
+func (p *parser) value() (token, error) {
+	t := p.next()
+	if t.kind != tokString {
+		return t, errorAt(t, "expected a quoted string, got %s", t.describe())
+	}
+	return t, nil
+}
+
+func (p *parser) condition() error {
+	name := p.next()
+	column, err := columnName(name)
+	if err != nil {
+		return err
+	}
+	switch column {
+	case "level":
+		return p.level()
+	case "key":
+		return p.keys()
+	case "message":
+		return p.message()
+	case "time":
+		return p.timeBound()
+	}
+	return p.field(column[len("fields."):])
+}
+
+func (p *parser) level() error {
+	op, err := p.op(">=", ">", "<=", "<", "=")
+	if err != nil {
+		return err
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	level, err := logquery.ParseLevel(value.text)
+	if err != nil {
+		return errorAt(value, "%s", err)
+	}
+	min, max := level, level
+	switch op.text {
+	case ">":
+		min++
+	case "<":
+		max--
+	}
+	if op.text == "<" && max == logquery.Undefined {
+		return errorAt(value, "no level is below %s", strings.ToLower(level.String()))
+	}
+	o := &p.stmt.opts
+	// Conditions are ANDed so the highest lowest level and the lowest highest level win
+	if op.text != "<=" && op.text != "<" && min > o.MinSeverity {
+		o.MinSeverity = min
+	}
+	if op.text != ">=" && op.text != ">" && (o.MaxSeverity == logquery.Undefined || max < o.MaxSeverity) {
+		o.MaxSeverity = max
+	}
+	return nil
+}
+
+func (p *parser) keys() error {
+	op, err := p.op("=", "in")
+	if err != nil {
+		return err
+	}
+	keys := []string{}
+	if op.text == "=" {
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, value.text)
+	} else {
+		if keys, err = p.list(); err != nil {
+			return err
+		}
+	}
+
+	o := &p.stmt.opts
+	if o.Keys == nil {
+		o.Keys = keys
+		return nil
+	}
+	// A second key condition narrows the keys down to the ones in both
+	in := map[string]bool{}
+	for _, key := range keys {
+		in[key] = true
+	}
+	both := []string{}
+	for _, key := range o.Keys {
+		if in[key] {
+			both = append(both, key)
+		}
+	}
+	o.Keys = both
+	return nil
+}
+
+// list reads a parenthesized list of strings
+func (p *parser) list() ([]string, error) {
+	if t := p.next(); t.kind != tokLParen {
+		return nil, errorAt(t, "expected (, got %s", t.describe())
+	}
+	values := []string{}
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value.text)
+		t := p.next()
+		if t.kind == tokRParen {
+			return values, nil
+		}
+		if t.kind != tokComma {
+			return nil, errorAt(t, "expected , or ), got %s", t.describe())
+		}
+	}
+}
+
+func (p *parser) message() error {
+	op, err := p.op("=", "like")
+	if err != nil {
+		return err
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	o := &p.stmt.opts
+	if o.Message != nil {
+		return errorAt(op, "message can only be compared once")
+	}
+	o.Message = &logquery.MessageFilter{Pattern: pattern(op.text, value.text)}
+	return nil
+}
+
+// pattern returns the regular expression matching the whole of value with = or LIKE
+func pattern(op, value string) *regexp.Regexp {
+	if op == "=" {
+		return regexp.MustCompile(`^` + regexp.QuoteMeta(value) + `$`)
+	}
+	b := strings.Builder{}
+	b.WriteString(`(?s)^`)
+	for _, r := range value {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString(`$`)
+	return regexp.MustCompile(b.String())
+}
+
+func (p *parser) timeBound() error {
+	op, err := p.op(">=", ">", "<=", "<")
+	if err != nil {
+		return err
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339, value.text)
+	if err != nil {
+		return errorAt(value, "time must be RFC3339 like '2020-02-28T05:20:00Z'")
+	}
+	// Queries leave out logs at their start and end times, so the inclusive bounds move out by a nanosecond
+	switch op.text {
+	case ">=":
+		t = t.Add(-time.Nanosecond)
+	case "<=":
+		t = t.Add(time.Nanosecond)
+	}
+	o := &p.stmt.opts
+	if strings.HasPrefix(op.text, ">") {
+		if t.After(o.Start) {
+			o.Start = t
+		}
+	} else if o.End.IsZero() || t.Before(o.End) {
+		o.End = t
+	}
+	return nil
+}
+
+func (p *parser) field(name string) error {
+	op, err := p.op("=", "like")
+	if err != nil {
+		return err
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	filter := logquery.FieldFilter{Name: name, Value: value.text}
+	if op.text == "like" {
+		filter.Pattern = pattern(op.text, value.text)
+	}
+	p.stmt.opts.Fields = append(p.stmt.opts.Fields, filter)
+	return nil
+}
+
+// group reads the columns of GROUP BY
+func (p *parser) group() error {
+	if err := p.keyword("by"); err != nil {
+		return err
+	}
+	p.stmt.grouped = true
+	for {
+		column, err := columnName(p.next())
+		if err != nil {
+			return err
+		}
+		p.stmt.groupBy = append(p.stmt.groupBy, column)
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// checkGroups makes sure every column selected by a grouped statement is one it groups by
+func (p *parser) checkGroups() error {
+	if !p.stmt.grouped {
+		return nil
+	}
+	grouped := map[string]bool{}
+	for _, column := range p.stmt.groupBy {
+		grouped[column] = true
+	}
+	for _, item := range p.stmt.items {
+		if item.fn == "" && !grouped[item.column] {
+			return fmt.Errorf("%s has to be in GROUP BY or in an aggregate like count(*)", item.column)
+		}
+	}
+	return nil
+}
+
+// order reads ORDER BY items, each naming an output column by name, expression or position
+func (p *parser) order() error {
+	if err := p.keyword("by"); err != nil {
+		return err
+	}
+	for {
+		t := p.peek()
+		index := -1
+		if position, err := strconv.Atoi(t.text); t.kind == tokWord && err == nil {
+			p.next()
+			if position < 1 || position > len(p.stmt.items) {
+				return errorAt(t, "ORDER BY position %d isn't in the select list", position)
+			}
+			index = position - 1
+		} else if index = p.alias(t); index != -1 {
+			p.next()
+		} else {
+			e, err := p.expr()
+			if err != nil {
+				return err
+			}
+			for i, item := range p.stmt.items {
+				if item.expr == e {
+					index = i
+					break
+				}
+			}
+			if index == -1 {
+				return errorAt(t, "ORDER BY %s isn't in the select list", e)
+			}
+		}
+		item := orderItem{index: index}
+		if isKeyword(p.peek(), "desc") {
+			p.next()
+			item.descending = true
+		} else if isKeyword(p.peek(), "asc") {
+			p.next()
+		}
+		p.stmt.orderBy = append(p.stmt.orderBy, item)
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// alias returns the index of the output column named t, or -1
+func (p *parser) alias(t token) int {
+	if t.kind != tokWord || p.tokens[p.i+1].kind == tokLParen {
+		return -1
+	}
+	for i, item := range p.stmt.items {
+		if strings.EqualFold(item.name, t.text) {
+			return i
+		}
+	}
+	return -1
+}
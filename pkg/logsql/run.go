@@ -0,0 +1,243 @@
+package logsql
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// Result is the table a statement returns. Values are a time.Time for time, a logquery.LogLevel for
+// level, an int64 for count, a string for the other columns and nil for a missing field
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Run runs the statement over the logs of l. Like QueryLogs keys that failed to load are reported as a
+// *logquery.LoadError along with the result of the other keys
+func (s *Statement) Run(ctx context.Context, l *logquery.LogQuery) (*Result, error) {
+	opts := s.opts
+	if !s.grouped && len(s.orderBy) == 0 {
+		// Logs come in time order so the first ones are the result
+		opts.TotalLimit = s.limit
+	}
+	it := l.Iter(ctx, logquery.WithOptions(opts))
+	defer it.Close()
+	result := &Result{Columns: s.Columns()}
+	groups := map[string]*group{}
+	for it.Next() {
+		log := it.Log()
+		if !s.grouped {
+			row := make([]interface{}, len(s.items))
+			for i, item := range s.items {
+				row[i] = value(log, item.column)
+			}
+			result.Rows = append(result.Rows, row)
+			continue
+		}
+		s.groupOf(groups, log).add(s.items, log)
+	}
+	err := it.Err()
+	if _, ok := err.(*logquery.LoadError); err != nil && !ok {
+		return nil, err
+	}
+	if s.grouped {
+		result.Rows = s.groupRows(groups)
+	}
+	s.sort(result.Rows)
+	if s.limit > 0 && len(result.Rows) > s.limit {
+		result.Rows = result.Rows[:s.limit]
+	}
+	return result, err
+}
+
+// value returns column of log
+func value(log logquery.Log, column string) interface{} {
+	switch column {
+	case "time":
+		return log.Time
+	case "key":
+		return log.Key
+	case "level":
+		return log.Severity
+	case "message":
+		return log.Log
+	}
+	if v, ok := log.Fields[column[len("fields."):]]; ok {
+		return v
+	}
+	return nil
+}
+
+// group is the logs with the same values of the GROUP BY columns, keys. values holds its row so far,
+// the grouped columns and the aggregates
+type group struct {
+	keys   []interface{}
+	values []interface{}
+}
+
+// groupOf returns the group of log, adding it to groups if it's new
+func (s *Statement) groupOf(groups map[string]*group, log logquery.Log) *group {
+	keys := make([]interface{}, len(s.groupBy))
+	b := strings.Builder{}
+	for i, column := range s.groupBy {
+		keys[i] = value(log, column)
+		// A missing field isn't the same group as an empty one
+		if keys[i] == nil {
+			b.WriteByte(1)
+		} else {
+			b.WriteString(Format(keys[i]))
+		}
+		b.WriteByte(0)
+	}
+	g, ok := groups[b.String()]
+	if !ok {
+		g = &group{keys: keys, values: make([]interface{}, len(s.items))}
+		for i, item := range s.items {
+			switch {
+			case item.fn == "":
+				g.values[i] = value(log, item.column)
+			case item.fn == "count":
+				g.values[i] = int64(0)
+			}
+		}
+		groups[b.String()] = g
+	}
+	return g
+}
+
+// add folds log into the aggregates of the group
+func (g *group) add(items []selectItem, log logquery.Log) {
+	for i, item := range items {
+		if item.fn == "" {
+			continue
+		}
+		var v interface{}
+		if item.column != "" {
+			if v = value(log, item.column); v == nil {
+				continue
+			}
+		}
+		switch item.fn {
+		case "count":
+			g.values[i] = g.values[i].(int64) + 1
+		case "min":
+			if g.values[i] == nil || compare(v, g.values[i]) < 0 {
+				g.values[i] = v
+			}
+		case "max":
+			if g.values[i] == nil || compare(v, g.values[i]) > 0 {
+				g.values[i] = v
+			}
+		}
+	}
+}
+
+// groupRows returns a row per group sorted by the grouped columns. Aggregates without a GROUP BY return
+// a single row even when no log matched, like count(*) being 0
+func (s *Statement) groupRows(groups map[string]*group) [][]interface{} {
+	if len(groups) == 0 && len(s.groupBy) == 0 {
+		row := make([]interface{}, len(s.items))
+		for i, item := range s.items {
+			if item.fn == "count" {
+				row[i] = int64(0)
+			}
+		}
+		return [][]interface{}{row}
+	}
+	sorted := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		for k := range s.groupBy {
+			if c := compare(sorted[i].keys[k], sorted[j].keys[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	rows := make([][]interface{}, len(sorted))
+	for i, g := range sorted {
+		rows[i] = g.values
+	}
+	return rows
+}
+
+// sort orders rows by ORDER BY, keeping the order they are in for ties
+func (s *Statement) sort(rows [][]interface{}) {
+	if len(s.orderBy) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, item := range s.orderBy {
+			c := compare(rows[i][item.index], rows[j][item.index])
+			if item.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// compare returns -1, 0 or 1 as a is before, the same as or after b. nil is before everything
+func compare(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+	switch a := a.(type) {
+	case time.Time:
+		b := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case logquery.LogLevel:
+		return compareInt(int64(a), int64(b.(logquery.LogLevel)))
+	case int64:
+		return compareInt(a, b.(int64))
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Format returns a value of a Result as text, times are RFC3339 and levels lowercase like in the
+// ndjson output. nil is an empty string
+func Format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case logquery.LogLevel:
+		return strings.ToLower(v.String())
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return v.(string)
+}
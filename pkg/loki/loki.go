@@ -0,0 +1,124 @@
+// Package loki forwards parsed logs to Grafana Loki's push API, so logs in formats Loki's agents can't
+// parse can still be shipped to it
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// pushPath is where Loki accepts logs
+const pushPath = "/loki/api/v1/push"
+
+// Client pushes logs to Loki. Every log is sent with its key and severity as the key and severity
+// labels, so each key and severity is its own Loki stream
+type Client struct {
+	// URL is the base url of Loki like http://loki:3100
+	URL string
+	// Labels are added to every stream, like job=legacy
+	Labels map[string]string
+	// TenantID is sent as X-Scope-OrgID when Loki runs with multiple tenants
+	TenantID string
+	// HTTPClient is used for requests, nil means http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// pushRequest is the JSON body of a push
+type pushRequest struct {
+	Streams []stream `json:"streams"`
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are pairs of unix nanosecond timestamp and line
+	Values [][2]string `json:"values"`
+}
+
+// Push sends logs to Loki in one request
+func (c *Client) Push(ctx context.Context, logs []logquery.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(c.pushRequest(logs))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+pushPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.TenantID)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		// Loki explains rejected pushes in plain text, like entries that are too old
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("loki push failed with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// pushRequest groups logs into a stream per key and severity, keeping the order of the logs
+func (c *Client) pushRequest(logs []logquery.Log) pushRequest {
+	streams := map[string]*stream{}
+	for _, log := range logs {
+		severity := strings.ToLower(log.Severity.String())
+		id := log.Key + "\x00" + severity
+		s, ok := streams[id]
+		if !ok {
+			labels := map[string]string{}
+			for name, value := range c.Labels {
+				labels[name] = value
+			}
+			labels["key"], labels["severity"] = log.Key, severity
+			s = &stream{Stream: labels}
+			streams[id] = s
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(log.Time.UnixNano(), 10), log.Log})
+	}
+
+	ids := []string{}
+	for id := range streams {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	rv := pushRequest{Streams: make([]stream, len(ids))}
+	for i, id := range ids {
+		rv.Streams[i] = *streams[id]
+	}
+	return rv
+}
+
+// Ship pushes every log from logs until the channel is closed. Logs are sent in batches of up to
+// batchSize, and a partial batch is sent once it has waited for interval so a quiet file still shows
+// up in Loki promptly. It stops at the first failed push
+func (c *Client) Ship(ctx context.Context, logs <-chan logquery.Log, batchSize int, interval time.Duration) error {
+	for batch := range logquery.Batches(ctx, logs, batchSize, interval) {
+		if err := c.Push(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
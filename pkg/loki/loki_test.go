@@ -0,0 +1,110 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLoki records every push it receives
+type fakeLoki struct {
+	mutex   sync.Mutex
+	pushes  []pushRequest
+	tenants []string
+	status  int
+}
+
+func (f *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if r.URL.Path != pushPath || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if f.status != 0 {
+		http.Error(w, "entry too far behind", f.status)
+		return
+	}
+	push := pushRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.pushes = append(f.pushes, push)
+	f.tenants = append(f.tenants, r.Header.Get("X-Scope-OrgID"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func testLogs(t *testing.T) logquery.Logs {
+	logQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	})
+	assert.NoError(t, err)
+	logs, err := logQuery.QueryLogs(context.Background())
+	assert.NoError(t, err)
+	return logs
+}
+
+func TestPush(t *testing.T) {
+	assert := assert.New(t)
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	client := &Client{URL: server.URL + "/", Labels: map[string]string{"job": "legacy"}, TenantID: "team-a"}
+	assert.NoError(client.Push(context.Background(), testLogs(t)))
+	assert.Equal([]string{"team-a"}, loki.tenants)
+	assert.Equal(1, len(loki.pushes))
+
+	streams := loki.pushes[0].Streams
+	assert.Equal(6, len(streams))
+	assert.Equal(map[string]string{"job": "legacy", "key": "db", "severity": "info"}, streams[0].Stream)
+	assert.Equal([2]string{"1582867255370000000", "Request to open database “my_db7” "}, streams[0].Values[0])
+	assert.Equal(2, len(streams[0].Values))
+
+	// Nothing to send doesn't make a request
+	assert.NoError(client.Push(context.Background(), nil))
+	assert.Equal(1, len(loki.pushes))
+
+	loki.status = http.StatusBadRequest
+	err := client.Push(context.Background(), testLogs(t))
+	assert.EqualError(err, "loki push failed with 400 Bad Request: entry too far behind")
+}
+
+func TestShip(t *testing.T) {
+	assert := assert.New(t)
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	logs := make(chan logquery.Log)
+	done := make(chan error)
+	client := &Client{URL: server.URL}
+	go func() {
+		done <- client.Ship(context.Background(), logs, 3, time.Hour)
+	}()
+	for _, log := range testLogs(t) {
+		logs <- log
+	}
+	close(logs)
+	assert.NoError(<-done)
+
+	// 8 logs go out in batches of 3, 3 and the 2 left when the channel closes
+	sizes := []int{}
+	for _, push := range loki.pushes {
+		n := 0
+		for _, s := range push.Streams {
+			n += len(s.Values)
+		}
+		sizes = append(sizes, n)
+	}
+	assert.Equal([]int{3, 3, 2}, sizes)
+}
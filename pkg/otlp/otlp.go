@@ -0,0 +1,190 @@
+// Package otlp converts logs to OpenTelemetry log records and exports them to a collector with
+// OTLP/HTTP, so parsed legacy logs can be fed into an OpenTelemetry pipeline
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// logsPath is where OTLP/HTTP receivers accept logs
+const logsPath = "/v1/logs"
+
+// KeyAttribute is the attribute holding the key a log was read under
+const KeyAttribute = "logquery.key"
+
+// SeverityNumber is the OTLP severity, each level spans four numbers and the first of each is used
+type SeverityNumber int
+
+const (
+	SeverityUnspecified SeverityNumber = 0
+	SeverityDebug       SeverityNumber = 5
+	SeverityInfo        SeverityNumber = 9
+	SeverityWarn        SeverityNumber = 13
+	SeverityError       SeverityNumber = 17
+	SeverityFatal       SeverityNumber = 21
+)
+
+var severityNumbers = map[logquery.LogLevel]SeverityNumber{
+	logquery.Debug: SeverityDebug,
+	logquery.Info:  SeverityInfo,
+	logquery.Warn:  SeverityWarn,
+	logquery.Error: SeverityError,
+	logquery.Fatal: SeverityFatal,
+}
+
+// LogRecord is an OTLP log record in the OTLP/JSON encoding
+type LogRecord struct {
+	// Times are nanoseconds since the epoch, 64 bit numbers are strings in OTLP/JSON
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       SeverityNumber `json:"severityNumber,omitempty"`
+	// SeverityText is the level as it was written in the file
+	SeverityText string     `json:"severityText,omitempty"`
+	Body         AnyValue   `json:"body"`
+	Attributes   []KeyValue `json:"attributes,omitempty"`
+}
+
+// AnyValue is an OTLP value, only strings are used
+type AnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// KeyValue is an OTLP attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// FromLog converts a log to a record observed at observed. The key and structured fields become
+// attributes, with the key under KeyAttribute
+func FromLog(log logquery.Log, observed time.Time) LogRecord {
+	severityText := strings.TrimSuffix(strings.TrimPrefix(log.SeverityString, "["), "]")
+	if severityText == "" && log.Severity != logquery.Undefined {
+		severityText = log.Severity.String()
+	}
+	return LogRecord{
+		TimeUnixNano:         strconv.FormatInt(log.Time.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(observed.UnixNano(), 10),
+		SeverityNumber:       severityNumbers[log.Severity],
+		SeverityText:         severityText,
+		Body:                 AnyValue{StringValue: log.Log},
+		Attributes:           append([]KeyValue{{Key: KeyAttribute, Value: AnyValue{StringValue: log.Key}}}, attributes(log.Fields)...),
+	}
+}
+
+// attributes turns a map into attributes sorted by name
+func attributes(values map[string]string) []KeyValue {
+	rv := []KeyValue{}
+	for key, value := range values {
+		rv = append(rv, KeyValue{Key: key, Value: AnyValue{StringValue: value}})
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Key < rv[j].Key
+	})
+	return rv
+}
+
+// exportRequest is the body of an OTLP/HTTP logs export
+type exportRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []LogRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+// Exporter sends logs to an OpenTelemetry collector with OTLP/HTTP using the JSON encoding
+type Exporter struct {
+	// Endpoint is the base url of the collector like http://collector:4318, logs go to /v1/logs
+	Endpoint string
+	// Resource attributes describe where the logs came from. service.name defaults to logparser
+	Resource map[string]string
+	// Headers are added to every request, like an authorization header
+	Headers map[string]string
+	// HTTPClient is used for requests, nil means http.DefaultClient
+	HTTPClient *http.Client
+
+	// now is swapped out in tests
+	now func() time.Time
+}
+
+// Export sends logs in one request
+func (e *Exporter) Export(ctx context.Context, logs []logquery.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(e.exportRequest(logs))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+logsPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.Headers {
+		req.Header.Set(name, value)
+	}
+	client := e.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp export failed with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (e *Exporter) exportRequest(logs []logquery.Log) exportRequest {
+	now := time.Now
+	if e.now != nil {
+		now = e.now
+	}
+	observed := now()
+
+	resourceValues := map[string]string{"service.name": "logparser"}
+	for key, value := range e.Resource {
+		resourceValues[key] = value
+	}
+	records := make([]LogRecord, len(logs))
+	for i, log := range logs {
+		records[i] = FromLog(log, observed)
+	}
+	return exportRequest{ResourceLogs: []resourceLogs{{
+		Resource:  resource{Attributes: attributes(resourceValues)},
+		ScopeLogs: []scopeLogs{{Scope: scope{Name: "github.com/screenshotjy/logquery"}, LogRecords: records}},
+	}}}
+}
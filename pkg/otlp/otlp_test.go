@@ -0,0 +1,90 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromLog(t *testing.T) {
+	assert := assert.New(t)
+	observed := time.Date(2020, 2, 28, 6, 0, 0, 0, time.UTC)
+	log := logquery.Log{
+		Time:           time.Date(2020, 2, 28, 5, 20, 57, 450000000, time.UTC),
+		Severity:       logquery.Warn,
+		Log:            "disk almost full",
+		Key:            "db",
+		Fields:         map[string]string{"host": "db1", "disk": "sda"},
+		SeverityString: "[WARNING]",
+	}
+	assert.Equal(LogRecord{
+		TimeUnixNano:         "1582867257450000000",
+		ObservedTimeUnixNano: "1582869600000000000",
+		SeverityNumber:       SeverityWarn,
+		SeverityText:         "WARNING",
+		Body:                 AnyValue{StringValue: "disk almost full"},
+		Attributes: []KeyValue{
+			{Key: KeyAttribute, Value: AnyValue{StringValue: "db"}},
+			{Key: "disk", Value: AnyValue{StringValue: "sda"}},
+			{Key: "host", Value: AnyValue{StringValue: "db1"}},
+		},
+	}, FromLog(log, observed))
+
+	// Raw lines kept by lenient parsing have no severity
+	record := FromLog(logquery.Log{Key: "db", Log: "  at main.go:12"}, observed)
+	assert.Equal(SeverityUnspecified, record.SeverityNumber)
+	assert.Equal("", record.SeverityText)
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+	requests := []map[string]interface{}{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/v1/logs", r.URL.Path)
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+		body := map[string]interface{}{}
+		assert.NoError(json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, body)
+	}))
+	defer collector.Close()
+
+	logQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{"server1": "../../logs/server1.log"})
+	assert.NoError(err)
+	logs, err := logQuery.QueryLogs(context.Background())
+	assert.NoError(err)
+
+	exporter := &Exporter{
+		Endpoint: collector.URL,
+		Resource: map[string]string{"host.name": "web1"},
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		now:      func() time.Time { return time.Date(2020, 2, 28, 6, 0, 0, 0, time.UTC) },
+	}
+	assert.NoError(exporter.Export(context.Background(), logs))
+	assert.Equal(1, len(requests))
+
+	body, err := json.Marshal(requests[0]["resourceLogs"].([]interface{})[0].(map[string]interface{})["resource"])
+	assert.NoError(err)
+	assert.JSONEq(`{"attributes": [
+		{"key": "host.name", "value": {"stringValue": "web1"}},
+		{"key": "service.name", "value": {"stringValue": "logparser"}}
+	]}`, string(body))
+	records := requests[0]["resourceLogs"].([]interface{})[0].(map[string]interface{})["scopeLogs"].([]interface{})[0].(map[string]interface{})["logRecords"].([]interface{})
+	assert.Equal(4, len(records))
+	body, err = json.Marshal(records[3])
+	assert.NoError(err)
+	assert.JSONEq(`{
+		"timeUnixNano": "1582867257450000000",
+		"observedTimeUnixNano": "1582869600000000000",
+		"severityNumber": 21,
+		"severityText": "fatal",
+		"body": {"stringValue": "Unable to write to database “my_db7”. Exiting. "},
+		"attributes": [{"key": "logquery.key", "value": {"stringValue": "server1"}}]
+	}`, string(body))
+}
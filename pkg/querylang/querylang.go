@@ -0,0 +1,441 @@
+// Package querylang parses a small query language into logquery.QueryOptions, so a whole query can be
+// written as one string like
+//
+//	level>=warn AND key IN (server1,db) AND msg~"timeout" SINCE 2h
+//
+// A query is conditions joined with AND, optionally followed by SINCE and a duration. The conditions are
+//
+//	level>=warn, level>info            lowest level to return
+//	level<=warn, level<error, level=warn  highest level to return, = is both
+//	key=server1, key IN (a,b)          keys to query
+//	msg~"db_\d+"                       message matches a regular expression
+//	msg CONTAINS "timeout"             message contains the text
+//	field.user=alice, field.user~"^a"  structured field equals or matches a regular expression
+//	time>=2020-02-28T05:20:00Z         RFC3339 start with > or >=, end with < or <=
+//
+// Keywords are case insensitive and values with spaces or operators in them have to be quoted
+package querylang
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// SyntaxError is a query that couldn't be parsed
+type SyntaxError struct {
+	// Pos is the byte offset of the problem in the query
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Pos+1)
+}
+
+// Compile parses query into the filters it describes. Limits, ordering and cursors aren't part of the
+// language and are left unset. now is the time SINCE counts back from
+func Compile(query string, now time.Time) (*logquery.QueryOptions, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, now: now, opts: &logquery.QueryOptions{}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if !p.opts.Start.IsZero() && !p.opts.End.IsZero() && !p.opts.Start.Before(p.opts.End) {
+		return nil, fmt.Errorf("the start time must be before the end time")
+	}
+	if p.opts.MaxSeverity != logquery.Undefined && p.opts.MinSeverity > p.opts.MaxSeverity {
+		return nil, fmt.Errorf("the lowest level must be at or below the highest level")
+	}
+	return p.opts, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	// text is the word, operator or unquoted string
+	text string
+	pos  int
+}
+
+// describe names the token for error messages
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lex splits query into tokens
+func lex(query string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+		case c == '>' || c == '<':
+			op := string(c)
+			if i+1 < len(query) && query[i+1] == '=' {
+				op += "="
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		case c == '=' || c == '~':
+			tokens = append(tokens, token{kind: tokOp, text: string(c), pos: i})
+			i++
+		case c == '"':
+			end := closingQuote(query[i:])
+			if end == -1 {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated string"}
+			}
+			text, err := strconv.Unquote(query[i : i+end+1])
+			if err != nil {
+				return nil, &SyntaxError{Pos: i, Msg: "bad string"}
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i += end + 1
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n\r(),<>=~\"", rune(query[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokWord, text: query[start:i], pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(query)}), nil
+}
+
+// closingQuote returns the index of the quote that ends the string s starts with, or -1
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	now    time.Time
+	opts   *logquery.QueryOptions
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// isKeyword returns true if t is the case insensitive word keyword
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+func errorAt(t token, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parse reads conditions joined with AND and an optional SINCE at the end
+func (p *parser) parse() error {
+	for i := 0; p.peek().kind != tokEOF; i++ {
+		if isKeyword(p.peek(), "since") {
+			if err := p.since(); err != nil {
+				return err
+			}
+			if t := p.peek(); t.kind != tokEOF {
+				return errorAt(t, "SINCE has to be at the end of the query, got %s", t.describe())
+			}
+			return nil
+		}
+		if i > 0 {
+			if t := p.next(); !isKeyword(t, "and") {
+				return errorAt(t, "expected AND, got %s", t.describe())
+			}
+		}
+		if err := p.condition(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// condition reads a single filter like level>=warn
+func (p *parser) condition() error {
+	name := p.next()
+	if name.kind != tokWord {
+		return errorAt(name, "expected a condition, got %s", name.describe())
+	}
+	switch {
+	case strings.EqualFold(name.text, "level"):
+		return p.level()
+	case strings.EqualFold(name.text, "key"):
+		return p.keys()
+	case strings.EqualFold(name.text, "msg"):
+		return p.message()
+	case strings.EqualFold(name.text, "time"):
+		return p.timeBound()
+	case strings.HasPrefix(strings.ToLower(name.text), "field.") && len(name.text) > len("field."):
+		return p.field(name.text[len("field."):])
+	}
+	return errorAt(name, "unknown condition %s, expected level, key, msg, time or field.<name>", name.describe())
+}
+
+// op reads an operator that has to be one of ops
+func (p *parser) op(ops ...string) (token, error) {
+	t := p.next()
+	if t.kind == tokOp {
+		for _, op := range ops {
+			if t.text == op {
+				return t, nil
+			}
+		}
+	}
+	return t, errorAt(t, "expected %s, got %s", strings.Join(ops, " or "), t.describe())
+}
+
+// value reads a word or a string
+func (p *parser) value() (token, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return t, errorAt(t, "expected a value, got %s", t.describe())
+	}
+	return t, nil
+}
+
+func (p *parser) level() error {
+	op, err := p.op(">=", ">", "<=", "<", "=")
+	if err != nil {
+		return err
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	level, err := logquery.ParseLevel(value.text)
+	if err != nil {
+		return errorAt(value, "%s", err)
+	}
+	min, max := level, level
+	switch op.text {
+	case ">":
+		min++
+	case "<":
+		max--
+	}
+	if op.text == "<" && max == logquery.Undefined {
+		return errorAt(value, "no level is below %s", strings.ToLower(level.String()))
+	}
+	// Conditions are ANDed so the highest lowest level and the lowest highest level win
+	if op.text != "<=" && op.text != "<" && min > p.opts.MinSeverity {
+		p.opts.MinSeverity = min
+	}
+	if op.text != ">=" && op.text != ">" && (p.opts.MaxSeverity == logquery.Undefined || max < p.opts.MaxSeverity) {
+		p.opts.MaxSeverity = max
+	}
+	return nil
+}
+
+func (p *parser) keys() error {
+	keys := []string{}
+	if isKeyword(p.peek(), "in") {
+		p.next()
+		if t := p.next(); t.kind != tokLParen {
+			return errorAt(t, "expected (, got %s", t.describe())
+		}
+		for {
+			value, err := p.value()
+			if err != nil {
+				return err
+			}
+			keys = append(keys, value.text)
+			t := p.next()
+			if t.kind == tokRParen {
+				break
+			}
+			if t.kind != tokComma {
+				return errorAt(t, "expected , or ), got %s", t.describe())
+			}
+		}
+	} else {
+		if _, err := p.op("="); err != nil {
+			return err
+		}
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, value.text)
+	}
+
+	if p.opts.Keys == nil {
+		p.opts.Keys = keys
+		return nil
+	}
+	// A second key condition narrows the keys down to the ones in both
+	in := map[string]bool{}
+	for _, key := range keys {
+		in[key] = true
+	}
+	both := []string{}
+	for _, key := range p.opts.Keys {
+		if in[key] {
+			both = append(both, key)
+		}
+	}
+	p.opts.Keys = both
+	return nil
+}
+
+func (p *parser) message() error {
+	if p.opts.Message == nil {
+		p.opts.Message = &logquery.MessageFilter{}
+	}
+	if t := p.peek(); isKeyword(t, "contains") {
+		p.next()
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		if p.opts.Message.Substring != "" {
+			return errorAt(t, "msg CONTAINS can only be used once")
+		}
+		p.opts.Message.Substring = value.text
+		return nil
+	}
+
+	op, err := p.op("~")
+	if err != nil {
+		return errorAt(op, "expected ~ or CONTAINS, got %s", op.describe())
+	}
+	pattern, err := p.pattern()
+	if err != nil {
+		return err
+	}
+	if p.opts.Message.Pattern != nil {
+		return errorAt(op, "msg~ can only be used once")
+	}
+	p.opts.Message.Pattern = pattern
+	return nil
+}
+
+// pattern reads a regular expression value
+func (p *parser) pattern() (*regexp.Regexp, error) {
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := regexp.Compile(value.text)
+	if err != nil {
+		return nil, errorAt(value, "bad regular expression, %s", err)
+	}
+	return pattern, nil
+}
+
+func (p *parser) timeBound() error {
+	op, err := p.op(">=", ">", "<=", "<")
+	if err != nil {
+		return err
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339, value.text)
+	if err != nil {
+		return errorAt(value, "time must be RFC3339 like 2020-02-28T05:20:00Z")
+	}
+	// Queries leave out logs at their start and end times, so the inclusive bounds move out by a nanosecond
+	switch op.text {
+	case ">=":
+		t = t.Add(-time.Nanosecond)
+	case "<=":
+		t = t.Add(time.Nanosecond)
+	}
+	if strings.HasPrefix(op.text, ">") {
+		p.after(t)
+	} else if p.opts.End.IsZero() || t.Before(p.opts.End) {
+		p.opts.End = t
+	}
+	return nil
+}
+
+func (p *parser) since() error {
+	p.next()
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value.text)
+	if err != nil || duration < 0 {
+		return errorAt(value, "SINCE takes a positive duration like 2h")
+	}
+	p.after(p.now.Add(-duration))
+	return nil
+}
+
+// after moves the start time up to t, the latest start of every condition wins
+func (p *parser) after(t time.Time) {
+	if t.After(p.opts.Start) {
+		p.opts.Start = t
+	}
+}
+
+func (p *parser) field(name string) error {
+	op, err := p.op("=", "~")
+	if err != nil {
+		return err
+	}
+	if op.text == "~" {
+		pattern, err := p.pattern()
+		if err != nil {
+			return err
+		}
+		p.opts.Fields = append(p.opts.Fields, logquery.FieldFilter{Name: name, Pattern: pattern})
+		return nil
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	p.opts.Fields = append(p.opts.Fields, logquery.FieldFilter{Name: name, Value: value.text})
+	return nil
+}
@@ -0,0 +1,111 @@
+package querylang
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2020, 2, 28, 8, 0, 0, 0, time.UTC)
+
+	opts, err := Compile(`level>=warn AND key IN (server1, db) AND msg~"time(out)?" SINCE 2h`, now)
+	assert.NoError(err)
+	assert.Equal(logquery.Warn, opts.MinSeverity)
+	assert.Equal([]string{"server1", "db"}, opts.Keys)
+	assert.Equal("time(out)?", opts.Message.Pattern.String())
+	assert.Equal(now.Add(-2*time.Hour), opts.Start)
+	assert.True(opts.End.IsZero())
+
+	opts, err = Compile(`LEVEL > info and key=server1 and msg contains "no such database" and field.user=alice `+
+		`and field.db~"^my_" and time>=2020-02-28T05:00:00Z and time<"2020-02-28T06:00:00Z"`, now)
+	assert.NoError(err)
+	assert.Equal(logquery.Warn, opts.MinSeverity)
+	assert.Equal([]string{"server1"}, opts.Keys)
+	assert.Equal("no such database", opts.Message.Substring)
+	assert.Nil(opts.Message.Pattern)
+	assert.Equal(2, len(opts.Fields))
+	assert.True(opts.Fields[0].Match(map[string]string{"user": "alice"}))
+	assert.True(opts.Fields[1].Match(map[string]string{"db": "my_db7"}))
+	assert.Equal(time.Date(2020, 2, 28, 5, 0, 0, 0, time.UTC).Add(-time.Nanosecond), opts.Start)
+	assert.Equal(time.Date(2020, 2, 28, 6, 0, 0, 0, time.UTC), opts.End)
+
+	// Conditions are ANDed together
+	opts, err = Compile(`level>=error AND level>=info AND key IN (a,b,c) AND key IN (c,b) AND time>2020-02-28T07:30:00Z SINCE 1h`, now)
+	assert.NoError(err)
+	assert.Equal(logquery.Error, opts.MinSeverity)
+	assert.Equal([]string{"b", "c"}, opts.Keys)
+	assert.Equal(time.Date(2020, 2, 28, 7, 30, 0, 0, time.UTC), opts.Start)
+
+	opts, err = Compile("level<=error AND level>info AND level<fatal", now)
+	assert.NoError(err)
+	assert.Equal(logquery.Warn, opts.MinSeverity)
+	assert.Equal(logquery.Error, opts.MaxSeverity)
+	opts, err = Compile("level=debug", now)
+	assert.NoError(err)
+	assert.Equal(logquery.Debug, opts.MinSeverity)
+	assert.Equal(logquery.Debug, opts.MaxSeverity)
+
+	opts, err = Compile("", now)
+	assert.NoError(err)
+	assert.Equal(&logquery.QueryOptions{}, opts)
+}
+
+func TestCompileErrors(t *testing.T) {
+	assert := assert.New(t)
+	for query, msg := range map[string]string{
+		"level~warn":                   `expected >= or > or <= or < or =, got "~" at column 6`,
+		"level<debug":                  `no level is below debug at column 7`,
+		"level>=error AND level<=warn": "the lowest level must be at or below the highest level",
+		"level>=loud":                  `unknown level "loud" at column 8`,
+		"level>=warn key=a":            `expected AND, got "key" at column 13`,
+		"level>=warn AND":              `expected a condition, got end of query at column 16`,
+		"host=a":                       `unknown condition "host", expected level, key, msg, time or field.<name> at column 1`,
+		"key IN (a b)":                 `expected , or ), got "b" at column 11`,
+		`msg~"("`:                      "bad regular expression, error parsing regexp: missing closing ): `(` at column 5",
+		`msg~"a`:                       "unterminated string at column 5",
+		`msg~a AND msg~b`:              "msg~ can only be used once at column 14",
+		"msg=a":                        `expected ~ or CONTAINS, got "=" at column 4`,
+		"SINCE 2h AND level>=warn":     `SINCE has to be at the end of the query, got "AND" at column 10`,
+		"SINCE yesterday":              "SINCE takes a positive duration like 2h at column 7",
+		"time>=yesterday":              "time must be RFC3339 like 2020-02-28T05:20:00Z at column 7",
+		"time>=2020-02-28T06:00:00Z AND time<2020-02-28T05:00:00Z": "the start time must be before the end time",
+	} {
+		_, err := Compile(query, time.Now())
+		if assert.Error(err, query) {
+			assert.Equal(msg, err.Error(), query)
+		}
+	}
+}
+
+func TestTimeBounds(t *testing.T) {
+	assert := assert.New(t)
+	source := logquery.NewMemorySource()
+	source.WriteFile("mem://app.log", []byte("[02/28/2020 5:59:59.00][info] before\n"+
+		"[02/28/2020 6:00:00.00][info] boundary\n[02/28/2020 6:00:01.00][info] after\n"))
+	testQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{"app": "mem://app.log"}, logquery.WithSource("mem", source))
+	assert.NoError(err)
+
+	// Only the inclusive bounds take in the log stamped exactly at the bound
+	for query, want := range map[string][]string{
+		"time>=2020-02-28T06:00:00Z":                                {"boundary", "after"},
+		"time>2020-02-28T06:00:00Z":                                 {"after"},
+		"time<=2020-02-28T06:00:00Z":                                {"before", "boundary"},
+		"time<2020-02-28T06:00:00Z":                                 {"before"},
+		"time>=2020-02-28T06:00:00Z AND time<=2020-02-28T06:00:00Z": {"boundary"},
+	} {
+		opts, err := Compile(query, time.Now())
+		assert.NoError(err, query)
+		logs, err := testQuery.QueryLogs(context.Background(), logquery.WithOptions(*opts))
+		assert.NoError(err, query)
+		messages := []string{}
+		for _, log := range logs {
+			messages = append(messages, log.Log)
+		}
+		assert.Equal(want, messages, query)
+	}
+}
@@ -0,0 +1,189 @@
+// Package saved keeps named queries in a YAML file, so a combination of keys, levels, patterns and time
+// windows can be run again by name
+//
+//	queries:
+//	  prod-errors:
+//	    query: level>=error AND key IN (api,db) SINCE 1h
+//	    description: errors of the production services
+//
+// The queries are written in the query language of pkg/querylang
+package saved
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/querylang"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotFound is returned for names that have no saved query
+var ErrNotFound = errors.New("no saved query")
+
+// ErrInvalid is returned when saving a bad name or a query that doesn't compile
+var ErrInvalid = errors.New("can't save")
+
+// validName is what a name can be made of, so names work in urls and on the command line unquoted
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Query is a saved query
+type Query struct {
+	// Query is the filters in the query language, like level>=error AND key=api SINCE 1h
+	Query       string `yaml:"query" json:"query"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// file is the contents of the file
+type file struct {
+	Queries map[string]Query `yaml:"queries"`
+}
+
+// Store reads and writes the saved queries of a file. The file is read on every call so changes made by
+// another process, like the CLI while a server is running, are picked up. A missing file has no queries
+type Store struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// Open returns the store for the file at path, it is created once a query is saved
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// DefaultPath is queries.yaml in the logparser directory of the user's config directory, or in the
+// working directory if there is no config directory
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "queries.yaml"
+	}
+	return filepath.Join(dir, "logparser", "queries.yaml")
+}
+
+// Path returns the file of the store
+func (s *Store) Path() string {
+	return s.path
+}
+
+// List returns every saved query by name
+func (s *Store) List() (map[string]Query, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return f.Queries, nil
+}
+
+// Names returns the names of the saved queries in sorted order
+func (s *Store) Names() ([]string, error) {
+	queries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Get returns the query saved as name, or an error wrapping ErrNotFound
+func (s *Store) Get(name string) (Query, error) {
+	queries, err := s.List()
+	if err != nil {
+		return Query{}, err
+	}
+	q, ok := queries[name]
+	if !ok {
+		return Query{}, fmt.Errorf("%w named %s", ErrNotFound, name)
+	}
+	return q, nil
+}
+
+// Save saves q as name, replacing any query with that name. The query has to compile
+func (s *Store) Save(name string, q Query) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("%w, bad name %q, names are letters, digits, _, . and -", ErrInvalid, name)
+	}
+	if _, err := querylang.Compile(q.Query, time.Now()); err != nil {
+		return fmt.Errorf("%w, bad query, %s", ErrInvalid, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	f.Queries[name] = q
+	return s.write(f)
+}
+
+// Delete removes the query saved as name, or returns an error wrapping ErrNotFound
+func (s *Store) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := f.Queries[name]; !ok {
+		return fmt.Errorf("%w named %s", ErrNotFound, name)
+	}
+	delete(f.Queries, name)
+	return s.write(f)
+}
+
+func (s *Store) read() (*file, error) {
+	f := &file{}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(f); err != nil {
+			return nil, fmt.Errorf("bad saved queries %s, %s", s.path, err)
+		}
+	}
+	if f.Queries == nil {
+		f.Queries = map[string]Query{}
+	}
+	return f, nil
+}
+
+// write replaces the file through a temporary file so readers never see half of it
+func (s *Store) write(f *file) error {
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".queries-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
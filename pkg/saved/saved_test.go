@@ -0,0 +1,50 @@
+package saved
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "logparser", "queries.yaml")
+	store := Open(path)
+
+	// A missing file has no queries
+	names, err := store.Names()
+	assert.NoError(err)
+	assert.Empty(names)
+	_, err = store.Get("prod-errors")
+	assert.True(errors.Is(err, ErrNotFound))
+
+	prodErrors := Query{Query: "level>=error AND key IN (api,db) SINCE 1h", Description: "errors of the production services"}
+	assert.NoError(store.Save("prod-errors", prodErrors))
+	assert.NoError(store.Save("warnings", Query{Query: "level=warn"}))
+	assert.ErrorIs(store.Save("bad name", Query{Query: "level=warn"}), ErrInvalid)
+	assert.ErrorIs(store.Save("bad-query", Query{Query: "level>=loud"}), ErrInvalid)
+
+	// Another store on the same file sees the queries
+	other := Open(path)
+	names, _ = other.Names()
+	assert.Equal([]string{"prod-errors", "warnings"}, names)
+	q, err := other.Get("prod-errors")
+	assert.NoError(err)
+	assert.Equal(prodErrors, q)
+
+	assert.NoError(store.Save("warnings", Query{Query: "level=warn AND key=api"}))
+	q, _ = other.Get("warnings")
+	assert.Equal("level=warn AND key=api", q.Query)
+
+	assert.NoError(store.Delete("warnings"))
+	assert.True(errors.Is(store.Delete("warnings"), ErrNotFound))
+	names, _ = other.Names()
+	assert.Equal([]string{"prod-errors"}, names)
+
+	assert.NoError(os.WriteFile(path, []byte("queries:\n  a:\n    qeury: level=warn\n"), 0644))
+	_, err = store.List()
+	assert.Error(err)
+}
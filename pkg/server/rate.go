@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+)
+
+// RateResponse is the body of a /rate response, see logquery.LogQuery.Rate
+type RateResponse struct {
+	Key           string      `json:"key"`
+	WindowSeconds float64     `json:"window_seconds"`
+	Points        []RatePoint `json:"points"`
+	// Limited is true if counting stopped on the limits of the server, the points run up to the last log
+	// counted
+	Limited bool `json:"limited,omitempty"`
+}
+
+// RatePoint is the rate of logs in the window ending at Time
+type RatePoint struct {
+	Time      time.Time `json:"time"`
+	Count     int       `json:"count"`
+	PerSecond float64   `json:"per_second"`
+}
+
+func (s *Server) handleRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	values := r.URL.Query()
+	key := values.Get("key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("key is required"))
+		return
+	}
+	known := false
+	for _, k := range s.logQuery.Keys() {
+		known = known || k == key
+	}
+	if !known {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown key %q", key))
+		return
+	}
+	durations := map[string]time.Duration{}
+	for _, name := range []string{"window", "step"} {
+		if value := values.Get(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%s must be a positive duration like 5m", name))
+				return
+			}
+			durations[name] = d
+		}
+	}
+	window, step := durations["window"], durations["step"]
+	if window == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("window is required"))
+		return
+	}
+	// The other filters are the same as /query's
+	params, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if step == 0 {
+		step = window
+	}
+	// Rate checks ranges that end at the last log itself, one that ends now is checked here
+	if !params.Start.IsZero() {
+		end := params.End
+		if end.IsZero() {
+			end = s.now()
+		}
+		if end.Sub(params.Start)/step > logquery.MaxRatePoints {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("the range has more than %d steps, use a larger step", logquery.MaxRatePoints))
+			return
+		}
+	}
+
+	points, err := s.logQuery.Rate(r.Context(), key, params.MinSeverity, window, step, logquery.WithOptions(*params))
+	if errors.Is(err, logquery.ErrTooManyPoints) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limited := errors.Is(err, logquery.ErrLimited)
+	if err != nil && !limited {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rv := RateResponse{Key: key, WindowSeconds: window.Seconds(), Points: make([]RatePoint, len(points)), Limited: limited}
+	for i, point := range points {
+		rv.Points[i] = RatePoint{Time: point.Time, Count: point.Count, PerSecond: point.PerSecond}
+	}
+	writeJSON(w, http.StatusOK, rv)
+}
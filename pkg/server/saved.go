@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/screenshotjy/logquery/pkg/saved"
+)
+
+// UseSavedQueries serves the queries of store under /saved and lets /query run them with saved=<name>
+func (s *Server) UseSavedQueries(store *saved.Store) {
+	s.saved = store
+	s.mux.HandleFunc("/saved", s.handleSavedList)
+	s.mux.HandleFunc("/saved/", s.handleSaved)
+}
+
+func (s *Server) handleSavedList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	queries, err := s.saved.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]map[string]saved.Query{"queries": queries})
+}
+
+func (s *Server) handleSaved(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/saved/")
+	if name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no saved query at %s", r.URL.Path))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		q, err := s.saved.Get(name)
+		if err != nil {
+			writeError(w, savedStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, q)
+	case http.MethodPut:
+		q := saved.Query{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&q); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("bad body, %s", err))
+			return
+		}
+		if err := s.saved.Save(name, q); err != nil {
+			writeError(w, savedStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, q)
+	case http.MethodDelete:
+		if err := s.saved.Delete(name); err != nil {
+			writeError(w, savedStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// savedStatus is the status for an error of the store
+func savedStatus(err error) int {
+	if errors.Is(err, saved.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, saved.ErrInvalid) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/screenshotjy/logquery/pkg/saved"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedQueries(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?saved=errors", nil))
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+
+	s.UseSavedQueries(saved.Open(filepath.Join(t.TempDir(), "queries.yaml")))
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/saved/db-warnings", strings.NewReader(`{"query": "level=warn AND key=db", "description": "warnings of the db"}`)))
+	assert.Equal(http.StatusOK, recorder.Code)
+
+	for _, body := range []string{`{"query": "level>=loud"}`, `{"qeury": "level=warn"}`, `nope`} {
+		recorder = httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/saved/bad", strings.NewReader(body)))
+		assert.Equal(http.StatusBadRequest, recorder.Code, body)
+	}
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/saved", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.JSONEq(`{"queries": {"db-warnings": {"query": "level=warn AND key=db", "description": "warnings of the db"}}}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?saved=db-warnings", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	rv := QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(2, len(rv.Logs))
+	for _, log := range rv.Logs {
+		assert.Equal("db", log.Key)
+	}
+
+	for _, query := range []string{"saved=nope", "saved=db-warnings&q=level%3Dwarn", "saved=db-warnings&min_level=error"} {
+		recorder = httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?"+query, nil))
+		assert.Equal(http.StatusBadRequest, recorder.Code, query)
+	}
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/saved/db-warnings", nil))
+	assert.Equal(http.StatusNoContent, recorder.Code)
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		recorder = httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(method, "/saved/db-warnings", nil))
+		assert.Equal(http.StatusNotFound, recorder.Code, method)
+	}
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/saved/db-warnings", nil))
+	assert.Equal(http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,430 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/screenshotjy/logquery/pkg/querylang"
+	"github.com/screenshotjy/logquery/pkg/saved"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 10000
+	maxContext   = 100
+)
+
+// Server serves a LogQuery over HTTP
+//
+//	GET /keys                       lists the keys that can be queried
+//	GET /query?keys=a,b&since=1h... returns matching logs as JSON
+//	GET /rate?key=a&window=5m...    returns the logs per second of a key over a rolling window
+//	GET /saved                      lists the saved queries, see UseSavedQueries
+//	GET|PUT|DELETE /saved/<name>    reads, saves or deletes a saved query
+type Server struct {
+	logQuery *logquery.LogQuery
+	mux      *http.ServeMux
+	// saved is nil unless UseSavedQueries was called
+	saved *saved.Store
+	// limits is applied to every query, see SetQueryLimits
+	limits logquery.QueryLimits
+
+	// now is swapped out in tests
+	now func() time.Time
+}
+
+// New returns a Server for logQuery
+func New(logQuery *logquery.LogQuery) *Server {
+	s := &Server{
+		logQuery: logQuery,
+		mux:      http.NewServeMux(),
+		now:      time.Now,
+	}
+	s.mux.HandleFunc("/keys", s.handleKeys)
+	s.mux.HandleFunc("/query", s.handleQuery)
+	s.mux.HandleFunc("/rate", s.handleRate)
+	return s
+}
+
+// SetQueryLimits stops every query at limits, returning what it found so far with limited set in the
+// response. Without limits one expensive query can keep the server busy for as long as it runs
+func (s *Server) SetQueryLimits(limits logquery.QueryLimits) {
+	s.limits = limits
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// QueryResponse is the body of a /query response. Error is set when some files failed to load, the
+// logs from the other files are still returned
+type QueryResponse struct {
+	Logs  []logquery.Record `json:"logs"`
+	Error string            `json:"error,omitempty"`
+	// NextCursor is passed as the cursor parameter to get the next page, it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Stats is only set when the stats parameter is true
+	Stats *QueryStats `json:"stats,omitempty"`
+	// Groups is only set when the group_by parameter is, the largest group first
+	Groups []QueryGroup `json:"groups,omitempty"`
+	// Limited is true if the query stopped on the limits of the server, the logs are the ones found
+	// before it did and NextCursor carries on from there
+	Limited bool `json:"limited,omitempty"`
+}
+
+// QueryGroup is a group of the matches of a grouped query, see logquery.Group
+type QueryGroup struct {
+	Values   []string       `json:"values"`
+	Count    int            `json:"count"`
+	Messages []GroupMessage `json:"messages"`
+}
+
+// GroupMessage is one of the most common messages of a group
+type GroupMessage struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// QueryStats describes how much matched a query, see logquery.QueryResult
+type QueryStats struct {
+	Matched    int            `json:"matched"`
+	KeyCounts  map[string]int `json:"key_counts"`
+	Truncated  bool           `json:"truncated"`
+	DurationMs float64        `json:"duration_ms"`
+	BytesRead  int64          `json:"bytes_read"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"keys": s.logQuery.Keys()})
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	params, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	withStats := false
+	if param := r.URL.Query().Get("stats"); param != "" {
+		if withStats, err = strconv.ParseBool(param); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("stats must be true or false"))
+			return
+		}
+	}
+
+	// Counting every match reads past the limit so it is only done when asked for
+	var stats *QueryStats
+	var groups []QueryGroup
+	var page *logquery.Page
+	if withStats || len(params.GroupBy) > 0 {
+		var result *logquery.QueryResult
+		if result, err = s.logQuery.QueryResult(r.Context(), logquery.WithOptions(*params)); result != nil {
+			page = &logquery.Page{Logs: result.Logs, Cursor: result.Cursor, Limited: result.Limited}
+			if withStats {
+				stats = &QueryStats{
+					Matched:    result.Matched,
+					KeyCounts:  result.KeyCounts,
+					Truncated:  result.Truncated,
+					DurationMs: float64(result.Duration) / float64(time.Millisecond),
+					BytesRead:  result.BytesRead,
+				}
+			}
+			groups = queryGroups(result.Groups)
+		}
+	} else {
+		page, err = s.logQuery.QueryPage(r.Context(), logquery.WithOptions(*params))
+	}
+	if errors.Is(err, logquery.ErrInvalidCursor) || errors.Is(err, logquery.ErrInvalidGroupBy) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var loadErr *logquery.LoadError
+	if err != nil && !errors.As(err, &loadErr) {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rv := QueryResponse{
+		Logs:       make([]logquery.Record, len(page.Logs)),
+		NextCursor: page.Cursor,
+		Stats:      stats,
+		Groups:     groups,
+		Limited:    page.Limited,
+	}
+	if err != nil {
+		rv.Error = err.Error()
+	}
+	for i, log := range page.Logs {
+		rv.Logs[i] = log.Record()
+	}
+	writeJSON(w, http.StatusOK, rv)
+}
+
+// queryGroups returns the groups of a result for the response, the logs are already in it
+func queryGroups(groups []logquery.Group) []QueryGroup {
+	if groups == nil {
+		return nil
+	}
+	rv := make([]QueryGroup, len(groups))
+	for i, group := range groups {
+		rv[i] = QueryGroup{Values: group.Values, Count: group.Count, Messages: make([]GroupMessage, len(group.Messages))}
+		for j, message := range group.Messages {
+			rv[i].Messages[j] = GroupMessage{Message: message.Message, Count: message.Count}
+		}
+	}
+	return rv
+}
+
+// parseQuery parses the url parameters of a /query request
+func (s *Server) parseQuery(r *http.Request) (*logquery.QueryOptions, error) {
+	values := r.URL.Query()
+	params := &logquery.QueryOptions{
+		Keys:       s.logQuery.Keys(),
+		TotalLimit: defaultLimit,
+		Limits:     s.limits,
+	}
+
+	include, err := knownKeys(values.Get("keys"), params.Keys)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := knownKeys(values.Get("exclude"), params.Keys)
+	if err != nil {
+		return nil, err
+	}
+	params.Keys = logquery.SelectKeys(params.Keys, include, exclude)
+	if selector := values.Get("selector"); selector != "" {
+		if params.Labels, err = logquery.ParseLabelSelector(selector); err != nil {
+			return nil, err
+		}
+	}
+
+	if since := values.Get("since"); since != "" {
+		duration, err := time.ParseDuration(since)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("since must be a positive duration like 1h")
+		}
+		params.Start = s.now().Add(-duration)
+	}
+	for name, t := range map[string]*time.Time{"start": &params.Start, "end": &params.End} {
+		if value := values.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC3339 time", name)
+			}
+			*t = parsed
+		}
+	}
+	if !params.Start.IsZero() && !params.End.IsZero() && !params.Start.Before(params.End) {
+		return nil, fmt.Errorf("the start time must be before end")
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		params.TotalLimit = n
+	}
+	if limit := values.Get("per_key_limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("per_key_limit must be positive")
+		}
+		params.PerKeyLimit = n
+	}
+	// context sets both before and after, which can override it like grep's -C with -A or -B
+	for _, name := range []string{"context", "before", "after"} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > maxContext {
+			return nil, fmt.Errorf("%s must be between 0 and %d", name, maxContext)
+		}
+		switch name {
+		case "context":
+			params.Before, params.After = n, n
+		case "before":
+			params.Before = n
+		case "after":
+			params.After = n
+		}
+	}
+
+	if level := values.Get("min_level"); level != "" {
+		severity, err := logquery.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("unknown min_level %q", level)
+		}
+		params.MinSeverity = severity
+	}
+
+	if level := values.Get("max_level"); level != "" {
+		severity, err := logquery.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("unknown max_level %q", level)
+		}
+		if severity < params.MinSeverity {
+			return nil, fmt.Errorf("max_level can't be below min_level")
+		}
+		params.MaxSeverity = severity
+	}
+
+	grep, pattern := values.Get("grep"), values.Get("regex")
+	if grep != "" || pattern != "" {
+		params.Message = &logquery.MessageFilter{Substring: grep}
+		if pattern != "" {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("bad regex, %s", err)
+			}
+			params.Message.Pattern = compiled
+		}
+	}
+
+	for _, field := range values["field"] {
+		i := strings.Index(field, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("field must be name=value, got %q", field)
+		}
+		params.Fields = append(params.Fields, logquery.FieldFilter{Name: field[:i], Value: field[i+1:]})
+	}
+
+	if sample := values.Get("sample"); sample != "" {
+		rate, err := strconv.Atoi(sample)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("sample must be positive")
+		}
+		levels := []logquery.LogLevel{}
+		if names := values.Get("sample_levels"); names != "" {
+			for _, name := range strings.Split(names, ",") {
+				level, err := logquery.ParseLevel(name)
+				if err != nil {
+					return nil, fmt.Errorf("unknown sample_levels %q", name)
+				}
+				levels = append(levels, level)
+			}
+		}
+		logquery.WithSampleRate(rate, levels...)(params)
+	}
+
+	if q := values.Get("q"); q != "" {
+		if err := s.applyQueryString("q", q, values, params); err != nil {
+			return nil, err
+		}
+	}
+	if name := values.Get("saved"); name != "" {
+		if s.saved == nil {
+			return nil, fmt.Errorf("saved queries aren't enabled")
+		}
+		if _, ok := values["q"]; ok {
+			return nil, fmt.Errorf("saved can't be used with q")
+		}
+		q, err := s.saved.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.applyQueryString("saved", q.Query, values, params); err != nil {
+			return nil, err
+		}
+	}
+
+	params.Cursor = values.Get("cursor")
+	if groupBy := values.Get("group_by"); groupBy != "" {
+		params.GroupBy = strings.Split(groupBy, ",")
+	}
+
+	for name, value := range map[string]*bool{"desc": &params.Descending, "collapse": &params.CollapseRepeats} {
+		if param := values.Get(name); param != "" {
+			parsed, err := strconv.ParseBool(param)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be true or false", name)
+			}
+			*value = parsed
+		}
+	}
+	return params, nil
+}
+
+// knownKeys splits a comma separated list of keys and key patterns and checks each matches a known key,
+// nil if there are none
+func knownKeys(value string, known []string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	keys := strings.Split(value, ",")
+	for _, key := range keys {
+		found := false
+		for _, k := range known {
+			found = found || logquery.MatchKey(key, k)
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return keys, nil
+}
+
+// applyQueryString sets the filters of params from a querylang query given as param. It replaces the
+// filter parameters so they can't be used together
+func (s *Server) applyQueryString(param string, q string, values url.Values, params *logquery.QueryOptions) error {
+	for _, name := range []string{"keys", "exclude", "since", "start", "end", "min_level", "max_level", "grep", "regex", "field"} {
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("%s can't be used with %s", param, name)
+		}
+	}
+	compiled, err := querylang.Compile(q, s.now())
+	if err != nil {
+		return fmt.Errorf("bad %s, %s", param, err)
+	}
+	if compiled.Keys != nil {
+		known := map[string]bool{}
+		for _, key := range params.Keys {
+			known[key] = true
+		}
+		for _, key := range compiled.Keys {
+			if !known[key] {
+				return fmt.Errorf("unknown key %q", key)
+			}
+		}
+		params.Keys = compiled.Keys
+	}
+	params.Start, params.End = compiled.Start, compiled.End
+	params.MinSeverity, params.MaxSeverity = compiled.MinSeverity, compiled.MaxSeverity
+	params.Message = compiled.Message
+	params.Fields = compiled.Fields
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
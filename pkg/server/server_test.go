@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/screenshotjy/logquery/pkg/logquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) *Server {
+	logQuery, err := logquery.NewLogQuery(context.Background(), map[string]string{
+		"server1": "../../logs/server1.log",
+		"db":      "../../logs/db_server.log",
+	}, logquery.WithLabels("db", map[string]string{"env": "prod"}))
+	assert.NoError(t, err)
+	s := New(logQuery)
+	s.now = func() time.Time { return time.Date(2020, 2, 28, 5, 20, 57, 0, time.UTC) }
+	return s
+}
+
+func TestQuery(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?keys=server1,db&since=1s&min_level=warn&limit=2", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal("application/json", recorder.Header().Get("Content-Type"))
+
+	rv := QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(2, len(rv.Logs))
+	assert.Equal("db", rv.Logs[0].Key)
+	assert.Equal("warn", rv.Logs[0].Severity)
+	assert.Equal("server1", rv.Logs[1].Key)
+	assert.Equal("Database “my_db7” did not exist, creating...", rv.Logs[1].Message)
+	assert.Empty(rv.Error)
+	assert.NotEmpty(rv.NextCursor)
+
+	// The next page carries on after the first two logs
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?keys=server1,db&since=1s&min_level=warn&limit=2&cursor="+rv.NextCursor, nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	rv = QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(2, len(rv.Logs))
+	assert.Equal("db", rv.Logs[0].Key)
+	assert.Equal(time.Date(2020, 2, 28, 5, 20, 57, 250000000, time.UTC), rv.Logs[0].Time)
+
+	// Only warnings, the errors above them are left out
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?keys=server1,db&since=1s&min_level=warn&max_level=warn", nil))
+	rv = QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(3, len(rv.Logs))
+
+	// Context comes flagged so clients can tell it from the matches
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?keys=server1&min_level=fatal&context=1", nil))
+	rv = QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(2, len(rv.Logs))
+	assert.True(rv.Logs[0].Context)
+	assert.False(rv.Logs[1].Context)
+
+	// Stats count every match, not only the page
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?keys=server1,db&since=1s&min_level=warn&limit=2&stats=true", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	rv = QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(2, len(rv.Logs))
+	assert.NotNil(rv.Stats)
+	assert.True(rv.Stats.Truncated)
+	assert.Equal(rv.Stats.KeyCounts["server1"]+rv.Stats.KeyCounts["db"], rv.Stats.Matched)
+	assert.True(rv.Stats.Matched > 2)
+	assert.NotEmpty(rv.NextCursor)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?keys=server1,db&min_level=warn&limit=1&group_by=key", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	rv = QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(1, len(rv.Logs))
+	assert.Nil(rv.Stats)
+	assert.Equal(2, len(rv.Groups))
+	assert.Equal(rv.Groups[0].Count, len(rv.Groups[0].Messages))
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?group_by=host", nil))
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+
+	// Every key but the excluded one
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?keys=*&exclude=db&limit=1000", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	rv = QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.NotEmpty(rv.Logs)
+	for _, log := range rv.Logs {
+		assert.Equal("server1", log.Key)
+	}
+}
+
+func TestQueryString(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+
+	q := url.QueryEscape(`level>=warn AND key IN (server1,db) AND msg~"(?i)database" SINCE 1s`)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?limit=2&q="+q, nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+
+	rv := QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(2, len(rv.Logs))
+	assert.Equal("Rejecting request: No such database. ", rv.Logs[0].Message)
+	assert.Equal("Database “my_db7” did not exist, creating...", rv.Logs[1].Message)
+}
+
+func TestQuerySelector(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+
+	for selector, key := range map[string]string{"env%3Dprod": "db", "env!%3Dprod": "server1"} {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?selector="+selector, nil))
+		assert.Equal(http.StatusOK, recorder.Code)
+		rv := QueryResponse{}
+		assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+		assert.Equal(4, len(rv.Logs))
+		for _, log := range rv.Logs {
+			assert.Equal(key, log.Key)
+		}
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+	s.SetQueryLimits(logquery.QueryLimits{MaxMatches: 3})
+
+	for _, query := range []string{"/query", "/query?stats=true"} {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, query, nil))
+		assert.Equal(http.StatusOK, recorder.Code)
+		rv := QueryResponse{}
+		assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+		assert.True(rv.Limited, query)
+		assert.NotEmpty(rv.NextCursor, query)
+		assert.NotEmpty(rv.Logs, query)
+	}
+
+	// Queries under the limits aren't flagged
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?min_level=error", nil))
+	rv := QueryResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.False(rv.Limited)
+	assert.Equal(2, len(rv.Logs))
+}
+
+func TestRateLimits(t *testing.T) {
+	assert := assert.New(t)
+	for _, limits := range []logquery.QueryLimits{{MaxScanBytes: 200}, {Timeout: time.Nanosecond}} {
+		s := newTestServer(t)
+		s.SetQueryLimits(limits)
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rate?key=db&window=1s", nil))
+		assert.Equal(http.StatusOK, recorder.Code)
+		rv := RateResponse{}
+		assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+		assert.True(rv.Limited, limits)
+	}
+
+	// Without limits every log is counted
+	s := newTestServer(t)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rate?key=db&window=1s", nil))
+	rv := RateResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.False(rv.Limited)
+}
+
+func TestQueryBadParams(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+
+	for _, query := range []string{"keys=nope", "exclude=nope*", "stats=maybe", "since=abc", "limit=0", "min_level=loud", "max_level=loud", "context=-1", "after=101", "min_level=error&max_level=warn", "q=level%3C%3Dwarn&max_level=warn", "regex=(", "start=yesterday", "cursor=nope", "field=novalue", "per_key_limit=-1",
+		"q=level%3E%3Dloud", "q=key%3Dnope", "q=level%3E%3Dwarn&since=1h", "collapse=maybe", "sample=0", "sample=10&sample_levels=loud", "selector=env"} {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query?"+query, nil))
+		assert.Equal(http.StatusBadRequest, recorder.Code, query)
+	}
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/query", nil))
+	assert.Equal(http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestKeys(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/keys", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.JSONEq(`{"keys": ["db", "server1"]}`, recorder.Body.String())
+}
+
+func TestRate(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rate?key=db&window=2s&step=1s&min_level=warn", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	rv := RateResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &rv))
+	assert.Equal(2.0, rv.WindowSeconds)
+	assert.Equal([]RatePoint{
+		{Time: time.Date(2020, 2, 28, 5, 20, 57, 0, time.UTC), Count: 1, PerSecond: 0.5},
+		{Time: time.Date(2020, 2, 28, 5, 20, 58, 0, time.UTC), Count: 2, PerSecond: 1},
+	}, rv.Points)
+
+	for query, status := range map[string]int{
+		"/rate?window=1m":                          http.StatusBadRequest,
+		"/rate?key=nope&window=1m":                 http.StatusBadRequest,
+		"/rate?key=db":                             http.StatusBadRequest,
+		"/rate?key=db&window=1m&step=-1s":          http.StatusBadRequest,
+		"/rate?key=db&window=1m&step=1ms&since=1h": http.StatusBadRequest,
+		// Without a start the range runs from the first to the last log
+		"/rate?key=db&window=1ms&step=1us": http.StatusBadRequest,
+	} {
+		recorder = httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, query, nil))
+		assert.Equal(status, recorder.Code, query)
+	}
+}